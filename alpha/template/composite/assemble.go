@@ -0,0 +1,248 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+// AssembleOption configures AssembleCatalog.
+type AssembleOption func(*assembleOptions)
+
+type assembleOptions struct {
+	log        *logrus.Entry
+	report     *RenderReport
+	outputDir  string
+	outputType OutputType
+	validate   bool
+}
+
+// WithAssembleLogger sets the logger used to report the assembly.
+func WithAssembleLogger(log *logrus.Entry) AssembleOption {
+	return func(o *assembleOptions) {
+		o.log = log
+	}
+}
+
+// WithAssembleReport only assembles the destinations of the components of the
+// catalog that report rendered without errors, instead of everything under
+// the working directory, leaving out the stale output of components that
+// failed.
+func WithAssembleReport(report *RenderReport) AssembleOption {
+	return func(o *assembleOptions) {
+		o.report = report
+	}
+}
+
+// WithAssembleOutputDir writes the assembled catalog to dir in the
+// per-package layout, replacing its previous contents once the catalog is
+// fully written.
+func WithAssembleOutputDir(dir string) AssembleOption {
+	return func(o *assembleOptions) {
+		o.outputDir = dir
+	}
+}
+
+// WithAssembleOutputType sets the format the assembled catalog is written in,
+// which defaults to OutputTypeJSON.
+func WithAssembleOutputType(outputType OutputType) AssembleOption {
+	return func(o *assembleOptions) {
+		o.outputType = outputType
+	}
+}
+
+// WithAssembleValidation validates every package of the assembled catalog
+// with model validation before it is written or returned.
+func WithAssembleValidation(validate bool) AssembleOption {
+	return func(o *assembleOptions) {
+		o.validate = validate
+	}
+}
+
+// AssembleCatalog merges the FBC that components rendered for catalogName
+// into a single declarative config, as the last step after Render. The
+// component destinations are loaded in lexical order and identical
+// olm.package blobs written by more than one of them are only kept once. The
+// merged blobs are ordered by schema, package and name, so the result only
+// depends on the rendered FBC.
+func AssembleCatalog(ctx context.Context, catalogName string, workingDir string, opts ...AssembleOption) (*declcfg.DeclarativeConfig, error) {
+	o := &assembleOptions{outputType: OutputTypeJSON}
+	for _, opt := range opts {
+		opt(o)
+	}
+	log := o.log
+	if log == nil {
+		log = nullLogger()
+	}
+	log = log.WithField("catalog", catalogName)
+
+	dests, err := o.destinations(catalogName, workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &declcfg.DeclarativeConfig{}
+	for _, dest := range dests {
+		if _, err := os.Stat(dest); errors.Is(err, fs.ErrNotExist) {
+			log.Debugf("skipping missing destination %q", dest)
+			continue
+		}
+		log.Debugf("loading %q", dest)
+		dcfg, err := declcfg.LoadFS(ctx, os.DirFS(dest))
+		if err != nil {
+			return nil, fmt.Errorf("loading %q: %v", dest, err)
+		}
+		mergeDeclcfg(merged, dcfg)
+	}
+	sortDeclcfg(merged)
+
+	if o.validate {
+		log.Info("validating assembled catalog")
+		packages := packagesOf(merged)
+		names := make([]string, 0, len(packages))
+		for name := range packages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var errs []error
+		for _, name := range names {
+			if _, err := declcfg.ConvertToModel(*packages[name]); err != nil {
+				errs = append(errs, fmt.Errorf("package %q: %v", name, err))
+			}
+		}
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("catalog %q failed validation: %w", catalogName, utilerrors.NewAggregate(errs))
+		}
+	}
+
+	if o.outputDir != "" {
+		log.Infof("writing assembled catalog to %q", o.outputDir)
+		if err := writeAssembledCatalog(ctx, merged, o.outputDir, o.outputType, log); err != nil {
+			return nil, fmt.Errorf("writing catalog %q: %w", catalogName, err)
+		}
+	}
+	return merged, nil
+}
+
+// destinations returns the directories the catalog is assembled from, in
+// lexical order: the destinations of its components in the report, or
+// workingDir without a report. Destinations nested in another one are
+// dropped, as loading the other one includes them.
+func (o *assembleOptions) destinations(catalogName string, workingDir string) ([]string, error) {
+	if o.report == nil {
+		if o.outputDir != "" && isWithin(workingDir, o.outputDir) {
+			return nil, fmt.Errorf("the output directory %q can't be inside the working directory %q it is assembled from", o.outputDir, workingDir)
+		}
+		return []string{workingDir}, nil
+	}
+
+	var dests []string
+	for _, component := range o.report.Components {
+		if component.Catalog != catalogName || component.Err != nil || component.Disabled {
+			continue
+		}
+		if filepath.Base(component.Destination) == StdoutPath {
+			continue
+		}
+		dests = append(dests, filepath.Clean(component.Destination))
+	}
+	sort.Strings(dests)
+
+	var kept []string
+	for _, dest := range dests {
+		if len(kept) > 0 && isWithin(kept[len(kept)-1], dest) {
+			continue
+		}
+		kept = append(kept, dest)
+	}
+	return kept, nil
+}
+
+// mergeDeclcfg appends the blobs of src to dst, skipping olm.package blobs
+// that dst already has.
+func mergeDeclcfg(dst *declcfg.DeclarativeConfig, src *declcfg.DeclarativeConfig) {
+	for _, pkg := range src.Packages {
+		duplicate := false
+		for _, existing := range dst.Packages {
+			if reflect.DeepEqual(existing, pkg) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			dst.Packages = append(dst.Packages, pkg)
+		}
+	}
+	dst.Channels = append(dst.Channels, src.Channels...)
+	dst.Bundles = append(dst.Bundles, src.Bundles...)
+	dst.Others = append(dst.Others, src.Others...)
+}
+
+// sortDeclcfg orders the blobs of dcfg by schema, package and name, keeping
+// the order of blobs that compare equal.
+func sortDeclcfg(dcfg *declcfg.DeclarativeConfig) {
+	sort.SliceStable(dcfg.Packages, func(i, j int) bool {
+		return dcfg.Packages[i].Name < dcfg.Packages[j].Name
+	})
+	sort.SliceStable(dcfg.Channels, func(i, j int) bool {
+		a, b := dcfg.Channels[i], dcfg.Channels[j]
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.Name < b.Name
+	})
+	sort.SliceStable(dcfg.Bundles, func(i, j int) bool {
+		a, b := dcfg.Bundles[i], dcfg.Bundles[j]
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.Name < b.Name
+	})
+	sort.SliceStable(dcfg.Others, func(i, j int) bool {
+		a, b := dcfg.Others[i], dcfg.Others[j]
+		if a.Schema != b.Schema {
+			return a.Schema < b.Schema
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.Name < b.Name
+	})
+}
+
+// writeAssembledCatalog writes dcfg to a staging directory next to dir in the
+// per-package layout, which then replaces dir.
+func writeAssembledCatalog(ctx context.Context, dcfg *declcfg.DeclarativeConfig, dir string, outputType OutputType, log *logrus.Entry) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0o777); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+"-")
+	if err != nil {
+		return fmt.Errorf("creating staging directory: %v", err)
+	}
+	defer os.RemoveAll(staging)
+	if err := os.Chmod(staging, 0o755); err != nil {
+		return err
+	}
+
+	bc := BuilderConfig{
+		WorkingDir:   staging,
+		OutputType:   outputType,
+		Log:          log,
+		OutputLayout: OutputLayoutPerPackage,
+	}
+	if err := bc.writeOutput(ctx, dcfg, "", ""); err != nil {
+		return err
+	}
+	return commitStagingDir(staging, dir)
+}
@@ -3,14 +3,21 @@ package composite
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
 	"os"
 	"os/exec"
-	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/blang/semver/v4"
+	"github.com/sirupsen/logrus"
 	"sigs.k8s.io/yaml"
 
 	"github.com/operator-framework/operator-registry/alpha/declcfg"
@@ -27,21 +34,332 @@ const (
 	CustomBuilderSchema = "olm.builder.custom"
 )
 
+// OutputType is the format the rendered catalogs are written in.
+type OutputType string
+
+const (
+	OutputTypeJSON OutputType = "json"
+	OutputTypeYAML OutputType = "yaml"
+	// OutputTypeMermaid writes the FBC as JSON and, with the basic and
+	// semver builders, a mermaid graph of the channels of each package next
+	// to it.
+	OutputTypeMermaid OutputType = "mermaid"
+)
+
+// outputTypes are the supported output types of the rendered catalogs.
+var outputTypes = []OutputType{OutputTypeJSON, OutputTypeYAML, OutputTypeMermaid}
+
+// ParseOutputType returns the OutputType named by output. An empty output
+// defaults to OutputTypeJSON.
+func ParseOutputType(output string) (OutputType, error) {
+	if output == "" {
+		return OutputTypeJSON, nil
+	}
+	for _, o := range outputTypes {
+		if OutputType(output) == o {
+			return o, nil
+		}
+	}
+	return "", fmt.Errorf("invalid output type %q, expected one of %s", output, outputTypes)
+}
+
+// fbcType returns the type the FBC is written in for output type o.
+func (o OutputType) fbcType() OutputType {
+	if o == OutputTypeMermaid {
+		return OutputTypeJSON
+	}
+	return o
+}
+
+// unsupportedOutputType returns an error unless the builder for schema can
+// write output type o.
+func unsupportedOutputType(schema string, o OutputType) error {
+	if o == OutputTypeMermaid {
+		return fmt.Errorf("unsupported output type %q for this builder: the %s builder only writes json or yaml", o, schema)
+	}
+	return nil
+}
+
+// ValidationLevel is how thoroughly builders validate the catalogs they
+// render.
+type ValidationLevel string
+
+const (
+	// ValidationLevelModel converts the rendered FBC to the model used to
+	// serve catalogs and validates it, e.g. that channel entries are unique,
+	// that they only replace entries of the same channel and that every
+	// bundle is in a channel. It requires complete packages.
+	ValidationLevelModel ValidationLevel = "model"
+	// ValidationLevelLoad only checks that the rendered FBC loads, for
+	// destinations that are intentionally partial fragments of a package.
+	ValidationLevelLoad ValidationLevel = "load"
+)
+
+// validationLevels are the supported validation levels.
+var validationLevels = []ValidationLevel{ValidationLevelModel, ValidationLevelLoad}
+
+// ParseValidationLevel returns the ValidationLevel named by level. An empty
+// level defaults to ValidationLevelModel.
+func ParseValidationLevel(level string) (ValidationLevel, error) {
+	if level == "" {
+		return ValidationLevelModel, nil
+	}
+	for _, l := range validationLevels {
+		if ValidationLevel(level) == l {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("invalid validation level %q, expected one of %s", level, validationLevels)
+}
+
+// ComponentInfo describes the component a builder is building. The Template
+// passes it to builders through the context given to Build.
+type ComponentInfo struct {
+	// Component is the name of the component.
+	Component string
+	// Catalog is the name of the catalog the component is built into.
+	Catalog string
+	// Destination is the path of the component's destination, relative to
+	// the current directory. Builders must still write to the directory they
+	// are given, which differs when output is staged.
+	Destination string
+	// SkipPatch is the skip-patch override of the component's strategy, if
+	// any.
+	SkipPatch *bool
+}
+
+type componentInfoKey struct{}
+
+// ContextWithComponentInfo returns a copy of ctx carrying info.
+func ContextWithComponentInfo(ctx context.Context, info ComponentInfo) context.Context {
+	return context.WithValue(ctx, componentInfoKey{}, info)
+}
+
+// ComponentInfoFromContext returns the component info carried by ctx, if any.
+func ComponentInfoFromContext(ctx context.Context) (ComponentInfo, bool) {
+	info, ok := ctx.Value(componentInfoKey{}).(ComponentInfo)
+	return info, ok
+}
+
+// BuildRequest describes a component for a RequestBuilder to build.
+type BuildRequest struct {
+	// ComponentName is the name of the component.
+	ComponentName string
+	// CatalogName is the name of the catalog the component is built into.
+	CatalogName string
+	// Destination is the directory the component is written to, relative
+	// to the catalog working directory. It differs from the component's
+	// destination path when output is staged.
+	Destination string
+	// Template is the template definition of the component.
+	Template TemplateDefinition
+	// OutputType overrides the output type of the builder's BuilderConfig
+	// when set.
+	OutputType OutputType
+	// Logger reports the progress of the build, attributed to the
+	// component. When nil, the builder's BuilderConfig.Log is used.
+	Logger *logrus.Entry
+}
+
+// BuildResult describes what a RequestBuilder generated while building a
+// component, which the render report is assembled from.
+type BuildResult struct {
+	// Files are the files the builder wrote, relative to the request's
+	// destination, or nil if the builder doesn't know.
+	Files []string
+	// Channels are the channels of the rendered FBC.
+	Channels []ChannelSummary
+	// ChannelGraph is the mermaid graph of the channels.
+	ChannelGraph string
+	// PinnedImages maps the bundle images that were pinned to their
+	// digest-based references.
+	PinnedImages map[string]string
+	// MigrationLevel is the migration level the FBC was rendered at, if the
+	// builder applies one.
+	MigrationLevel MigrationLevel
+	// SkipPatch is whether the FBC was rendered skipping patch versions, if
+	// the builder supports it.
+	SkipPatch *bool
+}
+
 type BuilderConfig struct {
 	WorkingDir string
-	OutputType string
+	OutputType OutputType
+	// Log is used by builders to report progress. A nil Log discards all output.
+	Log *logrus.Entry
+	// HttpGetter is used to fetch template inputs referenced by URL. When nil,
+	// inputs are always read from the local filesystem.
+	HttpGetter HttpGetter
+	// OutputWriter receives the rendered FBC of streaming builders. When nil,
+	// it is written to stdout for components whose destination path is
+	// StdoutPath.
+	OutputWriter io.Writer
+	// Offline forbids fetching template inputs over the network.
+	Offline bool
+	// ValidationLevel is how thoroughly Validate checks the rendered
+	// catalog. An empty level selects ValidationLevelModel.
+	ValidationLevel ValidationLevel
+	// OutputLayout is how the rendered FBC is laid out in the destination.
+	// An empty layout selects OutputLayoutSingleFile.
+	OutputLayout OutputLayout
+	// MigrationLevel is the migration level the basic and semver builders
+	// render catalogs at. An empty level selects MigrationLevelLatest.
+	MigrationLevel MigrationLevel
+	// PinImages is whether the basic and semver builders pin bundle images
+	// when their template configuration doesn't set pinImages.
+	PinImages bool
+	// Sink receives the rendered FBC in place of WorkingDir when it is not
+	// nil, and is what Validate reads back. Builders that write files
+	// themselves rather than with writeOutput must write them to Sink.
+	Sink OutputSink
+
+	// renderWorkingDirs are the working directories of every catalog of the
+	// render, which custom commands are not blamed for writing to.
+	renderWorkingDirs []string
+}
+
+// pinImages returns whether bundle images are pinned, given the pinImages
+// setting of a template configuration.
+func (bc BuilderConfig) pinImages(configured *bool) bool {
+	if configured != nil {
+		return *configured
+	}
+	return bc.PinImages
+}
+
+func (bc BuilderConfig) logger() *logrus.Entry {
+	if bc.Log == nil {
+		return nullLogger()
+	}
+	return bc.Log
+}
+
+// openInput opens a template input, fetching it remotely when it is a URL and
+// an HttpGetter is configured.
+func (bc BuilderConfig) openInput(ctx context.Context, input string) (io.ReadCloser, error) {
+	if bc.HttpGetter == nil {
+		return os.Open(input)
+	}
+	return FetchContributionConfig(ctx, input, bc.HttpGetter, WithFetchLogger(bc.logger()), WithOfflineFetch(bc.Offline))
+}
+
+// fetchInput opens a template input that may be a local path, an http or
+// https URL fetched with the configured HttpGetter, or an oci:// reference
+// pulled with the registry set in opts.
+func (bc BuilderConfig) fetchInput(ctx context.Context, input string, opts ...FetchOption) (io.ReadCloser, error) {
+	getter := bc.HttpGetter
+	if getter == nil {
+		getter = missingHttpGetter{}
+	}
+	return fetchConfig(ctx, "template input", input, getter, append([]FetchOption{WithFetchLogger(bc.logger()), WithOfflineFetch(bc.Offline)}, opts...)...)
+}
+
+// missingHttpGetter fails every request, for builders configured without an
+// HttpGetter.
+type missingHttpGetter struct{}
+
+func (missingHttpGetter) Do(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("no HTTP getter configured to fetch %q", req.URL)
+}
+
+// outputWriter returns the writer streamed output is written to.
+func (bc BuilderConfig) outputWriter() io.Writer {
+	if bc.OutputWriter == nil {
+		return stdoutWriter
+	}
+	return bc.OutputWriter
+}
+
+// stdoutWriter serializes the streamed output of concurrently built components.
+var stdoutWriter io.Writer = &syncWriter{w: os.Stdout}
+
+// syncWriter serializes writes to w.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.w.Write(p)
 }
 
 type Builder interface {
 	Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error
 	Validate(ctx context.Context, dir string) error
+	// Schema returns the template schema the builder builds.
+	Schema() string
+	// ValidateConfig returns an error if td is not a valid template
+	// configuration for the builder. Render calls it for every component
+	// before building any of them, and Template.Lint only calls it, so it
+	// must be cheap: it may not run commands, fetch inputs or write files.
+	ValidateConfig(td TemplateDefinition) error
+}
+
+// ConfigBuilder is implemented by builders that can return the rendered FBC
+// of a component instead of writing it, which Template.RenderToConfig
+// requires.
+type ConfigBuilder interface {
+	Builder
+	// BuildConfig renders the template configured by td. Its output fields
+	// are ignored.
+	BuildConfig(ctx context.Context, reg image.Registry, td TemplateDefinition) (*declcfg.DeclarativeConfig, error)
+}
+
+// RequestBuilder is implemented by builders that build a component described
+// by a BuildRequest and return what they built, which Render prefers over
+// Build. Builders that only implement Build are still supported for one more
+// release, but can't have their output type or logger overridden and have
+// their report assembled from the files found in the destination.
+type RequestBuilder interface {
+	Builder
+	// BuildComponent builds the component described by req.
+	BuildComponent(ctx context.Context, reg image.Registry, req BuildRequest) (*BuildResult, error)
+}
+
+// buildComponent builds req with builder, calling Build when builder is not a
+// RequestBuilder.
+func buildComponent(ctx context.Context, reg image.Registry, builder Builder, req BuildRequest) (*BuildResult, error) {
+	if rb, ok := builder.(RequestBuilder); ok {
+		return rb.BuildComponent(ctx, reg, req)
+	}
+	return recordBuild(ctx, func(ctx context.Context) error {
+		return builder.Build(ctx, reg, req.Destination, req.Template)
+	})
+}
+
+// buildRequest builds req with the builder newBuilder returns for a copy of
+// bc that has the output type and logger of req.
+func buildRequest(ctx context.Context, reg image.Registry, bc BuilderConfig, req BuildRequest, newBuilder func(BuilderConfig) Builder) (*BuildResult, error) {
+	if req.OutputType != "" {
+		bc.OutputType = req.OutputType
+	}
+	if req.Logger != nil {
+		bc.Log = req.Logger
+	}
+	return recordBuild(ctx, func(ctx context.Context) error {
+		return newBuilder(bc).Build(ctx, reg, req.Destination, req.Template)
+	})
+}
+
+// StreamingBuilder is implemented by builders that can write the rendered
+// FBC of a component to BuilderConfig.OutputWriter instead of a directory.
+type StreamingBuilder interface {
+	Builder
+	// Streams reports whether a component with destination dir is written
+	// to the output writer.
+	Streams(dir string) bool
 }
 
 type BasicBuilder struct {
 	builderCfg BuilderConfig
 }
 
-var _ Builder = &BasicBuilder{}
+var (
+	_ ConfigBuilder  = &BasicBuilder{}
+	_ RequestBuilder = &BasicBuilder{}
+)
 
 func NewBasicBuilder(builderCfg BuilderConfig) *BasicBuilder {
 	return &BasicBuilder{
@@ -49,15 +367,47 @@ func NewBasicBuilder(builderCfg BuilderConfig) *BasicBuilder {
 	}
 }
 
+// BuildComponent builds the basic template of the component described by req.
+func (bb *BasicBuilder) BuildComponent(ctx context.Context, reg image.Registry, req BuildRequest) (*BuildResult, error) {
+	return buildRequest(ctx, reg, bb.builderCfg, req, func(bc BuilderConfig) Builder { return NewBasicBuilder(bc) })
+}
+
 func (bb *BasicBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	basicConfig, dcfg, err := bb.render(ctx, reg, td, bb.builderCfg.needsOutput() && !bb.Streams(dir))
+	if err != nil {
+		return err
+	}
+
+	if bb.Streams(dir) {
+		bb.builderCfg.logger().Debug("streaming rendered basic template")
+		return stream(dcfg, bb.builderCfg.outputWriter(), bb.builderCfg.OutputType)
+	}
+
+	bb.builderCfg.logger().Debugf("writing rendered basic template to %q", filepath.Join(bb.builderCfg.WorkingDir, dir))
+	if err := bb.builderCfg.writeOutput(ctx, dcfg, dir, basicConfig.Output); err != nil {
+		return err
+	}
+	return bb.builderCfg.writeGraphs(ctx, dcfg, dir, basicConfig.Output)
+}
+
+// ValidateConfig checks that td configures a valid basic template, without
+// requiring an output, which depends on the destination.
+func (bb *BasicBuilder) ValidateConfig(td TemplateDefinition) error {
+	_, err := parseBasicConfig(td, false)
+	return err
+}
+
+// parseBasicConfig parses the basic template configured by td. An output is
+// only required when needOutput is set.
+func parseBasicConfig(td TemplateDefinition, needOutput bool) (*BasicConfig, error) {
 	if td.Schema != BasicBuilderSchema {
-		return fmt.Errorf("schema %q does not match the basic template builder schema %q", td.Schema, BasicBuilderSchema)
+		return nil, fmt.Errorf("schema %q does not match the basic template builder schema %q", td.Schema, BasicBuilderSchema)
 	}
 	// Parse out the basic template configuration
 	basicConfig := &BasicConfig{}
 	err := yaml.UnmarshalStrict(td.Config, basicConfig)
 	if err != nil {
-		return fmt.Errorf("unmarshalling basic template config: %w", err)
+		return nil, fmt.Errorf("unmarshalling basic template config: %w", err)
 	}
 
 	// validate the basic config fields
@@ -68,41 +418,77 @@ func (bb *BasicBuilder) Build(ctx context.Context, reg image.Registry, dir strin
 		validationErrs = append(validationErrs, "basic template config must have a non-empty input (templateDefinition.config.input)")
 	}
 
-	if basicConfig.Output == "" {
+	if basicConfig.Output == "" && needOutput {
 		valid = false
 		validationErrs = append(validationErrs, "basic template config must have a non-empty output (templateDefinition.config.output)")
 	}
 
 	if !valid {
-		return fmt.Errorf("basic template configuration is invalid: %s", strings.Join(validationErrs, ","))
+		return nil, fmt.Errorf("basic template configuration is invalid: %s", strings.Join(validationErrs, ","))
+	}
+	return basicConfig, nil
+}
+
+// BuildConfig renders the basic template configured by td without writing
+// it.
+func (bb *BasicBuilder) BuildConfig(ctx context.Context, reg image.Registry, td TemplateDefinition) (*declcfg.DeclarativeConfig, error) {
+	_, dcfg, err := bb.render(ctx, reg, td, false)
+	return dcfg, err
+}
+
+// render parses td and renders the basic template it configures. An output
+// is only required when needOutput is set.
+func (bb *BasicBuilder) render(ctx context.Context, reg image.Registry, td TemplateDefinition, needOutput bool) (*BasicConfig, *declcfg.DeclarativeConfig, error) {
+	basicConfig, err := parseBasicConfig(td, needOutput)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	bb.builderCfg.logger().Debugf("rendering basic template %q", basicConfig.Input)
 	b := basictemplate.Template{Registry: reg}
-	reader, err := os.Open(basicConfig.Input)
+	reader, err := bb.builderCfg.openInput(ctx, basicConfig.Input)
 	if err != nil {
-		return fmt.Errorf("error reading basic template: %v", err)
+		return nil, nil, fmt.Errorf("error reading basic template: %v", err)
 	}
 	defer reader.Close()
 
 	dcfg, err := b.Render(ctx, reader)
 	if err != nil {
-		return fmt.Errorf("error rendering basic template: %v", err)
+		return nil, nil, fmt.Errorf("error rendering basic template: %v", err)
 	}
+	if bb.builderCfg.pinImages(basicConfig.PinImages) {
+		if _, err := pinImages(ctx, reg, dcfg); err != nil {
+			return nil, nil, fmt.Errorf("error pinning basic template images: %v", err)
+		}
+	}
+	if err := bb.builderCfg.migrate(ctx, dcfg); err != nil {
+		return nil, nil, fmt.Errorf("error migrating basic template: %v", err)
+	}
+	return basicConfig, dcfg, nil
+}
 
-	destPath := path.Join(bb.builderCfg.WorkingDir, dir, basicConfig.Output)
-
-	return build(dcfg, destPath, bb.builderCfg.OutputType)
+// Streams reports whether the basic template is streamed, which it is when an
+// output writer is configured or dir is StdoutPath.
+func (bb *BasicBuilder) Streams(dir string) bool {
+	return bb.builderCfg.OutputWriter != nil || dir == StdoutPath
 }
 
 func (bb *BasicBuilder) Validate(ctx context.Context, dir string) error {
 	return validate(ctx, bb.builderCfg, dir)
 }
 
+func (bb *BasicBuilder) Schema() string {
+	return BasicBuilderSchema
+}
+
 type SemverBuilder struct {
 	builderCfg BuilderConfig
 }
 
-var _ Builder = &SemverBuilder{}
+var (
+	_ ConfigBuilder  = &SemverBuilder{}
+	_ RequestBuilder = &SemverBuilder{}
+)
 
 func NewSemverBuilder(builderCfg BuilderConfig) *SemverBuilder {
 	return &SemverBuilder{
@@ -110,15 +496,42 @@ func NewSemverBuilder(builderCfg BuilderConfig) *SemverBuilder {
 	}
 }
 
+// BuildComponent builds the semver template of the component described by req.
+func (sb *SemverBuilder) BuildComponent(ctx context.Context, reg image.Registry, req BuildRequest) (*BuildResult, error) {
+	return buildRequest(ctx, reg, sb.builderCfg, req, func(bc BuilderConfig) Builder { return NewSemverBuilder(bc) })
+}
+
 func (sb *SemverBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	semverConfig, dcfg, err := sb.render(ctx, reg, td, sb.builderCfg.needsOutput())
+	if err != nil {
+		return err
+	}
+
+	sb.builderCfg.logger().Debugf("writing rendered semver template to %q", filepath.Join(sb.builderCfg.WorkingDir, dir))
+	if err := sb.builderCfg.writeOutput(ctx, dcfg, dir, semverConfig.Output); err != nil {
+		return err
+	}
+	return sb.builderCfg.writeGraphs(ctx, dcfg, dir, semverConfig.Output)
+}
+
+// ValidateConfig checks that td configures a valid semver template, without
+// requiring an output, which depends on the destination.
+func (sb *SemverBuilder) ValidateConfig(td TemplateDefinition) error {
+	_, _, err := parseSemverConfig(td, false)
+	return err
+}
+
+// parseSemverConfig parses the semver template configured by td and its
+// channel ranges. An output is only required when needOutput is set.
+func parseSemverConfig(td TemplateDefinition, needOutput bool) (*SemverConfig, map[string]semver.Range, error) {
 	if td.Schema != SemverBuilderSchema {
-		return fmt.Errorf("schema %q does not match the semver template builder schema %q", td.Schema, SemverBuilderSchema)
+		return nil, nil, fmt.Errorf("schema %q does not match the semver template builder schema %q", td.Schema, SemverBuilderSchema)
 	}
 	// Parse out the semver template configuration
 	semverConfig := &SemverConfig{}
 	err := yaml.UnmarshalStrict(td.Config, semverConfig)
 	if err != nil {
-		return fmt.Errorf("unmarshalling semver template config: %w", err)
+		return nil, nil, fmt.Errorf("unmarshalling semver template config: %w", err)
 	}
 
 	// validate the semver config fields
@@ -129,42 +542,109 @@ func (sb *SemverBuilder) Build(ctx context.Context, reg image.Registry, dir stri
 		validationErrs = append(validationErrs, "semver template config must have a non-empty input (templateDefinition.config.input)")
 	}
 
-	if semverConfig.Output == "" {
+	if semverConfig.Output == "" && needOutput {
 		valid = false
 		validationErrs = append(validationErrs, "semver template config must have a non-empty output (templateDefinition.config.output)")
 	}
 
+	ranges, rangeErrs := parseChannelRanges(semverConfig.ChannelRanges)
+	if len(rangeErrs) > 0 {
+		valid = false
+		validationErrs = append(validationErrs, rangeErrs...)
+	}
+
 	if !valid {
-		return fmt.Errorf("semver template configuration is invalid: %s", strings.Join(validationErrs, ","))
+		return nil, nil, fmt.Errorf("semver template configuration is invalid: %s", strings.Join(validationErrs, ","))
 	}
+	return semverConfig, ranges, nil
+}
 
-	reader, err := os.Open(semverConfig.Input)
+// BuildConfig renders the semver template configured by td without writing
+// it.
+func (sb *SemverBuilder) BuildConfig(ctx context.Context, reg image.Registry, td TemplateDefinition) (*declcfg.DeclarativeConfig, error) {
+	_, dcfg, err := sb.render(ctx, reg, td, false)
+	return dcfg, err
+}
+
+// render parses td and renders the semver template it configures. An output
+// is only required when needOutput is set.
+func (sb *SemverBuilder) render(ctx context.Context, reg image.Registry, td TemplateDefinition, needOutput bool) (*SemverConfig, *declcfg.DeclarativeConfig, error) {
+	semverConfig, ranges, err := parseSemverConfig(td, needOutput)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sb.builderCfg.logger().Debugf("rendering semver template %q", semverConfig.Input)
+	reader, err := sb.builderCfg.openInput(ctx, semverConfig.Input)
 	if err != nil {
-		return fmt.Errorf("error reading semver template: %v", err)
+		return nil, nil, fmt.Errorf("error reading semver template: %v", err)
 	}
 	defer reader.Close()
 
-	s := semvertemplate.Template{Registry: reg, Data: reader}
+	skipPatch := sb.skipPatch(ctx, semverConfig)
+	if record, ok := ctx.Value(buildRecordKey{}).(*buildRecord); ok {
+		record.skipPatch = &skipPatch
+	}
+	s := semvertemplate.Template{Registry: reg, Data: reader, AvoidSkipPatch: !skipPatch}
 
 	dcfg, err := s.Render(ctx)
 	if err != nil {
-		return fmt.Errorf("error rendering semver template: %v", err)
+		return nil, nil, fmt.Errorf("error rendering semver template: %v", err)
 	}
+	if sb.builderCfg.pinImages(semverConfig.PinImages) {
+		if _, err := pinImages(ctx, reg, dcfg); err != nil {
+			return nil, nil, fmt.Errorf("error pinning semver template images: %v", err)
+		}
+	}
+	excluded, err := filterChannelRanges(dcfg, ranges)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error applying semver template channel ranges: %v", err)
+	}
+	for _, image := range excluded {
+		sb.builderCfg.logger().Warnf("bundle %q is outside the range of every channel it was listed in, leaving it out of the catalog", image)
+	}
+	if err := sb.builderCfg.migrate(ctx, dcfg); err != nil {
+		return nil, nil, fmt.Errorf("error migrating semver template: %v", err)
+	}
+	if err := recordChannels(ctx, dcfg); err != nil {
+		sb.builderCfg.logger().WithError(err).Warn("channel graph is not available")
+	}
+	return semverConfig, dcfg, nil
+}
 
-	destPath := path.Join(sb.builderCfg.WorkingDir, dir, semverConfig.Output)
-
-	return build(dcfg, destPath, sb.builderCfg.OutputType)
+// skipPatch returns whether the semver template is rendered skipping patch
+// versions: the override of the component's strategy carried by ctx if any,
+// then the template config, then true.
+func (sb *SemverBuilder) skipPatch(ctx context.Context, semverConfig *SemverConfig) bool {
+	info, _ := ComponentInfoFromContext(ctx)
+	switch {
+	case info.SkipPatch != nil:
+		if semverConfig.SkipPatch != nil && *semverConfig.SkipPatch != *info.SkipPatch {
+			sb.builderCfg.logger().Infof("component %q sets skipPatch to %t, overriding %t from its semver template config", info.Component, *info.SkipPatch, *semverConfig.SkipPatch)
+		}
+		return *info.SkipPatch
+	case semverConfig.SkipPatch != nil:
+		return *semverConfig.SkipPatch
+	}
+	return true
 }
 
 func (sb *SemverBuilder) Validate(ctx context.Context, dir string) error {
 	return validate(ctx, sb.builderCfg, dir)
 }
 
+func (sb *SemverBuilder) Schema() string {
+	return SemverBuilderSchema
+}
+
 type RawBuilder struct {
 	builderCfg BuilderConfig
 }
 
-var _ Builder = &RawBuilder{}
+var (
+	_ ConfigBuilder  = &RawBuilder{}
+	_ RequestBuilder = &RawBuilder{}
+)
 
 func NewRawBuilder(builderCfg BuilderConfig) *RawBuilder {
 	return &RawBuilder{
@@ -172,59 +652,186 @@ func NewRawBuilder(builderCfg BuilderConfig) *RawBuilder {
 	}
 }
 
-func (rb *RawBuilder) Build(ctx context.Context, _ image.Registry, dir string, td TemplateDefinition) error {
+// BuildComponent builds the raw template of the component described by req.
+func (rb *RawBuilder) BuildComponent(ctx context.Context, reg image.Registry, req BuildRequest) (*BuildResult, error) {
+	return buildRequest(ctx, reg, rb.builderCfg, req, func(bc BuilderConfig) Builder { return NewRawBuilder(bc) })
+}
+
+func (rb *RawBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	if err := unsupportedOutputType(RawBuilderSchema, rb.builderCfg.OutputType); err != nil {
+		return err
+	}
+	rawConfig, dcfg, err := rb.render(ctx, reg, td, rb.builderCfg.needsOutput())
+	if err != nil {
+		return err
+	}
+
+	rb.builderCfg.logger().Debugf("writing raw input to %q", filepath.Join(rb.builderCfg.WorkingDir, dir))
+	return rb.builderCfg.writeOutput(ctx, dcfg, dir, rawConfig.Output)
+}
+
+// ValidateConfig checks that td configures a valid raw template, without
+// requiring an output, which depends on the destination.
+func (rb *RawBuilder) ValidateConfig(td TemplateDefinition) error {
+	_, err := parseRawConfig(td, false)
+	return err
+}
+
+// parseRawConfig parses the raw template configured by td. An output is only
+// required when needOutput is set.
+func parseRawConfig(td TemplateDefinition, needOutput bool) (*RawConfig, error) {
 	if td.Schema != RawBuilderSchema {
-		return fmt.Errorf("schema %q does not match the raw template builder schema %q", td.Schema, RawBuilderSchema)
+		return nil, fmt.Errorf("schema %q does not match the raw template builder schema %q", td.Schema, RawBuilderSchema)
 	}
 	// Parse out the raw template configuration
 	rawConfig := &RawConfig{}
 	err := yaml.UnmarshalStrict(td.Config, rawConfig)
 	if err != nil {
-		return fmt.Errorf("unmarshalling raw template config: %w", err)
+		return nil, fmt.Errorf("unmarshalling raw template config: %w", err)
 	}
 
 	// validate the raw config fields
 	valid := true
 	validationErrs := []string{}
-	if rawConfig.Input == "" {
+	if rawConfig.Input == "" && len(rawConfig.Inputs) == 0 {
 		valid = false
 		validationErrs = append(validationErrs, "raw template config must have a non-empty input (templateDefinition.config.input)")
 	}
+	for i, input := range rawConfig.Inputs {
+		if input.Input == "" {
+			valid = false
+			validationErrs = append(validationErrs, fmt.Sprintf("raw template config inputs must be non-empty (templateDefinition.config.inputs[%d].input)", i))
+		}
+	}
 
-	if rawConfig.Output == "" {
+	if rawConfig.Output == "" && needOutput {
 		valid = false
 		validationErrs = append(validationErrs, "raw template config must have a non-empty output (templateDefinition.config.output)")
 	}
 
 	if !valid {
-		return fmt.Errorf("raw template configuration is invalid: %s", strings.Join(validationErrs, ","))
+		return nil, fmt.Errorf("raw template configuration is invalid: %s", strings.Join(validationErrs, ","))
+	}
+	return rawConfig, nil
+}
+
+// BuildConfig renders the raw template configured by td without writing
+// it.
+func (rb *RawBuilder) BuildConfig(ctx context.Context, reg image.Registry, td TemplateDefinition) (*declcfg.DeclarativeConfig, error) {
+	_, dcfg, err := rb.render(ctx, reg, td, false)
+	return dcfg, err
+}
+
+// render parses td and renders the raw template it configures. An output
+// is only required when needOutput is set.
+func (rb *RawBuilder) render(ctx context.Context, reg image.Registry, td TemplateDefinition, needOutput bool) (*RawConfig, *declcfg.DeclarativeConfig, error) {
+	rawConfig, err := parseRawConfig(td, needOutput)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dcfg := &declcfg.DeclarativeConfig{}
+	for _, rawInput := range rawConfig.inputs() {
+		inputs := []string{rawInput.Input}
+		if !isRemoteInput(rawInput.Input) {
+			inputs, err = expandRawInput(rawInput.Input, rb.builderCfg.logger())
+			if err != nil {
+				return nil, nil, fmt.Errorf("error reading raw input file: %s, %v", rawInput.Input, err)
+			}
+		}
+		if rawInput.Digest != "" && (len(inputs) != 1 || inputs[0] != rawInput.Input) {
+			return nil, nil, fmt.Errorf("error reading raw input file: %s, a digest can only be pinned for a single file or remote input", rawInput.Input)
+		}
+		for _, input := range inputs {
+			cfg, err := rb.loadInput(ctx, reg, input, rawInput.Digest)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !rawConfig.SkipValidation && len(cfg.Others) > 0 {
+				unknown := []string{}
+				for _, m := range cfg.Others {
+					unknown = append(unknown, fmt.Sprintf("%q (package %q, name %q)", m.Schema, m.Package, m.Name))
+				}
+				return nil, nil, fmt.Errorf("error parsing raw input file: %s, objects have unknown schemas: %s", input, strings.Join(unknown, ", "))
+			}
+			dcfg.Packages = append(dcfg.Packages, cfg.Packages...)
+			dcfg.Channels = append(dcfg.Channels, cfg.Channels...)
+			dcfg.Bundles = append(dcfg.Bundles, cfg.Bundles...)
+			dcfg.Others = append(dcfg.Others, cfg.Others...)
+		}
+	}
+	return rawConfig, dcfg, nil
+}
+
+// inputs returns Input followed by Inputs.
+func (rc *RawConfig) inputs() []RawInput {
+	inputs := []RawInput{}
+	if rc.Input != "" {
+		inputs = append(inputs, RawInput{Input: rc.Input})
 	}
+	return append(inputs, rc.Inputs...)
+}
 
-	reader, err := os.Open(rawConfig.Input)
+// loadInput loads a single raw input file, verifying it against
+// expectedDigest when set.
+func (rb *RawBuilder) loadInput(ctx context.Context, reg image.Registry, input string, expectedDigest string) (*declcfg.DeclarativeConfig, error) {
+	rb.builderCfg.logger().Debugf("loading raw input file %q", input)
+	var reader io.ReadCloser
+	var err error
+	if isRemoteInput(input) || expectedDigest != "" {
+		reader, err = rb.builderCfg.fetchInput(ctx, input, WithFetchRegistry(reg), WithExpectedDigest(expectedDigest))
+	} else {
+		reader, err = rb.builderCfg.openInput(ctx, input)
+	}
 	if err != nil {
-		return fmt.Errorf("error reading raw input file: %s, %v", rawConfig.Input, err)
+		return nil, fmt.Errorf("error reading raw input file: %s, %v", input, err)
 	}
 	defer reader.Close()
 
 	dcfg, err := declcfg.LoadReader(reader)
 	if err != nil {
-		return fmt.Errorf("error parsing raw input file: %s, %v", rawConfig.Input, err)
+		return nil, fmt.Errorf("error parsing raw input file: %s, %v", input, err)
 	}
+	return dcfg, nil
+}
 
-	destPath := path.Join(rb.builderCfg.WorkingDir, dir, rawConfig.Output)
-
-	return build(dcfg, destPath, rb.builderCfg.OutputType)
+// isRemoteInput reports whether input is an http, https or oci:// reference.
+func isRemoteInput(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://") || strings.HasPrefix(input, ociScheme)
 }
 
 func (rb *RawBuilder) Validate(ctx context.Context, dir string) error {
 	return validate(ctx, rb.builderCfg, dir)
 }
 
+func (rb *RawBuilder) Schema() string {
+	return RawBuilderSchema
+}
+
+// Environment variables set for the command run by the custom builder. They
+// are a stable contract for custom commands. Variables describing the
+// component are only set when the builder is run by a Template.
+const (
+	// CustomEnvComponent is the name of the component being built.
+	CustomEnvComponent = "OPM_COMPOSITE_COMPONENT"
+	// CustomEnvCatalog is the name of the catalog the component is built into.
+	CustomEnvCatalog = "OPM_COMPOSITE_CATALOG"
+	// CustomEnvDestination is the path of the component's destination,
+	// relative to the current directory.
+	CustomEnvDestination = "OPM_COMPOSITE_DESTINATION"
+	// CustomEnvOutputType is the output type the command's output is written
+	// in, json or yaml.
+	CustomEnvOutputType = "OPM_COMPOSITE_OUTPUT_TYPE"
+)
+
 type CustomBuilder struct {
 	builderCfg BuilderConfig
 }
 
-var _ Builder = &CustomBuilder{}
+var (
+	_ ConfigBuilder  = &CustomBuilder{}
+	_ RequestBuilder = &CustomBuilder{}
+)
 
 func NewCustomBuilder(builderCfg BuilderConfig) *CustomBuilder {
 	return &CustomBuilder{
@@ -232,15 +839,46 @@ func NewCustomBuilder(builderCfg BuilderConfig) *CustomBuilder {
 	}
 }
 
+// BuildComponent builds the custom template of the component described by req.
+func (cb *CustomBuilder) BuildComponent(ctx context.Context, reg image.Registry, req BuildRequest) (*BuildResult, error) {
+	return buildRequest(ctx, reg, cb.builderCfg, req, func(bc BuilderConfig) Builder { return NewCustomBuilder(bc) })
+}
+
 func (cb *CustomBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	if err := unsupportedOutputType(CustomBuilderSchema, cb.builderCfg.OutputType); err != nil {
+		return err
+	}
+	customConfig, dcfg, err := cb.render(ctx, reg, td, cb.builderCfg.needsOutput())
+	if err != nil {
+		return err
+	}
+
+	cb.builderCfg.logger().Debugf("writing custom command output to %q", filepath.Join(cb.builderCfg.WorkingDir, dir))
+
+	// custom template should output a valid FBC to STDOUT so we can
+	// build the FBC just like all the other templates.
+	return cb.builderCfg.writeOutput(ctx, dcfg, dir, customConfig.Output)
+}
+
+// ValidateConfig checks that td configures a valid custom template, without
+// requiring an output, which depends on the destination. The command is not
+// run.
+func (cb *CustomBuilder) ValidateConfig(td TemplateDefinition) error {
+	_, _, err := parseCustomConfig(td, false)
+	return err
+}
+
+// parseCustomConfig parses the custom template configured by td and its
+// timeout. An output is only required when needOutput is set.
+func parseCustomConfig(td TemplateDefinition, needOutput bool) (*CustomConfig, time.Duration, error) {
 	if td.Schema != CustomBuilderSchema {
-		return fmt.Errorf("schema %q does not match the custom template builder schema %q", td.Schema, CustomBuilderSchema)
+		return nil, 0, fmt.Errorf("schema %q does not match the custom template builder schema %q", td.Schema, CustomBuilderSchema)
 	}
 	// Parse out the raw template configuration
 	customConfig := &CustomConfig{}
 	err := yaml.UnmarshalStrict(td.Config, customConfig)
 	if err != nil {
-		return fmt.Errorf("unmarshalling custom template config: %w", err)
+		return nil, 0, fmt.Errorf("unmarshalling custom template config: %w", err)
 	}
 
 	// validate the custom config fields
@@ -251,49 +889,266 @@ func (cb *CustomBuilder) Build(ctx context.Context, reg image.Registry, dir stri
 		validationErrs = append(validationErrs, "custom template config must have a non-empty command (templateDefinition.config.command)")
 	}
 
-	if customConfig.Output == "" {
+	if customConfig.Output == "" && needOutput {
 		valid = false
 		validationErrs = append(validationErrs, "custom template config must have a non-empty output (templateDefinition.config.output)")
 	}
 
+	var timeout time.Duration
+	if customConfig.Timeout != "" {
+		timeout, err = time.ParseDuration(customConfig.Timeout)
+		if err != nil || timeout <= 0 {
+			valid = false
+			validationErrs = append(validationErrs, fmt.Sprintf("custom template config must have a positive duration as timeout, got %q (templateDefinition.config.timeout)", customConfig.Timeout))
+		}
+	}
+
+	if customConfig.Env != nil {
+		for _, name := range customConfig.Env.Allow {
+			if !validEnvName(name) {
+				valid = false
+				validationErrs = append(validationErrs, fmt.Sprintf("custom template config has an invalid environment variable name %q (templateDefinition.config.env.allow)", name))
+			}
+		}
+		for name := range customConfig.Env.Set {
+			if !validEnvName(name) {
+				valid = false
+				validationErrs = append(validationErrs, fmt.Sprintf("custom template config has an invalid environment variable name %q (templateDefinition.config.env.set)", name))
+			}
+		}
+	}
+
+	if customConfig.WorkingDir != "" && !localPath(customConfig.WorkingDir) {
+		valid = false
+		validationErrs = append(validationErrs, fmt.Sprintf("custom template config must have a workingDir within the catalog working directory, got %q (templateDefinition.config.workingDir)", customConfig.WorkingDir))
+	}
+
 	if !valid {
-		return fmt.Errorf("custom template configuration is invalid: %s", strings.Join(validationErrs, ","))
+		return nil, 0, fmt.Errorf("custom template configuration is invalid: %s", strings.Join(validationErrs, ","))
+	}
+	return customConfig, timeout, nil
+}
+
+// BuildConfig renders the custom template configured by td without writing
+// it.
+func (cb *CustomBuilder) BuildConfig(ctx context.Context, reg image.Registry, td TemplateDefinition) (*declcfg.DeclarativeConfig, error) {
+	_, dcfg, err := cb.render(ctx, reg, td, false)
+	return dcfg, err
+}
+
+// render parses td and renders the custom template it configures. An output
+// is only required when needOutput is set.
+func (cb *CustomBuilder) render(ctx context.Context, reg image.Registry, td TemplateDefinition, needOutput bool) (*CustomConfig, *declcfg.DeclarativeConfig, error) {
+	customConfig, timeout, err := parseCustomConfig(td, needOutput)
+	if err != nil {
+		return nil, nil, err
 	}
+
+	runCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	// build the command to execute
 	cmd := exec.Command(customConfig.Command, customConfig.Args...)
+	cmd.Env = customEnv(ctx, customConfig.Env, cb.builderCfg.OutputType.fbcType())
+	if customConfig.StdinConfig {
+		cmd.Stdin = bytes.NewReader(td.Config)
+	}
+	if customConfig.WorkingDir != "" {
+		cmd.Dir = filepath.Join(cb.builderCfg.WorkingDir, customConfig.WorkingDir)
+		if err := os.MkdirAll(cmd.Dir, 0o777); err != nil {
+			return nil, nil, fmt.Errorf("creating custom command working directory %q: %v", cmd.Dir, err)
+		}
+	}
+	cb.builderCfg.logger().Debugf("running custom command %q", cmd.String())
+
+	var sandbox *sandboxSnapshot
+	if customConfig.WorkingDir != "" || customConfig.StrictSandbox {
+		// the other catalogs of the render may be written concurrently
+		sandbox, err = newSandboxSnapshot(".", append([]string{cb.builderCfg.WorkingDir}, cb.builderCfg.renderWorkingDirs...)...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("snapshotting files outside the catalog working directory: %v", err)
+		}
+	}
+
+	// keep the tail of stderr for the error message, streaming it to the
+	// logger as it is written when one is configured
+	stderr := &tailBuffer{max: maxStderrTail}
+	cmd.Stderr = stderr
+	if cb.builderCfg.Log != nil {
+		logWriter := &lineLogger{log: cb.builderCfg.Log.WithField("stream", "stderr")}
+		defer logWriter.Flush()
+		cmd.Stderr = io.MultiWriter(stderr, logWriter)
+	}
 
 	// custom template should output a valid FBC to STDOUT so we can
 	// build the FBC just like all the other templates.
-	v, err := cmd.Output()
+	stdout := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	start := time.Now()
+	err = runCommand(runCtx, cmd)
 	if err != nil {
-		return fmt.Errorf("running command %q: %v: %v", cmd.String(), err, v)
+		wd, wdErr := filepath.Abs(cmd.Dir)
+		if wdErr != nil {
+			wd = cmd.Dir
+		}
+		if ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s, killed after running for %s: %w", timeout, time.Since(start).Round(time.Millisecond), err)
+		}
+		if tail := strings.TrimSpace(stderr.String()); tail != "" {
+			return nil, nil, fmt.Errorf("running command %q in directory %q: %w, stderr:\n%s", cmd.String(), wd, err, tail)
+		}
+		return nil, nil, fmt.Errorf("running command %q in directory %q: %w", cmd.String(), wd, err)
+	}
+
+	if sandbox != nil {
+		written, err := sandbox.changes()
+		if err != nil {
+			return nil, nil, fmt.Errorf("checking for files written outside the catalog working directory: %v", err)
+		}
+		if len(written) > 0 {
+			if customConfig.StrictSandbox {
+				return nil, nil, fmt.Errorf("running command %q: wrote outside the catalog working directory %q: %s", cmd.String(), cb.builderCfg.WorkingDir, written)
+			}
+			cb.builderCfg.logger().Warnf("custom command %q wrote outside the catalog working directory %q: %s", cmd.String(), cb.builderCfg.WorkingDir, written)
+		}
 	}
 
-	reader := bytes.NewReader(v)
+	reader := bytes.NewReader(stdout.Bytes())
 
 	dcfg, err := declcfg.LoadReader(reader)
 	cmdString := []string{customConfig.Command}
 	cmdString = append(cmdString, customConfig.Args...)
 	if err != nil {
-		return fmt.Errorf("error parsing custom command output: %s, %v", strings.Join(cmdString, "'"), err)
+		return nil, nil, fmt.Errorf("error parsing custom command output: %s, %v", strings.Join(cmdString, "'"), err)
 	}
-
-	destPath := path.Join(cb.builderCfg.WorkingDir, dir, customConfig.Output)
-
-	// custom template should output a valid FBC to STDOUT so we can
-	// build the FBC just like all the other templates.
-	return build(dcfg, destPath, cb.builderCfg.OutputType)
+	return customConfig, dcfg, nil
 }
 
 func (cb *CustomBuilder) Validate(ctx context.Context, dir string) error {
 	return validate(ctx, cb.builderCfg, dir)
 }
 
-func writeDeclCfg(dcfg declcfg.DeclarativeConfig, w io.Writer, output string) error {
-	switch output {
-	case "yaml":
+func (cb *CustomBuilder) Schema() string {
+	return CustomBuilderSchema
+}
+
+// customEnv returns the environment of a custom builder's command.
+func customEnv(ctx context.Context, env *CustomEnv, outputType OutputType) []string {
+	var vars []string
+	if env == nil {
+		vars = os.Environ()
+	} else {
+		for _, name := range env.Allow {
+			if value, ok := os.LookupEnv(name); ok {
+				vars = append(vars, name+"="+value)
+			}
+		}
+		names := make([]string, 0, len(env.Set))
+		for name := range env.Set {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			vars = append(vars, name+"="+env.Set[name])
+		}
+	}
+
+	vars = append(vars, CustomEnvOutputType+"="+string(outputType))
+	if info, ok := ComponentInfoFromContext(ctx); ok {
+		vars = append(vars,
+			CustomEnvComponent+"="+info.Component,
+			CustomEnvCatalog+"="+info.Catalog,
+			CustomEnvDestination+"="+info.Destination,
+		)
+	}
+	return vars
+}
+
+func validEnvName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "=\x00")
+}
+
+// runCommand runs cmd, killing it and every process in its process group
+// when ctx is done.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(cmd)
+		case <-done:
+		}
+	}()
+	return cmd.Wait()
+}
+
+// maxStderrTail is the number of bytes at the end of a custom command's
+// stderr that are included in its error.
+const maxStderrTail = 4 << 10
+
+// tailBuffer is an io.Writer that keeps the last max bytes written to it.
+type tailBuffer struct {
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (tb *tailBuffer) Write(p []byte) (int, error) {
+	tb.buf = append(tb.buf, p...)
+	if over := len(tb.buf) - tb.max; over > 0 {
+		tb.buf = append(tb.buf[:0], tb.buf[over:]...)
+		tb.truncated = true
+	}
+	return len(p), nil
+}
+
+func (tb *tailBuffer) String() string {
+	if tb.truncated {
+		return "..." + string(tb.buf)
+	}
+	return string(tb.buf)
+}
+
+// lineLogger is an io.Writer that logs every line written to it.
+type lineLogger struct {
+	log     *logrus.Entry
+	partial []byte
+}
+
+func (ll *lineLogger) Write(p []byte) (int, error) {
+	ll.partial = append(ll.partial, p...)
+	for {
+		i := bytes.IndexByte(ll.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		ll.log.Info(string(ll.partial[:i]))
+		ll.partial = ll.partial[i+1:]
+	}
+}
+
+// Flush logs any incomplete last line.
+func (ll *lineLogger) Flush() {
+	if len(ll.partial) > 0 {
+		ll.log.Info(string(ll.partial))
+		ll.partial = nil
+	}
+}
+
+func writeDeclCfg(dcfg declcfg.DeclarativeConfig, w io.Writer, output OutputType) error {
+	switch output.fbcType() {
+	case OutputTypeYAML:
 		return declcfg.WriteYAML(dcfg, w)
-	case "json":
+	case OutputTypeJSON:
 		return declcfg.WriteJSON(dcfg, w)
 	default:
 		return fmt.Errorf("invalid --output value %q, expected (json|yaml)", output)
@@ -302,22 +1157,54 @@ func writeDeclCfg(dcfg declcfg.DeclarativeConfig, w io.Writer, output string) er
 
 func validate(ctx context.Context, builderCfg BuilderConfig, dir string) error {
 
-	path := path.Join(builderCfg.WorkingDir, dir)
-	s, err := os.Stat(path)
-	if err != nil {
-		return fmt.Errorf("directory not found. validation path needs to be composed of BuilderConfig.WorkingDir+Component[].Destination.Path: %q: %v", path, err)
-	}
-	if !s.IsDir() {
-		return fmt.Errorf("%q is not a directory", path)
+	path := filepath.Join(builderCfg.WorkingDir, dir)
+	builderCfg.logger().Debugf("validating %q", path)
+	root := os.DirFS(path)
+	if builderCfg.Sink != nil {
+		// read back what was written to the sink
+		var err error
+		if root, err = fs.Sub(builderCfg.Sink, sinkName(dir, ".")); err != nil {
+			return fmt.Errorf("validation failure in path %q: %v", path, err)
+		}
+		if _, err := fs.Stat(root, "."); err != nil {
+			return fmt.Errorf("nothing was written to %q in the output sink: %v", sinkName(dir, "."), err)
+		}
+	} else {
+		s, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("directory not found. validation path needs to be composed of BuilderConfig.WorkingDir+Component[].Destination.Path: %q: %v", path, err)
+		}
+		if !s.IsDir() {
+			return fmt.Errorf("%q is not a directory", path)
+		}
 	}
 
-	if err := config.Validate(ctx, os.DirFS(path)); err != nil {
+	if builderCfg.ValidationLevel == ValidationLevelLoad {
+		if _, err := declcfg.LoadFS(ctx, root); err != nil {
+			return fmt.Errorf("validation failure in path %q: %v", path, err)
+		}
+		return nil
+	}
+	if err := config.Validate(ctx, root); err != nil {
 		return fmt.Errorf("validation failure in path %q: %v", path, err)
 	}
 	return nil
 }
 
-func build(dcfg *declcfg.DeclarativeConfig, outPath string, outType string) error {
+// stream writes dcfg to w with a single write, so that the output of
+// components streamed concurrently to the same writer does not interleave.
+func stream(dcfg *declcfg.DeclarativeConfig, w io.Writer, outType OutputType) error {
+	buf := &bytes.Buffer{}
+	if err := writeDeclCfg(*dcfg, buf, outType); err != nil {
+		return fmt.Errorf("writing to output stream: %v", err)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("writing to output stream: %v", err)
+	}
+	return nil
+}
+
+func build(dcfg *declcfg.DeclarativeConfig, outPath string, outType OutputType) error {
 	// create the destination for output, if it does not exist
 	outDir := filepath.Dir(outPath)
 	err := os.MkdirAll(outDir, 0o777)
@@ -1,15 +1,26 @@
 package composite
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"github.com/operator-framework/operator-registry/pkg/image"
 	"github.com/operator-framework/operator-registry/pkg/image/containerdregistry"
 )
 
@@ -33,68 +44,6 @@ func TestBasicBuilder(t *testing.T) {
 	}`
 
 	testCases := []testCase{
-		{
-			name:     "successful basic build yaml output",
-			validate: true,
-			basicBuilder: NewBasicBuilder(BuilderConfig{
-				WorkingDir: testDir,
-				OutputType: "yaml",
-			}),
-			templateDefinition: TemplateDefinition{
-				Schema: BasicBuilderSchema,
-				Config: []byte(fmt.Sprintf(validConfigTemplate, path.Join(testDir, "components/basic.yaml"), "catalog.yaml")),
-			},
-			files: map[string]string{
-				"components/basic.yaml": basicYaml,
-			},
-			buildAssertions: func(t *testing.T, dir string, buildErr error) {
-				require.NoError(t, buildErr)
-				// check if the catalog.yaml file exists in the correct place
-				filePath := path.Join(dir, "catalog.yaml")
-				_, err := os.Stat(filePath)
-				require.NoError(t, err)
-				file, err := os.Open(filePath)
-				require.NoError(t, err)
-				defer file.Close()
-				fileData, err := io.ReadAll(file)
-				require.NoError(t, err)
-				require.Equal(t, string(fileData), basicBuiltFbcYaml)
-			},
-			validateAssertions: func(t *testing.T, validateErr error) {
-				require.NoError(t, validateErr)
-			},
-		},
-		{
-			name:     "successful basic build json output",
-			validate: true,
-			basicBuilder: NewBasicBuilder(BuilderConfig{
-				WorkingDir: testDir,
-				OutputType: "json",
-			}),
-			templateDefinition: TemplateDefinition{
-				Schema: BasicBuilderSchema,
-				Config: []byte(fmt.Sprintf(validConfigTemplate, path.Join(testDir, "components/basic.yaml"), "catalog.json")),
-			},
-			files: map[string]string{
-				"components/basic.yaml": basicYaml,
-			},
-			buildAssertions: func(t *testing.T, dir string, buildErr error) {
-				require.NoError(t, buildErr)
-				// check if the catalog.yaml file exists in the correct place
-				filePath := path.Join(dir, "catalog.json")
-				_, err := os.Stat(filePath)
-				require.NoError(t, err)
-				file, err := os.Open(filePath)
-				require.NoError(t, err)
-				defer file.Close()
-				fileData, err := io.ReadAll(file)
-				require.NoError(t, err)
-				require.Equal(t, string(fileData), basicBuiltFbcJson)
-			},
-			validateAssertions: func(t *testing.T, validateErr error) {
-				require.NoError(t, validateErr)
-			},
-		},
 		{
 			name:     "invalid template configuration",
 			validate: false,
@@ -353,128 +302,37 @@ relatedImages:
 schema: olm.bundle
 `
 
-const basicBuiltFbcJson = `{
-    "schema": "olm.package",
-    "name": "webhook-operator",
-    "defaultChannel": "preview"
-}
-{
-    "schema": "olm.channel",
-    "name": "preview",
-    "package": "webhook-operator",
-    "entries": [
-        {
-            "name": "webhook-operator.v0.0.1"
-        }
-    ]
-}
-{
-    "schema": "olm.bundle",
-    "name": "webhook-operator.v0.0.1",
-    "package": "webhook-operator",
-    "image": "quay.io/olmtest/webhook-operator-bundle:0.0.3",
-    "properties": [
-        {
-            "type": "olm.gvk",
-            "value": {
-                "group": "webhook.operators.coreos.io",
-                "kind": "WebhookTest",
-                "version": "v1"
-            }
-        },
-        {
-            "type": "olm.gvk",
-            "value": {
-                "group": "webhook.operators.coreos.io",
-                "kind": "WebhookTest",
-                "version": "v2"
-            }
-        },
-        {
-            "type": "olm.package",
-            "value": {
-                "packageName": "webhook-operator",
-                "version": "0.0.1"
-            }
-        },
-        {
-            "type": "olm.csv.metadata",
-            "value": {
-                "annotations": {
-                    "alm-examples": "[\n  {\n    \"apiVersion\": \"webhook.operators.coreos.io/v1\",\n    \"kind\": \"WebhookTest\",\n    \"metadata\": {\n      \"name\": \"webhooktest-sample\",\n      \"namespace\": \"webhook-operator-system\"\n    },\n    \"spec\": {\n      \"valid\": true\n    }\n  }\n]",
-                    "capabilities": "Basic Install",
-                    "operators.operatorframework.io/builder": "operator-sdk-v1.0.0",
-                    "operators.operatorframework.io/project_layout": "go"
-                },
-                "apiServiceDefinitions": {},
-                "crdDescriptions": {
-                    "owned": [
-                        {
-                            "name": "webhooktests.webhook.operators.coreos.io",
-                            "version": "v1",
-                            "kind": "WebhookTest"
-                        }
-                    ]
-                },
-                "description": "Webhook Operator description. TODO.",
-                "displayName": "Webhook Operator",
-                "installModes": [
-                    {
-                        "type": "OwnNamespace",
-                        "supported": false
-                    },
-                    {
-                        "type": "SingleNamespace",
-                        "supported": false
-                    },
-                    {
-                        "type": "MultiNamespace",
-                        "supported": false
-                    },
-                    {
-                        "type": "AllNamespaces",
-                        "supported": true
-                    }
-                ],
-                "keywords": [
-                    "webhook-operator"
-                ],
-                "links": [
-                    {
-                        "name": "Webhook Operator",
-                        "url": "https://webhook-operator.domain"
-                    }
-                ],
-                "maintainers": [
-                    {
-                        "name": "Maintainer Name",
-                        "email": "your@email.com"
-                    }
-                ],
-                "maturity": "alpha",
-                "provider": {
-                    "name": "Provider Name",
-                    "url": "https://your.domain"
-                }
-            }
-        }
-    ],
-    "relatedImages": [
-        {
-            "name": "",
-            "image": "gcr.io/kubebuilder/kube-rbac-proxy:v0.5.0"
-        },
-        {
-            "name": "",
-            "image": "quay.io/olmtest/webhook-operator-bundle:0.0.3"
-        },
-        {
-            "name": "",
-            "image": "quay.io/olmtest/webhook-operator:0.0.3"
-        }
-    ]
+func TestSemverBuilderSkipPatch(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name      string
+		config    *bool
+		override  *bool
+		skipPatch bool
+		logged    bool
+	}{
+		{name: "defaults to skipping patch versions", skipPatch: true},
+		{name: "template config applies", config: &no, skipPatch: false},
+		{name: "component override applies", override: &no, skipPatch: false},
+		{name: "matching settings are not logged", config: &yes, override: &yes, skipPatch: true},
+		{name: "component override wins over template config", config: &no, override: &yes, skipPatch: true, logged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			logger := logrus.New()
+			logger.SetOutput(out)
+			sb := NewSemverBuilder(BuilderConfig{Log: logrus.NewEntry(logger)})
+			ctx := ContextWithComponentInfo(context.Background(), ComponentInfo{Component: "my-operator", SkipPatch: tt.override})
+			require.Equal(t, tt.skipPatch, sb.skipPatch(ctx, &SemverConfig{SkipPatch: tt.config}))
+			if tt.logged {
+				require.Contains(t, out.String(), `component \"my-operator\" sets skipPatch to true, overriding false from its semver template config`)
+			} else {
+				require.Empty(t, out.String())
+			}
+		})
+	}
 }
-`
 
 func TestSemverBuilder(t *testing.T) {
 	type testCase struct {
@@ -494,68 +352,6 @@ func TestSemverBuilder(t *testing.T) {
 	}`
 
 	testCases := []testCase{
-		{
-			name:     "successful semver build yaml output",
-			validate: true,
-			semverBuilder: NewSemverBuilder(BuilderConfig{
-				WorkingDir: testDir,
-				OutputType: "yaml",
-			}),
-			templateDefinition: TemplateDefinition{
-				Schema: SemverBuilderSchema,
-				Config: []byte(fmt.Sprintf(validConfigTemplate, path.Join(testDir, "components/semver.yaml"), "catalog.yaml")),
-			},
-			files: map[string]string{
-				"components/semver.yaml": semverYaml,
-			},
-			buildAssertions: func(t *testing.T, dir string, buildErr error) {
-				require.NoError(t, buildErr)
-				// check if the catalog.yaml file exists in the correct place
-				filePath := path.Join(dir, "catalog.yaml")
-				_, err := os.Stat(filePath)
-				require.NoError(t, err)
-				file, err := os.Open(filePath)
-				require.NoError(t, err)
-				defer file.Close()
-				fileData, err := io.ReadAll(file)
-				require.NoError(t, err)
-				require.Equal(t, semverBuiltFbcYaml, string(fileData))
-			},
-			validateAssertions: func(t *testing.T, validateErr error) {
-				require.NoError(t, validateErr)
-			},
-		},
-		{
-			name:     "successful semver build json output",
-			validate: true,
-			semverBuilder: NewSemverBuilder(BuilderConfig{
-				WorkingDir: testDir,
-				OutputType: "json",
-			}),
-			templateDefinition: TemplateDefinition{
-				Schema: SemverBuilderSchema,
-				Config: []byte(fmt.Sprintf(validConfigTemplate, path.Join(testDir, "components/semver.yaml"), "catalog.json")),
-			},
-			files: map[string]string{
-				"components/semver.yaml": semverYaml,
-			},
-			buildAssertions: func(t *testing.T, dir string, buildErr error) {
-				require.NoError(t, buildErr)
-				// check if the catalog.yaml file exists in the correct place
-				filePath := path.Join(dir, "catalog.json")
-				_, err := os.Stat(filePath)
-				require.NoError(t, err)
-				file, err := os.Open(filePath)
-				require.NoError(t, err)
-				defer file.Close()
-				fileData, err := io.ReadAll(file)
-				require.NoError(t, err)
-				require.Equal(t, semverBuiltFbcJson, string(fileData))
-			},
-			validateAssertions: func(t *testing.T, validateErr error) {
-				require.NoError(t, validateErr)
-			},
-		},
 		{
 			name:     "invalid template configuration",
 			validate: false,
@@ -653,6 +449,29 @@ func TestSemverBuilder(t *testing.T) {
 					buildErr.Error())
 			},
 		},
+		{
+			name:     "template config has invalid channel ranges",
+			validate: false,
+			semverBuilder: NewSemverBuilder(BuilderConfig{
+				WorkingDir: testDir,
+				OutputType: "yaml",
+			}),
+			templateDefinition: TemplateDefinition{
+				Schema: SemverBuilderSchema,
+				Config: []byte(`{
+					"input": "components/semver.yaml",
+					"output": "catalog.yaml",
+					"channelRanges": {"stable": ">=one", "beta": ">=1.0.0"}
+				}`),
+			},
+			files: map[string]string{},
+			buildAssertions: func(t *testing.T, dir string, buildErr error) {
+				require.Error(t, buildErr)
+				require.Equal(t,
+					"semver template configuration is invalid: semver template config has a channel range for unknown channel archetype \"beta\", expected one of [candidate fast stable] (templateDefinition.config.channelRanges.beta),semver template config has an invalid stable channel range \">=one\": Could not get version from string: \">=one\" (templateDefinition.config.channelRanges.stable)",
+					buildErr.Error())
+			},
+		},
 		{
 			name:     "template config has empty input & output",
 			validate: false,
@@ -722,232 +541,108 @@ Stable:
   - Image: quay.io/olmtest/webhook-operator-bundle:0.0.3
 `
 
-const semverBuiltFbcYaml = `---
-defaultChannel: stable-v0.0
-name: webhook-operator
-schema: olm.package
----
-entries:
-- name: webhook-operator.v0.0.1
-name: stable-v0
-package: webhook-operator
-schema: olm.channel
----
-entries:
-- name: webhook-operator.v0.0.1
-name: stable-v0.0
-package: webhook-operator
-schema: olm.channel
----
-image: quay.io/olmtest/webhook-operator-bundle:0.0.3
-name: webhook-operator.v0.0.1
-package: webhook-operator
-properties:
-- type: olm.gvk
-  value:
-    group: webhook.operators.coreos.io
-    kind: WebhookTest
-    version: v1
-- type: olm.gvk
-  value:
-    group: webhook.operators.coreos.io
-    kind: WebhookTest
-    version: v2
-- type: olm.package
-  value:
-    packageName: webhook-operator
-    version: 0.0.1
-- type: olm.csv.metadata
-  value:
-    annotations:
-      alm-examples: |-
-        [
-          {
-            "apiVersion": "webhook.operators.coreos.io/v1",
-            "kind": "WebhookTest",
-            "metadata": {
-              "name": "webhooktest-sample",
-              "namespace": "webhook-operator-system"
-            },
-            "spec": {
-              "valid": true
-            }
-          }
-        ]
-      capabilities: Basic Install
-      operators.operatorframework.io/builder: operator-sdk-v1.0.0
-      operators.operatorframework.io/project_layout: go
-    apiServiceDefinitions: {}
-    crdDescriptions:
-      owned:
-      - kind: WebhookTest
-        name: webhooktests.webhook.operators.coreos.io
-        version: v1
-    description: Webhook Operator description. TODO.
-    displayName: Webhook Operator
-    installModes:
-    - supported: false
-      type: OwnNamespace
-    - supported: false
-      type: SingleNamespace
-    - supported: false
-      type: MultiNamespace
-    - supported: true
-      type: AllNamespaces
-    keywords:
-    - webhook-operator
-    links:
-    - name: Webhook Operator
-      url: https://webhook-operator.domain
-    maintainers:
-    - email: your@email.com
-      name: Maintainer Name
-    maturity: alpha
-    provider:
-      name: Provider Name
-      url: https://your.domain
-relatedImages:
-- image: gcr.io/kubebuilder/kube-rbac-proxy:v0.5.0
-  name: ""
-- image: quay.io/olmtest/webhook-operator-bundle:0.0.3
-  name: ""
-- image: quay.io/olmtest/webhook-operator:0.0.3
-  name: ""
-schema: olm.bundle
-`
+func TestSemverChannelRanges(t *testing.T) {
+	bundle := func(version string) declcfg.Bundle {
+		return declcfg.Bundle{
+			Schema:     declcfg.SchemaBundle,
+			Name:       "my-operator.v" + version,
+			Package:    "my-operator",
+			Image:      "registry.example.com/my-operator-bundle:v" + version,
+			Properties: []property.Property{property.MustBuildPackage("my-operator", version)},
+		}
+	}
+	newConfig := func() *declcfg.DeclarativeConfig {
+		return &declcfg.DeclarativeConfig{
+			Packages: []declcfg.Package{{Schema: declcfg.SchemaPackage, Name: "my-operator", DefaultChannel: "candidate-v1"}},
+			Channels: []declcfg.Channel{
+				{Schema: declcfg.SchemaChannel, Package: "my-operator", Name: "candidate-v1", Entries: []declcfg.ChannelEntry{
+					{Name: "my-operator.v0.9.0"},
+					{Name: "my-operator.v1.0.0", Replaces: "my-operator.v0.9.0"},
+					{Name: "my-operator.v1.1.0", Replaces: "my-operator.v1.0.0"},
+				}},
+				{Schema: declcfg.SchemaChannel, Package: "my-operator", Name: "stable-v1", Entries: []declcfg.ChannelEntry{
+					{Name: "my-operator.v0.8.0"},
+					{Name: "my-operator.v0.9.0", Replaces: "my-operator.v0.8.0"},
+					{Name: "my-operator.v1.1.0", Replaces: "my-operator.v0.9.0", Skips: []string{"my-operator.v0.8.0"}},
+				}},
+			},
+			Bundles: []declcfg.Bundle{bundle("0.8.0"), bundle("0.9.0"), bundle("1.0.0"), bundle("1.1.0")},
+		}
+	}
 
-const semverBuiltFbcJson = `{
-    "schema": "olm.package",
-    "name": "webhook-operator",
-    "defaultChannel": "stable-v0.0"
+	ranges, validationErrs := parseChannelRanges(map[string]string{"stable": ">=1.0.0"})
+	require.Empty(t, validationErrs)
+
+	t.Run("bundles outside the range are dropped from the archetype's channels", func(t *testing.T) {
+		dcfg := newConfig()
+		excluded, err := filterChannelRanges(dcfg, ranges)
+		require.NoError(t, err)
+		require.Equal(t, []string{"registry.example.com/my-operator-bundle:v0.8.0"}, excluded)
+		require.Len(t, dcfg.Channels[0].Entries, 3)
+		require.Equal(t, []declcfg.ChannelEntry{{Name: "my-operator.v1.1.0"}}, dcfg.Channels[1].Entries)
+		require.Len(t, dcfg.Bundles, 3)
+	})
+
+	t.Run("the default channel can't be emptied", func(t *testing.T) {
+		dcfg := newConfig()
+		dcfg.Packages[0].DefaultChannel = "stable-v1"
+		ranges, _ := parseChannelRanges(map[string]string{"stable": ">=2.0.0"})
+		_, err := filterChannelRanges(dcfg, ranges)
+		require.EqualError(t, err, "default channel \"stable-v1\" of package \"my-operator\" has no bundles in the stable channel range")
+	})
 }
-{
-    "schema": "olm.channel",
-    "name": "stable-v0",
-    "package": "webhook-operator",
-    "entries": [
-        {
-            "name": "webhook-operator.v0.0.1"
-        }
-    ]
+
+// digestRegistry resolves image references to fixed digests.
+type digestRegistry struct {
+	image.MockRegistry
+	digests map[string]digest.Digest
 }
-{
-    "schema": "olm.channel",
-    "name": "stable-v0.0",
-    "package": "webhook-operator",
-    "entries": [
-        {
-            "name": "webhook-operator.v0.0.1"
-        }
-    ]
+
+func (r *digestRegistry) ResolveDigest(ctx context.Context, ref image.Reference) (digest.Digest, error) {
+	d, ok := r.digests[ref.String()]
+	if !ok {
+		return "", fmt.Errorf("manifest unknown")
+	}
+	return d, nil
 }
-{
-    "schema": "olm.bundle",
-    "name": "webhook-operator.v0.0.1",
-    "package": "webhook-operator",
-    "image": "quay.io/olmtest/webhook-operator-bundle:0.0.3",
-    "properties": [
-        {
-            "type": "olm.gvk",
-            "value": {
-                "group": "webhook.operators.coreos.io",
-                "kind": "WebhookTest",
-                "version": "v1"
-            }
-        },
-        {
-            "type": "olm.gvk",
-            "value": {
-                "group": "webhook.operators.coreos.io",
-                "kind": "WebhookTest",
-                "version": "v2"
-            }
-        },
-        {
-            "type": "olm.package",
-            "value": {
-                "packageName": "webhook-operator",
-                "version": "0.0.1"
-            }
-        },
-        {
-            "type": "olm.csv.metadata",
-            "value": {
-                "annotations": {
-                    "alm-examples": "[\n  {\n    \"apiVersion\": \"webhook.operators.coreos.io/v1\",\n    \"kind\": \"WebhookTest\",\n    \"metadata\": {\n      \"name\": \"webhooktest-sample\",\n      \"namespace\": \"webhook-operator-system\"\n    },\n    \"spec\": {\n      \"valid\": true\n    }\n  }\n]",
-                    "capabilities": "Basic Install",
-                    "operators.operatorframework.io/builder": "operator-sdk-v1.0.0",
-                    "operators.operatorframework.io/project_layout": "go"
-                },
-                "apiServiceDefinitions": {},
-                "crdDescriptions": {
-                    "owned": [
-                        {
-                            "name": "webhooktests.webhook.operators.coreos.io",
-                            "version": "v1",
-                            "kind": "WebhookTest"
-                        }
-                    ]
-                },
-                "description": "Webhook Operator description. TODO.",
-                "displayName": "Webhook Operator",
-                "installModes": [
-                    {
-                        "type": "OwnNamespace",
-                        "supported": false
-                    },
-                    {
-                        "type": "SingleNamespace",
-                        "supported": false
-                    },
-                    {
-                        "type": "MultiNamespace",
-                        "supported": false
-                    },
-                    {
-                        "type": "AllNamespaces",
-                        "supported": true
-                    }
-                ],
-                "keywords": [
-                    "webhook-operator"
-                ],
-                "links": [
-                    {
-                        "name": "Webhook Operator",
-                        "url": "https://webhook-operator.domain"
-                    }
-                ],
-                "maintainers": [
-                    {
-                        "name": "Maintainer Name",
-                        "email": "your@email.com"
-                    }
-                ],
-                "maturity": "alpha",
-                "provider": {
-                    "name": "Provider Name",
-                    "url": "https://your.domain"
-                }
-            }
-        }
-    ],
-    "relatedImages": [
-        {
-            "name": "",
-            "image": "gcr.io/kubebuilder/kube-rbac-proxy:v0.5.0"
-        },
-        {
-            "name": "",
-            "image": "quay.io/olmtest/webhook-operator-bundle:0.0.3"
-        },
-        {
-            "name": "",
-            "image": "quay.io/olmtest/webhook-operator:0.0.3"
-        }
-    ]
+
+func TestPinImages(t *testing.T) {
+	tagged := "registry.example.com:5000/my-operator-bundle:v1.0.0"
+	pinnedRef := "registry.example.com/my-operator-bundle@" + digest.FromString("v0.9.0").String()
+	reg := &digestRegistry{digests: map[string]digest.Digest{tagged: digest.FromString("v1.0.0")}}
+	newConfig := func(images ...string) *declcfg.DeclarativeConfig {
+		dcfg := &declcfg.DeclarativeConfig{}
+		for _, img := range images {
+			dcfg.Bundles = append(dcfg.Bundles, declcfg.Bundle{
+				Image:         img,
+				RelatedImages: []declcfg.RelatedImage{{Image: img}, {Name: "operator", Image: "registry.example.com/my-operator:v1.0.0"}},
+			})
+		}
+		return dcfg
+	}
+	ctx := ContextWithComponentInfo(context.Background(), ComponentInfo{Component: "my-operator"})
+
+	t.Run("tagged bundle images are pinned", func(t *testing.T) {
+		dcfg := newConfig(tagged, pinnedRef)
+		record := &buildRecord{}
+		pinned, err := pinImages(contextWithBuildRecord(ctx, record), reg, dcfg)
+		require.NoError(t, err)
+		expected := "registry.example.com:5000/my-operator-bundle@" + digest.FromString("v1.0.0").String()
+		require.Equal(t, map[string]string{tagged: expected}, pinned)
+		require.Equal(t, pinned, record.pinnedImages)
+		require.Equal(t, expected, dcfg.Bundles[0].Image)
+		require.Equal(t, []declcfg.RelatedImage{{Image: expected}, {Name: "operator", Image: "registry.example.com/my-operator:v1.0.0"}}, dcfg.Bundles[0].RelatedImages)
+		require.Equal(t, pinnedRef, dcfg.Bundles[1].Image)
+	})
+
+	t.Run("resolution failures name the image and component", func(t *testing.T) {
+		_, err := pinImages(ctx, reg, newConfig("registry.example.com/other-bundle:latest"))
+		require.EqualError(t, err, "resolving digest of image \"registry.example.com/other-bundle:latest\" for component \"my-operator\": manifest unknown")
+
+		_, err = pinImages(ctx, &image.MockRegistry{}, newConfig(tagged))
+		require.EqualError(t, err, fmt.Sprintf("resolving digest of image %q for component \"my-operator\": the registry can't resolve image digests", tagged))
+	})
 }
-`
 
 func TestRawBuilder(t *testing.T) {
 	type testCase struct {
@@ -968,65 +663,19 @@ func TestRawBuilder(t *testing.T) {
 
 	testCases := []testCase{
 		{
-			name:     "successful raw build yaml output",
-			validate: true,
+			name:     "glob input matching no files",
+			validate: false,
 			rawBuilder: NewRawBuilder(BuilderConfig{
 				WorkingDir: testDir,
 				OutputType: "yaml",
 			}),
 			templateDefinition: TemplateDefinition{
 				Schema: RawBuilderSchema,
-				Config: []byte(fmt.Sprintf(validConfigTemplate, path.Join(testDir, "components/raw.yaml"), "catalog.yaml")),
-			},
-			files: map[string]string{
-				"components/raw.yaml": rawYaml,
-			},
-			buildAssertions: func(t *testing.T, dir string, buildErr error) {
-				require.NoError(t, buildErr)
-				// check if the catalog.yaml file exists in the correct place
-				filePath := path.Join(dir, "catalog.yaml")
-				_, err := os.Stat(filePath)
-				require.NoError(t, err)
-				file, err := os.Open(filePath)
-				require.NoError(t, err)
-				defer file.Close()
-				fileData, err := io.ReadAll(file)
-				require.NoError(t, err)
-				require.Equal(t, string(fileData), rawBuiltFbcYaml)
-			},
-			validateAssertions: func(t *testing.T, validateErr error) {
-				require.NoError(t, validateErr)
-			},
-		},
-		{
-			name:     "successful raw build json output",
-			validate: true,
-			rawBuilder: NewRawBuilder(BuilderConfig{
-				WorkingDir: testDir,
-				OutputType: "json",
-			}),
-			templateDefinition: TemplateDefinition{
-				Schema: RawBuilderSchema,
-				Config: []byte(fmt.Sprintf(validConfigTemplate, path.Join(testDir, "components/raw.yaml"), "catalog.json")),
-			},
-			files: map[string]string{
-				"components/raw.yaml": rawYaml,
+				Config: []byte(fmt.Sprintf(validConfigTemplate, path.Join(testDir, "components/missing/*.yaml"), "catalog.yaml")),
 			},
 			buildAssertions: func(t *testing.T, dir string, buildErr error) {
-				require.NoError(t, buildErr)
-				// check if the catalog.yaml file exists in the correct place
-				filePath := path.Join(dir, "catalog.json")
-				_, err := os.Stat(filePath)
-				require.NoError(t, err)
-				file, err := os.Open(filePath)
-				require.NoError(t, err)
-				defer file.Close()
-				fileData, err := io.ReadAll(file)
-				require.NoError(t, err)
-				require.Equal(t, string(fileData), rawBuiltFbcJson)
-			},
-			validateAssertions: func(t *testing.T, validateErr error) {
-				require.NoError(t, validateErr)
+				input := path.Join(testDir, "components/missing/*.yaml")
+				require.EqualError(t, buildErr, fmt.Sprintf("error reading raw input file: %s, raw input pattern %q did not match any YAML or JSON files", input, input))
 			},
 		},
 		{
@@ -1060,7 +709,7 @@ func TestRawBuilder(t *testing.T) {
 				Config: []byte(fmt.Sprintf(validConfigTemplate, path.Join(testDir, "components/raw.yaml"), "catalog.yaml")),
 			},
 			files: map[string]string{
-				"components/raw.yaml": semverYaml,
+				"components/raw.yaml": rawYaml,
 			},
 			buildAssertions: func(t *testing.T, dir string, buildErr error) {
 				require.Error(t, buildErr)
@@ -1144,6 +793,45 @@ func TestRawBuilder(t *testing.T) {
 					"raw template configuration is invalid: raw template config must have a non-empty input (templateDefinition.config.input),raw template config must have a non-empty output (templateDefinition.config.output)")
 			},
 		},
+		{
+			name:     "input with unknown schemas",
+			validate: false,
+			rawBuilder: NewRawBuilder(BuilderConfig{
+				WorkingDir: testDir,
+				OutputType: "yaml",
+			}),
+			templateDefinition: TemplateDefinition{
+				Schema: RawBuilderSchema,
+				Config: []byte(fmt.Sprintf(validConfigTemplate, path.Join(testDir, "components/unknown.yaml"), "catalog.yaml")),
+			},
+			files: map[string]string{
+				"components/unknown.yaml": rawYaml + unknownSchemaYaml,
+			},
+			buildAssertions: func(t *testing.T, dir string, buildErr error) {
+				require.EqualError(t, buildErr, fmt.Sprintf("error parsing raw input file: %s, objects have unknown schemas: \"olm.unknown\" (package \"webhook-operator\", name \"mystery\")", path.Join(testDir, "components/unknown.yaml")))
+			},
+		},
+		{
+			name:     "input with unknown schemas and validation skipped",
+			validate: false,
+			rawBuilder: NewRawBuilder(BuilderConfig{
+				WorkingDir: testDir,
+				OutputType: "yaml",
+			}),
+			templateDefinition: TemplateDefinition{
+				Schema: RawBuilderSchema,
+				Config: []byte(fmt.Sprintf(`{"input": %q, "output": "catalog.yaml", "skipValidation": true}`, path.Join(testDir, "components/unknown.yaml"))),
+			},
+			files: map[string]string{
+				"components/unknown.yaml": rawYaml + unknownSchemaYaml,
+			},
+			buildAssertions: func(t *testing.T, dir string, buildErr error) {
+				require.NoError(t, buildErr)
+				fileData, err := os.ReadFile(path.Join(dir, "catalog.yaml"))
+				require.NoError(t, err)
+				require.Contains(t, string(fileData), "schema: olm.unknown")
+			},
+		},
 	}
 
 	for i, tc := range testCases {
@@ -1279,91 +967,244 @@ relatedImages:
 schema: olm.bundle
 `
 
-const rawBuiltFbcJson = `{
-    "schema": "olm.package",
-    "name": "webhook-operator-412",
-    "defaultChannel": "preview"
+func TestRawBuilderRemoteInputs(t *testing.T) {
+	split := strings.Index(rawYaml, "---\nimage:")
+	packageYaml, bundleYaml := rawYaml[:split], rawYaml[split:]
+	reg := &image.MockRegistry{
+		RemoteImages: map[image.Reference]*image.MockImage{
+			image.SimpleReference("registry.example.com/fbc/bundle:v1"): {
+				FS: fstest.MapFS{"bundle.yaml": &fstest.MapFile{Data: []byte(bundleYaml)}},
+			},
+		},
+	}
+
+	build := func(getter HttpGetter, inputs string) (string, error) {
+		workingDir := t.TempDir()
+		err := NewRawBuilder(BuilderConfig{
+			WorkingDir: workingDir,
+			OutputType: "yaml",
+			HttpGetter: getter,
+		}).Build(context.Background(), reg, "my-operator", TemplateDefinition{
+			Schema: RawBuilderSchema,
+			Config: []byte(fmt.Sprintf(`{"inputs": %s, "output": "catalog.yaml"}`, inputs)),
+		})
+		if err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(filepath.Join(workingDir, "my-operator", "catalog.yaml"))
+		return string(data), err
+	}
+
+	t.Run("http and oci inputs are combined", func(t *testing.T) {
+		out, err := build(&fakeGetter{catalog: packageYaml}, fmt.Sprintf(`[{"input": "https://example.com/package.yaml", "digest": %q}, {"input": "oci://registry.example.com/fbc/bundle:v1"}]`, digest.FromString(packageYaml)))
+		require.NoError(t, err)
+		require.Equal(t, rawBuiltFbcYaml, out)
+	})
+
+	t.Run("digest mismatch names the input", func(t *testing.T) {
+		other := digest.FromString("other")
+		_, err := build(&fakeGetter{catalog: packageYaml}, fmt.Sprintf(`[{"input": "https://example.com/package.yaml", "digest": %q}]`, other))
+		require.EqualError(t, err, fmt.Sprintf("error reading raw input file: https://example.com/package.yaml, template input config file %q does not match the expected digest: expected %s, got %s", "https://example.com/package.yaml", other, digest.FromString(packageYaml)))
+	})
+
+	t.Run("fetch failure names the input", func(t *testing.T) {
+		_, err := build(nil, `[{"input": "oci://registry.example.com/fbc/missing:v1"}]`)
+		require.ErrorContains(t, err, "error reading raw input file: oci://registry.example.com/fbc/missing:v1, pulling template input config artifact \"registry.example.com/fbc/missing:v1\"")
+
+		_, err = build(nil, `[{"input": "https://example.com/package.yaml"}]`)
+		require.EqualError(t, err, "error reading raw input file: https://example.com/package.yaml, fetching remote template input config file \"https://example.com/package.yaml\": no HTTP getter configured to fetch \"https://example.com/package.yaml\"")
+	})
+
+	t.Run("remote documents are validated", func(t *testing.T) {
+		_, err := build(&fakeGetter{catalog: unknownSchemaYaml}, `[{"input": "https://example.com/unknown.yaml"}]`)
+		require.EqualError(t, err, "error parsing raw input file: https://example.com/unknown.yaml, objects have unknown schemas: \"olm.unknown\" (package \"webhook-operator\", name \"mystery\")")
+	})
 }
-{
-    "schema": "olm.channel",
-    "name": "preview",
-    "package": "webhook-operator-412",
-    "entries": [
-        {
-            "name": "webhook-operator.v0.0.1"
-        }
-    ]
+
+func TestOutputLayout(t *testing.T) {
+	inputDir := t.TempDir()
+	input := filepath.Join(inputDir, "input.yaml")
+	require.NoError(t, os.WriteFile(input, []byte(rawYaml+`---
+schema: olm.package
+name: other-operator
+---
+schema: olm.extension
+name: unpackaged
+`), 0o666))
+
+	workingDir := t.TempDir()
+	ctx := contextWithBuildRecord(context.Background(), &buildRecord{})
+	record := ctx.Value(buildRecordKey{}).(*buildRecord)
+	err := NewRawBuilder(BuilderConfig{
+		WorkingDir:   workingDir,
+		OutputType:   OutputTypeYAML,
+		OutputLayout: OutputLayoutPerPackage,
+	}).Build(ctx, nil, "my-operator", TemplateDefinition{
+		Schema: RawBuilderSchema,
+		Config: []byte(fmt.Sprintf(`{"input": %q, "skipValidation": true}`, input)),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"catalog.yaml", "other-operator/catalog.yaml", "webhook-operator-412/catalog.yaml"}, record.outputs)
+
+	data, err := os.ReadFile(filepath.Join(workingDir, "my-operator", "webhook-operator-412", "catalog.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, rawBuiltFbcYaml, string(data))
+	data, err = os.ReadFile(filepath.Join(workingDir, "my-operator", "other-operator", "catalog.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "---\ndefaultChannel: \"\"\nname: other-operator\nschema: olm.package\n", string(data))
+	data, err = os.ReadFile(filepath.Join(workingDir, "my-operator", "catalog.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "---\nname: unpackaged\nschema: olm.extension\n", string(data))
+
+	layout, err := ParseOutputLayout("")
+	require.NoError(t, err)
+	require.Equal(t, OutputLayoutSingleFile, layout)
+	_, err = ParseOutputLayout("per-channel")
+	require.EqualError(t, err, "invalid output layout \"per-channel\", expected one of [single-file per-package]")
 }
-{
-    "schema": "olm.bundle",
-    "name": "webhook-operator.v0.0.1",
-    "package": "webhook-operator-412",
-    "image": "quay.io/olmtest/webhook-operator-bundle:0.0.3",
-    "properties": [
-        {
-            "type": "olm.gvk",
-            "value": {
-                "group": "webhook.operators.coreos.io",
-                "kind": "WebhookTest",
-                "version": "v1"
-            }
-        },
-        {
-            "type": "olm.gvk",
-            "value": {
-                "group": "webhook.operators.coreos.io",
-                "kind": "WebhookTest",
-                "version": "v2"
-            }
-        },
-        {
-            "type": "olm.package",
-            "value": {
-                "packageName": "webhook-operator-412",
-                "version": "0.0.1"
-            }
-        },
-        {
-            "type": "olm.bundle.object",
-            "value": {
-                "data": "eyJhcGlWZXJzaW9uIjoicmJhYy5hdXRob3JpemF0aW9uLms4cy5pby92MWJldGExIiwia2luZCI6IkNsdXN0ZXJSb2xlIiwibWV0YWRhdGEiOnsiY3JlYXRpb25UaW1lc3RhbXAiOm51bGwsIm5hbWUiOiJ3ZWJob29rLW9wZXJhdG9yLW1ldHJpY3MtcmVhZGVyIn0sInJ1bGVzIjpbeyJub25SZXNvdXJjZVVSTHMiOlsiL21ldHJpY3MiXSwidmVyYnMiOlsiZ2V0Il19XX0="
-            }
-        },
-        {
-            "type": "olm.bundle.object",
-            "value": {
-                "data": "eyJhcGlWZXJzaW9uIjoib3BlcmF0b3JzLmNvcmVvcy5jb20vdjFhbHBoYTEiLCJraW5kIjoiQ2x1c3RlclNlcnZpY2VWZXJzaW9uIiwibWV0YWRhdGEiOnsiYW5ub3RhdGlvbnMiOnsiYWxtLWV4YW1wbGVzIjoiW1xuICB7XG4gICAgXCJhcGlWZXJzaW9uXCI6IFwid2ViaG9vay5vcGVyYXRvcnMuY29yZW9zLmlvL3YxXCIsXG4gICAgXCJraW5kXCI6IFwiV2ViaG9va1Rlc3RcIixcbiAgICBcIm1ldGFkYXRhXCI6IHtcbiAgICAgIFwibmFtZVwiOiBcIndlYmhvb2t0ZXN0LXNhbXBsZVwiLFxuICAgICAgXCJuYW1lc3BhY2VcIjogXCJ3ZWJob29rLW9wZXJhdG9yLXN5c3RlbVwiXG4gICAgfSxcbiAgICBcInNwZWNcIjoge1xuICAgICAgXCJ2YWxpZFwiOiB0cnVlXG4gICAgfVxuICB9XG5dIiwiY2FwYWJpbGl0aWVzIjoiQmFzaWMgSW5zdGFsbCIsIm9wZXJhdG9ycy5vcGVyYXRvcmZyYW1ld29yay5pby9idWlsZGVyIjoib3BlcmF0b3Itc2RrLXYxLjAuMCIsIm9wZXJhdG9ycy5vcGVyYXRvcmZyYW1ld29yay5pby9wcm9qZWN0X2xheW91dCI6ImdvIn0sIm5hbWUiOiJ3ZWJob29rLW9wZXJhdG9yLnYwLjAuMSIsIm5hbWVzcGFjZSI6InBsYWNlaG9sZGVyIn0sInNwZWMiOnsiYXBpc2VydmljZWRlZmluaXRpb25zIjp7fSwiY3VzdG9tcmVzb3VyY2VkZWZpbml0aW9ucyI6eyJvd25lZCI6W3sia2luZCI6IldlYmhvb2tUZXN0IiwibmFtZSI6IndlYmhvb2t0ZXN0cy53ZWJob29rLm9wZXJhdG9ycy5jb3Jlb3MuaW8iLCJ2ZXJzaW9uIjoidjEifV19LCJkZXNjcmlwdGlvbiI6IldlYmhvb2sgT3BlcmF0b3IgZGVzY3JpcHRpb24uIFRPRE8uIiwiZGlzcGxheU5hbWUiOiJXZWJob29rIE9wZXJhdG9yIiwiaWNvbiI6W3siYmFzZTY0ZGF0YSI6IiIsIm1lZGlhdHlwZSI6IiJ9XSwiaW5zdGFsbCI6eyJzcGVjIjp7ImNsdXN0ZXJQZXJtaXNzaW9ucyI6W3sicnVsZXMiOlt7ImFwaUdyb3VwcyI6WyJ3ZWJob29rLm9wZXJhdG9ycy5jb3Jlb3MuaW8iXSwicmVzb3VyY2VzIjpbIndlYmhvb2t0ZXN0cyJdLCJ2ZXJicyI6WyJjcmVhdGUiLCJkZWxldGUiLCJnZXQiLCJsaXN0IiwicGF0Y2giLCJ1cGRhdGUiLCJ3YXRjaCJdfSx7ImFwaUdyb3VwcyI6WyJ3ZWJob29rLm9wZXJhdG9ycy5jb3Jlb3MuaW8iXSwicmVzb3VyY2VzIjpbIndlYmhvb2t0ZXN0cy9zdGF0dXMiXSwidmVyYnMiOlsiZ2V0IiwicGF0Y2giLCJ1cGRhdGUiXX0seyJhcGlHcm91cHMiOlsiYXV0aGVudGljYXRpb24uazhzLmlvIl0sInJlc291cmNlcyI6WyJ0b2tlbnJldmlld3MiXSwidmVyYnMiOlsiY3JlYXRlIl19LHsiYXBpR3JvdXBzIjpbImF1dGhvcml6YXRpb24uazhzLmlvIl0sInJlc291cmNlcyI6WyJzdWJqZWN0YWNjZXNzcmV2aWV3cyJdLCJ2ZXJicyI6WyJjcmVhdGUiXX1dLCJzZXJ2aWNlQWNjb3VudE5hbWUiOiJkZWZhdWx0In1dLCJkZXBsb3ltZW50cyI6W3sibmFtZSI6IndlYmhvb2stb3BlcmF0b3Itd2ViaG9vayIsInNwZWMiOnsicmVwbGljYXMiOjEsInNlbGVjdG9yIjp7Im1hdGNoTGFiZWxzIjp7ImNvbnRyb2wtcGxhbmUiOiJjb250cm9sbGVyLW1hbmFnZXIifX0sInN0cmF0ZWd5Ijp7fSwidGVtcGxhdGUiOnsibWV0YWRhdGEiOnsibGFiZWxzIjp7ImNvbnRyb2wtcGxhbmUiOiJjb250cm9sbGVyLW1hbmFnZXIifX0sInNwZWMiOnsiY29udGFpbmVycyI6W3siYXJncyI6WyItLXNlY3VyZS1saXN0ZW4tYWRkcmVzcz0wLjAuMC4wOjg0NDMiLCItLXVwc3RyZWFtPWh0dHA6Ly8xMjcuMC4wLjE6ODA4MC8iLCItLWxvZ3Rvc3RkZXJyPXRydWUiLCItLXY9MTAiXSwiaW1hZ2UiOiJnY3IuaW8va3ViZWJ1aWxkZXIva3ViZS1yYmFjLXByb3h5OnYwLjUuMCIsIm5hbWUiOiJrdWJlLXJiYWMtcHJveHkiLCJwb3J0cyI6W3siY29udGFpbmVyUG9ydCI6ODQ0MywibmFtZSI6Imh0dHBzIn1dLCJyZXNvdXJjZXMiOnt9fSx7ImFyZ3MiOlsiLS1tZXRyaWNzLWFkZHI9MTI3LjAuMC4xOjgwODAiLCItLWVuYWJsZS1sZWFkZXItZWxlY3Rpb24iXSwiY29tbWFuZCI6WyIvbWFuYWdlciJdLCJpbWFnZSI6InF1YXkuaW8vb2xtdGVzdC93ZWJob29rLW9wZXJhdG9yOjAuMC4zIiwibmFtZSI6Im1hbmFnZXIiLCJwb3J0cyI6W3siY29udGFpbmVyUG9ydCI6OTQ0MywibmFtZSI6IndlYmhvb2stc2VydmVyIiwicHJvdG9jb2wiOiJUQ1AifV0sInJlc291cmNlcyI6eyJsaW1pdHMiOnsiY3B1IjoiMTAwbSIsIm1lbW9yeSI6IjMwTWkifSwicmVxdWVzdHMiOnsiY3B1IjoiMTAwbSIsIm1lbW9yeSI6IjIwTWkifX19XSwidGVybWluYXRpb25HcmFjZVBlcmlvZFNlY29uZHMiOjEwfX19fV0sInBlcm1pc3Npb25zIjpbeyJydWxlcyI6W3siYXBpR3JvdXBzIjpbIiJdLCJyZXNvdXJjZXMiOlsiY29uZmlnbWFwcyJdLCJ2ZXJicyI6WyJnZXQiLCJsaXN0Iiwid2F0Y2giLCJjcmVhdGUiLCJ1cGRhdGUiLCJwYXRjaCIsImRlbGV0ZSJdfSx7ImFwaUdyb3VwcyI6WyIiXSwicmVzb3VyY2VzIjpbImNvbmZpZ21hcHMvc3RhdHVzIl0sInZlcmJzIjpbImdldCIsInVwZGF0ZSIsInBhdGNoIl19LHsiYXBpR3JvdXBzIjpbIiJdLCJyZXNvdXJjZXMiOlsiZXZlbnRzIl0sInZlcmJzIjpbImNyZWF0ZSJdfV0sInNlcnZpY2VBY2NvdW50TmFtZSI6ImRlZmF1bHQifV19LCJzdHJhdGVneSI6ImRlcGxveW1lbnQifSwiaW5zdGFsbE1vZGVzIjpbeyJzdXBwb3J0ZWQiOmZhbHNlLCJ0eXBlIjoiT3duTmFtZXNwYWNlIn0seyJzdXBwb3J0ZWQiOmZhbHNlLCJ0eXBlIjoiU2luZ2xlTmFtZXNwYWNlIn0seyJzdXBwb3J0ZWQiOmZhbHNlLCJ0eXBlIjoiTXVsdGlOYW1lc3BhY2UifSx7InN1cHBvcnRlZCI6dHJ1ZSwidHlwZSI6IkFsbE5hbWVzcGFjZXMifV0sImtleXdvcmRzIjpbIndlYmhvb2stb3BlcmF0b3IiXSwibGlua3MiOlt7Im5hbWUiOiJXZWJob29rIE9wZXJhdG9yIiwidXJsIjoiaHR0cHM6Ly93ZWJob29rLW9wZXJhdG9yLmRvbWFpbiJ9XSwibWFpbnRhaW5lcnMiOlt7ImVtYWlsIjoieW91ckBlbWFpbC5jb20iLCJuYW1lIjoiTWFpbnRhaW5lciBOYW1lIn1dLCJtYXR1cml0eSI6ImFscGhhIiwicHJvdmlkZXIiOnsibmFtZSI6IlByb3ZpZGVyIE5hbWUiLCJ1cmwiOiJodHRwczovL3lvdXIuZG9tYWluIn0sInZlcnNpb24iOiIwLjAuMSIsIndlYmhvb2tkZWZpbml0aW9ucyI6W3siYWRtaXNzaW9uUmV2aWV3VmVyc2lvbnMiOlsidjFiZXRhMSIsInYxIl0sImNvbnRhaW5lclBvcnQiOjQ0MywiZGVwbG95bWVudE5hbWUiOiJ3ZWJob29rLW9wZXJhdG9yLXdlYmhvb2siLCJmYWlsdXJlUG9saWN5IjoiRmFpbCIsImdlbmVyYXRlTmFtZSI6InZ3ZWJob29rdGVzdC5rYi5pbyIsInJ1bGVzIjpbeyJhcGlHcm91cHMiOlsid2ViaG9vay5vcGVyYXRvcnMuY29yZW9zLmlvIl0sImFwaVZlcnNpb25zIjpbInYxIl0sIm9wZXJhdGlvbnMiOlsiQ1JFQVRFIiwiVVBEQVRFIl0sInJlc291cmNlcyI6WyJ3ZWJob29rdGVzdHMiXX1dLCJzaWRlRWZmZWN0cyI6Ik5vbmUiLCJ0YXJnZXRQb3J0Ijo0MzQzLCJ0eXBlIjoiVmFsaWRhdGluZ0FkbWlzc2lvbldlYmhvb2siLCJ3ZWJob29rUGF0aCI6Ii92YWxpZGF0ZS13ZWJob29rLW9wZXJhdG9ycy1jb3Jlb3MtaW8tdjEtd2ViaG9va3Rlc3QifSx7ImFkbWlzc2lvblJldmlld1ZlcnNpb25zIjpbInYxYmV0YTEiLCJ2MSJdLCJjb250YWluZXJQb3J0Ijo0NDMsImRlcGxveW1lbnROYW1lIjoid2ViaG9vay1vcGVyYXRvci13ZWJob29rIiwiZmFpbHVyZVBvbGljeSI6IkZhaWwiLCJnZW5lcmF0ZU5hbWUiOiJtd2ViaG9va3Rlc3Qua2IuaW8iLCJydWxlcyI6W3siYXBpR3JvdXBzIjpbIndlYmhvb2sub3BlcmF0b3JzLmNvcmVvcy5pbyJdLCJhcGlWZXJzaW9ucyI6WyJ2MSJdLCJvcGVyYXRpb25zIjpbIkNSRUFURSIsIlVQREFURSJdLCJyZXNvdXJjZXMiOlsid2ViaG9va3Rlc3RzIl19XSwic2lkZUVmZmVjdHMiOiJOb25lIiwidGFyZ2V0UG9ydCI6NDM0MywidHlwZSI6Ik11dGF0aW5nQWRtaXNzaW9uV2ViaG9vayIsIndlYmhvb2tQYXRoIjoiL211dGF0ZS13ZWJob29rLW9wZXJhdG9ycy1jb3Jlb3MtaW8tdjEtd2ViaG9va3Rlc3QifSx7ImFkbWlzc2lvblJldmlld1ZlcnNpb25zIjpbInYxYmV0YTEiLCJ2MSJdLCJjb250YWluZXJQb3J0Ijo0NDMsImNvbnZlcnNpb25DUkRzIjpbIndlYmhvb2t0ZXN0cy53ZWJob29rLm9wZXJhdG9ycy5jb3Jlb3MuaW8iXSwiZGVwbG95bWVudE5hbWUiOiJ3ZWJob29rLW9wZXJhdG9yLXdlYmhvb2siLCJmYWlsdXJlUG9saWN5IjoiRmFpbCIsImdlbmVyYXRlTmFtZSI6ImN3ZWJob29rdGVzdC5rYi5pbyIsInJ1bGVzIjpbeyJhcGlHcm91cHMiOlsid2ViaG9vay5vcGVyYXRvcnMuY29yZW9zLmlvIl0sImFwaVZlcnNpb25zIjpbInYxIl0sIm9wZXJhdGlvbnMiOlsiQ1JFQVRFIiwiVVBEQVRFIl0sInJlc291cmNlcyI6WyJ3ZWJob29rdGVzdHMiXX1dLCJzaWRlRWZmZWN0cyI6Ik5vbmUiLCJ0YXJnZXRQb3J0Ijo0MzQzLCJ0eXBlIjoiQ29udmVyc2lvbldlYmhvb2siLCJ3ZWJob29rUGF0aCI6Ii9jb252ZXJ0In1dfX0="
-            }
-        },
-        {
-            "type": "olm.bundle.object",
-            "value": {
-                "data": "eyJhcGlWZXJzaW9uIjoiYXBpZXh0ZW5zaW9ucy5rOHMuaW8vdjFiZXRhMSIsImtpbmQiOiJDdXN0b21SZXNvdXJjZURlZmluaXRpb24iLCJtZXRhZGF0YSI6eyJhbm5vdGF0aW9ucyI6eyJjb250cm9sbGVyLWdlbi5rdWJlYnVpbGRlci5pby92ZXJzaW9uIjoidjAuMy4wIn0sImNyZWF0aW9uVGltZXN0YW1wIjpudWxsLCJuYW1lIjoid2ViaG9va3Rlc3RzLndlYmhvb2sub3BlcmF0b3JzLmNvcmVvcy5pbyJ9LCJzcGVjIjp7Imdyb3VwIjoid2ViaG9vay5vcGVyYXRvcnMuY29yZW9zLmlvIiwibmFtZXMiOnsia2luZCI6IldlYmhvb2tUZXN0IiwibGlzdEtpbmQiOiJXZWJob29rVGVzdExpc3QiLCJwbHVyYWwiOiJ3ZWJob29rdGVzdHMiLCJzaW5ndWxhciI6IndlYmhvb2t0ZXN0In0sInByZXNlcnZlVW5rbm93bkZpZWxkcyI6ZmFsc2UsInNjb3BlIjoiTmFtZXNwYWNlZCIsInZlcnNpb24iOiJ2MSIsInZlcnNpb25zIjpbeyJuYW1lIjoidjEiLCJzY2hlbWEiOnsib3BlbkFQSVYzU2NoZW1hIjp7ImRlc2NyaXB0aW9uIjoiV2ViaG9va1Rlc3QgaXMgdGhlIFNjaGVtYSBmb3IgdGhlIHdlYmhvb2t0ZXN0cyBBUEkiLCJwcm9wZXJ0aWVzIjp7ImFwaVZlcnNpb24iOnsiZGVzY3JpcHRpb24iOiJBUElWZXJzaW9uIGRlZmluZXMgdGhlIHZlcnNpb25lZCBzY2hlbWEgb2YgdGhpcyByZXByZXNlbnRhdGlvbiBvZiBhbiBvYmplY3QuIFNlcnZlcnMgc2hvdWxkIGNvbnZlcnQgcmVjb2duaXplZCBzY2hlbWFzIHRvIHRoZSBsYXRlc3QgaW50ZXJuYWwgdmFsdWUsIGFuZCBtYXkgcmVqZWN0IHVucmVjb2duaXplZCB2YWx1ZXMuIE1vcmUgaW5mbzogaHR0cHM6Ly9naXQuazhzLmlvL2NvbW11bml0eS9jb250cmlidXRvcnMvZGV2ZWwvc2lnLWFyY2hpdGVjdHVyZS9hcGktY29udmVudGlvbnMubWQjcmVzb3VyY2VzIiwidHlwZSI6InN0cmluZyJ9LCJraW5kIjp7ImRlc2NyaXB0aW9uIjoiS2luZCBpcyBhIHN0cmluZyB2YWx1ZSByZXByZXNlbnRpbmcgdGhlIFJFU1QgcmVzb3VyY2UgdGhpcyBvYmplY3QgcmVwcmVzZW50cy4gU2VydmVycyBtYXkgaW5mZXIgdGhpcyBmcm9tIHRoZSBlbmRwb2ludCB0aGUgY2xpZW50IHN1Ym1pdHMgcmVxdWVzdHMgdG8uIENhbm5vdCBiZSB1cGRhdGVkLiBJbiBDYW1lbENhc2UuIE1vcmUgaW5mbzogaHR0cHM6Ly9naXQuazhzLmlvL2NvbW11bml0eS9jb250cmlidXRvcnMvZGV2ZWwvc2lnLWFyY2hpdGVjdHVyZS9hcGktY29udmVudGlvbnMubWQjdHlwZXMta2luZHMiLCJ0eXBlIjoic3RyaW5nIn0sIm1ldGFkYXRhIjp7InR5cGUiOiJvYmplY3QifSwic3BlYyI6eyJkZXNjcmlwdGlvbiI6IldlYmhvb2tUZXN0U3BlYyBkZWZpbmVzIHRoZSBkZXNpcmVkIHN0YXRlIG9mIFdlYmhvb2tUZXN0IiwicHJvcGVydGllcyI6eyJtdXRhdGUiOnsiZGVzY3JpcHRpb24iOiJNdXRhdGUgaXMgYSBmaWVsZCB0aGF0IHdpbGwgYmUgc2V0IHRvIHRydWUgYnkgdGhlIG11dGF0aW5nIHdlYmhvb2suIiwidHlwZSI6ImJvb2xlYW4ifSwidmFsaWQiOnsiZGVzY3JpcHRpb24iOiJWYWxpZCBtdXN0IGJlIHNldCB0byB0cnVlIG9yIHRoZSB2YWxpZGF0aW9uIHdlYmhvb2sgd2lsbCByZWplY3QgdGhlIHJlc291cmNlLiIsInR5cGUiOiJib29sZWFuIn19LCJyZXF1aXJlZCI6WyJ2YWxpZCJdLCJ0eXBlIjoib2JqZWN0In0sInN0YXR1cyI6eyJkZXNjcmlwdGlvbiI6IldlYmhvb2tUZXN0U3RhdHVzIGRlZmluZXMgdGhlIG9ic2VydmVkIHN0YXRlIG9mIFdlYmhvb2tUZXN0IiwidHlwZSI6Im9iamVjdCJ9fSwidHlwZSI6Im9iamVjdCJ9fSwic2VydmVkIjp0cnVlLCJzdG9yYWdlIjp0cnVlfSx7Im5hbWUiOiJ2MiIsInNjaGVtYSI6eyJvcGVuQVBJVjNTY2hlbWEiOnsiZGVzY3JpcHRpb24iOiJXZWJob29rVGVzdCBpcyB0aGUgU2NoZW1hIGZvciB0aGUgd2ViaG9va3Rlc3RzIEFQSSIsInByb3BlcnRpZXMiOnsiYXBpVmVyc2lvbiI6eyJkZXNjcmlwdGlvbiI6IkFQSVZlcnNpb24gZGVmaW5lcyB0aGUgdmVyc2lvbmVkIHNjaGVtYSBvZiB0aGlzIHJlcHJlc2VudGF0aW9uIG9mIGFuIG9iamVjdC4gU2VydmVycyBzaG91bGQgY29udmVydCByZWNvZ25pemVkIHNjaGVtYXMgdG8gdGhlIGxhdGVzdCBpbnRlcm5hbCB2YWx1ZSwgYW5kIG1heSByZWplY3QgdW5yZWNvZ25pemVkIHZhbHVlcy4gTW9yZSBpbmZvOiBodHRwczovL2dpdC5rOHMuaW8vY29tbXVuaXR5L2NvbnRyaWJ1dG9ycy9kZXZlbC9zaWctYXJjaGl0ZWN0dXJlL2FwaS1jb252ZW50aW9ucy5tZCNyZXNvdXJjZXMiLCJ0eXBlIjoic3RyaW5nIn0sImtpbmQiOnsiZGVzY3JpcHRpb24iOiJLaW5kIGlzIGEgc3RyaW5nIHZhbHVlIHJlcHJlc2VudGluZyB0aGUgUkVTVCByZXNvdXJjZSB0aGlzIG9iamVjdCByZXByZXNlbnRzLiBTZXJ2ZXJzIG1heSBpbmZlciB0aGlzIGZyb20gdGhlIGVuZHBvaW50IHRoZSBjbGllbnQgc3VibWl0cyByZXF1ZXN0cyB0by4gQ2Fubm90IGJlIHVwZGF0ZWQuIEluIENhbWVsQ2FzZS4gTW9yZSBpbmZvOiBodHRwczovL2dpdC5rOHMuaW8vY29tbXVuaXR5L2NvbnRyaWJ1dG9ycy9kZXZlbC9zaWctYXJjaGl0ZWN0dXJlL2FwaS1jb252ZW50aW9ucy5tZCN0eXBlcy1raW5kcyIsInR5cGUiOiJzdHJpbmcifSwibWV0YWRhdGEiOnsidHlwZSI6Im9iamVjdCJ9LCJzcGVjIjp7ImRlc2NyaXB0aW9uIjoiV2ViaG9va1Rlc3RTcGVjIGRlZmluZXMgdGhlIGRlc2lyZWQgc3RhdGUgb2YgV2ViaG9va1Rlc3QiLCJwcm9wZXJ0aWVzIjp7ImNvbnZlcnNpb24iOnsiZGVzY3JpcHRpb24iOiJDb252ZXJzaW9uIGlzIGFuIGV4YW1wbGUgZmllbGQgb2YgV2ViaG9va1Rlc3QuIEVkaXQgV2ViaG9va1Rlc3RfdHlwZXMuZ28gdG8gcmVtb3ZlL3VwZGF0ZSIsInByb3BlcnRpZXMiOnsibXV0YXRlIjp7ImRlc2NyaXB0aW9uIjoiTXV0YXRlIGlzIGEgZmllbGQgdGhhdCB3aWxsIGJlIHNldCB0byB0cnVlIGJ5IHRoZSBtdXRhdGluZyB3ZWJob29rLiIsInR5cGUiOiJib29sZWFuIn0sInZhbGlkIjp7ImRlc2NyaXB0aW9uIjoiVmFsaWQgbXVzdCBiZSBzZXQgdG8gdHJ1ZSBvciB0aGUgdmFsaWRhdGlvbiB3ZWJob29rIHdpbGwgcmVqZWN0IHRoZSByZXNvdXJjZS4iLCJ0eXBlIjoiYm9vbGVhbiJ9fSwicmVxdWlyZWQiOlsidmFsaWQiXSwidHlwZSI6Im9iamVjdCJ9fSwicmVxdWlyZWQiOlsiY29udmVyc2lvbiJdLCJ0eXBlIjoib2JqZWN0In0sInN0YXR1cyI6eyJkZXNjcmlwdGlvbiI6IldlYmhvb2tUZXN0U3RhdHVzIGRlZmluZXMgdGhlIG9ic2VydmVkIHN0YXRlIG9mIFdlYmhvb2tUZXN0IiwidHlwZSI6Im9iamVjdCJ9fSwidHlwZSI6Im9iamVjdCJ9fSwic2VydmVkIjp0cnVlLCJzdG9yYWdlIjpmYWxzZX1dfSwic3RhdHVzIjp7ImFjY2VwdGVkTmFtZXMiOnsia2luZCI6IiIsInBsdXJhbCI6IiJ9LCJjb25kaXRpb25zIjpbXSwic3RvcmVkVmVyc2lvbnMiOltdfX0="
-            }
-        }
-    ],
-    "relatedImages": [
-        {
-            "name": "",
-            "image": "gcr.io/kubebuilder/kube-rbac-proxy:v0.5.0"
-        },
-        {
-            "name": "",
-            "image": "quay.io/olmtest/webhook-operator-bundle:0.0.3"
-        },
-        {
-            "name": "",
-            "image": "quay.io/olmtest/webhook-operator:0.0.3"
-        }
-    ]
+
+func TestMermaidOutputType(t *testing.T) {
+	inputDir := t.TempDir()
+	input := filepath.Join(inputDir, "input.yaml")
+	require.NoError(t, os.WriteFile(input, []byte(`---
+schema: olm.package
+name: webhook-operator
+---
+schema: olm.channel
+package: webhook-operator
+name: stable
+entries:
+  - name: webhook-operator.v0.0.1
+`), 0o666))
+
+	workingDir := t.TempDir()
+	ctx := contextWithBuildRecord(context.Background(), &buildRecord{})
+	record := ctx.Value(buildRecordKey{}).(*buildRecord)
+	bc := BuilderConfig{WorkingDir: workingDir, OutputType: OutputTypeMermaid}
+	err := NewBasicBuilder(bc).Build(ctx, nil, "my-operator", TemplateDefinition{
+		Schema: BasicBuilderSchema,
+		Config: []byte(fmt.Sprintf(`{"input": %q, "output": "catalog.json"}`, input)),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"catalog.json", "webhook-operator.mmd"}, record.outputs)
+
+	_, err = declcfg.LoadFS(context.Background(), os.DirFS(filepath.Join(workingDir, "my-operator")))
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(workingDir, "my-operator", "webhook-operator.mmd"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "graph LR")
+	require.Contains(t, string(data), `subgraph "webhook-operator"`)
+	data, err = os.ReadFile(filepath.Join(workingDir, "my-operator", indexIgnoreFileName))
+	require.NoError(t, err)
+	require.Equal(t, "*.mmd\n", string(data))
+
+	err = NewRawBuilder(bc).Build(ctx, nil, "raw", TemplateDefinition{
+		Schema: RawBuilderSchema,
+		Config: []byte(fmt.Sprintf(`{"input": %q, "output": "catalog.json"}`, input)),
+	})
+	require.EqualError(t, err, `unsupported output type "mermaid" for this builder: the olm.builder.raw builder only writes json or yaml`)
+	require.NoDirExists(t, filepath.Join(workingDir, "raw"))
+}
+
+func TestBuildComponent(t *testing.T) {
+	inputDir := t.TempDir()
+	input := filepath.Join(inputDir, "input.yaml")
+	require.NoError(t, os.WriteFile(input, []byte(`---
+schema: olm.package
+name: webhook-operator
+---
+schema: olm.channel
+package: webhook-operator
+name: stable
+entries:
+  - name: webhook-operator.v0.0.1
+`), 0o666))
+
+	logs := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(logs)
+	logger.SetLevel(logrus.DebugLevel)
+
+	workingDir := t.TempDir()
+	result, err := NewBasicBuilder(BuilderConfig{WorkingDir: workingDir, OutputType: OutputTypeJSON}).BuildComponent(context.Background(), nil, BuildRequest{
+		ComponentName: "webhooks",
+		CatalogName:   "shop",
+		Destination:   "my-operator",
+		Template: TemplateDefinition{
+			Schema: BasicBuilderSchema,
+			Config: []byte(fmt.Sprintf(`{"input": %q, "output": "catalog.json"}`, input)),
+		},
+		OutputType: OutputTypeMermaid,
+		Logger:     logger.WithField("component", "webhooks"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"catalog.json", "webhook-operator.mmd"}, result.Files)
+	require.FileExists(t, filepath.Join(workingDir, "my-operator", "webhook-operator.mmd"))
+	require.Contains(t, logs.String(), "component=webhooks")
+}
+
+func TestMigrationLevel(t *testing.T) {
+	newConfig := func() *declcfg.DeclarativeConfig {
+		return &declcfg.DeclarativeConfig{Bundles: []declcfg.Bundle{
+			{
+				Name:    "webhook-operator.v0.0.1",
+				Package: "webhook-operator",
+				Properties: []property.Property{
+					property.MustBuildPackage("webhook-operator", "0.0.1"),
+					property.MustBuild(&property.CSVMetadata{DisplayName: "Webhook Operator"}),
+				},
+			},
+			{
+				Name:    "webhook-operator.v0.0.2",
+				Package: "webhook-operator",
+				Properties: []property.Property{
+					property.MustBuildPackage("webhook-operator", "0.0.2"),
+					property.MustBuild(&property.CSVMetadata{DisplayName: "Webhook Operator"}),
+				},
+				Objects: []string{`{"kind":"ClusterServiceVersion"}`, `{"kind":"CustomResourceDefinition"}`},
+			},
+		}}
+	}
+	migrate := func(level MigrationLevel) (*declcfg.DeclarativeConfig, *buildRecord) {
+		dcfg := newConfig()
+		record := &buildRecord{}
+		require.NoError(t, BuilderConfig{MigrationLevel: level}.migrate(contextWithBuildRecord(context.Background(), record), dcfg))
+		return dcfg, record
+	}
+
+	dcfg, record := migrate("")
+	require.Equal(t, MigrationLevelLatest, record.migrationLevel)
+	require.Equal(t, newConfig(), dcfg)
+
+	dcfg, record = migrate(MigrationLevelNone)
+	require.Equal(t, MigrationLevelNone, record.migrationLevel)
+	require.Equal(t, []property.Property{
+		property.MustBuildPackage("webhook-operator", "0.0.2"),
+		property.MustBuildBundleObjectData([]byte(`{"kind":"ClusterServiceVersion"}`)),
+		property.MustBuildBundleObjectData([]byte(`{"kind":"CustomResourceDefinition"}`)),
+	}, dcfg.Bundles[1].Properties)
+
+	// bundles that were not rendered from an image have no objects
+	props, err := property.Parse(dcfg.Bundles[0].Properties)
+	require.NoError(t, err)
+	require.Len(t, props.BundleObjects, 1)
+	require.Empty(t, props.CSVMetadatas)
+	csv, err := props.BundleObjects[0].GetData(nil, "")
+	require.NoError(t, err)
+	require.Contains(t, string(csv), `"kind":"ClusterServiceVersion"`)
+	require.Contains(t, string(csv), `"name":"webhook-operator.v0.0.1"`)
+	require.Contains(t, string(csv), `"displayName":"Webhook Operator"`)
+
+	_, err = ParseMigrationLevel("csv-metadata")
+	require.EqualError(t, err, `invalid migration level "csv-metadata", expected one of [none bundle-object-to-csv-metadata]`)
 }
-`
 
 func TestCustomBuilder(t *testing.T) {
 	type testCase struct {
 		name               string
 		validate           bool
 		customBuilder      *CustomBuilder
+		componentInfo      *ComponentInfo
 		templateDefinition TemplateDefinition
 		files              map[string]string
 		buildAssertions    func(t *testing.T, dir string, buildErr error)
@@ -1371,6 +1212,11 @@ func TestCustomBuilder(t *testing.T) {
 	}
 
 	testDir := t.TempDir()
+	t.Setenv("COMPOSITE_TEST_ALLOWED", "allowed")
+	t.Setenv("COMPOSITE_TEST_SECRET", "secret")
+	stderrLog := &bytes.Buffer{}
+	stderrLogger := logrus.New()
+	stderrLogger.SetOutput(stderrLog)
 	validTemplateConfig := `{
 		"command": "%s",
 		"args": ["%s"],
@@ -1543,6 +1389,143 @@ func TestCustomBuilder(t *testing.T) {
 				)
 			},
 		},
+		{
+			name:     "failing command reports its stderr",
+			validate: false,
+			customBuilder: NewCustomBuilder(BuilderConfig{
+				WorkingDir: testDir,
+				OutputType: "yaml",
+				Log:        logrus.NewEntry(stderrLogger),
+			}),
+			templateDefinition: TemplateDefinition{
+				Schema: CustomBuilderSchema,
+				Config: []byte(`{
+					"command": "sh",
+					"args": ["-c", "echo generating >&2; echo no such package >&2; exit 3"],
+					"output": "catalog.yaml"
+				}`),
+			},
+			files: map[string]string{},
+			buildAssertions: func(t *testing.T, dir string, buildErr error) {
+				wd, err := os.Getwd()
+				require.NoError(t, err)
+				cmd := exec.Command("sh", "-c", "echo generating >&2; echo no such package >&2; exit 3")
+				require.EqualError(t, buildErr, fmt.Sprintf("running command %q in directory %q: exit status 3, stderr:\ngenerating\nno such package", cmd.String(), wd))
+				require.Contains(t, stderrLog.String(), "no such package")
+			},
+		},
+		{
+			name:     "command receives the component context",
+			validate: false,
+			customBuilder: NewCustomBuilder(BuilderConfig{
+				WorkingDir: testDir,
+				OutputType: "yaml",
+			}),
+			componentInfo: &ComponentInfo{Component: "my-component", Catalog: "my-catalog", Destination: "catalogs/my-component"},
+			templateDefinition: TemplateDefinition{
+				Schema: CustomBuilderSchema,
+				Config: []byte(`{
+					"command": "sh",
+					"args": ["-c", "echo $OPM_COMPOSITE_COMPONENT $OPM_COMPOSITE_CATALOG $OPM_COMPOSITE_DESTINATION $OPM_COMPOSITE_OUTPUT_TYPE >&2; exit 1"],
+					"output": "catalog.yaml"
+				}`),
+			},
+			files: map[string]string{},
+			buildAssertions: func(t *testing.T, dir string, buildErr error) {
+				require.Error(t, buildErr)
+				require.True(t, strings.HasSuffix(buildErr.Error(), "stderr:\nmy-component my-catalog catalogs/my-component yaml"), buildErr.Error())
+			},
+		},
+		{
+			name:     "command receives its config on stdin",
+			validate: false,
+			customBuilder: NewCustomBuilder(BuilderConfig{
+				WorkingDir: testDir,
+				OutputType: "yaml",
+			}),
+			templateDefinition: TemplateDefinition{
+				Schema: CustomBuilderSchema,
+				Config: []byte(`{"command": "sh", "args": ["-c", "cat >&2; exit 1"], "output": "catalog.yaml", "stdinConfig": true}`),
+			},
+			files: map[string]string{},
+			buildAssertions: func(t *testing.T, dir string, buildErr error) {
+				require.Error(t, buildErr)
+				require.True(t, strings.HasSuffix(buildErr.Error(), `stderr:
+{"command": "sh", "args": ["-c", "cat >&2; exit 1"], "output": "catalog.yaml", "stdinConfig": true}`), buildErr.Error())
+			},
+		},
+		{
+			name:     "command receives an empty stdin by default",
+			validate: false,
+			customBuilder: NewCustomBuilder(BuilderConfig{
+				WorkingDir: testDir,
+				OutputType: "yaml",
+			}),
+			templateDefinition: TemplateDefinition{
+				Schema: CustomBuilderSchema,
+				Config: []byte(`{"command": "sh", "args": ["-c", "echo stdin: $(wc -c) >&2; exit 1"], "output": "catalog.yaml"}`),
+			},
+			files: map[string]string{},
+			buildAssertions: func(t *testing.T, dir string, buildErr error) {
+				require.Error(t, buildErr)
+				require.True(t, strings.HasSuffix(buildErr.Error(), "stderr:\nstdin: 0"), buildErr.Error())
+			},
+		},
+		{
+			name:     "command environment is restricted to the allow-list",
+			validate: false,
+			customBuilder: NewCustomBuilder(BuilderConfig{
+				WorkingDir: testDir,
+				OutputType: "yaml",
+			}),
+			templateDefinition: TemplateDefinition{
+				Schema: CustomBuilderSchema,
+				Config: []byte(`{
+					"command": "sh",
+					"args": ["-c", "echo $COMPOSITE_TEST_ALLOWED/$COMPOSITE_TEST_SECRET/$COMPOSITE_TEST_EXTRA/$OPM_COMPOSITE_OUTPUT_TYPE >&2; exit 1"],
+					"output": "catalog.yaml",
+					"env": {"allow": ["COMPOSITE_TEST_ALLOWED"], "set": {"COMPOSITE_TEST_EXTRA": "extra"}}
+				}`),
+			},
+			files: map[string]string{},
+			buildAssertions: func(t *testing.T, dir string, buildErr error) {
+				require.Error(t, buildErr)
+				require.True(t, strings.HasSuffix(buildErr.Error(), "stderr:\nallowed//extra/yaml"), buildErr.Error())
+			},
+		},
+		{
+			name:     "command exceeding its timeout is killed with its children",
+			validate: false,
+			customBuilder: NewCustomBuilder(BuilderConfig{
+				WorkingDir: testDir,
+				OutputType: "yaml",
+			}),
+			templateDefinition: TemplateDefinition{
+				Schema: CustomBuilderSchema,
+				Config: []byte(`{"command": "sh", "args": ["-c", "sleep 30 & sleep 30; wait"], "output": "catalog.yaml", "timeout": "200ms"}`),
+			},
+			files: map[string]string{},
+			buildAssertions: func(t *testing.T, dir string, buildErr error) {
+				require.Error(t, buildErr)
+				require.Contains(t, buildErr.Error(), "timed out after 200ms, killed after running for ")
+			},
+		},
+		{
+			name:     "invalid timeout and environment",
+			validate: false,
+			customBuilder: NewCustomBuilder(BuilderConfig{
+				WorkingDir: testDir,
+				OutputType: "yaml",
+			}),
+			templateDefinition: TemplateDefinition{
+				Schema: CustomBuilderSchema,
+				Config: []byte(`{"command": "ls", "output": "catalog.yaml", "timeout": "soon", "env": {"allow": ["A=B"]}}`),
+			},
+			files: map[string]string{},
+			buildAssertions: func(t *testing.T, dir string, buildErr error) {
+				require.EqualError(t, buildErr, "custom template configuration is invalid: custom template config must have a positive duration as timeout, got \"soon\" (templateDefinition.config.timeout),custom template config has an invalid environment variable name \"A=B\" (templateDefinition.config.env.allow)")
+			},
+		},
 	}
 
 	for i, tc := range testCases {
@@ -1571,7 +1554,13 @@ func TestCustomBuilder(t *testing.T) {
 			defer reg.Destroy()
 			require.NoError(t, err)
 
-			buildErr := tc.customBuilder.Build(context.Background(), reg, outDir, tc.templateDefinition)
+			ctx := context.Background()
+			if tc.componentInfo != nil {
+				ctx = ContextWithComponentInfo(ctx, *tc.componentInfo)
+			}
+			start := time.Now()
+			buildErr := tc.customBuilder.Build(ctx, reg, outDir, tc.templateDefinition)
+			require.Less(t, time.Since(start), 10*time.Second)
 			tc.buildAssertions(t, outPath, buildErr)
 
 			if tc.validate {
@@ -1582,6 +1571,12 @@ func TestCustomBuilder(t *testing.T) {
 	}
 }
 
+const unknownSchemaYaml = `---
+schema: olm.unknown
+package: webhook-operator
+name: mystery
+`
+
 const customYaml = `---
 defaultChannel: preview
 name: webhook-operator-413
@@ -1758,8 +1753,114 @@ const customBuiltFbcJson = `{
 }
 `
 
+func TestCustomBuilderSandbox(t *testing.T) {
+	// the sandbox check watches the current directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	root := t.TempDir()
+	require.NoError(t, os.Chdir(root))
+	defer func() { require.NoError(t, os.Chdir(wd)) }()
+	require.NoError(t, os.WriteFile("custom.yaml", []byte(customYaml), 0o666))
+	input := filepath.Join(root, "custom.yaml")
+
+	build := func(t *testing.T, script string, extraConfig string) (error, *bytes.Buffer) {
+		out := &bytes.Buffer{}
+		logger := logrus.New()
+		logger.SetOutput(out)
+		builder := NewCustomBuilder(BuilderConfig{
+			WorkingDir: "catalog",
+			OutputType: "yaml",
+			Log:        logrus.NewEntry(logger),
+		})
+		err := builder.Build(context.Background(), nil, "my-operator", TemplateDefinition{
+			Schema: CustomBuilderSchema,
+			Config: []byte(fmt.Sprintf(`{"command": "sh", "args": ["-c", %q], "output": "catalog.yaml", "workingDir": "scratch"%s}`, script, extraConfig)),
+		})
+		return err, out
+	}
+
+	t.Run("command runs in its working directory", func(t *testing.T) {
+		err, out := build(t, "touch generated.yaml && cat "+input, "")
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join("catalog", "scratch", "generated.yaml"))
+		require.FileExists(t, filepath.Join("catalog", "my-operator", "catalog.yaml"))
+		require.NotContains(t, out.String(), "wrote outside")
+	})
+
+	t.Run("writes outside the catalog working directory are reported", func(t *testing.T) {
+		err, out := build(t, "touch ../../outside.yaml && cat "+input, "")
+		require.NoError(t, err)
+		require.Contains(t, out.String(), `wrote outside the catalog working directory \"catalog\": [outside.yaml]`)
+	})
+
+	t.Run("strict sandbox fails the build", func(t *testing.T) {
+		script := "echo changed >> ../../custom.yaml && cat " + input
+		err, _ := build(t, script, `, "strictSandbox": true`)
+		cmd := exec.Command("sh", "-c", script)
+		require.EqualError(t, err, fmt.Sprintf("running command %q: wrote outside the catalog working directory \"catalog\": [custom.yaml]", cmd.String()))
+	})
+
+	t.Run("working directory must be within the catalog working directory", func(t *testing.T) {
+		err := NewCustomBuilder(BuilderConfig{WorkingDir: "catalog"}).Build(context.Background(), nil, "my-operator", TemplateDefinition{
+			Schema: CustomBuilderSchema,
+			Config: []byte(`{"command": "true", "output": "catalog.yaml", "workingDir": "../elsewhere"}`),
+		})
+		require.EqualError(t, err, "custom template configuration is invalid: custom template config must have a workingDir within the catalog working directory, got \"../elsewhere\" (templateDefinition.config.workingDir)")
+	})
+}
+
 func TestValidateFailure(t *testing.T) {
 	err := validate(context.Background(), BuilderConfig{}, "")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "no such file or directory")
 }
+
+func TestValidationLevels(t *testing.T) {
+	// a fragment of a package whose bundle foo.v0.1.0 is in another channel
+	// that is not part of it
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "catalog.yaml"), []byte(`---
+schema: olm.package
+name: foo
+defaultChannel: stable
+---
+schema: olm.channel
+package: foo
+name: stable
+entries:
+  - name: foo.v0.2.0
+---
+schema: olm.bundle
+package: foo
+name: foo.v0.1.0
+image: quay.io/some/foo:v0.1.0
+properties:
+  - type: olm.package
+    value:
+      packageName: foo
+      version: 0.1.0
+---
+schema: olm.bundle
+package: foo
+name: foo.v0.2.0
+image: quay.io/some/foo:v0.2.0
+properties:
+  - type: olm.package
+    value:
+      packageName: foo
+      version: 0.2.0
+`), 0o666))
+
+	err := validate(context.Background(), BuilderConfig{WorkingDir: dir}, "")
+	require.ErrorContains(t, err, fmt.Sprintf("validation failure in path %q", dir))
+	require.ErrorContains(t, err, "foo.v0.1.0")
+	err = validate(context.Background(), BuilderConfig{WorkingDir: dir, ValidationLevel: ValidationLevelModel}, "")
+	require.Error(t, err)
+	require.NoError(t, validate(context.Background(), BuilderConfig{WorkingDir: dir, ValidationLevel: ValidationLevelLoad}, ""))
+
+	level, err := ParseValidationLevel("")
+	require.NoError(t, err)
+	require.Equal(t, ValidationLevelModel, level)
+	_, err = ParseValidationLevel("strict")
+	require.EqualError(t, err, "invalid validation level \"strict\", expected one of [model load]")
+}
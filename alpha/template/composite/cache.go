@@ -0,0 +1,145 @@
+package composite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fetchCache stores remote configuration files on disk, keyed by URL, so that
+// unchanged files are not downloaded again.
+type fetchCache struct {
+	dir     string
+	ttl     time.Duration
+	refresh bool
+}
+
+// cacheEntry is a cached remote configuration file along with the validators
+// used to revalidate it.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+	Body         []byte    `json:"body"`
+}
+
+// WithFetchCache caches remote configuration files in dir. A cached file is
+// used without contacting the server for ttl after it was last fetched or
+// revalidated; after that it is revalidated with a conditional request.
+func WithFetchCache(dir string, ttl time.Duration) FetchOption {
+	return func(o *fetchOptions) {
+		if o.cache == nil {
+			o.cache = &fetchCache{}
+		}
+		o.cache.dir = dir
+		o.cache.ttl = ttl
+	}
+}
+
+// WithFetchCacheRefresh forces remote configuration files to be fetched
+// again, ignoring any cached copy. The fetched file still updates the cache.
+func WithFetchCacheRefresh(refresh bool) FetchOption {
+	return func(o *fetchOptions) {
+		if o.cache == nil {
+			o.cache = &fetchCache{}
+		}
+		o.cache.refresh = refresh
+	}
+}
+
+func newCacheEntry(url string, resp *http.Response, body []byte) *cacheEntry {
+	return &cacheEntry{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+		Body:         body,
+	}
+}
+
+func (e *cacheEntry) setConditionalHeaders(req *http.Request) {
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+func (e *cacheEntry) refreshed() *cacheEntry {
+	refreshed := *e
+	refreshed.FetchedAt = time.Now()
+	return &refreshed
+}
+
+func (c *fetchCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load returns the cached entry for url, or nil if there is none or the cache
+// is being refreshed. Corrupted entries are discarded.
+func (c *fetchCache) load(url string, log *logrus.Entry) *cacheEntry {
+	if c.dir == "" || c.refresh {
+		return nil
+	}
+	data, err := os.ReadFile(c.path(url))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("reading cached config for %q: %v", url, err)
+		}
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil || entry.URL != url || len(entry.Body) == 0 {
+		log.Warnf("discarding corrupted cached config for %q", url)
+		_ = os.Remove(c.path(url))
+		return nil
+	}
+	return entry
+}
+
+func (c *fetchCache) fresh(entry *cacheEntry) bool {
+	return c.ttl > 0 && time.Since(entry.FetchedAt) < c.ttl
+}
+
+// store writes entry to the cache. Failing to write the cache does not fail
+// the fetch.
+func (c *fetchCache) store(entry *cacheEntry, log *logrus.Entry) {
+	if c.dir == "" {
+		return
+	}
+	if err := c.write(entry); err != nil {
+		log.Warnf("caching config for %q: %v", entry.URL, err)
+	}
+}
+
+func (c *fetchCache) write(entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, "entry-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(entry.URL))
+}
@@ -0,0 +1,132 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+// WithCatalogValidation validates the working directory of each catalog as a
+// whole after all components are rendered, catching conflicts between
+// components that each validate on their own, such as two components
+// defining the same package.
+func WithCatalogValidation(validate bool) TemplateOption {
+	return func(t *Template) {
+		t.catalogValidation = validate
+	}
+}
+
+// validateCatalogs loads the working directory of every catalog that
+// components were rendered into as a single declarative config and validates
+// each of its packages with model validation. Errors name the components
+// whose destinations contribute to the invalid package.
+func (t *Template) validateCatalogs(ctx context.Context, catalogs map[string]Catalog, components []Component) error {
+	names := make([]string, 0, len(catalogs))
+	for name := range catalogs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		workingDir := catalogs[name].Destination.WorkingDir
+		if _, err := os.Stat(workingDir); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		t.logger().WithField("catalog", name).Info("validating catalog")
+		if err := validateCatalog(ctx, catalogs[name], components); err != nil {
+			errs = append(errs, fmt.Errorf("catalog %q failed validation: %w", name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func validateCatalog(ctx context.Context, catalog Catalog, components []Component) error {
+	workingDir := catalog.Destination.WorkingDir
+	dcfg, err := declcfg.LoadFS(ctx, os.DirFS(workingDir))
+	if err != nil {
+		return fmt.Errorf("loading %q: %v", workingDir, err)
+	}
+
+	// contributors are the components contributing to each package
+	contributors := map[string][]string{}
+	for _, component := range components {
+		if component.CatalogName() != catalog.Name || component.Destination.Path == StdoutPath {
+			continue
+		}
+		dest := filepath.Join(workingDir, component.Destination.Path)
+		if _, err := os.Stat(dest); err != nil {
+			continue
+		}
+		cdcfg, err := declcfg.LoadFS(ctx, os.DirFS(dest))
+		if err != nil {
+			return fmt.Errorf("loading destination of component %q: %v", component.Name, err)
+		}
+		for pkg := range packagesOf(cdcfg) {
+			contributors[pkg] = append(contributors[pkg], component.Name)
+		}
+	}
+
+	packages := packagesOf(dcfg)
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if _, err := declcfg.ConvertToModel(*packages[name]); err != nil {
+			if len(contributors[name]) > 0 {
+				errs = append(errs, fmt.Errorf("package %q, contributed by component(s) %s: %v", name, strings.Join(quoteAll(contributors[name]), ", "), err))
+			} else {
+				errs = append(errs, fmt.Errorf("package %q: %v", name, err))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// packagesOf splits dcfg by package. Objects that don't belong to a package
+// are omitted.
+func packagesOf(dcfg *declcfg.DeclarativeConfig) map[string]*declcfg.DeclarativeConfig {
+	packages := map[string]*declcfg.DeclarativeConfig{}
+	get := func(name string) *declcfg.DeclarativeConfig {
+		if _, ok := packages[name]; !ok {
+			packages[name] = &declcfg.DeclarativeConfig{}
+		}
+		return packages[name]
+	}
+	for _, p := range dcfg.Packages {
+		get(p.Name).Packages = append(get(p.Name).Packages, p)
+	}
+	for _, c := range dcfg.Channels {
+		get(c.Package).Channels = append(get(c.Package).Channels, c)
+	}
+	for _, b := range dcfg.Bundles {
+		get(b.Package).Bundles = append(get(b.Package).Bundles, b)
+	}
+	for _, o := range dcfg.Others {
+		if o.Package != "" {
+			get(o.Package).Others = append(get(o.Package).Others, o)
+		}
+	}
+	return packages
+}
+
+func quoteAll(values []string) []string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", v))
+	}
+	return quoted
+}
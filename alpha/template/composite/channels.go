@@ -0,0 +1,188 @@
+package composite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+// ChannelSummary describes a channel generated by a builder.
+type ChannelSummary struct {
+	Package string `json:"package"`
+	Name    string `json:"name"`
+	// Heads are the entries of the channel that no other entry replaces or
+	// skips. A well-formed channel has exactly one.
+	Heads []string `json:"heads"`
+	// Entries is the number of entries in the channel.
+	Entries int `json:"entries"`
+}
+
+// WithChannelGraphDir writes a mermaid graph of the channels generated by the
+// semver builder for each component to "<dir>/<component>.mmd". The graphs
+// are written outside of the catalogs, which may only contain FBC.
+func WithChannelGraphDir(dir string) TemplateOption {
+	return func(t *Template) {
+		t.channelGraphDir = dir
+	}
+}
+
+// buildRecord collects what a builder generated while building a component,
+// for the render report.
+type buildRecord struct {
+	channels     []ChannelSummary
+	graph        string
+	pinnedImages map[string]string
+	// migrationLevel is the migration level the builder rendered at, if it
+	// applies one
+	migrationLevel MigrationLevel
+	// skipPatch is whether the builder skipped patch versions, if it
+	// supports it
+	skipPatch *bool
+	// outputs are the files the builder wrote, relative to the directory
+	// it built the component in
+	outputs []string
+}
+
+type buildRecordKey struct{}
+
+func contextWithBuildRecord(ctx context.Context, record *buildRecord) context.Context {
+	return context.WithValue(ctx, buildRecordKey{}, record)
+}
+
+// recordBuild runs build with a context carrying a new build record, unless
+// ctx already carries one, and returns what was recorded.
+func recordBuild(ctx context.Context, build func(ctx context.Context) error) (*BuildResult, error) {
+	record, ok := ctx.Value(buildRecordKey{}).(*buildRecord)
+	if !ok {
+		record = &buildRecord{}
+		ctx = contextWithBuildRecord(ctx, record)
+	}
+	if err := build(ctx); err != nil {
+		return nil, err
+	}
+	return &BuildResult{
+		Files:          record.outputs,
+		Channels:       record.channels,
+		ChannelGraph:   record.graph,
+		PinnedImages:   record.pinnedImages,
+		MigrationLevel: record.migrationLevel,
+		SkipPatch:      record.skipPatch,
+	}, nil
+}
+
+// recordChannels records the channels of dcfg and their mermaid graph in the
+// build record carried by ctx, if any.
+func recordChannels(ctx context.Context, dcfg *declcfg.DeclarativeConfig) error {
+	record, ok := ctx.Value(buildRecordKey{}).(*buildRecord)
+	if !ok {
+		return nil
+	}
+	record.channels = channelSummaries(dcfg.Channels)
+
+	graph := &bytes.Buffer{}
+	if err := declcfg.NewMermaidWriter().WriteChannels(*dcfg, graph); err != nil {
+		return fmt.Errorf("generating channel graph: %v", err)
+	}
+	record.graph = graph.String()
+	return nil
+}
+
+// channelSummaries summarizes channels, ordered by package and channel name.
+func channelSummaries(channels []declcfg.Channel) []ChannelSummary {
+	summaries := []ChannelSummary{}
+	for _, channel := range channels {
+		replaced := map[string]bool{}
+		for _, entry := range channel.Entries {
+			if entry.Replaces != "" {
+				replaced[entry.Replaces] = true
+			}
+			for _, skip := range entry.Skips {
+				replaced[skip] = true
+			}
+		}
+		heads := []string{}
+		for _, entry := range channel.Entries {
+			if !replaced[entry.Name] {
+				heads = append(heads, entry.Name)
+			}
+		}
+		sort.Strings(heads)
+		summaries = append(summaries, ChannelSummary{
+			Package: channel.Package,
+			Name:    channel.Name,
+			Heads:   heads,
+			Entries: len(channel.Entries),
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Package != summaries[j].Package {
+			return summaries[i].Package < summaries[j].Package
+		}
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries
+}
+
+// writeGraphs writes a mermaid graph of the channels of each package of dcfg
+// next to its FBC when the output type is mermaid: to "<package>.mmd" in the
+// directory of output in the single-file layout, and to
+// "<package>/<package>.mmd" in the per-package layout. The graphs are
+// excluded from the catalog with an .indexignore file in dir.
+func (bc BuilderConfig) writeGraphs(ctx context.Context, dcfg *declcfg.DeclarativeConfig, dir string, output string) error {
+	if bc.OutputType != OutputTypeMermaid {
+		return nil
+	}
+	packages := packagesOf(dcfg)
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var written []string
+	for _, name := range names {
+		graph := &bytes.Buffer{}
+		if err := declcfg.NewMermaidWriter().WriteChannels(*packages[name], graph); err != nil {
+			return fmt.Errorf("generating channel graph of package %q: %v", name, err)
+		}
+		graphPath := path.Join(name, name+".mmd")
+		if bc.needsOutput() {
+			graphPath = path.Join(path.Dir(output), name+".mmd")
+		}
+		destPath := filepath.Join(bc.WorkingDir, dir, graphPath)
+		bc.logger().Debugf("writing %q", destPath)
+		if err := os.MkdirAll(path.Dir(destPath), 0o777); err != nil {
+			return fmt.Errorf("writing channel graph: %v", err)
+		}
+		if err := os.WriteFile(destPath, graph.Bytes(), 0o666); err != nil {
+			return fmt.Errorf("writing channel graph: %v", err)
+		}
+		written = append(written, graphPath)
+	}
+	if err := ensureIndexIgnored(filepath.Join(bc.WorkingDir, dir), "*.mmd"); err != nil {
+		return fmt.Errorf("updating %s: %v", indexIgnoreFileName, err)
+	}
+	if record, ok := ctx.Value(buildRecordKey{}).(*buildRecord); ok {
+		record.outputs = append(record.outputs, written...)
+	}
+	return nil
+}
+
+// writeChannelGraph writes the channel graph of a component to the channel
+// graph directory, returning the path of the file.
+func (t *Template) writeChannelGraph(component string, graph string) (string, error) {
+	if err := os.MkdirAll(t.channelGraphDir, 0o777); err != nil {
+		return "", fmt.Errorf("writing channel graph: %v", err)
+	}
+	p := filepath.Join(t.channelGraphDir, component+".mmd")
+	if err := os.WriteFile(p, []byte(graph), 0o666); err != nil {
+		return "", fmt.Errorf("writing channel graph: %v", err)
+	}
+	return p, nil
+}
@@ -1,17 +1,30 @@
 package composite
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
 	"github.com/operator-framework/operator-registry/pkg/image"
-	"k8s.io/apimachinery/pkg/util/yaml"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 type BuilderMap map[string]Builder
@@ -21,31 +34,184 @@ type CatalogBuilderMap map[string]BuilderMap
 type builderFunc func(BuilderConfig) Builder
 
 type Template struct {
-	catalogFile        io.Reader
-	contributionFile   io.Reader
-	validate           bool
-	outputType         string
-	registry           image.Registry
-	registeredBuilders map[string]builderFunc
+	catalogFiles         []namedReader
+	catalogObject        *CatalogConfig
+	contributionFiles    []namedReader
+	contributionObject   *CompositeConfig
+	contributionPatterns []string
+	validate             bool
+	failFast             bool
+	maxConcurrency       int
+	dryRun               bool
+	dryRunOutput         io.Writer
+	diff                 bool
+	diffOutput           io.Writer
+	componentFilter      []string
+	log                  *logrus.Entry
+	optionErrs           []error
+	allowedBuilders      map[string]bool
+	lenientParsing       bool
+	variables            map[string]string
+	renderValues         map[string]string
+	expandCatalogs       bool
+	resolvedVariables    map[string]string
+	atomicOutput         bool
+	componentTimeout     time.Duration
+	buildAttempts        int
+	incremental          bool
+	resume               bool
+	resumeProgress       map[string]*catalogProgress
+	workingDirRoot       string
+	requireBaseImage     bool
+	strictWorkingDirRoot bool
+	forceRebuild         bool
+	buildBackoff         time.Duration
+	preBuildHooks        []ComponentHook
+	postBuildHooks       []ComponentHook
+	summaryPath          string
+	strictUnused         bool
+	catalogs             parsedCatalogConfig
+	catalogSources       map[string]string
+	contributions        parsedCompositeConfig
+	inputGetter          HttpGetter
+	outputWriter         io.Writer
+	registryConfig       *CatalogRegistry
+	imageCacheDir        string
+	offline              bool
+	pruneStale           bool
+	forcePrune           bool
+	validationLevel      ValidationLevel
+	catalogValidation    bool
+	warnPackageConflicts bool
+	crossDeprecations    bool
+	outputLayout         OutputLayout
+	migrationLevel       MigrationLevel
+	sqliteDir            string
+	writeManifest        bool
+	progress             func(ProgressEvent)
+	instrumentation      Instrumentation
+	catalogMapKey        string
+	contributionMapKey   string
+	channelGraphDir      string
+	openSink             func(Catalog) (OutputSink, error)
+	sinks                map[string]OutputSink
+	outputType           OutputType
+	registry             image.Registry
+	registeredBuilders   map[string]builderFunc
+}
+
+// parsedCatalogConfig is the memoized outcome of parsing the catalog files.
+type parsedCatalogConfig struct {
+	parsed bool
+	config *CatalogConfig
+	err    error
+}
+
+// parsedCompositeConfig is the memoized outcome of parsing the contribution
+// files.
+type parsedCompositeConfig struct {
+	parsed bool
+	config *CompositeConfig
+	err    error
 }
 
 type TemplateOption func(t *Template)
 
+// WithCatalogFile adds a catalog configuration file to the Template.
+// It may be supplied multiple times; the catalogs of every file are merged.
 func WithCatalogFile(catalogFile io.Reader) TemplateOption {
 	return func(t *Template) {
-		t.catalogFile = catalogFile
+		t.catalogFiles = append(t.catalogFiles, namedReader{reader: catalogFile})
+	}
+}
+
+// WithNamedCatalogFile adds a catalog configuration file to the Template like
+// WithCatalogFile, identifying it in errors by name, such as the path or URL
+// it was read from.
+func WithNamedCatalogFile(name string, catalogFile io.Reader) TemplateOption {
+	return func(t *Template) {
+		t.catalogFiles = append(t.catalogFiles, namedReader{name: name, reader: catalogFile})
+	}
+}
+
+// WithCatalogFiles adds several catalog configuration files to the Template.
+// The catalogs of every file are merged in the order they are supplied.
+func WithCatalogFiles(catalogFiles ...io.Reader) TemplateOption {
+	return func(t *Template) {
+		for _, catalogFile := range catalogFiles {
+			t.catalogFiles = append(t.catalogFiles, namedReader{reader: catalogFile})
+		}
 	}
 }
 
+// WithContributionFile adds a composite configuration file to the Template.
+// It may be supplied multiple times; the components of every file are merged.
 func WithContributionFile(contribFile io.Reader) TemplateOption {
 	return func(t *Template) {
-		t.contributionFile = contribFile
+		t.contributionFiles = append(t.contributionFiles, namedReader{reader: contribFile})
+	}
+}
+
+// WithNamedContributionFile adds a composite configuration file to the
+// Template like WithContributionFile, identifying it in errors by name, such
+// as the path or URL it was read from.
+func WithNamedContributionFile(name string, contribFile io.Reader) TemplateOption {
+	return func(t *Template) {
+		t.contributionFiles = append(t.contributionFiles, namedReader{name: name, reader: contribFile})
+	}
+}
+
+// WithContributionFiles adds several composite configuration files to the
+// Template. The components of every file are merged into a single render.
+func WithContributionFiles(contribFiles ...io.Reader) TemplateOption {
+	return func(t *Template) {
+		for _, contribFile := range contribFiles {
+			t.contributionFiles = append(t.contributionFiles, namedReader{reader: contribFile})
+		}
+	}
+}
+
+// WithCatalogConfigObject sets the catalog configuration of the Template to
+// an already parsed catalog configuration, in place of catalog configuration
+// files. It is validated like a file would be. It must not be combined with
+// WithCatalogFile.
+func WithCatalogConfigObject(catalogConfig *CatalogConfig) TemplateOption {
+	return func(t *Template) {
+		t.catalogObject = catalogConfig
+	}
+}
+
+// WithContributionConfigObject sets the composite configuration of the
+// Template to an already parsed composite configuration, in place of
+// contribution files. It is validated like a file would be. It must not be
+// combined with WithContributionFile or WithContributionPattern.
+func WithContributionConfigObject(contributionConfig *CompositeConfig) TemplateOption {
+	return func(t *Template) {
+		t.contributionObject = contributionConfig
+	}
+}
+
+// WithContributionPattern adds every contribution file in a directory, or
+// matching a glob pattern, to the Template. Files are loaded in lexical order
+// after any files added with WithContributionFile; hidden files and files
+// without a .yaml, .yml or .json extension are skipped.
+func WithContributionPattern(pattern string) TemplateOption {
+	return func(t *Template) {
+		t.contributionPatterns = append(t.contributionPatterns, pattern)
 	}
 }
 
+// WithOutputType sets the format the rendered catalogs are written in, one of
+// "json", "yaml" or "mermaid". An empty outputType selects OutputTypeJSON;
+// unsupported values are reported when the Template is rendered.
 func WithOutputType(outputType string) TemplateOption {
 	return func(t *Template) {
-		t.outputType = outputType
+		output, err := ParseOutputType(outputType)
+		if err != nil {
+			t.optionErrs = append(t.optionErrs, err)
+			return
+		}
+		t.outputType = output
 	}
 }
 
@@ -61,8 +227,285 @@ func WithValidate(validate bool) TemplateOption {
 	}
 }
 
+// WithValidationLevel sets how thoroughly builders validate the components
+// they render, one of "model" or "load". An empty level selects "model";
+// unsupported values are reported when the Template is rendered.
+func WithValidationLevel(level string) TemplateOption {
+	return func(t *Template) {
+		validationLevel, err := ParseValidationLevel(level)
+		if err != nil {
+			t.optionErrs = append(t.optionErrs, err)
+			return
+		}
+		t.validationLevel = validationLevel
+	}
+}
+
+// WithFailFast configures the Template to stop rendering at the first
+// component that fails. By default all components are rendered and the
+// errors are aggregated.
+func WithFailFast(failFast bool) TemplateOption {
+	return func(t *Template) {
+		t.failFast = failFast
+	}
+}
+
+// WithMaxConcurrency sets the maximum number of components that are built
+// and validated concurrently. Values less than 1 are treated as 1.
+func WithMaxConcurrency(n int) TemplateOption {
+	return func(t *Template) {
+		t.maxConcurrency = n
+	}
+}
+
+// WithDryRun configures the Template to resolve every component against the
+// catalog configuration and print the resulting build plan instead of
+// building anything.
+func WithDryRun(dryRun bool) TemplateOption {
+	return func(t *Template) {
+		t.dryRun = dryRun
+	}
+}
+
+// WithDryRunOutput sets where the build plan is written in dry-run mode.
+// Defaults to os.Stdout.
+func WithDryRunOutput(w io.Writer) TemplateOption {
+	return func(t *Template) {
+		t.dryRunOutput = w
+	}
+}
+
+// WithWorkingDirRoot resolves every catalog working directory under root,
+// which is created if needed, so that a shared catalog configuration can be
+// rendered into a scratch directory. Absolute working directories are rebased
+// under root, or rejected if strict is set.
+func WithWorkingDirRoot(root string, strict bool) TemplateOption {
+	return func(t *Template) {
+		t.workingDirRoot = root
+		t.strictWorkingDirRoot = strict
+	}
+}
+
+// WithRequireBaseImage rejects catalogs without a destination.baseImage.
+// A baseImage that is set must always be a valid image reference.
+func WithRequireBaseImage(require bool) TemplateOption {
+	return func(t *Template) {
+		t.requireBaseImage = require
+	}
+}
+
+// WithDiff configures the Template to build every component into a staging
+// directory and print a unified diff against its current destination instead
+// of replacing it. RenderReport.Changed reports whether any differences were
+// found. Incremental builds are disabled in diff mode.
+func WithDiff(diff bool) TemplateOption {
+	return func(t *Template) {
+		t.diff = diff
+	}
+}
+
+// WithDiffOutput sets where the diff is written in diff mode. Defaults to
+// os.Stdout.
+func WithDiffOutput(w io.Writer) TemplateOption {
+	return func(t *Template) {
+		t.diffOutput = w
+	}
+}
+
+// WithComponentFilter restricts Render to the components with the given names.
+// An empty filter renders every component.
+func WithComponentFilter(names ...string) TemplateOption {
+	return func(t *Template) {
+		t.componentFilter = names
+	}
+}
+
+// WithLogger sets the logger used to report rendering progress. The logger is
+// also handed to every builder through BuilderConfig.Log.
+func WithLogger(log *logrus.Entry) TemplateOption {
+	return func(t *Template) {
+		t.log = log
+	}
+}
+
+// WithRegisteredBuilder registers a builder for the given template schema so
+// that it can be referenced from a catalog's builders and a component's
+// strategy.template.schema. Registering a schema that is already registered
+// is an error reported by Render unless override is true, in which case the
+// existing builder is replaced.
+func WithRegisteredBuilder(schema string, fn func(BuilderConfig) Builder, override bool) TemplateOption {
+	return func(t *Template) {
+		if _, ok := t.registeredBuilders[schema]; ok && !override {
+			t.optionErrs = append(t.optionErrs, fmt.Errorf("registering builder: schema %q is already registered", schema))
+			return
+		}
+		if t.registeredBuilders == nil {
+			t.registeredBuilders = map[string]builderFunc{}
+		}
+		t.registeredBuilders[schema] = fn
+	}
+}
+
+// WithAllowedBuilders restricts the Template to the builders registered for the
+// given schemas. Catalogs that request any other registered builder are
+// rejected. By default every registered builder is allowed.
+func WithAllowedBuilders(schemas ...string) TemplateOption {
+	return func(t *Template) {
+		t.allowedBuilders = map[string]bool{}
+		for _, schema := range schemas {
+			t.allowedBuilders[schema] = true
+		}
+	}
+}
+
+// WithLenientParsing configures the Template to ignore unknown fields in the
+// catalog and composite configuration files instead of rejecting them.
+func WithLenientParsing(lenient bool) TemplateOption {
+	return func(t *Template) {
+		t.lenientParsing = lenient
+	}
+}
+
+// WithVariableExpansion expands ${NAME} references in the contribution files
+// before they are parsed, using vars or, for variables not in vars, the
+// environment. A literal $ is written as $$. Undefined variables are an error
+// unless parsing is lenient. The resolved values are recorded in the render
+// report.
+func WithVariableExpansion(vars map[string]string) TemplateOption {
+	return func(t *Template) {
+		t.variables = map[string]string{}
+		for name, value := range vars {
+			t.variables[name] = value
+		}
+	}
+}
+
+// WithCatalogVariableExpansion also expands variables in the catalog
+// configuration files. It only has an effect together with
+// WithVariableExpansion.
+func WithCatalogVariableExpansion(expand bool) TemplateOption {
+	return func(t *Template) {
+		t.expandCatalogs = expand
+	}
+}
+
+// WithAtomicOutput configures whether each component is built and validated
+// in a staging directory under its catalog's working directory, which then
+// replaces the destination only if both succeed. When a component fails, its
+// staging directory is removed and the existing destination is left
+// untouched. Atomic output is enabled by default.
+func WithAtomicOutput(atomic bool) TemplateOption {
+	return func(t *Template) {
+		t.atomicOutput = atomic
+	}
+}
+
+// WithComponentTimeout limits the time spent building and validating each
+// component. A component that exceeds it fails with a timeout error; unless
+// fail-fast is enabled the remaining components are still rendered. A zero
+// timeout, the default, disables the limit.
+func WithComponentTimeout(timeout time.Duration) TemplateOption {
+	return func(t *Template) {
+		t.componentTimeout = timeout
+	}
+}
+
+// WithBuildRetries retries failed component builds, e.g. due to registry
+// throttling, up to a total of attempts builds per component. The delay
+// before the first retry is backoff, doubling for each subsequent retry.
+// Successfully built components are never rebuilt. Values of attempts less
+// than 1 are treated as 1, which disables retries.
+func WithBuildRetries(attempts int, backoff time.Duration) TemplateOption {
+	return func(t *Template) {
+		t.buildAttempts = attempts
+		t.buildBackoff = backoff
+	}
+}
+
+// WithIncrementalBuild skips building components whose builder schema,
+// builder config and output type are unchanged since they were last built
+// into an existing destination. The inputs are tracked in a state file under
+// each destination. Changes to files referenced by a builder config, e.g. its
+// input, are not detected; use WithForceRebuild to rebuild regardless.
+// Skipped components are still validated when validation is requested.
+func WithIncrementalBuild(incremental bool) TemplateOption {
+	return func(t *Template) {
+		t.incremental = incremental
+	}
+}
+
+// WithForceRebuild builds every component even if WithIncrementalBuild
+// considers it up to date or WithResume finds it was built by the previous
+// render. The recorded state is still updated.
+func WithForceRebuild(force bool) TemplateOption {
+	return func(t *Template) {
+		t.forceRebuild = force
+	}
+}
+
+// ComponentHook is run by the Template before or after a component is built.
+// The report describes the component; for post-build hooks it also lists the
+// files that were written.
+type ComponentHook func(ctx context.Context, c ComponentReport) error
+
+// WithPreBuildHook adds a hook that is run before each component is built,
+// or found up to date by an incremental build. A hook returning an error
+// vetoes the component, which fails with that error without being built.
+// Hooks are run in the order they are added, and are not run in dry-run mode.
+func WithPreBuildHook(hook ComponentHook) TemplateOption {
+	return func(t *Template) {
+		t.preBuildHooks = append(t.preBuildHooks, hook)
+	}
+}
+
+// WithPostBuildHook adds a hook that is run after each component is built,
+// and validated if validation is requested, and its destination has been
+// updated. A hook returning an error fails the component. Hooks are run in the
+// order they are added, and are not run for components that were not built,
+// i.e. in dry-run or diff mode or when an incremental build skipped them.
+func WithPostBuildHook(hook ComponentHook) TemplateOption {
+	return func(t *Template) {
+		t.postBuildHooks = append(t.postBuildHooks, hook)
+	}
+}
+
+// WithContributionFetcher configures the Template to fetch template inputs
+// referenced by URL in component strategies using getter. Local paths are
+// still read from the filesystem.
+func WithContributionFetcher(getter HttpGetter) TemplateOption {
+	return func(t *Template) {
+		t.inputGetter = getter
+	}
+}
+
+// WithOfflineMode forbids network access while rendering. Builders may only
+// pull images that are already in the registry's local cache, template inputs
+// referenced by http or https URL can only be served from the fetch cache and
+// image digests can't be resolved. Use WithOfflineFetch to fetch the
+// configuration files offline too.
+func WithOfflineMode(offline bool) TemplateOption {
+	return func(t *Template) {
+		t.offline = offline
+	}
+}
+
+// WithOutputWriter streams the rendered FBC of every component built by a
+// builder that supports streaming, such as the basic template builder, to w
+// instead of writing it to the component's destination. Components are
+// written whole, one at a time, so YAML output is a stream of documents and
+// JSON output a stream of objects.
+func WithOutputWriter(w io.Writer) TemplateOption {
+	return func(t *Template) {
+		t.outputWriter = &syncWriter{w: w}
+	}
+}
+
 func NewTemplate(opts ...TemplateOption) *Template {
 	temp := &Template{
+		maxConcurrency: 1,
+		atomicOutput:   true,
+		outputType:     OutputTypeJSON,
+		log:            nullLogger(),
 		// Default registered builders when creating a new Template
 		registeredBuilders: map[string]builderFunc{
 			BasicBuilderSchema:  func(bc BuilderConfig) Builder { return NewBasicBuilder(bc) },
@@ -79,190 +522,1632 @@ func NewTemplate(opts ...TemplateOption) *Template {
 	return temp
 }
 
+// HttpGetter executes HTTP requests on behalf of FetchCatalogConfig and
+// FetchContributionConfig. *http.Client satisfies this interface.
 type HttpGetter interface {
-	Get(url string) (*http.Response, error)
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// FetchOption configures how configuration files are retrieved.
+type FetchOption func(*fetchOptions)
+
+type fetchOptions struct {
+	log            *logrus.Entry
+	maxSize        int64
+	cache          *fetchCache
+	stdin          io.Reader
+	expectedDigest string
+	registry       image.Registry
+	offline        bool
+	progress       func(ProgressEvent)
+	metrics        Instrumentation
+}
+
+// WithFetchLogger sets the logger used to report configuration fetches.
+func WithFetchLogger(log *logrus.Entry) FetchOption {
+	return func(o *fetchOptions) {
+		o.log = log
+	}
+}
+
+// WithMaxConfigSize sets the maximum size in bytes of a remote configuration
+// file, which defaults to 4MiB. A value of 0 removes the limit.
+func WithMaxConfigSize(maxSize int64) FetchOption {
+	return func(o *fetchOptions) {
+		o.maxSize = maxSize
+	}
+}
+
+// WithStdin sets the reader used for the path "-", which defaults to
+// os.Stdin.
+func WithStdin(stdin io.Reader) FetchOption {
+	return func(o *fetchOptions) {
+		o.stdin = stdin
+	}
 }
 
+// WithFetchRegistry sets the registry used to pull configuration files
+// referenced as oci://<image reference>.
+func WithFetchRegistry(reg image.Registry) FetchOption {
+	return func(o *fetchOptions) {
+		o.registry = reg
+	}
+}
+
+// WithOfflineFetch rejects configuration files referenced by http or https
+// URL unless they are in the fetch cache, in which case the cached copy is
+// used however old it is, and only reads oci:// artifacts that are already in
+// the registry's local cache.
+func WithOfflineFetch(offline bool) FetchOption {
+	return func(o *fetchOptions) {
+		o.offline = offline
+	}
+}
+
+// WithExpectedDigest verifies that the fetched file, local or remote, has the
+// given digest, e.g. "sha256:<hex>".
+func WithExpectedDigest(expected string) FetchOption {
+	return func(o *fetchOptions) {
+		o.expectedDigest = expected
+	}
+}
+
+// StdinPath is the path used to read a configuration file from stdin.
+const StdinPath = "-"
+
+// StdoutPath is the destination path of a component whose rendered FBC is
+// streamed to the Template's output writer, or to stdout if it has none.
+// Only builders that support streaming accept it.
+const StdoutPath = "-"
+
 // FetchCatalogConfig will fetch the catalog configuration file from the given path.
-// The path can be a local file path OR a URL that returns the raw contents of the catalog
-// configuration file.
+// The path can be a local file path, a URL that returns the raw contents of the catalog
+// configuration file, an oci:// reference to an artifact containing the file, OR "-"
+// to read the file from stdin.
 // The filepath can be structured relative or as an absolute path
-func FetchCatalogConfig(path string, httpGetter HttpGetter) (io.ReadCloser, error) {
-	var tempCatalog io.ReadCloser
-	catalogURI, err := url.ParseRequestURI(path)
-	// Evalute local catalog config
-	// URI parse will fail on relative filepaths
-	// Check if path is an absolute filepath
-	if err != nil || filepath.IsAbs(path) {
-		tempCatalog, err = os.Open(path)
+func FetchCatalogConfig(ctx context.Context, path string, httpGetter HttpGetter, opts ...FetchOption) (io.ReadCloser, error) {
+	return fetchConfig(ctx, "catalog", path, httpGetter, opts...)
+}
+
+// FetchContributionConfig will fetch a contribution file, or a template input
+// referenced by one, from the given path. Paths are resolved in the same way
+// as FetchCatalogConfig.
+func FetchContributionConfig(ctx context.Context, path string, httpGetter HttpGetter, opts ...FetchOption) (io.ReadCloser, error) {
+	return fetchConfig(ctx, "contribution", path, httpGetter, opts...)
+}
+
+func fetchConfig(ctx context.Context, kind string, path string, httpGetter HttpGetter, opts ...FetchOption) (rc io.ReadCloser, err error) {
+	options := fetchOptions{
+		log:     nullLogger(),
+		maxSize: defaultMaxConfigSize,
+		stdin:   os.Stdin,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.metrics != nil {
+		start := time.Now()
+		defer func() {
+			options.metrics.ConfigFetched(kind, configSource(path), time.Since(start), err)
+		}()
+	}
+
+	var expectedDigest digest.Digest
+	if options.expectedDigest != "" {
+		var err error
+		expectedDigest, err = digest.Parse(options.expectedDigest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expected digest %q for %s config file %q: %v", options.expectedDigest, kind, path, err)
+		}
+	}
+
+	var (
+		tempConfig io.ReadCloser
+		size       int64
+	)
+	localPath, local := localConfigPath(path)
+	if path == StdinPath {
+		options.log.Debugf("reading %s config from stdin", kind)
+		tempConfig = io.NopCloser(options.stdin)
+	} else if strings.HasPrefix(path, ociScheme) {
+		// Evaluate config published as an OCI artifact
+		if options.offline && options.registry != nil {
+			options.registry = &offlineRegistry{reg: options.registry}
+		}
+		tempConfig, err = fetchOCIConfig(ctx, options, kind, strings.TrimPrefix(path, ociScheme))
+		if err != nil {
+			return nil, err
+		}
+	} else if local {
+		// Evalute local config, including Windows paths that would otherwise
+		// parse as URLs with a drive letter scheme
+		options.log.Debugf("opening local %s config file %q", kind, localPath)
+		tempConfig, err = os.Open(localPath)
 		if err != nil {
-			return nil, fmt.Errorf("opening catalog config file %q: %v", path, err)
+			return nil, fmt.Errorf("opening %s config file %q: %v", kind, path, err)
+		}
+		if info, err := os.Stat(localPath); err == nil {
+			size = info.Size()
 		}
+	} else if configURI, _ := url.ParseRequestURI(path); configURI.Scheme != "http" && configURI.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q for %s config file %q, expected a local path or an http, https, file or oci URL", configURI.Scheme, kind, path)
 	} else {
-		// Evalute remote catalog config
+		// Evalute remote config
 		// If URi is valid, execute fetch
-		tempResp, err := httpGetter.Get(catalogURI.String())
+		data, err := fetchRemote(ctx, kind, configURI.String(), httpGetter, options)
 		if err != nil {
-			return nil, fmt.Errorf("fetching remote catalog config file %q: %v", path, err)
+			return nil, fmt.Errorf("fetching remote %s config file %q: %w", kind, path, err)
 		}
-		tempCatalog = tempResp.Body
+		tempConfig = io.NopCloser(bytes.NewReader(data))
+		size = int64(len(data))
+	}
+	if options.progress != nil {
+		options.progress(ProgressEvent{Phase: ProgressConfigFetched, Time: time.Now(), Config: path, Bytes: size})
 	}
 
-	return tempCatalog, nil
+	if expectedDigest != "" {
+		return verifyDigest(tempConfig, expectedDigest, kind, path)
+	}
+	return tempConfig, nil
 }
 
-// TODO(everettraven): do we need the context here? If so, how should it be used?
-func (t *Template) Render(ctx context.Context, validate bool) error {
+const ociScheme = "oci://"
 
-	catalogFile, err := t.parseCatalogsSpec()
-	if err != nil {
-		return err
+// fetchOCIConfig pulls the artifact ref and returns the single file contained
+// in its layers.
+func fetchOCIConfig(ctx context.Context, options fetchOptions, kind string, ref string) (io.ReadCloser, error) {
+	if options.registry == nil {
+		return nil, fmt.Errorf("fetching %s config artifact %q: no registry configured", kind, ref)
 	}
 
-	contributionFile, err := t.parseContributionSpec()
-	if err != nil {
-		return err
+	options.log.Infof("pulling %s config artifact %q", kind, ref)
+	if err := options.registry.Pull(ctx, image.SimpleReference(ref)); err != nil {
+		return nil, fmt.Errorf("pulling %s config artifact %q: %v", kind, ref, err)
 	}
 
-	catalogBuilderMap, err := t.newCatalogBuilderMap(catalogFile.Catalogs, t.outputType)
+	dir, err := os.MkdirTemp("", "composite-config-")
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer os.RemoveAll(dir)
 
-	// TODO(everettraven): should we return aggregated errors?
-	for _, component := range contributionFile.Components {
-		if builderMap, ok := (*catalogBuilderMap)[component.Name]; ok {
-			if builder, ok := builderMap[component.Strategy.Template.Schema]; ok {
-				// run the builder corresponding to the schema
-				err := builder.Build(ctx, t.registry, component.Destination.Path, component.Strategy.Template)
-				if err != nil {
-					return fmt.Errorf("building component %q: %w", component.Name, err)
-				}
+	if err := options.registry.Unpack(ctx, image.SimpleReference(ref), dir); err != nil {
+		return nil, fmt.Errorf("unpacking %s config artifact %q, its layer must be a tar archive containing the config file: %v", kind, ref, err)
+	}
 
-				if validate {
-					// run the validation for the builder
-					err = builder.Validate(ctx, component.Destination.Path)
-					if err != nil {
-						return fmt.Errorf("validating component %q: %w", component.Name, err)
-					}
-				}
-			} else {
-				return fmt.Errorf("building component %q: no builder found for template schema %q", component.Name, component.Strategy.Template.Schema)
-			}
-		} else {
-			allowedComponents := []string{}
-			for k := range *catalogBuilderMap {
-				allowedComponents = append(allowedComponents, k)
-			}
-			return fmt.Errorf("building component %q: component does not exist in the catalog configuration. Available components are: %s", component.Name, allowedComponents)
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s config artifact %q: %v", kind, ref, err)
+	}
+	if len(files) != 1 {
+		return nil, fmt.Errorf("%s config artifact %q must contain exactly one file, found %d", kind, ref, len(files))
 	}
-	return nil
-}
 
-func (t *Template) builderForSchema(schema string, builderCfg BuilderConfig) (Builder, error) {
-	builderFunc, ok := t.registeredBuilders[schema]
-	if !ok {
-		return nil, fmt.Errorf("unknown schema %q", schema)
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		return nil, fmt.Errorf("reading %s config artifact %q: %v", kind, ref, err)
 	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
 
-	return builderFunc(builderCfg), nil
+// verifyDigest reads and closes rc, returning its contents if they match the
+// expected digest.
+func verifyDigest(rc io.ReadCloser, expected digest.Digest, kind string, path string) (io.ReadCloser, error) {
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s config file %q: %v", kind, path, err)
+	}
+	if actual := expected.Algorithm().FromBytes(data); actual != expected {
+		return nil, fmt.Errorf("%s config file %q does not match the expected digest: expected %s, got %s", kind, path, expected, actual)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
 }
 
-func (t *Template) parseCatalogsSpec() (*CatalogConfig, error) {
+// maxErrorBodySize is the number of bytes of an unsuccessful response body
+// included in the returned error.
+const maxErrorBodySize = 512
 
-	// get catalog configurations
-	catalogConfig := &CatalogConfig{}
-	catalogDoc := json.RawMessage{}
-	catalogDecoder := yaml.NewYAMLOrJSONDecoder(t.catalogFile, 4096)
-	err := catalogDecoder.Decode(&catalogDoc)
+// defaultMaxConfigSize is the default maximum size of a remote configuration
+// file.
+const defaultMaxConfigSize = 4 << 20
+
+// fetchRemote fetches the contents of the remote config at rawURL, serving
+// them from the fetch cache when one is configured and the cached copy is
+// still valid.
+func fetchRemote(ctx context.Context, kind string, rawURL string, httpGetter HttpGetter, options fetchOptions) ([]byte, error) {
+	var entry *cacheEntry
+	if options.cache != nil {
+		entry = options.cache.load(rawURL, options.log)
+		if entry != nil && (options.offline || options.cache.fresh(entry)) {
+			options.log.Debugf("using cached %s config file %q", kind, rawURL)
+			return entry.Body, nil
+		}
+	}
+	if options.offline {
+		return nil, errors.New("offline mode: not in the fetch cache")
+	}
+
+	options.log.Infof("fetching remote %s config file %q", kind, rawURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("decoding catalog config: %v", err)
+		return nil, err
+	}
+	if entry != nil {
+		entry.setConditionalHeaders(req)
 	}
-	err = json.Unmarshal(catalogDoc, catalogConfig)
+	resp, err := httpGetter.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshalling catalog config: %v", err)
+		return nil, err
 	}
 
-	if catalogConfig.Schema != CatalogSchema {
-		return nil, fmt.Errorf("catalog configuration file has unknown schema, should be %q", CatalogSchema)
+	if entry != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		options.log.Debugf("remote %s config file %q is not modified, using cached copy", kind, rawURL)
+		options.cache.store(entry.refreshed(), options.log)
+		return entry.Body, nil
 	}
 
-	return catalogConfig, nil
+	data, err := readResponse(resp, kind, rawURL, options)
+	if err != nil {
+		return nil, err
+	}
+	if options.cache != nil {
+		options.cache.store(newCacheEntry(rawURL, resp, data), options.log)
+	}
+	return data, nil
 }
 
-func (t *Template) parseContributionSpec() (*CompositeConfig, error) {
+// readResponse reads the body of a successful response, rejecting
+// unsuccessful, empty and oversized responses. The body is always closed.
+func readResponse(resp *http.Response, kind string, path string, options fetchOptions) ([]byte, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return nil, fmt.Errorf("unexpected status %d %s: %s", resp.StatusCode, http.StatusText(resp.StatusCode), strings.TrimSpace(string(body)))
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, fmt.Errorf("remote %s config was empty", kind)
+	}
 
-	// parse data to composite config
-	compositeConfig := &CompositeConfig{}
-	compositeDoc := json.RawMessage{}
-	compositeDecoder := yaml.NewYAMLOrJSONDecoder(t.contributionFile, 4096)
-	err := compositeDecoder.Decode(&compositeDoc)
-	if err != nil {
-		return nil, fmt.Errorf("decoding composite config: %v", err)
+	sizeErr := fmt.Errorf("remote %s config exceeds the maximum size of %d bytes", kind, options.maxSize)
+	body := resp.Body
+	if options.maxSize > 0 {
+		if resp.ContentLength > options.maxSize {
+			return nil, sizeErr
+		}
+		body = io.NopCloser(io.LimitReader(resp.Body, options.maxSize+1))
 	}
-	err = json.Unmarshal(compositeDoc, compositeConfig)
+	data, err := io.ReadAll(body)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshalling composite config: %v", err)
+		return nil, err
+	}
+	if options.maxSize > 0 && int64(len(data)) > options.maxSize {
+		return nil, sizeErr
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("remote %s config was empty", kind)
 	}
 
-	if compositeConfig.Schema != CompositeSchema {
-		return nil, fmt.Errorf("composite configuration file has unknown schema, should be %q", CompositeSchema)
+	if contentType, ok := unexpectedContentType(resp.Header.Get("Content-Type"), data); ok {
+		options.log.Warnf("remote %s config file %q has content type %q, which does not look like YAML or JSON", kind, path, contentType)
 	}
 
-	return compositeConfig, nil
+	return data, nil
 }
 
-func (t *Template) newCatalogBuilderMap(catalogs []Catalog, outputType string) (*CatalogBuilderMap, error) {
-
-	catalogBuilderMap := make(CatalogBuilderMap)
+// unexpectedContentType reports whether a response is clearly not a YAML or
+// JSON document, based on its Content-Type header and its contents.
+func unexpectedContentType(header string, data []byte) (string, bool) {
+	if mediaType, _, err := mime.ParseMediaType(header); err == nil && mediaType == "text/html" {
+		return mediaType, true
+	}
+	detected := http.DetectContentType(data)
+	if !strings.HasPrefix(detected, "text/plain") {
+		return detected, true
+	}
+	return "", false
+}
 
-	// setup the builders for each catalog
-	setupFailed := false
-	setupErrors := map[string][]string{}
-	for _, catalog := range catalogs {
-		errs := []string{}
-		// if catalog.Destination.BaseImage == "" {
-		// 	errs = append(errs, "destination.baseImage must not be an empty string")
-		// }
+// Render builds every component in the contribution file using the builders
+// configured for its catalog. Cancelling ctx stops any further components from
+// being started; the returned error identifies the component at which the
+// cancellation was observed.
+func (t *Template) Render(ctx context.Context, validate bool) error {
+	_, err := t.RenderWithReport(ctx, validate)
+	return err
+}
 
-		if catalog.Destination.WorkingDir == "" {
-			errs = append(errs, "destination.workingDir must not be an empty string")
+// RenderWithReport behaves like Render but also returns a report describing
+// each component that was rendered. The report is returned even when some
+// components fail to render.
+func (t *Template) RenderWithReport(ctx context.Context, validate bool) (*RenderReport, error) {
+	report, err := t.render(ctx, validate, t.renderMode())
+	if t.summaryPath != "" {
+		if summaryErr := t.writeSummary(report, validate, err); summaryErr != nil {
+			return report, utilerrors.NewAggregate([]error{err, summaryErr})
 		}
+	}
+	return report, err
+}
 
-		// check for validation errors and skip builder creation if there are any errors
-		if len(errs) > 0 {
-			setupFailed = true
-			setupErrors[catalog.Name] = errs
+// Lint checks the catalog and contribution configurations, including the
+// template configuration of every component, like Render does before building
+// anything, but builds and writes nothing. The report lists the components
+// that fail the checks.
+func (t *Template) Lint(ctx context.Context) (*RenderReport, error) {
+	return t.render(ctx, false, renderModeLint)
+}
+
+// Validate runs the validation of every component against its existing
+// destination without building anything. Failures, including missing
+// destinations, are aggregated across all components.
+func (t *Template) Validate(ctx context.Context) error {
+	_, err := t.render(ctx, true, renderModeValidate)
+	return err
+}
+
+// RenderToConfig builds every component in memory, without writing anything,
+// and returns the rendered FBC of each catalog by catalog name. The FBC of
+// the components of a catalog is merged in the order they are defined in the
+// contribution files. Every component must be built by a ConfigBuilder, and
+// is validated with model validation when the Template is configured
+// WithValidate, unless the validation level is ValidationLevelLoad.
+func (t *Template) RenderToConfig(ctx context.Context) (map[string]*declcfg.DeclarativeConfig, error) {
+	report, err := t.render(ctx, t.validate, renderModeInMemory)
+	if err != nil {
+		return nil, err
+	}
+	configs := map[string]*declcfg.DeclarativeConfig{}
+	for _, component := range report.Components {
+		if component.Disabled {
 			continue
 		}
-
-		if _, ok := catalogBuilderMap[catalog.Name]; !ok {
-			builderMap := make(BuilderMap)
-			for _, schema := range catalog.Builders {
-				builder, err := t.builderForSchema(schema, BuilderConfig{
-					OutputType: outputType,
-				})
-				if err != nil {
-					return nil, fmt.Errorf("getting builder %q for catalog %q: %v", schema, catalog.Name, err)
-				}
-				builderMap[schema] = builder
-			}
-			catalogBuilderMap[catalog.Name] = builderMap
+		cfg, ok := configs[component.Catalog]
+		if !ok {
+			cfg = &declcfg.DeclarativeConfig{}
+			configs[component.Catalog] = cfg
 		}
+		cfg.Packages = append(cfg.Packages, component.config.Packages...)
+		cfg.Channels = append(cfg.Channels, component.config.Channels...)
+		cfg.Bundles = append(cfg.Bundles, component.config.Bundles...)
+		cfg.Others = append(cfg.Others, component.config.Others...)
 	}
+	return configs, nil
+}
 
-	// if there were errors validating the catalog configuration then exit
-	if setupFailed {
-		//build the error message
-		var errMsg string
-		for cat, errs := range setupErrors {
-			errMsg += fmt.Sprintf("\nCatalog %v:\n", cat)
-			for _, err := range errs {
-				errMsg += fmt.Sprintf("  - %v\n", err)
+// render renders the components selected by the component filter in the
+// given mode.
+func (t *Template) render(ctx context.Context, validate bool, mode renderMode) (*RenderReport, error) {
+	start := time.Now()
+	t.instrument().RenderStarted()
+	report, err := t.renderCatalogs(ctx, validate, mode)
+	if err == nil && t.sinks != nil {
+		err = t.closeSinks()
+	}
+	t.sinks = nil
+	t.resumeProgress = nil
+	t.instrument().RenderFinished(time.Since(start), err)
+	return report, err
+}
+
+// renderCatalogs does the work of render, which reports its outcome to the
+// instrumentation.
+func (t *Template) renderCatalogs(ctx context.Context, validate bool, mode renderMode) (*RenderReport, error) {
+	report := &RenderReport{Offline: t.offline}
+
+	if len(t.optionErrs) > 0 {
+		return report, utilerrors.NewAggregate(t.optionErrs)
+	}
+	if t.sqliteDir != "" && t.outputLayout == OutputLayoutPerPackage {
+		return report, fmt.Errorf("sqlite output can't be combined with the %s output layout", OutputLayoutPerPackage)
+	}
+	if t.outputType == "" {
+		t.outputType = OutputTypeJSON
+	}
+
+	var catalogFile *CatalogConfig
+	if len(t.catalogFiles) > 0 || t.catalogObject != nil {
+		t.logger().Debug("parsing catalog configuration")
+		var err error
+		catalogFile, err = t.parsedCatalogs()
+		if err != nil {
+			return report, err
+		}
+	}
+
+	t.logger().Debug("parsing contribution configuration")
+	contributionFile, err := t.parsedContributions()
+	if err != nil {
+		return report, err
+	}
+	report.Variables = t.resolvedVariables
+
+	catalogFile, err = t.resolveCatalogs(catalogFile, contributionFile)
+	if err != nil {
+		return report, err
+	}
+
+	catalogs, err := t.relocateCatalogs(catalogFile.Catalogs)
+	if err != nil {
+		return report, err
+	}
+	if t.workingDirRoot != "" && mode.builds() {
+		if err := os.MkdirAll(t.workingDirRoot, 0o777); err != nil {
+			return report, fmt.Errorf("creating working directory root %q: %v", t.workingDirRoot, err)
+		}
+	}
+
+	if t.openSink != nil && mode.builds() {
+		if t.sinks, err = t.openSinks(catalogs); err != nil {
+			return report, err
+		}
+	}
+
+	catalogBuilderMap, err := t.newCatalogBuilderMap(catalogs, t.outputType)
+	if err != nil {
+		return report, err
+	}
+
+	allComponents := applyCatalogDefaults(catalogs, contributionFile.Components)
+	components, err := t.filterComponents(allComponents)
+	if err != nil {
+		return report, err
+	}
+
+	in := &renderInput{
+		catalogs:       map[string]Catalog{},
+		builders:       *catalogBuilderMap,
+		outputBuilders: map[OutputType]CatalogBuilderMap{},
+		validate:       validate,
+		mode:           mode,
+	}
+	for _, component := range components {
+		output := t.componentOutputType(component)
+		if _, ok := in.outputBuilders[output]; ok || output == t.outputType {
+			continue
+		}
+		builders, err := t.newCatalogBuilderMap(catalogs, output)
+		if err != nil {
+			return report, err
+		}
+		in.outputBuilders[output] = *builders
+	}
+	for _, catalog := range catalogs {
+		in.catalogs[catalog.Name] = catalog
+	}
+
+	if err := validateDestinations(in.catalogs, components); err != nil {
+		return report, err
+	}
+	if t.resume && mode == renderModeWrite {
+		t.resumeProgress = loadResumeProgress(in.catalogs)
+	}
+	if in.order, err = buildOrder(components); err != nil {
+		return report, err
+	}
+	if in.disabled, err = t.disabledComponents(components); err != nil {
+		return report, err
+	}
+	if report.Components, err = t.preflight(in, components); err != nil || mode == renderModeLint {
+		return report, err
+	}
+
+	if mode == renderModeDryRun {
+		enabled := []Component{}
+		for _, component := range components {
+			if !in.disabled[component.Name] {
+				enabled = append(enabled, component)
+			}
+		}
+		if err := t.writeBuildPlan(in, enabled); err != nil || !t.pruneStale {
+			return report, err
+		}
+		report.Pruned, err = t.pruneStaleOutputs(in.catalogs, allComponents, nil, true)
+		if err != nil {
+			return report, err
+		}
+		return report, t.writePrunePlan(report.Pruned)
+	}
+
+	t.logger().Infof("rendering %d component(s)", len(components))
+	report.Components, err = t.renderComponents(ctx, in, components)
+	if err == nil {
+		report.PackageConflicts = packageConflicts(in.catalogs, report.Components)
+		var conflictErrs []error
+		for _, conflict := range report.PackageConflicts {
+			if t.warnPackageConflicts {
+				t.logger().WithField("catalog", conflict.Catalog).Warn(conflict.String())
+			} else {
+				conflictErrs = append(conflictErrs, errors.New(conflict.String()))
+			}
+		}
+		if len(conflictErrs) > 0 {
+			err = fmt.Errorf("components write the same packages: %w", utilerrors.NewAggregate(conflictErrs))
+		}
+	}
+	if err == nil && t.crossDeprecations && (mode == renderModeWrite || mode == renderModeInMemory) {
+		err = t.checkCatalogDeprecations(ctx, in, allComponents, report.Components)
+	}
+	if err == nil && t.pruneStale && mode.builds() {
+		// in diff mode nothing is written, so nothing is pruned either
+		report.Pruned, err = t.pruneStaleOutputs(in.catalogs, allComponents, report.Components, mode == renderModeDiff)
+	}
+	if err == nil && t.catalogValidation && (mode == renderModeWrite || mode == renderModeValidate) {
+		err = t.validateCatalogs(ctx, in.catalogs, allComponents)
+	}
+	if err == nil && t.sqliteDir != "" && mode == renderModeWrite {
+		report.SQLiteIndexes, err = t.writeSQLiteIndexes(ctx, in.catalogs)
+	}
+	if err == nil && t.writeManifest && mode == renderModeWrite {
+		report.Manifests, err = t.writeManifests(in.catalogs, allComponents, in.disabled)
+	}
+	if unused := unusedCatalogEntries(catalogs, allComponents); len(unused) > 0 {
+		if t.strictUnused {
+			unusedErr := fmt.Errorf("catalog configuration has unused entries: %w", unused)
+			if err != nil {
+				unusedErr = utilerrors.NewAggregate([]error{err, unusedErr})
+			}
+			err = unusedErr
+		} else {
+			for _, entry := range unused {
+				t.logger().WithField("catalog", entry.Catalog).Warn(entry.Message)
+			}
+			report.Warnings = unused
+		}
+	}
+	if err == nil && t.resumeProgress != nil && len(t.componentFilter) == 0 {
+		err = t.finishResume()
+	}
+	if mode == renderModeDiff {
+		if diffErr := t.writeDiff(report); diffErr != nil {
+			return report, utilerrors.NewAggregate([]error{err, diffErr})
+		}
+	}
+	return report, err
+}
+
+// writeDiff writes the diff of every component, in component order, and
+// records whether any component changed.
+func (t *Template) writeDiff(report *RenderReport) error {
+	out := t.diffOutput
+	if out == nil {
+		out = os.Stdout
+	}
+	for _, component := range report.Components {
+		if !component.Changed {
+			continue
+		}
+		report.Changed = true
+		if _, err := io.WriteString(out, component.Diff); err != nil {
+			return fmt.Errorf("writing diff: %v", err)
+		}
+	}
+	return nil
+}
+
+func (t *Template) logger() *logrus.Entry {
+	if t.log == nil {
+		return nullLogger()
+	}
+	return t.log
+}
+
+func nullLogger() *logrus.Entry {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logrus.NewEntry(logger)
+}
+
+// renderMode is what a render does with the components it selects.
+type renderMode int
+
+const (
+	// renderModeWrite builds components and writes their outputs
+	renderModeWrite renderMode = iota
+	// renderModeDryRun writes the build plan and builds nothing
+	renderModeDryRun
+	// renderModeDiff builds components and diffs them against their existing
+	// outputs without writing anything
+	renderModeDiff
+	// renderModeValidate only validates the existing destinations
+	renderModeValidate
+	// renderModeInMemory builds components with ConfigBuilder.BuildConfig and
+	// writes nothing
+	renderModeInMemory
+	// renderModeLint only checks the configurations
+	renderModeLint
+)
+
+// builds reports whether components are built into their catalog working
+// directories.
+func (m renderMode) builds() bool {
+	return m == renderModeWrite || m == renderModeDiff
+}
+
+// renderMode returns the mode of a render configured by the template options.
+func (t *Template) renderMode() renderMode {
+	switch {
+	case t.dryRun:
+		return renderModeDryRun
+	case t.diff:
+		return renderModeDiff
+	default:
+		return renderModeWrite
+	}
+}
+
+// renderInput is the catalog configuration resolved for a single render.
+type renderInput struct {
+	catalogs map[string]Catalog
+	builders CatalogBuilderMap
+	// outputBuilders are the builders of components that override the
+	// template's output type, by output type
+	outputBuilders map[OutputType]CatalogBuilderMap
+	validate       bool
+	mode           renderMode
+	// order are the indices of the components in the order they are built
+	order []int
+	// disabled are the names of the components whose enabled condition is
+	// false
+	disabled map[string]bool
+}
+
+// buildersFor returns the builders for component's output type.
+func (in *renderInput) buildersFor(component Component) CatalogBuilderMap {
+	if builders, ok := in.outputBuilders[component.Output]; ok {
+		return builders
+	}
+	return in.builders
+}
+
+// catalogValidationLevel returns the validation level of the components of
+// catalog.
+func (t *Template) catalogValidationLevel(catalog Catalog) ValidationLevel {
+	if catalog.Defaults != nil && catalog.Defaults.ValidationLevel != "" {
+		return catalog.Defaults.ValidationLevel
+	}
+	return t.validationLevel
+}
+
+// applyCatalogDefaults returns a copy of components with the output type and
+// destination prefix defaults of their catalogs applied. The remaining
+// defaults are part of the configuration of the catalog's builders.
+func applyCatalogDefaults(catalogs []Catalog, components []Component) []Component {
+	defaults := map[string]*CatalogDefaults{}
+	for _, catalog := range catalogs {
+		if catalog.Defaults != nil {
+			defaults[catalog.Name] = catalog.Defaults
+		}
+	}
+	applied := make([]Component, 0, len(components))
+	for _, component := range components {
+		if d, ok := defaults[component.CatalogName()]; ok {
+			if component.Output == "" {
+				component.Output = d.Output
+			}
+			if d.DestinationPrefix != "" && component.Destination.Path != StdoutPath {
+				component.Destination.Path = filepath.Join(d.DestinationPrefix, component.Destination.Path)
+			}
+		}
+		applied = append(applied, component)
+	}
+	return applied
+}
+
+// componentOutputType returns the output type component is rendered with.
+func (t *Template) componentOutputType(component Component) OutputType {
+	if component.Output != "" {
+		return component.Output
+	}
+	return t.outputType
+}
+
+// filterComponents returns the components selected by the component filter,
+// preserving their order in the contribution file.
+func (t *Template) filterComponents(components []Component) ([]Component, error) {
+	if len(t.componentFilter) == 0 {
+		return components, nil
+	}
+
+	selected := map[string]bool{}
+	for _, name := range t.componentFilter {
+		selected[name] = false
+	}
+
+	filtered := []Component{}
+	available := []string{}
+	for _, component := range components {
+		available = append(available, component.Name)
+		if _, ok := selected[component.Name]; ok {
+			selected[component.Name] = true
+			filtered = append(filtered, component)
+		}
+	}
+
+	unknown := []string{}
+	for _, name := range t.componentFilter {
+		if !selected[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("component filter references components that do not exist in the composite configuration: %s. Available components are: %s", unknown, available)
+	}
+
+	return filtered, nil
+}
+
+// relocateCatalogs returns a copy of catalogs with their working directories
+// resolved under the working directory root, if one is configured.
+func (t *Template) relocateCatalogs(catalogs []Catalog) ([]Catalog, error) {
+	if t.workingDirRoot == "" {
+		return catalogs, nil
+	}
+
+	var errs []error
+	relocated := make([]Catalog, 0, len(catalogs))
+	for _, catalog := range catalogs {
+		workingDir := catalog.Destination.WorkingDir
+		if filepath.IsAbs(workingDir) {
+			if t.strictWorkingDirRoot {
+				errs = append(errs, fmt.Errorf("catalog %q: working directory %q must be relative to the working directory root %q", catalog.Name, workingDir, t.workingDirRoot))
+				continue
+			}
+			workingDir = strings.TrimPrefix(workingDir, filepath.VolumeName(workingDir))
+		}
+		relocatedDir := filepath.Join(t.workingDirRoot, workingDir)
+		if !isWithin(t.workingDirRoot, relocatedDir) {
+			errs = append(errs, fmt.Errorf("catalog %q: working directory %q escapes the working directory root %q", catalog.Name, catalog.Destination.WorkingDir, t.workingDirRoot))
+			continue
+		}
+		catalog.Destination.WorkingDir = relocatedDir
+		t.logger().Debugf("catalog %q: relocated working directory to %q", catalog.Name, catalog.Destination.WorkingDir)
+		relocated = append(relocated, catalog)
+	}
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+	return relocated, nil
+}
+
+// validateDestinations ensures that every component destination resolves to a
+// path inside its catalog's working directory, and that no two components
+// resolve to the same path. Components targeting unknown catalogs are
+// reported when their builder is resolved.
+func validateDestinations(catalogs map[string]Catalog, components []Component) error {
+	var errs []error
+	owners := map[string]string{}
+	for _, component := range components {
+		catalog, ok := catalogs[component.CatalogName()]
+		if !ok {
+			continue
+		}
+		destPath := component.Destination.Path
+		if destPath == StdoutPath {
+			continue
+		}
+		if isAbsPath(destPath) {
+			errs = append(errs, fmt.Errorf("component %q: destination path %q must be relative to the catalog working directory", component.Name, destPath))
+			continue
+		}
+		workingDir, err := filepath.Abs(catalog.Destination.WorkingDir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("component %q: resolving working directory %q: %v", component.Name, catalog.Destination.WorkingDir, err))
+			continue
+		}
+		dest := filepath.Join(workingDir, destPath)
+		if !isWithin(workingDir, dest) {
+			errs = append(errs, fmt.Errorf("component %q: destination path %q escapes the catalog working directory %q", component.Name, destPath, catalog.Destination.WorkingDir))
+			continue
+		}
+		if owner, ok := owners[dest]; ok {
+			errs = append(errs, fmt.Errorf("component %q: destination path %q resolves to %q, which is also the destination of component %q", component.Name, destPath, dest, owner))
+			continue
+		}
+		owners[dest] = component.Name
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid component destinations: %v", utilerrors.NewAggregate(errs))
+	}
+	return nil
+}
+
+// writeBuildPlan writes what would be built to the dry-run output without
+// invoking any builder.
+func (t *Template) writeBuildPlan(in *renderInput, components []Component) error {
+	out := t.dryRunOutput
+	if out == nil {
+		out = os.Stdout
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tCATALOG\tSCHEMA\tDESTINATION\tOUTPUT")
+	for _, component := range components {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", component.Name, component.CatalogName(), component.Strategy.Template.Schema, component.Destination.Path, t.componentOutputType(component))
+	}
+	return tw.Flush()
+}
+
+// writePrunePlan writes the stale files that would be pruned to the dry-run
+// output.
+func (t *Template) writePrunePlan(pruned []string) error {
+	out := t.dryRunOutput
+	if out == nil {
+		out = os.Stdout
+	}
+	for _, p := range pruned {
+		if _, err := fmt.Fprintf(out, "would prune %s\n", p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderComponents builds (and optionally validates) the given components using
+// at most t.maxConcurrency workers. Errors and reports are collected in component
+// order; components that were never started are omitted from the reports.
+func (t *Template) renderComponents(ctx context.Context, in *renderInput, components []Component) ([]ComponentReport, error) {
+	concurrency := t.maxConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	registries, destroyRegistries := t.catalogRegistries(in.catalogs)
+	defer destroyRegistries()
+	if concurrency > 1 {
+		synced := map[image.Registry]image.Registry{}
+		for catalog, reg := range registries {
+			if _, ok := synced[reg]; !ok {
+				synced[reg] = &syncRegistry{reg: reg}
+			}
+			registries[catalog] = synced[reg]
+		}
+	}
+
+	nested := nestedDestinationLocks(in.catalogs, components)
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		failed  bool
+		errs    = make([]error, len(components))
+		reports = make([]*ComponentReport, len(components))
+		sem     = make(chan struct{}, concurrency)
+		done    = map[string]chan struct{}{}
+		index   = map[string]int{}
+	)
+	for i, component := range components {
+		done[component.Name] = make(chan struct{})
+		index[component.Name] = i
+	}
+	for _, i := range in.order {
+		component := components[i]
+		if in.disabled[component.Name] {
+			reports[i] = newComponentReport(in, component)
+			reports[i].Disabled = true
+			close(done[component.Name])
+			continue
+		}
+		sem <- struct{}{}
+		mu.Lock()
+		stop := t.failFast && failed
+		mu.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+		if err := parent.Err(); err != nil {
+			<-sem
+			errs[i] = fmt.Errorf("building component %q: %w", component.Name, err)
+			break
+		}
+
+		t.emit(ProgressEvent{Phase: ProgressComponentQueued}, newComponentReport(in, component))
+		wg.Add(1)
+		go func(i int, component Component) {
+			defer func() {
+				t.emit(ProgressEvent{Phase: ProgressComponentFinished, Err: errs[i]}, reports[i])
+				close(done[component.Name])
+				<-sem
+				wg.Done()
+			}()
+			// components are started in build order, so the components this
+			// one depends on have already been started
+			for _, dependency := range component.DependsOn {
+				if _, ok := done[dependency]; !ok {
+					continue
+				}
+				<-done[dependency]
+				if errs[index[dependency]] != nil {
+					reports[i] = newComponentReport(in, component)
+					reports[i].Err = fmt.Errorf("building component %q: dependency %q failed to build", component.Name, dependency)
+					errs[i] = reports[i].Err
+					return
+				}
+			}
+			if lock, ok := nested[component.Name]; ok {
+				lock.Lock()
+				defer lock.Unlock()
+			}
+			report, err := t.renderComponent(ctx, registries[component.CatalogName()], in, component)
+			reports[i] = report
+			if err != nil {
+				errs[i] = err
+				if t.failFast {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+					cancel()
+				}
+			}
+		}(i, component)
+	}
+	wg.Wait()
+
+	componentReports := []ComponentReport{}
+	for _, report := range reports {
+		if report != nil {
+			componentReports = append(componentReports, *report)
+		}
+	}
+
+	if t.failFast {
+		for _, err := range errs {
+			if err != nil {
+				return componentReports, err
+			}
+		}
+		return componentReports, nil
+	}
+	return componentReports, utilerrors.NewAggregate(errs)
+}
+
+// preflight checks every enabled component before any of them is built: that
+// its catalog exists, allows it and enables its schema and, unless builds are
+// skipped, that its builder accepts its template configuration. It returns
+// the reports of the components that fail the checks.
+func (t *Template) preflight(in *renderInput, components []Component) ([]ComponentReport, error) {
+	var (
+		failed []ComponentReport
+		errs   []error
+	)
+	for _, component := range components {
+		if in.disabled[component.Name] {
+			continue
+		}
+		builder, err := t.resolveBuilder(in.buildersFor(component), component)
+		rejected := false
+		if err == nil {
+			if policyErr := checkComponentAllowed(in.catalogs[component.CatalogName()], component.Name); policyErr != nil {
+				err = fmt.Errorf("building component %q: %w", component.Name, policyErr)
+				rejected = true
+			}
+		}
+		if err == nil && in.mode != renderModeValidate {
+			if cfgErr := builder.ValidateConfig(component.Strategy.Template); cfgErr != nil {
+				err = fmt.Errorf("building component %q: %w", component.Name, cfgErr)
+			}
+		}
+		if err != nil {
+			report := newComponentReport(in, component)
+			report.Err = err
+			report.Rejected = rejected
+			failed = append(failed, *report)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		t.logger().Infof("%d component(s) failed the checks before building", len(errs))
+		return failed, utilerrors.NewAggregate(errs)
+	}
+	return nil, nil
+}
+
+// newComponentReport returns the report of component before it is built.
+func newComponentReport(in *renderInput, component Component) *ComponentReport {
+	return &ComponentReport{
+		Name:        component.Name,
+		Catalog:     component.CatalogName(),
+		Schema:      component.Strategy.Template.Schema,
+		WorkingDir:  in.catalogs[component.CatalogName()].Destination.WorkingDir,
+		Destination: filepath.Join(in.catalogs[component.CatalogName()].Destination.WorkingDir, component.Destination.Path),
+		Validation:  ValidationSkipped,
+	}
+}
+
+func (t *Template) renderComponent(ctx context.Context, reg image.Registry, in *renderInput, component Component) (*ComponentReport, error) {
+	report := newComponentReport(in, component)
+	log := t.logger().WithFields(logrus.Fields{
+		"component": component.Name,
+		"catalog":   report.Catalog,
+		"schema":    report.Schema,
+	})
+	fail := func(err error) (*ComponentReport, error) {
+		report.Err = err
+		log.WithError(err).Debug("component failed")
+		return report, err
+	}
+	if (t.progress != nil || t.instrumentation != nil) && reg != nil {
+		reg = &progressRegistry{Registry: reg, t: t, component: report}
+	}
+
+	builder, err := t.resolveBuilder(in.buildersFor(component), component)
+	if err != nil {
+		return fail(err)
+	}
+	// streamed components are not written to their destination, so there is
+	// nothing to stage, diff, validate or record
+	streamed := false
+	if sb, ok := builder.(StreamingBuilder); ok && in.mode != renderModeInMemory && sb.Streams(component.Destination.Path) {
+		streamed = true
+		report.Destination = StdoutPath
+		if len(component.Deprecations) > 0 {
+			return fail(fmt.Errorf("building component %q: deprecations can't be written alongside streamed output", component.Name))
+		}
+		if component.PackageNamePrefix != "" {
+			return fail(fmt.Errorf("building component %q: a package name prefix can't be applied to streamed output", component.Name))
+		}
+	}
+	// components written to an output sink are read back from it
+	var sink OutputSink
+	if !streamed && in.mode != renderModeInMemory {
+		sink = t.sinks[report.Catalog]
+	}
+	if sink != nil {
+		if len(component.Deprecations) > 0 {
+			return fail(fmt.Errorf("building component %q: deprecations can't be written to an output sink", component.Name))
+		}
+		if component.PackageNamePrefix != "" {
+			return fail(fmt.Errorf("building component %q: a package name prefix can't be applied to output written to an output sink", component.Name))
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+	}
+
+	// the component timeout covers both building and validating
+	componentCtx := ctx
+	if t.componentTimeout > 0 {
+		var cancel context.CancelFunc
+		componentCtx, cancel = context.WithTimeout(ctx, t.componentTimeout)
+		defer cancel()
+	}
+	stepErr := func(step string, err error) error {
+		if ctx.Err() == nil && errors.Is(componentCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%s component %q: timed out after %s: %w", step, component.Name, t.componentTimeout, err)
+		}
+		return fmt.Errorf("%s component %q: %w", step, component.Name, err)
+	}
+
+	skipBuild := in.mode == renderModeValidate
+	diff := in.mode == renderModeDiff && !streamed
+	if !skipBuild {
+		for _, hook := range t.preBuildHooks {
+			if err := hook(componentCtx, *report); err != nil {
+				return fail(stepErr("pre-build hook rejected", err))
+			}
+		}
+	}
+
+	// in memory, the FBC is only recorded in the report
+	if in.mode == renderModeInMemory {
+		cb, ok := builder.(ConfigBuilder)
+		if !ok {
+			return fail(fmt.Errorf("building component %q: the builder for schema %q can't render in memory", component.Name, report.Schema))
+		}
+
+		start := time.Now()
+		record := &buildRecord{}
+		log.Info("building component in memory")
+		err = t.retryBuild(componentCtx, log, func() error {
+			report.Attempts++
+			record = &buildRecord{}
+			buildCtx := contextWithBuildRecord(componentCtx, record)
+			report.config, err = cb.BuildConfig(ContextWithComponentInfo(buildCtx, ComponentInfo{
+				Component:   component.Name,
+				Catalog:     report.Catalog,
+				Destination: report.Destination,
+				SkipPatch:   component.Strategy.SkipPatch,
+			}), reg, component.Strategy.Template)
+			return err
+		})
+		report.Duration = time.Since(start)
+		t.emit(ProgressEvent{Phase: ProgressBuildFinished, Duration: report.Duration, Err: err}, report)
+		t.instrument().ComponentBuilt(report.Name, report.Catalog, report.Schema, report.Duration, err)
+		if err != nil {
+			return fail(stepErr("building", err))
+		}
+		log.Infof("built component in %s", report.Duration)
+		report.Channels = record.channels
+		report.ChannelGraph = record.graph
+		report.PinnedImages = record.pinnedImages
+		report.MigrationLevel = record.migrationLevel
+		report.SkipPatch = record.skipPatch
+		if len(component.Deprecations) > 0 {
+			if !t.crossDeprecations {
+				if err := utilerrors.NewAggregate(unresolvedDeprecations(component.Deprecations, report.config)); err != nil {
+					return fail(fmt.Errorf("building component %q: deprecations are not in the component's output: %w", component.Name, err))
+				}
+			}
+			metas, err := deprecationBlobs(component.Deprecations)
+			if err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+			}
+			report.config.Others = append(report.config.Others, metas...)
+		}
+		if component.PackageNamePrefix != "" {
+			if err := prefixPackages(report.config, component.PackageNamePrefix, packageNames(report.config)); err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+			}
+		}
+		report.Packages = []string{}
+		for _, pkg := range report.config.Packages {
+			report.Packages = append(report.Packages, pkg.Name)
+		}
+		sort.Strings(report.Packages)
+		if len(component.ExpectedPackages) > 0 {
+			if err := checkExpectedPackages(component.ExpectedPackages, report.Packages); err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+			}
+		}
+
+		if in.validate && t.catalogValidationLevel(in.catalogs[component.CatalogName()]) != ValidationLevelLoad {
+			log.Info("validating component")
+			validationStart := time.Now()
+			_, err := declcfg.ConvertToModel(*report.config)
+			validationDuration := time.Since(validationStart)
+			t.emit(ProgressEvent{Phase: ProgressValidationFinished, Duration: validationDuration, Err: err}, report)
+			t.instrument().ComponentValidated(report.Name, report.Catalog, report.Schema, validationDuration, err)
+			if err != nil {
+				report.Validation = ValidationFailed
+				return fail(stepErr("validating", err))
+			}
+			report.Validation = ValidationPassed
+		}
+
+		for _, hook := range t.postBuildHooks {
+			if err := hook(componentCtx, *report); err != nil {
+				return fail(stepErr("post-build hook failed for", err))
+			}
+		}
+		return report, nil
+	}
+
+	var hash string
+	progress := t.resumeProgress[report.Catalog]
+	if (t.incremental || progress != nil) && !skipBuild && !diff && !streamed {
+		hash, err = componentHash(component, t.componentOutputType(component), t.migrationLevel, in.catalogs[component.CatalogName()].Defaults)
+		if err != nil {
+			return fail(fmt.Errorf("building component %q: hashing inputs: %w", component.Name, err))
+		}
+		if !t.forceRebuild && t.incremental && readComponentState(report.Destination) == hash {
+			log.Infof("component is up to date in %q, skipping build", report.Destination)
+			report.UpToDate = true
+			skipBuild = true
+		} else if !t.forceRebuild && progress != nil && progress.succeeded(component.Name, hash) {
+			log.Infof("component was built into %q by the previous render, skipping build", report.Destination)
+			report.UpToDate = true
+			skipBuild = true
+		}
+	}
+
+	// builders write to and validate dir, relative to the catalog working
+	// directory, which is a staging directory when output is atomic
+	dir := component.Destination.Path
+	workingDir := in.catalogs[component.CatalogName()].Destination.WorkingDir
+	staged := !skipBuild && !streamed && sink == nil && (t.atomicOutput || diff) && filepath.Clean(report.Destination) != filepath.Clean(workingDir)
+	if diff && !staged {
+		return fail(fmt.Errorf("diffing component %q: the destination must be a subdirectory of the catalog working directory", component.Name))
+	}
+	if component.PackageNamePrefix != "" && !streamed && filepath.Clean(report.Destination) == filepath.Clean(workingDir) {
+		// the output of the other components of the catalog would be prefixed
+		return fail(fmt.Errorf("building component %q: a package name prefix needs a destination that is a subdirectory of the catalog working directory", component.Name))
+	}
+	if staged {
+		dir, err = newStagingDir(workingDir, report.Destination)
+		if err != nil {
+			return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+		}
+		defer func() { os.RemoveAll(filepath.Join(workingDir, dir)) }()
+		log.Debugf("staging component in %q", filepath.Join(workingDir, dir))
+	}
+
+	start := time.Now()
+	var result *BuildResult
+	if !skipBuild {
+		if hash != "" && t.incremental {
+			// a build that fails part way must not be considered up to date
+			if err := removeComponentState(filepath.Join(workingDir, dir)); err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+			}
+		}
+		if hash != "" && progress != nil {
+			if err := progress.record(component.Name, hash, false); err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+			}
+		}
+		// run the builder corresponding to the schema
+		log.Infof("building component into %q", report.Destination)
+		err = t.retryBuild(componentCtx, log, func() error {
+			if staged && report.Attempts > 0 {
+				// start every attempt from the destination's original contents
+				os.RemoveAll(filepath.Join(workingDir, dir))
+				if dir, err = newStagingDir(workingDir, report.Destination); err != nil {
+					return err
+				}
+			}
+			report.Attempts++
+			result, err = buildComponent(ContextWithComponentInfo(componentCtx, ComponentInfo{
+				Component:   component.Name,
+				Catalog:     report.Catalog,
+				Destination: report.Destination,
+				SkipPatch:   component.Strategy.SkipPatch,
+			}), reg, builder, BuildRequest{
+				ComponentName: component.Name,
+				CatalogName:   report.Catalog,
+				Destination:   dir,
+				Template:      component.Strategy.Template,
+				OutputType:    t.componentOutputType(component),
+				Logger:        log,
+			})
+			return err
+		})
+		report.Duration = time.Since(start)
+		t.emit(ProgressEvent{Phase: ProgressBuildFinished, Duration: report.Duration, Err: err}, report)
+		t.instrument().ComponentBuilt(report.Name, report.Catalog, report.Schema, report.Duration, err)
+		if err != nil {
+			return fail(stepErr("building", err))
+		}
+		log.Infof("built component in %s", report.Duration)
+		report.Channels = result.Channels
+		report.ChannelGraph = result.ChannelGraph
+		report.PinnedImages = result.PinnedImages
+		report.MigrationLevel = result.MigrationLevel
+		report.SkipPatch = result.SkipPatch
+		if !streamed {
+			report.outputs = result.Files
+		}
+		if len(component.Deprecations) > 0 {
+			if err := t.addDeprecations(componentCtx, component, filepath.Join(workingDir, dir), report); err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+			}
+		}
+		if component.PackageNamePrefix != "" {
+			log.Debugf("prefixing package names with %q", component.PackageNamePrefix)
+			if err := prefixDestinationPackages(filepath.Join(workingDir, dir), component.PackageNamePrefix); err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+			}
+		}
+		if t.channelGraphDir != "" && result.ChannelGraph != "" {
+			graphPath, err := t.writeChannelGraph(component.Name, result.ChannelGraph)
+			if err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+			}
+			log.Debugf("wrote channel graph to %q", graphPath)
+		}
+	}
+
+	if in.validate && streamed {
+		log.Debug("component output is streamed, skipping validation")
+	} else if in.validate {
+		if err := componentCtx.Err(); err != nil {
+			return fail(stepErr("validating", err))
+		}
+		// run the validation for the builder
+		log.Info("validating component")
+		validationStart := time.Now()
+		err = builder.Validate(componentCtx, dir)
+		validationDuration := time.Since(validationStart)
+		t.emit(ProgressEvent{Phase: ProgressValidationFinished, Duration: validationDuration, Err: err}, report)
+		t.instrument().ComponentValidated(report.Name, report.Catalog, report.Schema, validationDuration, err)
+		if err != nil {
+			report.Validation = ValidationFailed
+			return fail(stepErr("validating", err))
+		}
+		report.Validation = ValidationPassed
+		log.Debug("component is valid")
+	}
+
+	if !streamed {
+		// unless the component expects packages, they are only used to detect
+		// conflicts, which serving the catalog would report anyway
+		if sink != nil {
+			report.Packages, err = sinkPackages(sink, dir)
+		} else {
+			report.Packages, err = writtenPackages(filepath.Join(workingDir, dir))
+		}
+		if err != nil && len(component.ExpectedPackages) > 0 {
+			return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+		} else if err != nil {
+			log.WithError(err).Warn("not checking the packages written by the component for conflicts")
+		} else if len(component.ExpectedPackages) > 0 {
+			if err := checkExpectedPackages(component.ExpectedPackages, report.Packages); err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+			}
+		}
+	}
+
+	if hash != "" && t.incremental && !skipBuild {
+		if err := writeComponentState(filepath.Join(workingDir, dir), hash); err != nil {
+			return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+		}
+	}
+
+	if diff {
+		report.Diff, err = diffDirs(report.Destination, filepath.Join(workingDir, dir), report.Destination)
+		if err != nil {
+			return fail(fmt.Errorf("diffing component %q: %w", component.Name, err))
+		}
+		report.Changed = report.Diff != ""
+		return report, nil
+	}
+
+	if staged {
+		if err := commitStagingDir(filepath.Join(workingDir, dir), report.Destination); err != nil {
+			return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+		}
+	}
+
+	if !skipBuild {
+		if sink != nil && report.outputs == nil {
+			// the builder didn't say what it wrote
+			if report.outputs, err = sinkFiles(sink, dir); err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+			}
+		}
+		if !streamed && report.outputs != nil {
+			report.Files = make([]string, 0, len(report.outputs))
+			for _, output := range report.outputs {
+				report.Files = append(report.Files, filepath.Join(report.Destination, output))
+			}
+			sort.Strings(report.Files)
+		} else if !streamed {
+			// the builder didn't say what it wrote
+			report.Files, err = filesWrittenSince(report.Destination, start)
+			if err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
 			}
 		}
-		return nil, fmt.Errorf("catalog configuration file field validation failed: %s", errMsg)
+		if len(report.Files) > 0 {
+			report.Digests = map[string]string{}
+			for _, file := range report.Files {
+				if sink != nil {
+					report.Digests[file], err = sinkDigest(sink, workingDir, file)
+				} else {
+					report.Digests[file], err = fileDigest(file)
+				}
+				if err != nil {
+					return fail(fmt.Errorf("building component %q: computing digest of %q: %w", component.Name, file, err))
+				}
+			}
+		}
+		for _, hook := range t.postBuildHooks {
+			if err := hook(componentCtx, *report); err != nil {
+				return fail(stepErr("post-build hook failed for", err))
+			}
+		}
+		if hash != "" && progress != nil {
+			if err := progress.record(component.Name, hash, true); err != nil {
+				return fail(fmt.Errorf("building component %q: %w", component.Name, err))
+			}
+		}
+	}
+	return report, nil
+}
+
+// retryBuild runs build, retrying failures according to the build retry
+// policy until it succeeds, runs out of attempts, or ctx is done.
+func (t *Template) retryBuild(ctx context.Context, log *logrus.Entry, build func() error) error {
+	delay := t.buildBackoff
+	for attempt := 1; ; attempt++ {
+		err := build()
+		if err == nil || attempt >= t.buildAttempts || ctx.Err() != nil {
+			return err
+		}
+		log.WithError(err).Warnf("build attempt %d of %d failed, retrying in %s", attempt, t.buildAttempts, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// resolveBuilder finds the builder that should be used for the component
+// based on the catalog it targets and the schema of its template. A schema
+// that the catalog doesn't enable is reported differently from one that no
+// builder is registered for, as only the latter is likely a typo.
+func (t *Template) resolveBuilder(catalogBuilderMap CatalogBuilderMap, component Component) (Builder, error) {
+	builderMap, ok := catalogBuilderMap[component.CatalogName()]
+	if !ok {
+		allowedComponents := []string{}
+		for k := range catalogBuilderMap {
+			allowedComponents = append(allowedComponents, k)
+		}
+		sort.Strings(allowedComponents)
+		if component.Catalog != "" {
+			return nil, fmt.Errorf("building component %q: catalog %q does not exist in the catalog configuration. Available catalogs are: %s", component.Name, component.Catalog, allowedComponents)
+		}
+		return nil, fmt.Errorf("building component %q: component does not exist in the catalog configuration. Available components are: %s", component.Name, allowedComponents)
+	}
+
+	schema := component.Strategy.Template.Schema
+	builder, ok := builderMap[schema]
+	if !ok {
+		if _, registered := t.registeredBuilders[schema]; !registered {
+			return nil, fmt.Errorf("building component %q: unknown template schema %q, registered schemas are: %s", component.Name, schema, t.RegisteredSchemas())
+		}
+		if !t.builderAllowed(schema) {
+			return nil, fmt.Errorf("building component %q: builder schema %q is not permitted, permitted schemas are: %s", component.Name, schema, t.RegisteredSchemas())
+		}
+		schemas := []string{}
+		for schema := range builderMap {
+			schemas = append(schemas, schema)
+		}
+		sort.Strings(schemas)
+		return nil, fmt.Errorf("building component %q: schema %q is not enabled for catalog %q; enabled schemas are %s", component.Name, schema, component.CatalogName(), schemas)
+	}
+	return builder, nil
+}
+
+func (t *Template) builderForSchema(schema string, builderCfg BuilderConfig) (Builder, error) {
+	builderFunc, ok := t.registeredBuilders[schema]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %q, registered schemas are: %s", schema, t.RegisteredSchemas())
+	}
+	if !t.builderAllowed(schema) {
+		return nil, fmt.Errorf("builder schema %q is not permitted, permitted schemas are: %s", schema, t.RegisteredSchemas())
+	}
+
+	return builderFunc(builderCfg), nil
+}
+
+func (t *Template) builderAllowed(schema string) bool {
+	return t.allowedBuilders == nil || t.allowedBuilders[schema]
+}
+
+// RegisteredSchemas returns the schemas of all registered and permitted
+// builders in lexical order.
+func (t *Template) RegisteredSchemas() []string {
+	schemas := make([]string, 0, len(t.registeredBuilders))
+	for schema := range t.registeredBuilders {
+		if t.builderAllowed(schema) {
+			schemas = append(schemas, schema)
+		}
+	}
+	sort.Strings(schemas)
+	return schemas
+}
+
+func (t *Template) newCatalogBuilderMap(catalogs []Catalog, outputType OutputType) (*CatalogBuilderMap, error) {
+
+	catalogBuilderMap := make(CatalogBuilderMap)
+
+	workingDirs := make([]string, 0, len(catalogs))
+	for _, catalog := range catalogs {
+		if catalog.Destination.WorkingDir != "" {
+			workingDirs = append(workingDirs, catalog.Destination.WorkingDir)
+		}
+	}
+
+	// setup the builders for each catalog
+	var setupErrors ValidationErrors
+	seenCatalogs := map[string]bool{}
+	for i, catalog := range catalogs {
+		errs := ValidationErrors{}
+		invalidAt := func(field string, path string, format string, args ...interface{}) {
+			errs = append(errs, ConfigValidationError{
+				Catalog: catalog.Name,
+				Source:  t.catalogSources[catalog.Name],
+				Field:   field,
+				Path:    fmt.Sprintf("catalogs[%d].%s", i, path),
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+		invalid := func(field string, format string, args ...interface{}) {
+			invalidAt(field, field, format, args...)
+		}
+		if catalog.Destination.BaseImage == "" {
+			if t.requireBaseImage {
+				invalid("destination.baseImage", "destination.baseImage must not be an empty string")
+			}
+		} else if _, err := reference.ParseNormalizedNamed(catalog.Destination.BaseImage); err != nil {
+			invalid("destination.baseImage", "destination.baseImage %q is not a valid image reference: %v", catalog.Destination.BaseImage, err)
+		}
+
+		if seenCatalogs[catalog.Name] {
+			invalid("name", "catalog name must be unique, but is defined more than once")
+		}
+		seenCatalogs[catalog.Name] = true
+
+		if catalog.Destination.WorkingDir == "" {
+			invalid("destination.workingDir", "destination.workingDir must not be an empty string")
+		}
+
+		defaults := CatalogDefaults{}
+		if catalog.Defaults != nil {
+			defaults = *catalog.Defaults
+		}
+		if defaults.Output != "" {
+			if _, err := ParseOutputType(string(defaults.Output)); err != nil {
+				invalid("defaults.output", "defaults.output has unsupported output type %q, expected one of %s", defaults.Output, outputTypes)
+			}
+		}
+		if defaults.ValidationLevel != "" {
+			if _, err := ParseValidationLevel(string(defaults.ValidationLevel)); err != nil {
+				invalid("defaults.validationLevel", "defaults.validationLevel has unsupported validation level %q, expected one of %s", defaults.ValidationLevel, validationLevels)
+			}
+		}
+		if isAbsPath(defaults.DestinationPrefix) {
+			invalid("defaults.destinationPrefix", "defaults.destinationPrefix %q must be relative to the catalog working directory", defaults.DestinationPrefix)
+		}
+
+		for j, pattern := range catalog.AllowedComponents {
+			if _, err := path.Match(pattern, ""); err != nil {
+				invalidAt("allowedComponents", fmt.Sprintf("allowedComponents[%d]", j), "%q is not a valid component name pattern: %v", pattern, err)
+			}
+		}
+
+		seenBuilders := map[string]bool{}
+		for j, schema := range catalog.Builders {
+			if seenBuilders[schema] {
+				invalidAt("builders", fmt.Sprintf("builders[%d]", j), "builders must be unique, but %q is listed more than once", schema)
+			}
+			seenBuilders[schema] = true
+		}
+
+		// check for validation errors and skip builder creation if there are any errors
+		if len(errs) > 0 {
+			setupErrors = append(setupErrors, errs...)
+			continue
+		}
+
+		builderMap := make(BuilderMap)
+		for _, schema := range catalog.Builders {
+			builder, err := t.builderForSchema(schema, BuilderConfig{
+				WorkingDir:      catalog.Destination.WorkingDir,
+				OutputType:      outputType,
+				Log:             t.logger().WithFields(logrus.Fields{"catalog": catalog.Name, "builder": schema}),
+				HttpGetter:      t.inputGetter,
+				OutputWriter:    t.outputWriter,
+				Offline:         t.offline,
+				ValidationLevel: t.catalogValidationLevel(catalog),
+				OutputLayout:    t.outputLayout,
+				MigrationLevel:  t.migrationLevel,
+				PinImages:       defaults.PinImages != nil && *defaults.PinImages,
+				Sink:            t.sinks[catalog.Name],
+
+				renderWorkingDirs: workingDirs,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("getting builder %q for catalog %q: %v", schema, catalog.Name, err)
+			}
+			builderMap[schema] = builder
+		}
+		catalogBuilderMap[catalog.Name] = builderMap
+	}
+
+	// if there were errors validating the catalog configuration then exit
+	if len(setupErrors) > 0 {
+		return nil, fmt.Errorf("catalog configuration file field validation failed: %w", setupErrors)
 	}
 
 	return &catalogBuilderMap, nil
@@ -1,17 +1,39 @@
 package composite
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
-	"github.com/operator-framework/operator-registry/pkg/image"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"github.com/operator-framework/operator-registry/pkg/image"
+	libimage "github.com/operator-framework/operator-registry/pkg/lib/image"
+	"github.com/operator-framework/operator-registry/pkg/sqlite"
 )
 
 var _ Builder = &TestBuilder{}
@@ -37,6 +59,14 @@ func (tb *TestBuilder) Validate(ctx context.Context, dir string) error {
 	return nil
 }
 
+func (tb *TestBuilder) Schema() string {
+	return TestBuilderSchema
+}
+
+func (tb *TestBuilder) ValidateConfig(td TemplateDefinition) error {
+	return nil
+}
+
 var renderValidCatalog = `
 schema: olm.composite.catalogs
 catalogs:
@@ -92,6 +122,46 @@ components:
           output: catalog.yaml
 `
 
+var renderMultiCatalog = `
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: contributions/first-catalog
+    builders:
+      - olm.builder.test
+  - name: second-catalog
+    destination:
+      workingDir: contributions/second-catalog
+    builders:
+      - olm.builder.test
+`
+
+var renderMultiComposite = `
+schema: olm.composite
+components:
+  - name: first-catalog
+    destination:
+      path: my-operator
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+        config:
+          input: components/contribution1.yaml
+          output: catalog.yaml
+  - name: second-catalog
+    destination:
+      path: my-operator
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+        config:
+          input: components/contribution2.yaml
+          output: catalog.yaml
+`
+
 func TestCompositeRender(t *testing.T) {
 	type testCase struct {
 		name              string
@@ -105,8 +175,8 @@ func TestCompositeRender(t *testing.T) {
 			name:     "successful render",
 			validate: true,
 			compositeTemplate: Template{
-				catalogFile:      strings.NewReader(renderValidCatalog),
-				contributionFile: strings.NewReader(renderValidComposite),
+				catalogFiles:      []namedReader{{reader: strings.NewReader(renderValidCatalog)}},
+				contributionFiles: []namedReader{{reader: strings.NewReader(renderValidComposite)}},
 				registeredBuilders: map[string]builderFunc{
 					TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{} },
 				},
@@ -119,8 +189,39 @@ func TestCompositeRender(t *testing.T) {
 			name:     "Component build failure",
 			validate: true,
 			compositeTemplate: Template{
-				catalogFile:      strings.NewReader(renderValidCatalog),
-				contributionFile: strings.NewReader(renderValidComposite),
+				catalogFiles:      []namedReader{{reader: strings.NewReader(renderValidCatalog)}},
+				contributionFiles: []namedReader{{reader: strings.NewReader(renderValidComposite)}},
+				registeredBuilders: map[string]builderFunc{
+					TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{buildShouldError: true} },
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				require.Equal(t, "building component \"first-catalog\": build error!", err.Error())
+			},
+		},
+		{
+			name:     "Component build failures are aggregated",
+			validate: true,
+			compositeTemplate: Template{
+				catalogFiles:      []namedReader{{reader: strings.NewReader(renderMultiCatalog)}},
+				contributionFiles: []namedReader{{reader: strings.NewReader(renderMultiComposite)}},
+				registeredBuilders: map[string]builderFunc{
+					TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{buildShouldError: true} },
+				},
+			},
+			assertions: func(t *testing.T, err error) {
+				require.Error(t, err)
+				require.Equal(t, "[building component \"first-catalog\": build error!, building component \"second-catalog\": build error!]", err.Error())
+			},
+		},
+		{
+			name:     "Component build failure with fail fast",
+			validate: true,
+			compositeTemplate: Template{
+				catalogFiles:      []namedReader{{reader: strings.NewReader(renderMultiCatalog)}},
+				contributionFiles: []namedReader{{reader: strings.NewReader(renderMultiComposite)}},
+				failFast:          true,
 				registeredBuilders: map[string]builderFunc{
 					TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{buildShouldError: true} },
 				},
@@ -134,8 +235,8 @@ func TestCompositeRender(t *testing.T) {
 			name:     "Component validate failure",
 			validate: true,
 			compositeTemplate: Template{
-				catalogFile:      strings.NewReader(renderValidCatalog),
-				contributionFile: strings.NewReader(renderValidComposite),
+				catalogFiles:      []namedReader{{reader: strings.NewReader(renderValidCatalog)}},
+				contributionFiles: []namedReader{{reader: strings.NewReader(renderValidComposite)}},
 				registeredBuilders: map[string]builderFunc{
 					TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{validateShouldError: true} },
 				},
@@ -149,8 +250,8 @@ func TestCompositeRender(t *testing.T) {
 			name:     "Skipping validation",
 			validate: false,
 			compositeTemplate: Template{
-				catalogFile:      strings.NewReader(renderValidCatalog),
-				contributionFile: strings.NewReader(renderValidComposite),
+				catalogFiles:      []namedReader{{reader: strings.NewReader(renderValidCatalog)}},
+				contributionFiles: []namedReader{{reader: strings.NewReader(renderValidComposite)}},
 				registeredBuilders: map[string]builderFunc{
 					TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{validateShouldError: true} },
 				},
@@ -165,8 +266,8 @@ func TestCompositeRender(t *testing.T) {
 			name:     "component not in catalog config",
 			validate: true,
 			compositeTemplate: Template{
-				catalogFile:      strings.NewReader(renderValidCatalog),
-				contributionFile: strings.NewReader(renderInvalidComponentComposite),
+				catalogFiles:      []namedReader{{reader: strings.NewReader(renderValidCatalog)}},
+				contributionFiles: []namedReader{{reader: strings.NewReader(renderInvalidComponentComposite)}},
 				registeredBuilders: map[string]builderFunc{
 					TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{} },
 				},
@@ -181,38 +282,38 @@ func TestCompositeRender(t *testing.T) {
 			name:     "builder not in catalog config",
 			validate: true,
 			compositeTemplate: Template{
-				catalogFile:      strings.NewReader(renderValidCatalog),
-				contributionFile: strings.NewReader(renderInvalidBuilderComposite),
+				catalogFiles:      []namedReader{{reader: strings.NewReader(renderValidCatalog)}},
+				contributionFiles: []namedReader{{reader: strings.NewReader(renderInvalidBuilderComposite)}},
 				registeredBuilders: map[string]builderFunc{
 					TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{} },
 				},
 			},
 			assertions: func(t *testing.T, err error) {
 				require.Error(t, err)
-				require.Equal(t, "building component \"first-catalog\": no builder found for template schema \"olm.builder.invalid\"", err.Error())
+				require.Equal(t, "building component \"first-catalog\": unknown template schema \"olm.builder.invalid\", registered schemas are: [olm.builder.test]", err.Error())
 			},
 		},
 		{
 			name:     "error parsing catalog spec",
 			validate: true,
 			compositeTemplate: Template{
-				catalogFile: strings.NewReader(invalidSchemaCatalog),
+				catalogFiles: []namedReader{{reader: strings.NewReader(invalidSchemaCatalog)}},
 			},
 			assertions: func(t *testing.T, err error) {
 				require.Error(t, err)
-				require.Equal(t, "catalog configuration file has unknown schema, should be \"olm.composite.catalogs\"", err.Error())
+				require.Equal(t, "catalog-config[0]: catalog configuration file has unknown schema \"invalid\", supported schemas are: [olm.composite.catalogs olm.composite.catalogs/v2]", err.Error())
 			},
 		},
 		{
 			name:     "error parsing contribution spec",
 			validate: true,
 			compositeTemplate: Template{
-				catalogFile:      strings.NewReader(renderValidCatalog),
-				contributionFile: strings.NewReader(invalidSchemaComposite),
+				catalogFiles:      []namedReader{{reader: strings.NewReader(renderValidCatalog)}},
+				contributionFiles: []namedReader{{reader: strings.NewReader(invalidSchemaComposite)}},
 			},
 			assertions: func(t *testing.T, err error) {
 				require.Error(t, err)
-				require.Equal(t, "composite configuration file has unknown schema, should be \"olm.composite\"", err.Error())
+				require.Equal(t, "contribution-config[0]: composite configuration file has unknown schema, should be \"olm.composite\"", err.Error())
 			},
 		},
 	}
@@ -225,391 +326,5731 @@ func TestCompositeRender(t *testing.T) {
 	}
 }
 
-func TestBuilderForSchema(t *testing.T) {
-	type testCase struct {
-		name          string
-		builderSchema string
-		builderCfg    BuilderConfig
-		assertions    func(t *testing.T, builder Builder, err error)
-	}
+type concurrencyBuilder struct {
+	mu      sync.Mutex
+	current int
+	peak    int
+}
 
-	testCases := []testCase{
-		{
-			name:          "Basic Builder Schema",
-			builderSchema: BasicBuilderSchema,
-			builderCfg:    BuilderConfig{},
-			assertions: func(t *testing.T, builder Builder, err error) {
-				require.NoError(t, err)
-				require.IsType(t, &BasicBuilder{}, builder)
-			},
-		},
-		{
-			name:          "Semver Builder Schema",
-			builderSchema: SemverBuilderSchema,
-			builderCfg:    BuilderConfig{},
-			assertions: func(t *testing.T, builder Builder, err error) {
-				require.NoError(t, err)
-				require.IsType(t, &SemverBuilder{}, builder)
-			},
-		},
-		{
-			name:          "Raw Builder Schema",
-			builderSchema: RawBuilderSchema,
-			builderCfg:    BuilderConfig{},
-			assertions: func(t *testing.T, builder Builder, err error) {
-				require.NoError(t, err)
-				require.IsType(t, &RawBuilder{}, builder)
-			},
-		},
-		{
-			name:          "Custom Builder Schema",
-			builderSchema: CustomBuilderSchema,
-			builderCfg:    BuilderConfig{},
-			assertions: func(t *testing.T, builder Builder, err error) {
-				require.NoError(t, err)
-				require.IsType(t, &CustomBuilder{}, builder)
-			},
-		},
-		{
-			name:          "Invalid Builder Schema",
-			builderSchema: "invalid",
-			builderCfg:    BuilderConfig{},
-			assertions: func(t *testing.T, builder Builder, err error) {
-				require.Error(t, err)
-				require.Equal(t, fmt.Sprintf("unknown schema %q", "invalid"), err.Error())
-				require.Nil(t, builder)
-			},
-		},
+func (cb *concurrencyBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	cb.mu.Lock()
+	cb.current++
+	if cb.current > cb.peak {
+		cb.peak = cb.current
 	}
+	cb.mu.Unlock()
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			template := NewTemplate()
-			builder, err := template.builderForSchema(tc.builderSchema, tc.builderCfg)
-			tc.assertions(t, builder, err)
-		})
-	}
+	time.Sleep(10 * time.Millisecond)
 
+	cb.mu.Lock()
+	cb.current--
+	cb.mu.Unlock()
+	return fmt.Errorf("build error for %s!", dir)
 }
 
-var validCatalog = `
-schema: olm.composite.catalogs
-catalogs:
-  - name: first-catalog
-    destination:
-      workingDir: contributions/first-catalog
-    builders:
-      - olm.builder.semver
-      - olm.builder.basic
-  - name: second-catalog
-    destination:
-      workingDir: contributions/second-catalog
-    builders:
-      - olm.builder.semver
-  - name: test-catalog
-    destination:
-      workingDir: contributions/test-catalog
-    builders:
-      - olm.builder.custom`
+func (cb *concurrencyBuilder) Validate(ctx context.Context, dir string) error {
+	return nil
+}
 
-var unmarshalFail = `
-invalid
-`
+func (cb *concurrencyBuilder) Schema() string {
+	return TestBuilderSchema
+}
 
-var invalidSchemaCatalog = `
-schema: invalid
-catalogs:
-  - name: first-catalog
-    destination:
-      workingDir: contributions/first-catalog
-    builders:
-      - olm.builder.semver
-      - olm.builder.basic
-`
+func (cb *concurrencyBuilder) ValidateConfig(td TemplateDefinition) error {
+	return nil
+}
 
-func TestParseCatalogSpec(t *testing.T) {
-	type testCase struct {
-		name       string
-		catalog    string
-		assertions func(t *testing.T, catalog *CatalogConfig, err error)
+func TestCompositeRenderConcurrency(t *testing.T) {
+	var catalogs, components strings.Builder
+	catalogs.WriteString("schema: olm.composite.catalogs\ncatalogs:\n")
+	components.WriteString("schema: olm.composite\ncomponents:\n")
+	expectedErrs := []string{}
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&catalogs, "  - name: catalog-%d\n    destination:\n      workingDir: contributions/catalog-%d\n    builders:\n      - olm.builder.test\n", i, i)
+		fmt.Fprintf(&components, "  - name: catalog-%d\n    destination:\n      path: operator-%d\n    strategy:\n      name: test\n      template:\n        schema: olm.builder.test\n", i, i)
+		expectedErrs = append(expectedErrs, fmt.Sprintf("building component \"catalog-%d\": build error for operator-%d!", i, i))
 	}
 
-	testCases := []testCase{
-		{
-			name:    "Valid catalog configuration",
-			catalog: validCatalog,
-			assertions: func(t *testing.T, catalog *CatalogConfig, err error) {
-				require.NoError(t, err)
-				require.Equal(t, 3, len(catalog.Catalogs))
-			},
-		},
-		{
-			name:    "Unmarshal failure",
-			catalog: unmarshalFail,
-			assertions: func(t *testing.T, catalog *CatalogConfig, err error) {
-				require.Error(t, err)
-				require.Equal(t, "unmarshalling catalog config: json: cannot unmarshal string into Go value of type composite.CatalogConfig", err.Error())
-			},
-		},
-		{
-			name:    "Invalid schema",
-			catalog: invalidSchemaCatalog,
-			assertions: func(t *testing.T, catalog *CatalogConfig, err error) {
-				require.Error(t, err)
-				require.Equal(t, fmt.Sprintf("catalog configuration file has unknown schema, should be %q", CatalogSchema), err.Error())
-			},
-		},
+	builder := &concurrencyBuilder{}
+	template := NewTemplate(
+		WithAtomicOutput(false),
+		WithCatalogFile(strings.NewReader(catalogs.String())),
+		WithContributionFile(strings.NewReader(components.String())),
+		WithMaxConcurrency(2),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
 	}
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			template := NewTemplate(WithCatalogFile(strings.NewReader(tc.catalog)))
-			catalog, err := template.parseCatalogsSpec()
-			tc.assertions(t, catalog, err)
-		})
+	err := template.Render(context.Background(), true)
+	require.Error(t, err)
+	// errors are reported in component order regardless of completion order
+	require.Equal(t, "["+strings.Join(expectedErrs, ", ")+"]", err.Error())
+	require.LessOrEqual(t, builder.peak, 2)
+}
+
+// waitingBuilder writes its output once the file at wait exists.
+type waitingBuilder struct {
+	fileWritingBuilder
+	wait string
+}
+
+func (wb *waitingBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	for i := 0; i < 500; i++ {
+		if _, err := os.Stat(wb.wait); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
+	return wb.fileWritingBuilder.Build(ctx, reg, dir, td)
 }
 
-var validComposite = `
+func TestCompositeRenderSandboxConcurrentCatalogs(t *testing.T) {
+	// the sandbox check watches the current directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer func() { require.NoError(t, os.Chdir(wd)) }()
+	require.NoError(t, os.WriteFile("custom.yaml", []byte(customYaml), 0o666))
+
+	catalogs := `
+schema: olm.composite.catalogs
+catalogs:
+  - name: cat-a
+    destination:
+      workingDir: cat-a
+    builders:
+      - olm.builder.custom
+  - name: cat-b
+    destination:
+      workingDir: cat-b
+    builders:
+      - olm.builder.test
+`
+	// the custom command of cat-a only finishes once cat-b has written its
+	// output, which only happens once the command has started
+	script := "mkdir -p cat-a && touch cat-a/started && for i in $(seq 500); do [ -f cat-b/pkg/catalog.yaml ] && break; sleep 0.01; done && cat custom.yaml"
+	components := fmt.Sprintf(`
 schema: olm.composite
 components:
-  - name: first-catalog
+  - name: cat-a
     destination:
-      path: my-operator
+      path: pkg
     strategy:
-      name: semver
+      name: custom
       template:
-        schema: olm.builder.semver
+        schema: olm.builder.custom
         config:
-          input: components/contribution1.yaml
+          command: sh
+          args: ["-c", %q]
           output: catalog.yaml
-`
-
-var invalidSchemaComposite = `
-schema: invalid
-components:
-  - name: first-catalog
+          strictSandbox: true
+  - name: cat-b
     destination:
-      path: my-operator
+      path: pkg
     strategy:
-      name: semver
+      name: test
       template:
-        schema: olm.builder.semver
-        config:
-          input: components/contribution1.yaml
-          output: catalog.yaml
-`
+        schema: olm.builder.test
+`, script)
 
-func TestParseContributionSpec(t *testing.T) {
-	type testCase struct {
-		name       string
-		composite  string
-		assertions func(t *testing.T, composite *CompositeConfig, err error)
+	template := NewTemplate(
+		WithCatalogFile(strings.NewReader(catalogs)),
+		WithContributionFile(strings.NewReader(components)),
+		WithMaxConcurrency(2),
+		WithRegisteredBuilder(TestBuilderSchema, func(bc BuilderConfig) Builder {
+			return &waitingBuilder{fileWritingBuilder: fileWritingBuilder{builderCfg: bc}, wait: filepath.Join("cat-a", "started")}
+		}, true),
+	)
+	require.NoError(t, template.Render(context.Background(), false))
+	require.FileExists(t, filepath.Join("cat-a", "pkg", "catalog.yaml"))
+	require.FileExists(t, filepath.Join("cat-b", "pkg", "catalog.yaml"))
+}
+
+type cancellingBuilder struct {
+	cancel context.CancelFunc
+	built  []string
+}
+
+func (cb *cancellingBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	cb.built = append(cb.built, dir)
+	cb.cancel()
+	return nil
+}
+
+func (cb *cancellingBuilder) Validate(ctx context.Context, dir string) error {
+	return nil
+}
+
+func (cb *cancellingBuilder) Schema() string {
+	return TestBuilderSchema
+}
+
+func (cb *cancellingBuilder) ValidateConfig(td TemplateDefinition) error {
+	return nil
+}
+
+func TestCompositeRenderCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	multiDestComposite := strings.Replace(renderMultiComposite, "path: my-operator", "path: first-operator", 1)
+	builder := &cancellingBuilder{cancel: cancel}
+	template := NewTemplate(
+		WithAtomicOutput(false),
+		WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+		WithContributionFile(strings.NewReader(multiDestComposite)),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
 	}
 
-	testCases := []testCase{
+	err := template.Render(ctx, false)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, "building component \"second-catalog\": context canceled", err.Error())
+	require.Equal(t, []string{"first-operator"}, builder.built)
+}
+
+func TestFetchCatalogConfigCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := FetchCatalogConfig(ctx, "http://some-path.com", http.DefaultClient)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestCompositeRenderDryRun(t *testing.T) {
+	t.Run("prints the build plan without building", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+			WithContributionFile(strings.NewReader(renderMultiComposite)),
+			WithOutputType("yaml"),
+			WithDryRun(true),
+			WithDryRunOutput(out),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{buildShouldError: true} },
+		}
+
+		err := template.Render(context.Background(), true)
+		require.NoError(t, err)
+		require.Equal(t, `COMPONENT       CATALOG         SCHEMA            DESTINATION  OUTPUT
+first-catalog   first-catalog   olm.builder.test  my-operator  yaml
+second-catalog  second-catalog  olm.builder.test  my-operator  yaml
+`, out.String())
+	})
+
+	t.Run("fails on unresolvable components", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(renderValidCatalog)),
+			WithContributionFile(strings.NewReader(renderInvalidBuilderComposite)),
+			WithDryRun(true),
+			WithDryRunOutput(out),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{} },
+		}
+
+		err := template.Render(context.Background(), true)
+		require.Error(t, err)
+		require.Equal(t, "building component \"first-catalog\": unknown template schema \"olm.builder.invalid\", registered schemas are: [olm.builder.test]", err.Error())
+		require.Empty(t, out.String())
+	})
+}
+
+type recordingBuilder struct {
+	mu        sync.Mutex
+	built     []string
+	validated []string
+}
+
+func (rb *recordingBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.built = append(rb.built, dir)
+	return nil
+}
+
+func (rb *recordingBuilder) Validate(ctx context.Context, dir string) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.validated = append(rb.validated, dir)
+	return nil
+}
+
+func (rb *recordingBuilder) Schema() string {
+	return TestBuilderSchema
+}
+
+func (rb *recordingBuilder) ValidateConfig(td TemplateDefinition) error {
+	return nil
+}
+
+func TestCompositeRenderComponentFilter(t *testing.T) {
+	multiDestComposite := strings.Replace(renderMultiComposite, "path: my-operator", "path: first-operator", 1)
+
+	t.Run("renders only the filtered components", func(t *testing.T) {
+		builder := &recordingBuilder{}
+		template := NewTemplate(
+			WithAtomicOutput(false),
+			WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+			WithContributionFile(strings.NewReader(multiDestComposite)),
+			WithComponentFilter("second-catalog"),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+		}
+
+		require.NoError(t, template.Render(context.Background(), true))
+		require.Equal(t, []string{"my-operator"}, builder.built)
+		require.Equal(t, []string{"my-operator"}, builder.validated)
+	})
+
+	t.Run("unknown filter names", func(t *testing.T) {
+		template := NewTemplate(
+			WithAtomicOutput(false),
+			WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+			WithContributionFile(strings.NewReader(multiDestComposite)),
+			WithComponentFilter("second-catalog", "missing"),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &recordingBuilder{} },
+		}
+
+		err := template.Render(context.Background(), true)
+		require.Error(t, err)
+		require.Equal(t, "component filter references components that do not exist in the composite configuration: [missing]. Available components are: [first-catalog second-catalog]", err.Error())
+	})
+}
+
+type fileWritingBuilder struct {
+	builderCfg       BuilderConfig
+	buildShouldError bool
+	// data is written to catalog.yaml, instead of basicYaml if set
+	data string
+}
+
+func (fb *fileWritingBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	if fb.buildShouldError {
+		return fmt.Errorf("build error!")
+	}
+	destDir := path.Join(fb.builderCfg.WorkingDir, dir)
+	if err := os.MkdirAll(destDir, 0o777); err != nil {
+		return err
+	}
+	data := fb.data
+	if data == "" {
+		data = basicYaml
+	}
+	return os.WriteFile(path.Join(destDir, "catalog.yaml"), []byte(data), 0o666)
+}
+
+func (fb *fileWritingBuilder) Validate(ctx context.Context, dir string) error {
+	return nil
+}
+
+func (fb *fileWritingBuilder) Schema() string {
+	return TestBuilderSchema
+}
+
+func (fb *fileWritingBuilder) ValidateConfig(td TemplateDefinition) error {
+	return nil
+}
+
+func TestCompositeRenderWithReport(t *testing.T) {
+	testDir := t.TempDir()
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %[1]s/first-catalog
+    builders:
+      - olm.builder.test
+  - name: second-catalog
+    destination:
+      workingDir: %[1]s/second-catalog
+    builders:
+      - olm.builder.test
+`, testDir)
+	template := NewTemplate(
+		WithCatalogFile(strings.NewReader(catalogs)),
+		WithContributionFile(strings.NewReader(renderMultiComposite)),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder {
+			return &fileWritingBuilder{builderCfg: bc, buildShouldError: strings.HasSuffix(bc.WorkingDir, "second-catalog")}
+		},
+	}
+
+	report, err := template.RenderWithReport(context.Background(), true)
+	require.Error(t, err)
+	require.Len(t, report.Components, 2)
+
+	first := report.Components[0]
+	require.Equal(t, "first-catalog", first.Name)
+	require.Equal(t, "first-catalog", first.Catalog)
+	require.Equal(t, TestBuilderSchema, first.Schema)
+	require.Equal(t, path.Join(testDir, "first-catalog", "my-operator"), first.Destination)
+	require.Equal(t, []string{path.Join(testDir, "first-catalog", "my-operator", "catalog.yaml")}, first.Files)
+	require.Equal(t, ValidationPassed, first.Validation)
+	require.NoError(t, first.Err)
+
+	// the builder of the second catalog fails
+	second := report.Components[1]
+	require.Equal(t, "second-catalog", second.Name)
+	require.Equal(t, ValidationSkipped, second.Validation)
+	require.Empty(t, second.Files)
+	require.EqualError(t, second.Err, "building component \"second-catalog\": build error!")
+	require.Equal(t, []ComponentReport{second}, report.Failed())
+}
+
+func TestCompositeRenderPruneStaleOutputs(t *testing.T) {
+	testDir := t.TempDir()
+	workingDir := filepath.Join(testDir, "first-catalog")
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s
+    builders:
+      - olm.builder.test
+`, workingDir)
+	for name, data := range map[string]string{
+		"old-operator/catalog.yaml": "schema: olm.package\nname: old-operator\n",
+		"my-operator/extra.yaml":    "not fbc",
+		"README.md":                 "# catalog",
+		"inputs/basic.yaml":         "schema: olm.template.basic\nentries: []\n",
+		"empty.yaml":                "",
+		"notes/catalog.yaml":        "schema: olm.package\nname: notes\n",
+		".indexignore":              "notes/\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(workingDir, name)), 0o777))
+		require.NoError(t, os.WriteFile(filepath.Join(workingDir, name), []byte(data), 0o666))
+	}
+	render := func(opts ...TemplateOption) (*RenderReport, error) {
+		template := NewTemplate(append([]TemplateOption{
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(renderValidComposite)),
+			WithPruneStaleOutputs(true),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc} },
+		}
+		return template.RenderWithReport(context.Background(), false)
+	}
+	stale := []string{
+		filepath.Join(workingDir, "README.md"),
+		filepath.Join(workingDir, "empty.yaml"),
+		filepath.Join(workingDir, "inputs", "basic.yaml"),
+		filepath.Join(workingDir, "old-operator", "catalog.yaml"),
+	}
+
+	_, err := render()
+	require.EqualError(t, err, fmt.Sprintf("pruning stale outputs: [refusing to prune %q, which does not look like generated FBC: it is not a YAML or JSON file, "+
+		"refusing to prune %q, which does not look like generated FBC: it contains no FBC blobs, "+
+		"refusing to prune %q, which does not look like generated FBC: it contains a blob with schema \"olm.template.basic\"]", stale[0], stale[1], stale[2]))
+	for _, p := range stale {
+		require.FileExists(t, p)
+	}
+
+	out := &bytes.Buffer{}
+	report, err := render(WithDryRun(true), WithDryRunOutput(out), WithForcePrune(true))
+	require.NoError(t, err)
+	require.Equal(t, stale, report.Pruned)
+	require.Contains(t, out.String(), fmt.Sprintf("would prune %s\nwould prune %s\nwould prune %s\nwould prune %s\n", stale[0], stale[1], stale[2], stale[3]))
+	require.FileExists(t, stale[0])
+
+	report, err = render(WithForcePrune(true))
+	require.NoError(t, err)
+	require.Equal(t, stale, report.Pruned)
+	require.NoFileExists(t, stale[0])
+	require.NoDirExists(t, filepath.Join(workingDir, "old-operator"))
+	require.NoDirExists(t, filepath.Join(workingDir, "inputs"))
+	require.FileExists(t, filepath.Join(workingDir, "notes", "catalog.yaml"))
+	require.FileExists(t, filepath.Join(workingDir, "my-operator", "extra.yaml"))
+	require.FileExists(t, filepath.Join(workingDir, "my-operator", "catalog.yaml"))
+	require.FileExists(t, filepath.Join(workingDir, ".indexignore"))
+}
+
+func TestCompositeRenderPruneOutputLayoutChange(t *testing.T) {
+	testDir := t.TempDir()
+	input := filepath.Join(testDir, "input.yaml")
+	require.NoError(t, os.WriteFile(input, []byte("schema: olm.package\nname: foo\n"), 0o666))
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s/first-catalog
+    builders:
+      - olm.builder.raw
+`, testDir)
+	composite := fmt.Sprintf(`
+schema: olm.composite
+components:
+  - name: first-catalog
+    destination:
+      path: my-operator
+    strategy:
+      name: raw
+      template:
+        schema: olm.builder.raw
+        config:
+          input: %s
+          output: catalog.json
+`, input)
+	render := func(layout string) *RenderReport {
+		report, err := NewTemplate(
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(composite)),
+			WithOutputLayout(layout),
+			WithPruneStaleOutputs(true),
+		).RenderWithReport(context.Background(), false)
+		require.NoError(t, err)
+		return report
+	}
+	dest := filepath.Join(testDir, "first-catalog", "my-operator")
+
+	require.Empty(t, render("single-file").Pruned)
+	require.FileExists(t, filepath.Join(dest, "catalog.json"))
+
+	require.Equal(t, []string{filepath.Join(dest, "catalog.json")}, render("per-package").Pruned)
+	require.FileExists(t, filepath.Join(dest, "foo", "catalog.json"))
+	require.NoFileExists(t, filepath.Join(dest, "catalog.json"))
+
+	require.Equal(t, []string{filepath.Join(dest, "foo", "catalog.json")}, render("single-file").Pruned)
+	require.NoDirExists(t, filepath.Join(dest, "foo"))
+	require.FileExists(t, filepath.Join(dest, "catalog.json"))
+}
+
+func TestCompositeRenderCatalogValidation(t *testing.T) {
+	testDir := t.TempDir()
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s/first-catalog
+    builders:
+      - olm.builder.test
+`, testDir)
+	render := func(composite string) error {
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(composite)),
+			WithCatalogValidation(true),
+			WithPackageConflictWarnings(true),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc, data: basicBuiltFbcYaml} },
+		}
+		return template.Render(context.Background(), false)
+	}
+
+	require.NoError(t, render(renderValidComposite))
+
+	// both components write the webhook-operator package
+	err := render(renderValidComposite + `
+  - name: second-operator
+    catalog: first-catalog
+    destination:
+      path: second-operator
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+        config:
+          input: components/contribution2.yaml
+          output: catalog.yaml
+`)
+	require.ErrorContains(t, err, `catalog "first-catalog" failed validation: package "webhook-operator", contributed by component(s) "first-catalog", "second-operator": `)
+}
+
+func TestCompositeRenderPackageConflicts(t *testing.T) {
+	testDir := t.TempDir()
+	composite := renderValidComposite + `
+  - name: second-operator
+    catalog: first-catalog
+    destination:
+      path: second-operator
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+        config:
+          input: components/contribution2.yaml
+          output: catalog.yaml
+`
+	render := func(sharedPackages string, opts ...TemplateOption) (*RenderReport, error) {
+		catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s/first-catalog
+    builders:
+      - olm.builder.test
+    sharedPackages: [%s]
+`, testDir, sharedPackages)
+		template := NewTemplate(append([]TemplateOption{
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(composite)),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc, data: basicBuiltFbcYaml} },
+		}
+		return template.RenderWithReport(context.Background(), false)
+	}
+	conflict := PackageConflict{Catalog: "first-catalog", Package: "webhook-operator", Components: []string{"first-catalog", "second-operator"}}
+
+	report, err := render("")
+	require.EqualError(t, err, `components write the same packages: package "webhook-operator" of catalog "first-catalog" is written by components "first-catalog" and "second-operator", list it in the catalog's sharedPackages if this is intended`)
+	require.Equal(t, []PackageConflict{conflict}, report.PackageConflicts)
+	require.Equal(t, []string{"webhook-operator"}, report.Components[1].Packages)
+
+	out := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(out)
+	report, err = render("", WithPackageConflictWarnings(true), WithLogger(logrus.NewEntry(logger)))
+	require.NoError(t, err)
+	require.Equal(t, []PackageConflict{conflict}, report.PackageConflicts)
+	require.Contains(t, out.String(), "level=warning")
+
+	report, err = render("webhook-operator")
+	require.NoError(t, err)
+	require.Empty(t, report.PackageConflicts)
+}
+
+func TestCompositeRenderDeprecations(t *testing.T) {
+	testDir := t.TempDir()
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s/first-catalog
+    builders:
+      - olm.builder.test
+      - olm.builder.other
+`, testDir)
+	render := func(deprecations string, opts ...TemplateOption) error {
+		composite := renderValidComposite + deprecations + `
+  - name: other-operator
+    catalog: first-catalog
+    destination:
+      path: other-operator
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.other
+        config:
+          output: catalog.yaml
+`
+		template := NewTemplate(append([]TemplateOption{
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(composite)),
+			WithOutputType(string(OutputTypeYAML)),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc, data: basicBuiltFbcYaml} },
+			"olm.builder.other": func(bc BuilderConfig) Builder {
+				return &fileWritingBuilder{builderCfg: bc, data: "schema: olm.package\nname: other-operator\n"}
+			},
+		}
+		return template.Render(context.Background(), false)
+	}
+
+	require.NoError(t, render(`
+    deprecations:
+      - package: webhook-operator
+        entries:
+          - reference:
+              schema: olm.bundle
+              name: webhook-operator.v0.0.1
+            message: use webhook-operator.v0.0.2 instead
+          - reference:
+              schema: olm.channel
+              name: preview
+            message: the preview channel is no longer updated
+`))
+	data, err := os.ReadFile(filepath.Join(testDir, "first-catalog", "my-operator", "deprecations.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, `---
+entries:
+- message: use webhook-operator.v0.0.2 instead
+  reference:
+    name: webhook-operator.v0.0.1
+    schema: olm.bundle
+- message: the preview channel is no longer updated
+  reference:
+    name: preview
+    schema: olm.channel
+package: webhook-operator
+schema: olm.deprecations
+`, string(data))
+	require.NoFileExists(t, filepath.Join(testDir, "first-catalog", "other-operator", "deprecations.yaml"))
+
+	err = render(`
+    deprecations:
+      - package: webhook-operator
+        entries:
+          - reference:
+              schema: olm.channel
+              name: stable
+            message: the stable channel is no longer updated
+`)
+	require.ErrorContains(t, err, `building component "first-catalog": deprecations are not in the component's output: deprecated olm.channel "stable" of package "webhook-operator" is not defined`)
+
+	// deprecating the package of another component of the catalog
+	otherPackage := `
+    deprecations:
+      - package: other-operator
+        entries:
+          - reference:
+              schema: olm.package
+            message: other-operator is no longer maintained
+`
+	require.ErrorContains(t, render(otherPackage), `deprecated package "other-operator" is not defined`)
+	require.NoError(t, render(otherPackage, WithCrossComponentDeprecations(true)))
+	err = render(strings.Replace(otherPackage, "other-operator\n", "missing-operator\n", 1), WithCrossComponentDeprecations(true))
+	require.EqualError(t, err, `component "first-catalog" has deprecations that are not in catalog "first-catalog": deprecated package "missing-operator" is not defined`)
+
+	err = render(`
+    deprecations:
+      - package: webhook-operator
+        entries:
+          - reference:
+              schema: olm.csv
+              name: webhook-operator.v0.0.1
+      - entries:
+          - reference:
+              schema: olm.package
+            message: deprecated
+`)
+	require.EqualError(t, err, `composite configuration file is invalid: [contribution-config[0]: component "first-catalog" has a deprecation entry with unsupported schema "olm.csv", expected one of [olm.package olm.channel olm.bundle], contribution-config[0]: component "first-catalog" has a deprecation entry without a message, contribution-config[0]: component "first-catalog" has a deprecation without a package]`)
+}
+
+func TestRun(t *testing.T) {
+	testDir := t.TempDir()
+	catalogPath := filepath.Join(testDir, "catalogs.yaml")
+	require.NoError(t, os.WriteFile(catalogPath, []byte(fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s/first-catalog
+    builders:
+      - olm.builder.test
+`, testDir)), 0o666))
+	contributionDir := filepath.Join(testDir, "contributions")
+	require.NoError(t, os.Mkdir(contributionDir, 0o777))
+	require.NoError(t, os.WriteFile(filepath.Join(contributionDir, "composite.yaml"), []byte(renderValidComposite), 0o666))
+	builder := WithRegisteredBuilder(TestBuilderSchema, func(bc BuilderConfig) Builder {
+		return &fileWritingBuilder{builderCfg: bc, data: basicBuiltFbcYaml}
+	}, false)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/composite.yaml" || r.URL.Query().Get("ref") != "main" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(renderValidComposite))
+	}))
+	defer server.Close()
+
+	for name, contributionPath := range map[string]string{
+		"contribution file":                filepath.Join(contributionDir, "composite.yaml"),
+		"contribution directory":           contributionDir,
+		"contribution URL with a query":    server.URL + "/composite.yaml?ref=main",
+		"contribution URL with glob chars": server.URL + "/composite.yaml?ref=main&sig=[abc]",
+	} {
+		t.Run(name, func(t *testing.T) {
+			report, err := Run(context.Background(), RunOptions{
+				CatalogConfigPath: catalogPath,
+				ContributionPath:  contributionPath,
+				OutputType:        string(OutputTypeYAML),
+				Validate:          true,
+				TemplateOptions:   []TemplateOption{builder},
+			})
+			require.NoError(t, err)
+			require.Len(t, report.Components, 1)
+			require.Equal(t, ValidationPassed, report.Components[0].Validation)
+			require.FileExists(t, filepath.Join(testDir, "first-catalog", "my-operator", "catalog.yaml"))
+		})
+	}
+
+	report, err := Run(context.Background(), RunOptions{
+		CatalogConfigPath: catalogPath,
+		ContributionPath:  contributionDir,
+		ValidateOnly:      true,
+		TemplateOptions:   []TemplateOption{builder},
+	})
+	require.NoError(t, err)
+	require.Equal(t, ValidationPassed, report.Components[0].Validation)
+
+	_, err = Run(context.Background(), RunOptions{
+		CatalogConfigPath:   catalogPath,
+		CatalogConfigDigest: digest.FromString("").String(),
+		ContributionPath:    contributionDir,
+	})
+	require.ErrorContains(t, err, "digest")
+
+	_, err = Run(context.Background(), RunOptions{CatalogConfigPath: catalogPath})
+	require.EqualError(t, err, "a contribution path is required")
+}
+
+func TestRenderToConfig(t *testing.T) {
+	testDir := t.TempDir()
+	for name, data := range map[string]string{
+		"foo.yaml": "schema: olm.package\nname: foo\n",
+		"bar.yaml": "schema: olm.package\nname: bar\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(testDir, name), []byte(data), 0o666))
+	}
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %[1]s/first-catalog
+    builders:
+      - olm.builder.raw
+  - name: second-catalog
+    destination:
+      workingDir: %[1]s/second-catalog
+    builders:
+      - olm.builder.raw
+`, testDir)
+	composite := fmt.Sprintf(`
+schema: olm.composite
+components:
+  - name: foo
+    catalog: first-catalog
+    destination:
+      path: foo
+    strategy:
+      name: raw
+      template:
+        schema: olm.builder.raw
+        config:
+          input: %[1]s/foo.yaml
+  - name: bar
+    catalog: first-catalog
+    destination:
+      path: bar
+    strategy:
+      name: raw
+      template:
+        schema: olm.builder.raw
+        config:
+          input: %[1]s/bar.yaml
+  - name: second-catalog
+    destination:
+      path: foo
+    strategy:
+      name: raw
+      template:
+        schema: olm.builder.raw
+        config:
+          input: %[1]s/foo.yaml
+`, testDir)
+
+	configs, err := NewTemplate(
+		WithCatalogFile(strings.NewReader(catalogs)),
+		WithContributionFile(strings.NewReader(composite)),
+		// the components are fragments without channels
+		WithValidate(true),
+		WithValidationLevel(string(ValidationLevelLoad)),
+	).RenderToConfig(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[string]*declcfg.DeclarativeConfig{
+		"first-catalog": {Packages: []declcfg.Package{
+			{Schema: declcfg.SchemaPackage, Name: "foo"},
+			{Schema: declcfg.SchemaPackage, Name: "bar"},
+		}},
+		"second-catalog": {Packages: []declcfg.Package{{Schema: declcfg.SchemaPackage, Name: "foo"}}},
+	}, configs)
+	require.NoDirExists(t, filepath.Join(testDir, "first-catalog"))
+	require.NoDirExists(t, filepath.Join(testDir, "second-catalog"))
+
+	t.Run("builders must render in memory", func(t *testing.T) {
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(renderValidCatalog)),
+			WithContributionFile(strings.NewReader(renderValidComposite)),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{} },
+		}
+		_, err := template.RenderToConfig(context.Background())
+		require.EqualError(t, err, "building component \"first-catalog\": the builder for schema \"olm.builder.test\" can't render in memory")
+	})
+}
+
+func TestCompositeRenderSummaryFile(t *testing.T) {
+	testDir := t.TempDir()
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %[1]s/first-catalog
+    builders:
+      - olm.builder.test
+  - name: second-catalog
+    destination:
+      workingDir: %[1]s/second-catalog
+    builders:
+      - olm.builder.test
+`, testDir)
+	summaryPath := filepath.Join(testDir, "reports", "summary.json")
+	template := NewTemplate(
+		WithCatalogFile(strings.NewReader(catalogs)),
+		WithContributionFile(strings.NewReader(renderMultiComposite)),
+		WithSummaryFile(summaryPath),
+		WithMaxConcurrency(2),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder {
+			return &fileWritingBuilder{builderCfg: bc, buildShouldError: strings.HasSuffix(bc.WorkingDir, "second-catalog")}
+		},
+	}
+
+	_, renderErr := template.RenderWithReport(context.Background(), true)
+	require.Error(t, renderErr)
+
+	data, err := os.ReadFile(summaryPath)
+	require.NoError(t, err)
+	var summary RenderSummary
+	require.NoError(t, json.Unmarshal(data, &summary))
+
+	require.Equal(t, SummarySchema, summary.Schema)
+	require.Equal(t, renderErr.Error(), summary.Error)
+	require.Equal(t, SummaryOptions{
+		Validate:       true,
+		OutputType:     "json",
+		MaxConcurrency: 2,
+		AtomicOutput:   true,
+	}, summary.Options)
+	require.Len(t, summary.Components, 2)
+
+	first := summary.Components[0]
+	require.Equal(t, "first-catalog", first.Name)
+	require.Equal(t, TestBuilderSchema, first.Schema)
+	require.Equal(t, path.Join(testDir, "first-catalog", "my-operator"), first.Destination)
+	require.Equal(t, []FileSummary{{
+		Path:   path.Join(testDir, "first-catalog", "my-operator", "catalog.yaml"),
+		Digest: digest.FromString(basicYaml).String(),
+	}}, first.Files)
+	require.Equal(t, ValidationPassed, first.Validation)
+	require.Empty(t, first.Error)
+
+	second := summary.Components[1]
+	require.Equal(t, "second-catalog", second.Name)
+	require.Empty(t, second.Files)
+	require.Equal(t, ValidationSkipped, second.Validation)
+	require.Equal(t, "building component \"second-catalog\": build error!", second.Error)
+}
+
+func TestCompositeRenderUnusedEntries(t *testing.T) {
+	catalogs := renderMultiCatalog + `
+  - name: third-catalog
+    destination:
+      workingDir: contributions/third-catalog
+    builders:
+      - olm.builder.test
+`
+	catalogs = strings.Replace(catalogs, "      - olm.builder.test\n  - name: second-catalog", "      - olm.builder.test\n      - olm.builder.unused\n  - name: second-catalog", 1)
+	render := func(t *testing.T, opts ...TemplateOption) (*RenderReport, error) {
+		template := NewTemplate(append([]TemplateOption{
+			WithAtomicOutput(false),
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(renderMultiComposite)),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema:    func(bc BuilderConfig) Builder { return &recordingBuilder{} },
+			"olm.builder.unused": func(bc BuilderConfig) Builder { return &recordingBuilder{} },
+		}
+		return template.RenderWithReport(context.Background(), false)
+	}
+	expected := ValidationErrors{
+		{Catalog: "first-catalog", Field: "builders", Path: "catalogs[0].builders[1]", Message: "builder \"olm.builder.unused\" is not used by any component"},
+		{Catalog: "third-catalog", Field: "name", Path: "catalogs[2].name", Message: "catalog is not targeted by any component"},
+	}
+
+	t.Run("unused entries are reported as warnings", func(t *testing.T) {
+		report, err := render(t)
+		require.NoError(t, err)
+		require.Equal(t, expected, report.Warnings)
+	})
+
+	t.Run("filtered components still count as used", func(t *testing.T) {
+		report, err := render(t, WithComponentFilter("second-catalog"))
+		require.NoError(t, err)
+		require.Equal(t, expected, report.Warnings)
+	})
+
+	t.Run("strict mode fails the render", func(t *testing.T) {
+		report, err := render(t, WithStrictUnused(true))
+		require.EqualError(t, err, "catalog configuration has unused entries: \nCatalog first-catalog:\n  - builder \"olm.builder.unused\" is not used by any component\n\nCatalog third-catalog:\n  - catalog is not targeted by any component\n")
+		require.Empty(t, report.Warnings)
+		require.Len(t, report.Components, 2)
+
+		var unused ValidationErrors
+		require.ErrorAs(t, err, &unused)
+		require.Equal(t, expected, unused)
+	})
+}
+
+func TestTemplateConfigs(t *testing.T) {
+	newTemplate := func(catalogs string) (*Template, *recordingBuilder) {
+		builder := &recordingBuilder{}
+		template := NewTemplate(
+			WithAtomicOutput(false),
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(renderMultiComposite)),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+		}
+		return template, builder
+	}
+
+	t.Run("configs are parsed once and reused by render", func(t *testing.T) {
+		template, builder := newTemplate(renderMultiCatalog)
+
+		catalogConfig, err := template.CatalogConfig()
+		require.NoError(t, err)
+		require.Len(t, catalogConfig.Catalogs, 2)
+		require.Equal(t, "first-catalog", catalogConfig.Catalogs[0].Name)
+
+		contributionConfig, err := template.ContributionConfig()
+		require.NoError(t, err)
+		require.Len(t, contributionConfig.Components, 2)
+
+		again, err := template.ContributionConfig()
+		require.NoError(t, err)
+		require.Same(t, contributionConfig, again)
+
+		require.NoError(t, template.Render(context.Background(), false))
+		require.NoError(t, template.Render(context.Background(), false))
+		require.Len(t, builder.built, 4)
+	})
+
+	t.Run("catalog fields are validated", func(t *testing.T) {
+		template, _ := newTemplate(strings.Replace(renderMultiCatalog, "workingDir: contributions/second-catalog", "workingDir: \"\"", 1))
+
+		_, err := template.CatalogConfig()
+		require.EqualError(t, err, "catalog configuration file field validation failed: \nCatalog second-catalog:\n  - catalog-config[0]: destination.workingDir must not be an empty string\n")
+		renderErr := template.Render(context.Background(), false)
+		require.EqualError(t, renderErr, err.Error())
+	})
+}
+
+func TestCompositeRenderTwice(t *testing.T) {
+	register := func(template *Template) *recordingBuilder {
+		builder := &recordingBuilder{}
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+		}
+		return builder
+	}
+
+	t.Run("readers are only consumed once", func(t *testing.T) {
+		template := NewTemplate(
+			WithAtomicOutput(false),
+			WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+			WithContributionFile(strings.NewReader(renderMultiComposite)),
+		)
+		builder := register(template)
+		for i := 0; i < 2; i++ {
+			report, err := template.RenderWithReport(context.Background(), true)
+			require.NoError(t, err)
+			require.Len(t, report.Components, 2)
+		}
+		require.Len(t, builder.built, 4)
+		require.Len(t, builder.validated, 4)
+	})
+
+	t.Run("parse errors are reported again", func(t *testing.T) {
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+			WithContributionFile(strings.NewReader("schema: olm.composite\ncomponents: {}\n")),
+		)
+		register(template)
+		first := template.Render(context.Background(), false)
+		require.Error(t, first)
+		require.EqualError(t, template.Render(context.Background(), false), first.Error())
+	})
+
+	t.Run("parsed configs are accepted in place of files", func(t *testing.T) {
+		parsed := NewTemplate(
+			WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+			WithContributionFile(strings.NewReader(renderMultiComposite)),
+		)
+		parsed.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &recordingBuilder{} },
+		}
+		catalogConfig, err := parsed.CatalogConfig()
+		require.NoError(t, err)
+		contributionConfig, err := parsed.ContributionConfig()
+		require.NoError(t, err)
+
+		template := NewTemplate(
+			WithAtomicOutput(false),
+			WithCatalogConfigObject(catalogConfig),
+			WithContributionConfigObject(contributionConfig),
+		)
+		builder := register(template)
+		require.NoError(t, template.Render(context.Background(), false))
+		require.NoError(t, template.Render(context.Background(), false))
+		require.Equal(t, []string{"my-operator", "my-operator", "my-operator", "my-operator"}, builder.built)
+	})
+
+	t.Run("parsed configs are validated", func(t *testing.T) {
+		template := NewTemplate(
+			WithCatalogConfigObject(&CatalogConfig{Schema: CatalogSchemaV2}),
+			WithContributionConfigObject(&CompositeConfig{Schema: "olm.composite/v0"}),
+		)
+		register(template)
+		require.EqualError(t, template.Render(context.Background(), false), "composite configuration file has unknown schema, should be \"olm.composite\"")
+	})
+}
+
+func TestCompositeRenderOutputWriter(t *testing.T) {
+	dir := t.TempDir()
+	basicTemplate := func(name string) string {
+		p := filepath.Join(dir, name+".yaml")
+		require.NoError(t, os.WriteFile(p, []byte(fmt.Sprintf("---\nschema: olm.package\nname: %s\ndefaultChannel: stable\n", name)), 0o666))
+		return p
+	}
+	component := func(name string, dest string, schema string, config string) Component {
+		return Component{
+			Name:        name,
+			Destination: ComponentDestination{Path: dest},
+			Strategy:    BuildStrategy{Name: "test", Template: TemplateDefinition{Schema: schema, Config: []byte(config)}},
+		}
+	}
+	catalogs := &CatalogConfig{
+		Schema: CatalogSchemaV2,
+		Catalogs: []Catalog{{
+			Name:        "first-catalog",
+			Destination: CatalogDestination{WorkingDir: filepath.Join(dir, "catalog")},
+			Builders:    []string{BasicBuilderSchema, TestBuilderSchema},
+		}},
+	}
+	contributions := &CompositeConfig{
+		Schema: CompositeSchema,
+		Components: []Component{
+			component("first-operator", StdoutPath, BasicBuilderSchema, fmt.Sprintf(`{"input": %q}`, basicTemplate("first-operator"))),
+			component("second-operator", StdoutPath, BasicBuilderSchema, fmt.Sprintf(`{"input": %q}`, basicTemplate("second-operator"))),
+			component("third-operator", "third-operator", TestBuilderSchema, "{}"),
+		},
+	}
+	for i := range contributions.Components {
+		contributions.Components[i].Catalog = "first-catalog"
+	}
+
+	t.Run("components with the stdout destination are streamed in order", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		report, err := NewTemplate(
+			WithCatalogConfigObject(catalogs),
+			WithContributionConfigObject(contributions),
+			WithRegisteredBuilder(TestBuilderSchema, func(bc BuilderConfig) Builder { return &TestBuilder{} }, false),
+			WithOutputType("yaml"),
+			WithMaxConcurrency(1),
+			WithOutputWriter(out),
+		).RenderWithReport(context.Background(), true)
+		require.NoError(t, err)
+		require.Equal(t, "---\ndefaultChannel: stable\nname: first-operator\nschema: olm.package\n---\ndefaultChannel: stable\nname: second-operator\nschema: olm.package\n", out.String())
+		require.Equal(t, StdoutPath, report.Components[0].Destination)
+		require.Equal(t, ValidationSkipped, report.Components[0].Validation)
+		require.Empty(t, report.Components[0].Files)
+		require.NoDirExists(t, filepath.Join(dir, "catalog", StdoutPath))
+	})
+
+	t.Run("json output is a stream of objects", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		_, err := NewTemplate(
+			WithCatalogConfigObject(catalogs),
+			WithContributionConfigObject(contributions),
+			WithRegisteredBuilder(TestBuilderSchema, func(bc BuilderConfig) Builder { return &TestBuilder{} }, false),
+			WithOutputWriter(out),
+		).RenderWithReport(context.Background(), false)
+		require.NoError(t, err)
+		dec := json.NewDecoder(out)
+		names := []string{}
+		for dec.More() {
+			var pkg declcfg.Package
+			require.NoError(t, dec.Decode(&pkg))
+			names = append(names, pkg.Name)
+		}
+		require.ElementsMatch(t, []string{"first-operator", "second-operator"}, names)
+	})
+}
+
+func TestConfigObjects(t *testing.T) {
+	catalogObject := &CatalogConfig{
+		Schema: CatalogSchemaV2,
+		Catalogs: []Catalog{
+			{Name: "first-catalog", Destination: CatalogDestination{WorkingDir: "contributions/first-catalog"}},
+			{Name: "second-catalog", Destination: CatalogDestination{WorkingDir: "contributions/second-catalog"}, Builders: []string{TestBuilderSchema}},
+		},
+	}
+	component := func(name string, dest string) Component {
+		return Component{
+			Name:        name,
+			Destination: ComponentDestination{Path: dest},
+			Strategy:    BuildStrategy{Name: "test", Template: TemplateDefinition{Schema: TestBuilderSchema}},
+		}
+	}
+
+	t.Run("catalog objects are converted without modifying them", func(t *testing.T) {
+		catalogConfig, err := NewTemplate(WithCatalogConfigObject(catalogObject)).parseCatalogsSpec()
+		require.NoError(t, err)
+		require.Equal(t, DefaultBuilders, catalogConfig.Catalogs[0].Builders)
+		require.Equal(t, []string{TestBuilderSchema}, catalogConfig.Catalogs[1].Builders)
+		require.Nil(t, catalogObject.Catalogs[0].Builders)
+	})
+
+	t.Run("contribution objects are copied", func(t *testing.T) {
+		contributionObject := &CompositeConfig{Schema: CompositeSchema, Components: []Component{component("first-catalog", "my-operator")}}
+		contributionObject.Components[0].ExpectedPackages = []string{"webhook-operator"}
+		template := NewTemplate(WithContributionConfigObject(contributionObject))
+		_, err := template.ContributionConfig()
+		require.NoError(t, err)
+
+		contributionObject.Components[0].Destination.Path = "other-operator"
+		contributionObject.Components[0].ExpectedPackages[0] = "other-operator"
+		contributionConfig, err := template.ContributionConfig()
+		require.NoError(t, err)
+		require.Equal(t, "my-operator", contributionConfig.Components[0].Destination.Path)
+		require.Equal(t, []string{"webhook-operator"}, contributionConfig.Components[0].ExpectedPackages)
+	})
+
+	t.Run("catalog object fields are validated", func(t *testing.T) {
+		invalid := &CatalogConfig{Schema: CatalogSchema, Catalogs: []Catalog{{Name: "first-catalog"}}}
+		_, err := NewTemplate(WithCatalogConfigObject(invalid)).CatalogConfig()
+		require.EqualError(t, err, "catalog configuration file field validation failed: \nCatalog first-catalog:\n  - destination.workingDir must not be an empty string\n")
+
+		_, err = NewTemplate(WithCatalogConfigObject(&CatalogConfig{Schema: "olm.composite.catalogs/v3"})).CatalogConfig()
+		require.EqualError(t, err, "catalog configuration file has unknown schema \"olm.composite.catalogs/v3\", supported schemas are: [olm.composite.catalogs olm.composite.catalogs/v2]")
+	})
+
+	t.Run("contribution object components are validated", func(t *testing.T) {
+		contributionObject := &CompositeConfig{
+			Schema:     CompositeSchema,
+			Components: []Component{component("first-catalog", "my-operator"), component("first-catalog", "other-operator")},
+		}
+		_, err := NewTemplate(WithContributionConfigObject(contributionObject)).ContributionConfig()
+		require.EqualError(t, err, "composite configuration file is invalid: duplicate component name \"first-catalog\" at components[0], components[1]")
+
+		var validationErrs ValidationErrors
+		require.ErrorAs(t, err, &validationErrs)
+		require.Equal(t, "components[1].name", validationErrs[0].Path)
+	})
+
+	t.Run("objects can't be combined with files", func(t *testing.T) {
+		_, err := NewTemplate(
+			WithCatalogConfigObject(catalogObject),
+			WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+		).parseCatalogsSpec()
+		require.EqualError(t, err, "only one of a catalog configuration file and a catalog configuration object can be provided")
+
+		_, err = NewTemplate(
+			WithContributionConfigObject(&CompositeConfig{Schema: CompositeSchema}),
+			WithContributionFile(strings.NewReader(renderMultiComposite)),
+		).parseContributionSpec()
+		require.EqualError(t, err, "only one of a composite configuration file and a composite configuration object can be provided")
+	})
+}
+
+// componentInfoBuilder records the component info it is built with.
+type componentInfoBuilder struct {
+	recordingBuilder
+	infos []ComponentInfo
+}
+
+func (cb *componentInfoBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	info, _ := ComponentInfoFromContext(ctx)
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.infos = append(cb.infos, info)
+	return nil
+}
+
+func TestCompositeRenderComponentInfo(t *testing.T) {
+	builder := &componentInfoBuilder{}
+	template := NewTemplate(
+		WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+		WithContributionFile(strings.NewReader(renderMultiComposite)),
+		WithAtomicOutput(false),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+	}
+
+	require.NoError(t, template.Render(context.Background(), false))
+	require.Equal(t, []ComponentInfo{
+		{Component: "first-catalog", Catalog: "first-catalog", Destination: "contributions/first-catalog/my-operator"},
+		{Component: "second-catalog", Catalog: "second-catalog", Destination: "contributions/second-catalog/my-operator"},
+	}, builder.infos)
+}
+
+func TestCompositeRenderComponentInfoSkipPatch(t *testing.T) {
+	builder := &componentInfoBuilder{}
+	template := NewTemplate(
+		WithCatalogFile(strings.NewReader(renderValidCatalog)),
+		WithContributionFile(strings.NewReader(strings.Replace(renderValidComposite, "      name: test\n", "      name: test\n      skipPatch: false\n", 1))),
+		WithAtomicOutput(false),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+	}
+
+	require.NoError(t, template.Render(context.Background(), false))
+	require.Len(t, builder.infos, 1)
+	require.NotNil(t, builder.infos[0].SkipPatch)
+	require.False(t, *builder.infos[0].SkipPatch)
+}
+
+// channelBuilder records the channels of a fixed catalog like the semver
+// builder does.
+type channelBuilder struct {
+	TestBuilder
+}
+
+func (cb *channelBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	bundle := func(name string, version string) declcfg.Bundle {
+		return declcfg.Bundle{
+			Schema:     declcfg.SchemaBundle,
+			Name:       name,
+			Package:    "my-operator",
+			Properties: []property.Property{property.MustBuildPackage("my-operator", version)},
+		}
+	}
+	return recordChannels(ctx, &declcfg.DeclarativeConfig{
+		Packages: []declcfg.Package{{Schema: declcfg.SchemaPackage, Name: "my-operator", DefaultChannel: "stable"}},
+		Channels: []declcfg.Channel{
+			{Schema: declcfg.SchemaChannel, Package: "my-operator", Name: "stable", Entries: []declcfg.ChannelEntry{
+				{Name: "my-operator.v1.0.0"},
+				{Name: "my-operator.v1.1.0", Replaces: "my-operator.v1.0.0"},
+			}},
+			{Schema: declcfg.SchemaChannel, Package: "my-operator", Name: "candidate", Entries: []declcfg.ChannelEntry{
+				{Name: "my-operator.v1.0.0"},
+				{Name: "my-operator.v1.1.0"},
+			}},
+		},
+		Bundles: []declcfg.Bundle{bundle("my-operator.v1.0.0", "1.0.0"), bundle("my-operator.v1.1.0", "1.1.0")},
+	})
+}
+
+func TestCompositeRenderChannels(t *testing.T) {
+	graphDir := filepath.Join(t.TempDir(), "graphs")
+	template := NewTemplate(
+		WithCatalogFile(strings.NewReader(renderValidCatalog)),
+		WithContributionFile(strings.NewReader(renderValidComposite)),
+		WithAtomicOutput(false),
+		WithChannelGraphDir(graphDir),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder { return &channelBuilder{} },
+	}
+
+	report, err := template.RenderWithReport(context.Background(), false)
+	require.NoError(t, err)
+	require.Equal(t, []ChannelSummary{
+		{Package: "my-operator", Name: "candidate", Heads: []string{"my-operator.v1.0.0", "my-operator.v1.1.0"}, Entries: 2},
+		{Package: "my-operator", Name: "stable", Heads: []string{"my-operator.v1.1.0"}, Entries: 2},
+	}, report.Components[0].Channels)
+	require.Contains(t, report.Components[0].ChannelGraph, "my-operator-stable-my-operator.v1.0.0[\"my-operator.v1.0.0\"]-- replace --> my-operator-stable-my-operator.v1.1.0")
+
+	graph, err := os.ReadFile(filepath.Join(graphDir, "first-catalog.mmd"))
+	require.NoError(t, err)
+	require.Equal(t, report.Components[0].ChannelGraph, string(graph))
+}
+
+// registryBuilder uses the registry it is built with.
+type registryBuilder struct {
+	TestBuilder
+	mu   sync.Mutex
+	regs []image.Registry
+}
+
+func (rb *registryBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.regs = append(rb.regs, reg)
+	if reg == nil {
+		return fmt.Errorf("no registry")
+	}
+	_, err := reg.Labels(ctx, image.SimpleReference("registry.example.com/missing:v1"))
+	if err == nil {
+		return fmt.Errorf("expected an error getting the labels of a missing image")
+	}
+	return nil
+}
+
+func TestCompositeRenderDefaultRegistry(t *testing.T) {
+	builder := &registryBuilder{}
+	template := NewTemplate(
+		WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+		WithContributionFile(strings.NewReader(renderMultiComposite)),
+		WithAtomicOutput(false),
+		WithMaxConcurrency(2),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+	}
+
+	require.NoError(t, template.Render(context.Background(), false))
+	require.Len(t, builder.regs, 2)
+	defaultReg := builder.regs[0].(*syncRegistry).reg.(*defaultRegistry)
+	require.Same(t, builder.regs[0], builder.regs[1])
+	require.NotNil(t, defaultReg.reg)
+	require.NoDirExists(t, defaultReg.cacheDir)
+}
+
+func TestCatalogRegistries(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(out)
+	injected := &image.MockRegistry{}
+	catalogs := map[string]Catalog{
+		"public":  {Name: "public"},
+		"other":   {Name: "other"},
+		"private": {Name: "private", Registry: &CatalogRegistry{SkipTLSVerifyHosts: []string{"registry.internal:5000", "quay.io"}}},
+	}
+
+	registries, destroy := NewTemplate(WithRegistry(injected), WithLogger(logrus.NewEntry(logger))).catalogRegistries(catalogs)
+	defer destroy()
+	require.Same(t, injected, registries["public"])
+	require.Same(t, injected, registries["other"])
+	private, ok := registries["private"].(*hostRegistry)
+	require.True(t, ok)
+	require.Equal(t, private.insecure, private.registryFor(image.SimpleReference("registry.internal:5000/my-operator-bundle:v1")))
+	require.Equal(t, private.secure, private.registryFor(image.SimpleReference("my-operator-bundle:v1")))
+	require.True(t, private.insecure.(*defaultRegistry).skipTLSVerify)
+	require.Contains(t, out.String(), `skipping TLS verification for public registry \"quay.io\"`)
+
+	t.Run("the template registry config applies to catalogs without their own", func(t *testing.T) {
+		registries, destroy := NewTemplate(WithRegistry(injected), WithRegistryConfig(CatalogRegistry{AuthFile: "auth.json"})).catalogRegistries(catalogs)
+		defer destroy()
+		require.Equal(t, "auth.json", registries["public"].(*defaultRegistry).config.AuthFile)
+		require.NotSame(t, registries["public"], registries["other"])
+		require.IsType(t, &hostRegistry{}, registries["private"])
+	})
+
+	t.Run("catalogs share a default registry", func(t *testing.T) {
+		registries, destroy := NewTemplate().catalogRegistries(map[string]Catalog{"public": {Name: "public"}, "other": {Name: "other"}})
+		defer destroy()
+		require.IsType(t, &defaultRegistry{}, registries["public"])
+		require.Same(t, registries["public"], registries["other"])
+	})
+
+	t.Run("the auth file is used by the registry", func(t *testing.T) {
+		authFile := filepath.Join(t.TempDir(), "auth.json")
+		require.NoError(t, os.WriteFile(authFile, []byte(`{"auths": {}}`), 0o600))
+		reg := &defaultRegistry{log: logrus.NewEntry(logger), config: &CatalogRegistry{AuthFile: authFile}}
+		_, err := reg.get()
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(reg.cacheDir, "auth", "config.json"))
+		require.NoError(t, reg.Destroy())
+		require.NoDirExists(t, reg.cacheDir)
+
+		reg = &defaultRegistry{log: logrus.NewEntry(logger), config: &CatalogRegistry{CAFile: authFile}}
+		_, err = reg.get()
+		require.EqualError(t, err, fmt.Sprintf("creating image registry: CA file %q contains no PEM certificates", authFile))
+	})
+}
+
+// offlineBuilder pulls a cached and an uncached image and fetches a remote
+// template input.
+type offlineBuilder struct {
+	TestBuilder
+	bc   BuilderConfig
+	errs []string
+}
+
+func (ob *offlineBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	if err := reg.Pull(ctx, image.SimpleReference("registry.example.com/cached:v1")); err != nil {
+		return err
+	}
+	err := reg.Pull(ctx, image.SimpleReference("registry.example.com/uncached:v1"))
+	ob.errs = append(ob.errs, err.Error())
+	_, err = ob.bc.fetchInput(ctx, "https://example.com/input.yaml")
+	ob.errs = append(ob.errs, err.Error())
+	_, err = pinImages(ctx, reg, &declcfg.DeclarativeConfig{Bundles: []declcfg.Bundle{{Name: "b", Image: "registry.example.com/cached:v1"}}})
+	ob.errs = append(ob.errs, err.Error())
+	return nil
+}
+
+func TestCompositeRenderOffline(t *testing.T) {
+	dials := 0
+	cached := image.SimpleReference("registry.example.com/cached:v1")
+	reg := &image.MockRegistry{
+		RemoteImages: map[image.Reference]*image.MockImage{
+			cached: {FS: fstest.MapFS{}},
+			image.SimpleReference("registry.example.com/uncached:v1"): {FS: fstest.MapFS{}},
+		},
+	}
+	require.NoError(t, reg.Pull(context.Background(), cached))
+
+	builder := &offlineBuilder{}
+	template := NewTemplate(
+		WithCatalogFile(strings.NewReader(renderValidCatalog)),
+		WithContributionFile(strings.NewReader(renderValidComposite)),
+		WithRegistry(reg),
+		WithContributionFetcher(dialCounter(&dials)),
+		WithAtomicOutput(false),
+		WithOfflineMode(true),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder {
+			builder.bc = bc
+			return builder
+		},
+	}
+
+	report, err := template.RenderWithReport(context.Background(), false)
+	require.NoError(t, err)
+	require.True(t, report.Offline)
+	require.Equal(t, []string{
+		"offline mode: image \"registry.example.com/uncached:v1\" not in cache",
+		"fetching remote template input config file \"https://example.com/input.yaml\": offline mode: not in the fetch cache",
+		"resolving digest of image \"registry.example.com/cached:v1\" for component \"first-catalog\": offline mode: can't resolve the digest of image \"registry.example.com/cached:v1\"",
+	}, builder.errs)
+	require.Zero(t, dials)
+}
+
+func TestCompositeRenderOfflineImageCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	host, cafile, err := libimage.RunDockerRegistry(ctx, "../../../pkg/image/testdata/golden")
+	require.NoError(t, err)
+
+	testDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(testDir, "basic.yaml"), []byte(fmt.Sprintf(`
+schema: olm.package
+name: kiali
+defaultChannel: stable
+---
+schema: olm.channel
+package: kiali
+name: stable
+entries:
+  - name: kiali-operator.v1.4.2
+---
+schema: olm.bundle
+image: %s/olmtest/kiali:1.4.2
+`, host)), 0o666))
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s/catalog
+    builders:
+      - olm.builder.basic
+`, testDir)
+	contributions := fmt.Sprintf(`
+schema: olm.composite
+components:
+  - name: first-catalog
+    destination:
+      path: kiali
+    strategy:
+      name: basic
+      template:
+        schema: olm.builder.basic
+        config:
+          input: %s/basic.yaml
+          output: catalog.yaml
+`, testDir)
+	render := func(cacheDir string, offline bool) error {
+		return NewTemplate(
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(contributions)),
+			WithRegistryConfig(CatalogRegistry{CAFile: cafile}),
+			WithImageCacheDir(cacheDir),
+			WithOfflineMode(offline),
+		).Render(ctx, true)
+	}
+
+	cacheDir := filepath.Join(testDir, "images")
+	require.ErrorContains(t, render(cacheDir, true), fmt.Sprintf("offline mode: image \"%s/olmtest/kiali:1.4.2\" not in cache", host))
+
+	require.NoError(t, render(cacheDir, false))
+	require.DirExists(t, filepath.Join(cacheDir, "catalogs", "first-catalog"))
+	require.NoError(t, os.RemoveAll(filepath.Join(testDir, "catalog")))
+
+	require.NoError(t, render(cacheDir, true))
+	out, err := os.ReadFile(filepath.Join(testDir, "catalog", "kiali", "catalog.yaml"))
+	require.NoError(t, err)
+	require.Contains(t, string(out), `"packageName": "kiali"`)
+	require.ErrorContains(t, render(filepath.Join(testDir, "other-images"), true), "not in cache")
+}
+
+func TestCompositeRenderLogger(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(out)
+	logger.SetLevel(logrus.DebugLevel)
+
+	var builderLog *logrus.Entry
+	template := NewTemplate(
+		WithAtomicOutput(false),
+		WithCatalogFile(strings.NewReader(renderValidCatalog)),
+		WithContributionFile(strings.NewReader(renderValidComposite)),
+		WithLogger(logrus.NewEntry(logger)),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder {
+			builderLog = bc.Log
+			return &TestBuilder{}
+		},
+	}
+
+	require.NoError(t, template.Render(context.Background(), true))
+	require.NotNil(t, builderLog)
+	require.Equal(t, "first-catalog", builderLog.Data["catalog"])
+	require.Contains(t, out.String(), "parsing catalog configuration")
+	require.Contains(t, out.String(), "building component into")
+	require.Contains(t, out.String(), "validating component")
+	require.Contains(t, out.String(), "component=first-catalog")
+}
+
+var renderInlineCatalogComposite = renderValidComposite + `catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: contributions/first-catalog
+    builders:
+      - olm.builder.test
+`
+
+func TestCompositeRenderInlineCatalogs(t *testing.T) {
+	newTemplate := func(opts ...TemplateOption) *Template {
+		template := NewTemplate(append(opts, WithAtomicOutput(false))...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{} },
+		}
+		return template
+	}
+
+	t.Run("inline catalogs are used without a catalog file", func(t *testing.T) {
+		report, err := newTemplate(WithContributionFile(strings.NewReader(renderInlineCatalogComposite))).RenderWithReport(context.Background(), true)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(report.Components))
+		require.Equal(t, "contributions/first-catalog/my-operator", report.Components[0].Destination)
+	})
+
+	t.Run("catalog file takes precedence", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		logger := logrus.New()
+		logger.SetOutput(out)
+		template := newTemplate(
+			WithCatalogFile(strings.NewReader(renderValidCatalog)),
+			WithContributionFile(strings.NewReader(strings.Replace(renderInlineCatalogComposite, "workingDir: contributions/first-catalog", "workingDir: inline", 1))),
+			WithLogger(logrus.NewEntry(logger)),
+		)
+		report, err := template.RenderWithReport(context.Background(), true)
+		require.NoError(t, err)
+		require.Equal(t, "contributions/first-catalog/my-operator", report.Components[0].Destination)
+		require.Contains(t, out.String(), "ignoring inline catalogs")
+	})
+
+	t.Run("inline catalogs are validated", func(t *testing.T) {
+		duplicated := renderInlineCatalogComposite + `  - name: first-catalog
+    destination:
+      workingDir: contributions/other
+    builders:
+      - olm.builder.test
+`
+		err := newTemplate(WithContributionFile(strings.NewReader(duplicated))).Render(context.Background(), true)
+		require.ErrorContains(t, err, "catalog name must be unique, but is defined more than once")
+
+		unknownField := strings.Replace(renderInlineCatalogComposite, "    builders:", "    owner: me\n    builders:", 1)
+		err = newTemplate(WithContributionFile(strings.NewReader(unknownField))).Render(context.Background(), true)
+		require.EqualError(t, err, "contribution-config[0]: unmarshalling composite config: catalogs[0] (\"first-catalog\"): line 18: json: unknown field \"owner\"")
+	})
+
+	t.Run("no catalogs", func(t *testing.T) {
+		err := newTemplate(WithContributionFile(strings.NewReader(renderValidComposite))).Render(context.Background(), true)
+		require.EqualError(t, err, "no catalog configuration file provided")
+	})
+}
+
+func TestCompositeValidate(t *testing.T) {
+	testDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(testDir, "first-catalog", "my-operator"), 0o777))
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %[1]s/first-catalog
+    builders:
+      - olm.builder.test
+  - name: second-catalog
+    destination:
+      workingDir: %[1]s/second-catalog
+    builders:
+      - olm.builder.test
+`, testDir)
+
+	builders := []*recordingBuilder{}
+	template := NewTemplate(
+		WithCatalogFile(strings.NewReader(catalogs)),
+		WithContributionFile(strings.NewReader(renderMultiComposite)),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		// use the real validation so that missing destinations are reported
+		TestBuilderSchema: func(bc BuilderConfig) Builder {
+			rb := &recordingBuilder{}
+			builders = append(builders, rb)
+			return &validatingBuilder{recordingBuilder: rb, builderCfg: bc}
+		},
+	}
+
+	err := template.Validate(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "validating component \"second-catalog\": directory not found")
+	require.NotContains(t, err.Error(), "first-catalog")
+	for _, rb := range builders {
+		require.Empty(t, rb.built)
+	}
+}
+
+type validatingBuilder struct {
+	*recordingBuilder
+	builderCfg BuilderConfig
+}
+
+func (vb *validatingBuilder) Validate(ctx context.Context, dir string) error {
+	return validate(ctx, vb.builderCfg, dir)
+}
+
+func TestBuilderForSchema(t *testing.T) {
+	type testCase struct {
+		name          string
+		builderSchema string
+		builderCfg    BuilderConfig
+		assertions    func(t *testing.T, builder Builder, err error)
+	}
+
+	testCases := []testCase{
+		{
+			name:          "Basic Builder Schema",
+			builderSchema: BasicBuilderSchema,
+			builderCfg:    BuilderConfig{},
+			assertions: func(t *testing.T, builder Builder, err error) {
+				require.NoError(t, err)
+				require.IsType(t, &BasicBuilder{}, builder)
+			},
+		},
+		{
+			name:          "Semver Builder Schema",
+			builderSchema: SemverBuilderSchema,
+			builderCfg:    BuilderConfig{},
+			assertions: func(t *testing.T, builder Builder, err error) {
+				require.NoError(t, err)
+				require.IsType(t, &SemverBuilder{}, builder)
+			},
+		},
+		{
+			name:          "Raw Builder Schema",
+			builderSchema: RawBuilderSchema,
+			builderCfg:    BuilderConfig{},
+			assertions: func(t *testing.T, builder Builder, err error) {
+				require.NoError(t, err)
+				require.IsType(t, &RawBuilder{}, builder)
+			},
+		},
+		{
+			name:          "Custom Builder Schema",
+			builderSchema: CustomBuilderSchema,
+			builderCfg:    BuilderConfig{},
+			assertions: func(t *testing.T, builder Builder, err error) {
+				require.NoError(t, err)
+				require.IsType(t, &CustomBuilder{}, builder)
+			},
+		},
+		{
+			name:          "Invalid Builder Schema",
+			builderSchema: "invalid",
+			builderCfg:    BuilderConfig{},
+			assertions: func(t *testing.T, builder Builder, err error) {
+				require.Error(t, err)
+				require.Equal(t, fmt.Sprintf("unknown schema %q, registered schemas are: %s", "invalid", []string{BasicBuilderSchema, CustomBuilderSchema, RawBuilderSchema, SemverBuilderSchema}), err.Error())
+				require.Nil(t, builder)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			template := NewTemplate()
+			builder, err := template.builderForSchema(tc.builderSchema, tc.builderCfg)
+			tc.assertions(t, builder, err)
+		})
+	}
+
+}
+
+func TestWithRegisteredBuilder(t *testing.T) {
+	type testCase struct {
+		name       string
+		opts       []TemplateOption
+		assertions func(t *testing.T, template *Template, err error)
+	}
+
+	testCases := []testCase{
+		{
+			name: "new schema",
+			opts: []TemplateOption{
+				WithRegisteredBuilder(TestBuilderSchema, func(bc BuilderConfig) Builder { return &TestBuilder{} }, false),
+			},
+			assertions: func(t *testing.T, template *Template, err error) {
+				require.NoError(t, err)
+				builder, err := template.builderForSchema(TestBuilderSchema, BuilderConfig{})
+				require.NoError(t, err)
+				require.IsType(t, &TestBuilder{}, builder)
+			},
+		},
+		{
+			name: "colliding schema without override",
+			opts: []TemplateOption{
+				WithRegisteredBuilder(BasicBuilderSchema, func(bc BuilderConfig) Builder { return &TestBuilder{} }, false),
+			},
+			assertions: func(t *testing.T, template *Template, err error) {
+				require.Error(t, err)
+				require.Equal(t, "registering builder: schema \"olm.builder.basic\" is already registered", err.Error())
+			},
+		},
+		{
+			name: "colliding schema with override",
+			opts: []TemplateOption{
+				WithRegisteredBuilder(BasicBuilderSchema, func(bc BuilderConfig) Builder { return &TestBuilder{} }, true),
+			},
+			assertions: func(t *testing.T, template *Template, err error) {
+				require.NoError(t, err)
+				builder, err := template.builderForSchema(BasicBuilderSchema, BuilderConfig{})
+				require.NoError(t, err)
+				require.IsType(t, &TestBuilder{}, builder)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			catalog := strings.Replace(renderValidCatalog, "olm.builder.test", BasicBuilderSchema, 1)
+			composite := strings.Replace(renderValidComposite, "olm.builder.test", BasicBuilderSchema, 1)
+			opts := append([]TemplateOption{
+				WithCatalogFile(strings.NewReader(catalog)),
+				WithContributionFile(strings.NewReader(composite)),
+				WithDryRun(true),
+				WithDryRunOutput(io.Discard),
+			}, tc.opts...)
+			template := NewTemplate(opts...)
+			tc.assertions(t, template, template.Render(context.Background(), false))
+		})
+	}
+}
+
+func TestWithAllowedBuilders(t *testing.T) {
+	template := NewTemplate(WithAllowedBuilders(BasicBuilderSchema, SemverBuilderSchema, RawBuilderSchema))
+
+	require.Equal(t, []string{BasicBuilderSchema, RawBuilderSchema, SemverBuilderSchema}, template.RegisteredSchemas())
+
+	builder, err := template.builderForSchema(RawBuilderSchema, BuilderConfig{})
+	require.NoError(t, err)
+	require.IsType(t, &RawBuilder{}, builder)
+	require.Equal(t, RawBuilderSchema, builder.Schema())
+
+	_, err = template.builderForSchema(CustomBuilderSchema, BuilderConfig{})
+	require.EqualError(t, err, "builder schema \"olm.builder.custom\" is not permitted, permitted schemas are: [olm.builder.basic olm.builder.raw olm.builder.semver]")
+
+	_, err = template.builderForSchema("olm.builder.unknown", BuilderConfig{})
+	require.EqualError(t, err, "unknown schema \"olm.builder.unknown\", registered schemas are: [olm.builder.basic olm.builder.raw olm.builder.semver]")
+
+	_, err = template.newCatalogBuilderMap([]Catalog{
+		{
+			Name:        "test-catalog",
+			Destination: CatalogDestination{WorkingDir: "/"},
+			Builders:    []string{BasicBuilderSchema, CustomBuilderSchema},
+		},
+	}, "yaml")
+	require.EqualError(t, err, "getting builder \"olm.builder.custom\" for catalog \"test-catalog\": builder schema \"olm.builder.custom\" is not permitted, permitted schemas are: [olm.builder.basic olm.builder.raw olm.builder.semver]")
+}
+
+var validCatalog = `
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: contributions/first-catalog
+    builders:
+      - olm.builder.semver
+      - olm.builder.basic
+  - name: second-catalog
+    destination:
+      workingDir: contributions/second-catalog
+    builders:
+      - olm.builder.semver
+  - name: test-catalog
+    destination:
+      workingDir: contributions/test-catalog
+    builders:
+      - olm.builder.custom`
+
+var unmarshalFail = `
+invalid
+`
+
+var invalidSchemaCatalog = `
+schema: invalid
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: contributions/first-catalog
+    builders:
+      - olm.builder.semver
+      - olm.builder.basic
+`
+
+func TestParseCatalogSpec(t *testing.T) {
+	type testCase struct {
+		name       string
+		catalog    string
+		assertions func(t *testing.T, catalog *CatalogConfig, err error)
+	}
+
+	testCases := []testCase{
+		{
+			name:    "Valid catalog configuration",
+			catalog: validCatalog,
+			assertions: func(t *testing.T, catalog *CatalogConfig, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 3, len(catalog.Catalogs))
+			},
+		},
+		{
+			name:    "Unmarshal failure",
+			catalog: unmarshalFail,
+			assertions: func(t *testing.T, catalog *CatalogConfig, err error) {
+				require.Error(t, err)
+				require.Equal(t, "catalog-config[0]: unmarshalling catalog config: json: cannot unmarshal string into Go value of type composite.CatalogConfig", err.Error())
+			},
+		},
+		{
+			name:    "Invalid schema",
+			catalog: invalidSchemaCatalog,
+			assertions: func(t *testing.T, catalog *CatalogConfig, err error) {
+				require.Error(t, err)
+				require.Equal(t, fmt.Sprintf("catalog-config[0]: catalog configuration file has unknown schema %q, supported schemas are: %s", "invalid", []string{CatalogSchema, CatalogSchemaV2}), err.Error())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			template := NewTemplate(WithCatalogFile(strings.NewReader(tc.catalog)))
+			catalog, err := template.parseCatalogsSpec()
+			tc.assertions(t, catalog, err)
+		})
+	}
+}
+
+var validComposite = `
+schema: olm.composite
+components:
+  - name: first-catalog
+    destination:
+      path: my-operator
+    strategy:
+      name: semver
+      template:
+        schema: olm.builder.semver
+        config:
+          input: components/contribution1.yaml
+          output: catalog.yaml
+`
+
+var invalidSchemaComposite = `
+schema: invalid
+components:
+  - name: first-catalog
+    destination:
+      path: my-operator
+    strategy:
+      name: semver
+      template:
+        schema: olm.builder.semver
+        config:
+          input: components/contribution1.yaml
+          output: catalog.yaml
+`
+
+var duplicateComponentsComposite = `
+schema: olm.composite
+components:
+  - name: first-catalog
+    destination:
+      path: my-operator
+    strategy:
+      name: semver
+      template:
+        schema: olm.builder.semver
+  - name: first-catalog
+    destination:
+      path: other-operator
+    strategy:
+      name: semver
+      template:
+        schema: olm.builder.semver
+  - name: first-catalog-extra
+    catalog: first-catalog
+    destination:
+      path: my-operator/
+    strategy:
+      name: semver
+      template:
+        schema: olm.builder.semver
+`
+
+var sharedCatalogComposite = `
+schema: olm.composite
+components:
+  - name: first-operator
+    catalog: first-catalog
+    destination:
+      path: first-operator
+    strategy:
+      name: semver
+      template:
+        schema: olm.builder.semver
+  - name: second-operator
+    catalog: first-catalog
+    destination:
+      path: second-operator
+    strategy:
+      name: semver
+      template:
+        schema: olm.builder.semver
+`
+
+var unknownFieldComposite = `
+schema: olm.composite
+components:
+  - name: first-catalog
+    destination:
+      path: my-operator
+    strategy:
+      name: semver
+      template:
+        schema: olm.builder.semver
+  - name: second-catalog
+    destionation:
+      path: my-operator
+    strategy:
+      name: semver
+      template:
+        schema: olm.builder.semver
+`
+
+var unknownFieldCatalog = `
+schema: olm.composite.catalogs
+owner: catalog-team
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: contributions/first-catalog
+    builders:
+      - olm.builder.semver
+`
+
+var secondContributionComposite = `
+schema: olm.composite
+components:
+  - name: second-catalog
+    destination:
+      path: my-operator
+    strategy:
+      name: semver
+      template:
+        schema: olm.builder.semver
+  - name: first-catalog
+    destination:
+      path: other-operator
+    strategy:
+      name: semver
+      template:
+        schema: olm.builder.semver
+`
+
+func TestParseMultipleContributionFiles(t *testing.T) {
+	t.Run("components are merged", func(t *testing.T) {
+		template := NewTemplate(
+			WithContributionFile(strings.NewReader(validComposite)),
+			WithContributionFile(strings.NewReader(strings.Replace(secondContributionComposite, "name: first-catalog", "name: third-catalog", 1))),
+		)
+		composite, err := template.parseContributionSpec()
+		require.NoError(t, err)
+		require.Equal(t, 3, len(composite.Components))
+		require.Equal(t, []string{"first-catalog", "second-catalog", "third-catalog"}, []string{composite.Components[0].Name, composite.Components[1].Name, composite.Components[2].Name})
+	})
+
+	t.Run("component names are unique across files", func(t *testing.T) {
+		template := NewTemplate(WithContributionFiles(strings.NewReader(validComposite), strings.NewReader(secondContributionComposite)))
+		_, err := template.parseContributionSpec()
+		require.EqualError(t, err, "composite configuration file is invalid: contribution-config[1]: duplicate component name \"first-catalog\" at contribution-config[0] components[0], contribution-config[1] components[1]")
+
+		var validationErrs ValidationErrors
+		require.ErrorAs(t, err, &validationErrs)
+		require.Equal(t, ValidationErrors{{
+			Source:  "contribution-config[1]",
+			Field:   "name",
+			Path:    "components[1].name",
+			Line:    11,
+			Message: "duplicate component name \"first-catalog\" at contribution-config[0] components[0], contribution-config[1] components[1]",
+		}}, validationErrs)
+	})
+
+	t.Run("errors identify the file", func(t *testing.T) {
+		template := NewTemplate(WithContributionFiles(strings.NewReader(validComposite), strings.NewReader(invalidSchemaComposite)))
+		_, err := template.parseContributionSpec()
+		require.EqualError(t, err, "contribution-config[1]: composite configuration file has unknown schema, should be \"olm.composite\"")
+	})
+}
+
+func TestParseUnknownFields(t *testing.T) {
+	t.Run("composite config", func(t *testing.T) {
+		_, err := NewTemplate(WithContributionFile(strings.NewReader(unknownFieldComposite))).parseContributionSpec()
+		require.EqualError(t, err, "contribution-config[0]: unmarshalling composite config: components[1] (\"second-catalog\"): line 12: json: unknown field \"destionation\"")
+
+		composite, err := NewTemplate(WithContributionFile(strings.NewReader(unknownFieldComposite)), WithLenientParsing(true)).parseContributionSpec()
+		require.NoError(t, err)
+		require.Equal(t, 2, len(composite.Components))
+	})
+
+	t.Run("catalog config", func(t *testing.T) {
+		_, err := NewTemplate(WithCatalogFile(strings.NewReader(unknownFieldCatalog))).parseCatalogsSpec()
+		require.EqualError(t, err, "catalog-config[0]: unmarshalling catalog config: line 3: json: unknown field \"owner\"")
+
+		catalog, err := NewTemplate(WithCatalogFile(strings.NewReader(unknownFieldCatalog)), WithLenientParsing(true)).parseCatalogsSpec()
+		require.NoError(t, err)
+		require.Equal(t, 1, len(catalog.Catalogs))
+	})
+}
+
+func TestParseMultipleCatalogFiles(t *testing.T) {
+	secondCatalog := `
+schema: olm.composite.catalogs
+catalogs:
+  - name: fourth-catalog
+    destination:
+      workingDir: contributions/fourth-catalog
+    builders:
+      - olm.builder.raw
+`
+
+	t.Run("catalogs are merged in order", func(t *testing.T) {
+		template := NewTemplate(WithCatalogFiles(strings.NewReader(validCatalog), strings.NewReader(secondCatalog)))
+		catalog, err := template.parseCatalogsSpec()
+		require.NoError(t, err)
+		names := []string{}
+		for _, c := range catalog.Catalogs {
+			names = append(names, c.Name)
+		}
+		require.Equal(t, []string{"first-catalog", "second-catalog", "test-catalog", "fourth-catalog"}, names)
+	})
+
+	t.Run("duplicate catalogs across files", func(t *testing.T) {
+		template := NewTemplate(WithCatalogFile(strings.NewReader(validCatalog)), WithCatalogFile(strings.NewReader(renderValidCatalog)))
+		_, err := template.parseCatalogsSpec()
+		require.EqualError(t, err, "catalog configuration is invalid: catalog-config[1]: duplicate catalog name \"first-catalog\" at catalog-config[0] catalogs[0], catalog-config[1] catalogs[0]")
+
+		var validationErrs ValidationErrors
+		require.ErrorAs(t, err, &validationErrs)
+		require.Len(t, validationErrs, 1)
+		require.Equal(t, "catalog-config[1]", validationErrs[0].Source)
+		require.Equal(t, "catalogs[0].name", validationErrs[0].Path)
+	})
+
+	t.Run("errors identify the file", func(t *testing.T) {
+		template := NewTemplate(WithCatalogFiles(strings.NewReader(validCatalog), strings.NewReader(invalidSchemaCatalog)))
+		_, err := template.parseCatalogsSpec()
+		require.EqualError(t, err, "catalog-config[1]: catalog configuration file has unknown schema \"invalid\", supported schemas are: [olm.composite.catalogs olm.composite.catalogs/v2]")
+	})
+}
+
+func TestParseMultiDocumentStreams(t *testing.T) {
+	t.Run("contribution documents are merged", func(t *testing.T) {
+		stream := validComposite + "---\n" + strings.Replace(secondContributionComposite, "name: first-catalog", "name: third-catalog", 1)
+		composite, err := NewTemplate(WithContributionFile(strings.NewReader(stream))).parseContributionSpec()
+		require.NoError(t, err)
+		require.Equal(t, []string{"first-catalog", "second-catalog", "third-catalog"}, []string{composite.Components[0].Name, composite.Components[1].Name, composite.Components[2].Name})
+	})
+
+	t.Run("duplicate components across documents", func(t *testing.T) {
+		stream := validComposite + "---\n" + secondContributionComposite
+		_, err := NewTemplate(WithContributionFile(strings.NewReader(stream))).parseContributionSpec()
+		require.EqualError(t, err, "composite configuration file is invalid: contribution-config[0] document[1]: duplicate component name \"first-catalog\" at contribution-config[0] document[0] components[0], contribution-config[0] document[1] components[1]")
+	})
+
+	t.Run("contribution document with unknown schema", func(t *testing.T) {
+		stream := validComposite + "---\n" + invalidSchemaComposite
+		_, err := NewTemplate(WithContributionFile(strings.NewReader(stream))).parseContributionSpec()
+		require.EqualError(t, err, "contribution-config[0]: document[1]: composite configuration file has unknown schema, should be \"olm.composite\"")
+	})
+
+	t.Run("catalog documents are merged", func(t *testing.T) {
+		stream := validCatalog + `
+---
+schema: olm.composite.catalogs
+catalogs:
+  - name: fourth-catalog
+    destination:
+      workingDir: contributions/fourth-catalog
+    builders:
+      - olm.builder.raw
+`
+		catalog, err := NewTemplate(WithCatalogFile(strings.NewReader(stream))).parseCatalogsSpec()
+		require.NoError(t, err)
+		require.Equal(t, 4, len(catalog.Catalogs))
+		require.Equal(t, "fourth-catalog", catalog.Catalogs[3].Name)
+	})
+
+	t.Run("catalog document with unknown schema", func(t *testing.T) {
+		stream := validCatalog + "\n---\n" + invalidSchemaCatalog
+		_, err := NewTemplate(WithCatalogFile(strings.NewReader(stream))).parseCatalogsSpec()
+		require.EqualError(t, err, "catalog-config[0]: document[1]: catalog configuration file has unknown schema \"invalid\", supported schemas are: [olm.composite.catalogs olm.composite.catalogs/v2]")
+	})
+}
+
+func TestParseContributionSpec(t *testing.T) {
+	type testCase struct {
+		name       string
+		composite  string
+		assertions func(t *testing.T, composite *CompositeConfig, err error)
+	}
+
+	testCases := []testCase{
+		{
+			name:      "Valid composite",
+			composite: validComposite,
+			assertions: func(t *testing.T, composite *CompositeConfig, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 1, len(composite.Components))
+			},
+		},
+		{
+			name:      "Unmarshal failure",
+			composite: unmarshalFail,
+			assertions: func(t *testing.T, composite *CompositeConfig, err error) {
+				require.Error(t, err)
+				require.Equal(t, "contribution-config[0]: unmarshalling composite config: json: cannot unmarshal string into Go value of type composite.CompositeConfig", err.Error())
+			},
+		},
+		{
+			name:      "Invalid schema",
+			composite: invalidSchemaComposite,
+			assertions: func(t *testing.T, composite *CompositeConfig, err error) {
+				require.Error(t, err)
+				require.Equal(t, fmt.Sprintf("contribution-config[0]: composite configuration file has unknown schema, should be %q", CompositeSchema), err.Error())
+			},
+		},
+		{
+			name:      "Duplicate component names and destinations",
+			composite: duplicateComponentsComposite,
+			assertions: func(t *testing.T, composite *CompositeConfig, err error) {
+				require.Error(t, err)
+				require.Equal(t, "composite configuration file is invalid: [contribution-config[0]: duplicate component name \"first-catalog\" at contribution-config[0] components[0], contribution-config[0] components[1], contribution-config[0]: duplicate destination path \"my-operator\" for catalog \"first-catalog\" at contribution-config[0] components[0], contribution-config[0] components[2]]", err.Error())
+
+				var validationErrs ValidationErrors
+				require.ErrorAs(t, err, &validationErrs)
+				require.Len(t, validationErrs, 2)
+				require.Equal(t, "components[1].name", validationErrs[0].Path)
+				require.Equal(t, "components[2].destination.path", validationErrs[1].Path)
+			},
+		},
+		{
+			name:      "Multiple components in one catalog",
+			composite: sharedCatalogComposite,
+			assertions: func(t *testing.T, composite *CompositeConfig, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 2, len(composite.Components))
+				require.Equal(t, "first-catalog", composite.Components[0].CatalogName())
+				require.Equal(t, "first-catalog", composite.Components[1].CatalogName())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			template := NewTemplate(WithContributionFile(strings.NewReader(tc.composite)))
+			contrib, err := template.parseContributionSpec()
+			tc.assertions(t, contrib, err)
+		})
+	}
+}
+
+func TestNewCatalogBuilderMap(t *testing.T) {
+	type testCase struct {
+		name             string
+		catalogs         []Catalog
+		requireBaseImage bool
+		assertions       func(t *testing.T, builderMap *CatalogBuilderMap, err error)
+	}
+
+	testCases := []testCase{
+		{
+			name: "Valid Catalogs",
+			catalogs: []Catalog{
+				{
+					Name: "test-catalog",
+					Destination: CatalogDestination{
+						WorkingDir: "/",
+						BaseImage:  "quay.io/operator-framework/opm:latest",
+					},
+					Builders: []string{
+						BasicBuilderSchema,
+					},
+				},
+			},
+			assertions: func(t *testing.T, builderMap *CatalogBuilderMap, err error) {
+				require.NoError(t, err)
+				//TODO: More assertions here
+			},
+		},
+		{
+			name: "Invalid Builder",
+			catalogs: []Catalog{
+				{
+					Name: "test-catalog",
+					Destination: CatalogDestination{
+						WorkingDir: "/",
+						BaseImage:  "quay.io/operator-framework/opm:latest",
+					},
+					Builders: []string{
+						"invalid",
+					},
+				},
+			},
+			assertions: func(t *testing.T, builderMap *CatalogBuilderMap, err error) {
+				require.Error(t, err)
+				require.Equal(t, "getting builder \"invalid\" for catalog \"test-catalog\": unknown schema \"invalid\", registered schemas are: [olm.builder.basic olm.builder.custom olm.builder.raw olm.builder.semver]", err.Error())
+			},
+		},
+		{
+			name: "Duplicate catalogs and builders",
+			catalogs: []Catalog{
+				{
+					Name: "test-catalog",
+					Destination: CatalogDestination{
+						WorkingDir: "/",
+					},
+					Builders: []string{
+						BasicBuilderSchema,
+					},
+				},
+				{
+					Name: "test-catalog",
+					Destination: CatalogDestination{
+						WorkingDir: "/other",
+					},
+					Builders: []string{
+						BasicBuilderSchema,
+						SemverBuilderSchema,
+						BasicBuilderSchema,
+					},
+				},
+			},
+			assertions: func(t *testing.T, builderMap *CatalogBuilderMap, err error) {
+				require.Error(t, err)
+				require.Equal(t, "catalog configuration file field validation failed: \nCatalog test-catalog:\n  - catalog name must be unique, but is defined more than once\n  - builders must be unique, but \"olm.builder.basic\" is listed more than once\n", err.Error())
+
+				var validationErrs ValidationErrors
+				require.ErrorAs(t, err, &validationErrs)
+				require.Equal(t, ValidationErrors{
+					{Catalog: "test-catalog", Field: "name", Path: "catalogs[1].name", Message: "catalog name must be unique, but is defined more than once"},
+					{Catalog: "test-catalog", Field: "builders", Path: "catalogs[1].builders[2]", Message: "builders must be unique, but \"olm.builder.basic\" is listed more than once"},
+				}, validationErrs)
+			},
+		},
+		{
+			name: "BaseImage+WorkingDir invalid",
+			catalogs: []Catalog{
+				{
+					Name:        "test-catalog",
+					Destination: CatalogDestination{},
+					Builders: []string{
+						BasicBuilderSchema,
+					},
+				},
+			},
+			requireBaseImage: true,
+			assertions: func(t *testing.T, builderMap *CatalogBuilderMap, err error) {
+				require.Error(t, err)
+				require.Equal(t, "catalog configuration file field validation failed: \nCatalog test-catalog:\n  - destination.baseImage must not be an empty string\n  - destination.workingDir must not be an empty string\n", err.Error())
+			},
+		},
+		{
+			name: "BaseImage not required",
+			catalogs: []Catalog{
+				{
+					Name: "test-catalog",
+					Destination: CatalogDestination{
+						WorkingDir: "/",
+					},
+					Builders: []string{
+						BasicBuilderSchema,
+					},
+				},
+			},
+			assertions: func(t *testing.T, builderMap *CatalogBuilderMap, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "invalid BaseImage reported for every catalog",
+			catalogs: []Catalog{
+				{
+					Name: "first-catalog",
+					Destination: CatalogDestination{
+						WorkingDir: "/first",
+						BaseImage:  "Not A Reference",
+					},
+					Builders: []string{
+						BasicBuilderSchema,
+					},
+				},
+				{
+					Name: "second-catalog",
+					Destination: CatalogDestination{
+						WorkingDir: "/second",
+						BaseImage:  "quay.io/operator-framework/opm:latest@sha256:bad",
+					},
+					Builders: []string{
+						BasicBuilderSchema,
+					},
+				},
+			},
+			assertions: func(t *testing.T, builderMap *CatalogBuilderMap, err error) {
+				require.Error(t, err)
+				require.Equal(t, "catalog configuration file field validation failed: \nCatalog first-catalog:\n  - destination.baseImage \"Not A Reference\" is not a valid image reference: invalid reference format: repository name must be lowercase\n\nCatalog second-catalog:\n  - destination.baseImage \"quay.io/operator-framework/opm:latest@sha256:bad\" is not a valid image reference: invalid reference format\n", err.Error())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			template := NewTemplate(WithRequireBaseImage(tc.requireBaseImage))
+			builderMap, err := template.newCatalogBuilderMap(tc.catalogs, "yaml")
+			tc.assertions(t, builderMap, err)
+		})
+	}
+}
+
+type fakeGetter struct {
+	catalog     string
+	statusCode  int
+	shouldError bool
+}
+
+func (fg *fakeGetter) Do(req *http.Request) (*http.Response, error) {
+	if fg.shouldError {
+		return nil, fmt.Errorf("error!")
+	}
+
+	statusCode := fg.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(strings.NewReader(fg.catalog)),
+	}, nil
+}
+
+func TestFetchCatalogConfig(t *testing.T) {
+	type testCase struct {
+		name       string
+		fakeGetter *fakeGetter
+		path       string
+		createFile bool
+		assertions func(t *testing.T, rc io.ReadCloser, err error)
+	}
+
+	testDir := t.TempDir()
+
+	testCases := []testCase{
+		{
+			name: "Successful HTTP fetch",
+			path: "http://some-path.com",
+			fakeGetter: &fakeGetter{
+				catalog: validCatalog,
+			},
+			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
+				require.NoError(t, err)
+				require.NotNil(t, rc)
+				data, err := io.ReadAll(rc)
+				require.NoError(t, err)
+				require.Equal(t, validCatalog, string(data))
+				require.NoError(t, rc.Close())
+			},
+		},
+		{
+			name: "Failed HTTP fetch",
+			path: "http://some-path.com",
+			fakeGetter: &fakeGetter{
+				catalog:     validCatalog,
+				shouldError: true,
+			},
+			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
+				require.Error(t, err)
+				require.Equal(t, "fetching remote catalog config file \"http://some-path.com\": error!", err.Error())
+			},
+		},
+		{
+			name: "HTTP error status",
+			path: "http://some-path.com",
+			fakeGetter: &fakeGetter{
+				catalog:    "<html>not found</html>\n",
+				statusCode: http.StatusNotFound,
+			},
+			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
+				require.Nil(t, rc)
+				require.EqualError(t, err, "fetching remote catalog config file \"http://some-path.com\": unexpected status 404 Not Found: <html>not found</html>")
+			},
+		},
+		{
+			name: "HTTP error body is truncated",
+			path: "http://some-path.com",
+			fakeGetter: &fakeGetter{
+				catalog:    strings.Repeat("a", 2*maxErrorBodySize),
+				statusCode: http.StatusInternalServerError,
+			},
+			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
+				require.EqualError(t, err, "fetching remote catalog config file \"http://some-path.com\": unexpected status 500 Internal Server Error: "+strings.Repeat("a", maxErrorBodySize))
+			},
+		},
+		{
+			name: "HTTP no content",
+			path: "http://some-path.com",
+			fakeGetter: &fakeGetter{
+				catalog:    validCatalog,
+				statusCode: http.StatusNoContent,
+			},
+			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
+				require.EqualError(t, err, "fetching remote catalog config file \"http://some-path.com\": remote catalog config was empty")
+			},
+		},
+		{
+			name:       "HTTP empty body",
+			path:       "http://some-path.com",
+			fakeGetter: &fakeGetter{},
+			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
+				require.EqualError(t, err, "fetching remote catalog config file \"http://some-path.com\": remote catalog config was empty")
+			},
+		},
+		// TODO: for some reason this is triggering the fakeGetter.Get() function instead of using os.Open()
+		{
+			name: "Successful file fetch",
+			path: "file/test.yaml",
+			fakeGetter: &fakeGetter{
+				catalog:     validCatalog,
+				shouldError: true,
+			},
+			createFile: true,
+			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
+				require.NoError(t, err)
+				require.NotNil(t, rc)
+			},
+		},
+		{
+			name: "Failed file fetch",
+			path: "file/test.yaml",
+			fakeGetter: &fakeGetter{
+				catalog: validCatalog,
+			},
+			createFile: false,
+			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
+				require.Error(t, err)
+				require.Equal(t, "opening catalog config file \"file/test.yaml\": open file/test.yaml: no such file or directory", err.Error())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filepath := tc.path
+			if tc.createFile {
+				err := os.MkdirAll(path.Join(testDir, path.Dir(tc.path)), 0o777)
+				require.NoError(t, err)
+				file, err := os.Create(path.Join(testDir, tc.path))
+				require.NoError(t, err)
+				_, err = file.WriteString(tc.fakeGetter.catalog)
+				require.NoError(t, err)
+
+				filepath = path.Join(testDir, tc.path)
+			}
+
+			rc, err := FetchCatalogConfig(context.Background(), filepath, tc.fakeGetter)
+			tc.assertions(t, rc, err)
+		})
+	}
+}
+
+func TestFetchContributionConfig(t *testing.T) {
+	rc, err := FetchContributionConfig(context.Background(), "https://some-path.com/composite.yaml", &fakeGetter{catalog: validComposite})
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.Equal(t, validComposite, string(data))
+
+	_, err = FetchContributionConfig(context.Background(), "https://some-path.com/composite.yaml", &fakeGetter{shouldError: true})
+	require.EqualError(t, err, "fetching remote contribution config file \"https://some-path.com/composite.yaml\": error!")
+
+	_, err = FetchContributionConfig(context.Background(), "file/composite.yaml", &fakeGetter{})
+	require.EqualError(t, err, "opening contribution config file \"file/composite.yaml\": open file/composite.yaml: no such file or directory")
+}
+
+// sequenceGetter returns the configured responses in order, returning an
+// error for every status code of 0.
+type sequenceGetter struct {
+	statusCodes []int
+	calls       int
+	// bodies are the bodies of the requests
+	bodies []string
+}
+
+func (sg *sequenceGetter) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		sg.bodies = append(sg.bodies, string(body))
+	}
+	statusCode := sg.statusCodes[sg.calls]
+	sg.calls++
+	if statusCode == 0 {
+		return nil, fmt.Errorf("connection reset")
+	}
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(strings.NewReader(validCatalog)),
+	}, nil
+}
+
+func TestRetryingHttpGetter(t *testing.T) {
+	newRequest := func(ctx context.Context) *http.Request {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://some-path.com", nil)
+		require.NoError(t, err)
+		return req
+	}
+
+	t.Run("retries server and network errors", func(t *testing.T) {
+		sg := &sequenceGetter{statusCodes: []int{http.StatusBadGateway, 0, http.StatusOK}}
+		resp, err := NewRetryingHttpGetter(sg, WithRetryBackoff(time.Millisecond)).Do(newRequest(context.Background()))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, 3, sg.calls)
+	})
+
+	t.Run("resends the body of retried requests", func(t *testing.T) {
+		sg := &sequenceGetter{statusCodes: []int{http.StatusBadGateway, http.StatusOK}}
+		req, err := http.NewRequest(http.MethodPost, "http://some-path.com", strings.NewReader("payload"))
+		require.NoError(t, err)
+		resp, err := NewRetryingHttpGetter(sg, WithRetryBackoff(time.Millisecond)).Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, []string{"payload", "payload"}, sg.bodies)
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		sg := &sequenceGetter{statusCodes: []int{http.StatusNotFound, http.StatusOK}}
+		resp, err := NewRetryingHttpGetter(sg, WithRetryBackoff(time.Millisecond)).Do(newRequest(context.Background()))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		require.Equal(t, 1, sg.calls)
+	})
+
+	t.Run("returns the last attempt", func(t *testing.T) {
+		sg := &sequenceGetter{statusCodes: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}}
+		resp, err := NewRetryingHttpGetter(sg, WithRetryAttempts(2), WithRetryBackoff(time.Millisecond)).Do(newRequest(context.Background()))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Equal(t, 2, sg.calls)
+	})
+
+	t.Run("caps total elapsed time", func(t *testing.T) {
+		sg := &sequenceGetter{statusCodes: []int{http.StatusBadGateway, http.StatusOK}}
+		resp, err := NewRetryingHttpGetter(sg, WithRetryBackoff(time.Hour), WithRetryMaxElapsed(time.Minute)).Do(newRequest(context.Background()))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		require.Equal(t, 1, sg.calls)
+	})
+
+	t.Run("respects context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		sg := &sequenceGetter{statusCodes: []int{http.StatusBadGateway, http.StatusOK}}
+		_, err := NewRetryingHttpGetter(sg, WithRetryBackoff(time.Hour), WithRetryMaxElapsed(0)).Do(newRequest(ctx))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, 1, sg.calls)
+	})
+
+	t.Run("fetches through FetchCatalogConfig", func(t *testing.T) {
+		sg := &sequenceGetter{statusCodes: []int{http.StatusBadGateway, http.StatusOK}}
+		rc, err := FetchCatalogConfig(context.Background(), "http://some-path.com", NewRetryingHttpGetter(sg, WithRetryBackoff(time.Millisecond)))
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	})
+}
+
+func TestNewDefaultHttpGetter(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte(validCatalog))
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	fetch := func(getter HttpGetter, path string) error {
+		rc, err := FetchCatalogConfig(context.Background(), server.URL+path, getter)
+		if err == nil {
+			rc.Close()
+		}
+		return err
+	}
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		getter, err := NewDefaultHttpGetter()
+		require.NoError(t, err)
+		require.ErrorContains(t, fetch(getter, "/"), "certificate")
+	})
+
+	t.Run("custom CA bundle", func(t *testing.T) {
+		getter, err := NewDefaultHttpGetter(WithHttpCAFile(caFile))
+		require.NoError(t, err)
+		require.NoError(t, fetch(getter, "/"))
+	})
+
+	t.Run("insecure skip verify", func(t *testing.T) {
+		getter, err := NewDefaultHttpGetter(WithHttpInsecureSkipVerify(true))
+		require.NoError(t, err)
+		require.NoError(t, fetch(getter, "/"))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		getter, err := NewDefaultHttpGetter(WithHttpCAFile(caFile), WithHttpTimeout(10*time.Millisecond))
+		require.NoError(t, err)
+		require.ErrorContains(t, fetch(getter, "/slow"), "Client.Timeout exceeded")
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := NewDefaultHttpGetter(WithHttpCAFile(filepath.Join(t.TempDir(), "missing.pem")))
+		require.ErrorContains(t, err, "reading CA file")
+
+		notPEM := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+		_, err = NewDefaultHttpGetter(WithHttpCAFile(notPEM))
+		require.EqualError(t, err, fmt.Sprintf("CA file %q does not contain any PEM encoded certificates", notPEM))
+
+		_, err = NewDefaultHttpGetter(WithHttpProxy("://bad"))
+		require.ErrorContains(t, err, "parsing proxy URL \"://bad\"")
+	})
+}
+
+func TestNewDefaultHttpGetterHeaders(t *testing.T) {
+	var authorizations []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(validCatalog))
+	}))
+	defer target.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, target.URL, http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte(validCatalog))
+	}))
+	defer origin.Close()
+
+	fetch := func(getter HttpGetter, url string) {
+		rc, err := FetchCatalogConfig(context.Background(), url, getter)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	}
+
+	t.Run("static headers", func(t *testing.T) {
+		authorizations = nil
+		getter, err := NewDefaultHttpGetter(WithHttpHeader("Authorization", "Basic dXNlcjpwYXNz"))
+		require.NoError(t, err)
+		fetch(getter, origin.URL)
+		require.Equal(t, []string{"Basic dXNlcjpwYXNz"}, authorizations)
+	})
+
+	t.Run("bearer token from the environment", func(t *testing.T) {
+		authorizations = nil
+		t.Setenv("COMPOSITE_TEST_TOKEN", "secret")
+		getter, err := NewDefaultHttpGetter(WithHttpBearerTokenFromEnv("COMPOSITE_TEST_TOKEN"))
+		require.NoError(t, err)
+		fetch(getter, origin.URL)
+		require.Equal(t, []string{"Bearer secret"}, authorizations)
+
+		_, err = NewDefaultHttpGetter(WithHttpBearerTokenFromEnv("COMPOSITE_TEST_UNSET_TOKEN"))
+		require.EqualError(t, err, "environment variable \"COMPOSITE_TEST_UNSET_TOKEN\" for the bearer token is empty or not set")
+	})
+
+	t.Run("authorization is not sent to a different host on redirect", func(t *testing.T) {
+		authorizations = nil
+		getter, err := NewDefaultHttpGetter(WithHttpHeader("Authorization", "Bearer secret"))
+		require.NoError(t, err)
+		fetch(getter, origin.URL+"/redirect")
+		require.Equal(t, []string{"Bearer secret", ""}, authorizations)
+	})
+}
+
+func TestFetchWithExpectedDigest(t *testing.T) {
+	localFile := filepath.Join(t.TempDir(), "catalogs.yaml")
+	require.NoError(t, os.WriteFile(localFile, []byte(validCatalog), 0o600))
+	expected := digest.FromString(validCatalog).String()
+	other := digest.FromString("other").String()
+
+	for _, path := range []string{localFile, "http://some-path.com"} {
+		t.Run(path, func(t *testing.T) {
+			rc, err := FetchCatalogConfig(context.Background(), path, &fakeGetter{catalog: validCatalog}, WithExpectedDigest(expected))
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.Equal(t, validCatalog, string(data))
+
+			_, err = FetchCatalogConfig(context.Background(), path, &fakeGetter{catalog: validCatalog}, WithExpectedDigest(other))
+			require.EqualError(t, err, fmt.Sprintf("catalog config file %q does not match the expected digest: expected %s, got %s", path, other, expected))
+		})
+	}
+
+	_, err := FetchCatalogConfig(context.Background(), localFile, &fakeGetter{}, WithExpectedDigest("sha256:abc"))
+	require.ErrorContains(t, err, fmt.Sprintf("invalid expected digest \"sha256:abc\" for catalog config file %q", localFile))
+}
+
+func TestFetchOCIConfig(t *testing.T) {
+	reg := &image.MockRegistry{
+		RemoteImages: map[image.Reference]*image.MockImage{
+			image.SimpleReference("registry.example.com/configs/catalog:v1"): {
+				FS: fstest.MapFS{"catalogs.yaml": &fstest.MapFile{Data: []byte(validCatalog)}},
+			},
+			image.SimpleReference("registry.example.com/configs/multiple:v1"): {
+				FS: fstest.MapFS{
+					"catalogs.yaml": &fstest.MapFile{Data: []byte(validCatalog)},
+					"README.md":     &fstest.MapFile{Data: []byte("readme")},
+				},
+			},
+		},
+	}
+
+	rc, err := FetchCatalogConfig(context.Background(), "oci://registry.example.com/configs/catalog:v1", &fakeGetter{shouldError: true}, WithFetchRegistry(reg))
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.Equal(t, validCatalog, string(data))
+
+	_, err = FetchCatalogConfig(context.Background(), "oci://registry.example.com/configs/multiple:v1", &fakeGetter{}, WithFetchRegistry(reg))
+	require.EqualError(t, err, "catalog config artifact \"registry.example.com/configs/multiple:v1\" must contain exactly one file, found 2")
+
+	_, err = FetchCatalogConfig(context.Background(), "oci://registry.example.com/configs/missing:v1", &fakeGetter{}, WithFetchRegistry(reg))
+	require.EqualError(t, err, "pulling catalog config artifact \"registry.example.com/configs/missing:v1\": not found")
+
+	_, err = FetchCatalogConfig(context.Background(), "oci://registry.example.com/configs/catalog:v1", &fakeGetter{})
+	require.EqualError(t, err, "fetching catalog config artifact \"registry.example.com/configs/catalog:v1\": no registry configured")
+}
+
+// dialCounter returns an HttpGetter that counts the connections it dials,
+// failing all of them.
+func dialCounter(dials *int) HttpGetter {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			*dials++
+			return nil, fmt.Errorf("dialing %s", addr)
+		},
+	}}
+}
+
+func TestFetchConfigOffline(t *testing.T) {
+	dials := 0
+	getter := dialCounter(&dials)
+	cacheDir := t.TempDir()
+
+	_, err := FetchCatalogConfig(context.Background(), "https://some-path.com/catalogs.yaml", getter, WithOfflineFetch(true), WithFetchCache(cacheDir, 0))
+	require.EqualError(t, err, "fetching remote catalog config file \"https://some-path.com/catalogs.yaml\": offline mode: not in the fetch cache")
+
+	rc, err := FetchCatalogConfig(context.Background(), "https://some-path.com/catalogs.yaml", &fakeGetter{catalog: validCatalog}, WithFetchCache(cacheDir, 0))
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	rc, err = FetchCatalogConfig(context.Background(), "https://some-path.com/catalogs.yaml", getter, WithOfflineFetch(true), WithFetchCache(cacheDir, 0))
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.Equal(t, validCatalog, string(data))
+
+	reg := &image.MockRegistry{
+		RemoteImages: map[image.Reference]*image.MockImage{
+			image.SimpleReference("registry.example.com/configs/catalog:v1"): {
+				FS: fstest.MapFS{"catalogs.yaml": &fstest.MapFile{Data: []byte(validCatalog)}},
+			},
+		},
+	}
+	_, err = FetchCatalogConfig(context.Background(), "oci://registry.example.com/configs/catalog:v1", getter, WithOfflineFetch(true), WithFetchRegistry(reg))
+	require.EqualError(t, err, "pulling catalog config artifact \"registry.example.com/configs/catalog:v1\": offline mode: image \"registry.example.com/configs/catalog:v1\" not in cache")
+	require.NoError(t, reg.Pull(context.Background(), image.SimpleReference("registry.example.com/configs/catalog:v1")))
+	rc, err = FetchCatalogConfig(context.Background(), "oci://registry.example.com/configs/catalog:v1", getter, WithOfflineFetch(true), WithFetchRegistry(reg))
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+
+	require.Zero(t, dials)
+}
+
+func TestFetchRemoteConfigLimits(t *testing.T) {
+	t.Run("maximum size", func(t *testing.T) {
+		_, err := FetchCatalogConfig(context.Background(), "http://some-path.com", &fakeGetter{catalog: validCatalog}, WithMaxConfigSize(16))
+		require.EqualError(t, err, "fetching remote catalog config file \"http://some-path.com\": remote catalog config exceeds the maximum size of 16 bytes")
+
+		rc, err := FetchCatalogConfig(context.Background(), "http://some-path.com", &fakeGetter{catalog: validCatalog}, WithMaxConfigSize(0))
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	})
+
+	t.Run("content length exceeds maximum size", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(defaultMaxConfigSize+1))
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		_, err := FetchCatalogConfig(context.Background(), server.URL, http.DefaultClient)
+		require.ErrorContains(t, err, fmt.Sprintf("remote catalog config exceeds the maximum size of %d bytes", defaultMaxConfigSize))
+	})
+
+	t.Run("warns about unexpected content", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			contentType string
+			body        []byte
+			warns       bool
+		}{
+			"yaml": {contentType: "application/yaml", body: []byte(validCatalog)},
+			"html": {contentType: "text/html; charset=utf-8", body: []byte("<html>login</html>"), warns: true},
+			"gzip": {contentType: "application/octet-stream", body: []byte{0x1f, 0x8b, 0x08, 0x00}, warns: true},
+		} {
+			t.Run(name, func(t *testing.T) {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", tc.contentType)
+					_, _ = w.Write(tc.body)
+				}))
+				defer server.Close()
+
+				out := &bytes.Buffer{}
+				logger := logrus.New()
+				logger.SetOutput(out)
+				rc, err := FetchCatalogConfig(context.Background(), server.URL, http.DefaultClient, WithFetchLogger(logrus.NewEntry(logger)))
+				require.NoError(t, err)
+				require.NoError(t, rc.Close())
+				if tc.warns {
+					require.Contains(t, out.String(), "which does not look like YAML or JSON")
+				} else {
+					require.NotContains(t, out.String(), "level=warning")
+				}
+			})
+		}
+	})
+}
+
+func TestFetchConfigSchemes(t *testing.T) {
+	localFile := filepath.Join(t.TempDir(), "catalogs.yaml")
+	require.NoError(t, os.WriteFile(localFile, []byte(validCatalog), 0o600))
+
+	rc, err := FetchCatalogConfig(context.Background(), "file://"+filepath.ToSlash(localFile), &fakeGetter{shouldError: true})
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.Equal(t, validCatalog, string(data))
+	require.NoError(t, rc.Close())
+
+	for _, path := range []string{"ftp://example.com/catalogs.yaml", "ssh://git@example.com/catalogs.yaml"} {
+		_, err := FetchCatalogConfig(context.Background(), path, &fakeGetter{})
+		require.EqualError(t, err, fmt.Sprintf("unsupported scheme %q for catalog config file %q, expected a local path or an http, https, file or oci URL", path[:3], path))
+	}
+}
+
+func TestFileURLPath(t *testing.T) {
+	for rawURL, expected := range map[string]string{
+		"file:///home/me/catalogs.yaml":          "/home/me/catalogs.yaml",
+		"file://localhost/home/me/catalogs.yaml": "/home/me/catalogs.yaml",
+		"file:///C:/Users/me/catalogs.yaml":      "C:/Users/me/catalogs.yaml",
+		"file://server/share/catalogs.yaml":      "//server/share/catalogs.yaml",
+	} {
+		u, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		require.Equal(t, filepath.FromSlash(expected), fileURLPath(u))
+	}
+}
+
+func TestWindowsPaths(t *testing.T) {
+	t.Run("config paths", func(t *testing.T) {
+		for path, expected := range map[string]string{
+			`C:\catalogs\catalogs.yaml`:         `C:\catalogs\catalogs.yaml`,
+			`c:/catalogs/catalogs.yaml`:         `c:/catalogs/catalogs.yaml`,
+			`D:catalogs.yaml`:                   `D:catalogs.yaml`,
+			`\\server\share\catalogs.yaml`:      `\\server\share\catalogs.yaml`,
+			`//server/share/catalogs.yaml`:      `//server/share/catalogs.yaml`,
+			`catalogs\catalogs.yaml`:            `catalogs\catalogs.yaml`,
+			`/catalogs/catalogs.yaml`:           `/catalogs/catalogs.yaml`,
+			`file:///C:/catalogs/catalogs.yaml`: filepath.FromSlash(`C:/catalogs/catalogs.yaml`),
+			`file://server/share/catalogs.yaml`: filepath.FromSlash(`//server/share/catalogs.yaml`),
+		} {
+			local, ok := localConfigPath(path)
+			require.True(t, ok, path)
+			require.Equal(t, expected, local, path)
+		}
+		for _, path := range []string{"https://example.com/catalogs.yaml", "ftp://example.com/catalogs.yaml", "oci://example.com/catalogs:v1"} {
+			_, ok := localConfigPath(path)
+			require.False(t, ok, path)
+		}
+	})
+
+	t.Run("drive letter paths are not fetched", func(t *testing.T) {
+		path := `C:\catalogs\missing.yaml`
+		_, err := FetchCatalogConfig(context.Background(), path, &fakeGetter{shouldError: true})
+		require.ErrorContains(t, err, fmt.Sprintf("opening catalog config file %q: ", path))
+	})
+
+	t.Run("absolute destinations", func(t *testing.T) {
+		for p, expected := range map[string]bool{
+			`C:\catalogs`:       true,
+			`c:/catalogs`:       true,
+			`\\server\share`:    true,
+			`/catalogs`:         true,
+			`catalogs\operator`: false,
+			`catalogs/operator`: false,
+			`.`:                 false,
+		} {
+			require.Equal(t, expected, isAbsPath(p), p)
+		}
+
+		workingDir := t.TempDir()
+		err := validateDestinations(map[string]Catalog{"shop": {Name: "shop", Destination: CatalogDestination{WorkingDir: workingDir}}}, []Component{
+			{Name: "drive", Catalog: "shop", Destination: ComponentDestination{Path: `C:\operators`}},
+			{Name: "unc", Catalog: "shop", Destination: ComponentDestination{Path: `\\server\share`}},
+		})
+		require.EqualError(t, err, `invalid component destinations: [component "drive": destination path "C:\\operators" must be relative to the catalog working directory, component "unc": destination path "\\\\server\\share" must be relative to the catalog working directory]`)
+	})
+
+	t.Run("within", func(t *testing.T) {
+		dir := filepath.FromSlash("/work/catalogs")
+		require.True(t, isWithin(dir, dir))
+		require.True(t, isWithin(dir, filepath.Join(dir, "operator")))
+		require.True(t, isWithin(dir, filepath.Join(dir, "..catalog")))
+		require.False(t, isWithin(dir, filepath.Join(dir, "..")))
+		require.False(t, isWithin(dir, filepath.Join(dir, "..", "other")))
+	})
+}
+
+func TestFetchCache(t *testing.T) {
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(validCatalog))
+	}))
+	defer server.Close()
+
+	fetch := func(opts ...FetchOption) string {
+		rc, err := FetchCatalogConfig(context.Background(), server.URL, http.DefaultClient, opts...)
+		require.NoError(t, err)
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("serves fresh entries without a request", func(t *testing.T) {
+		requests, notModified = 0, 0
+		dir := t.TempDir()
+		require.Equal(t, validCatalog, fetch(WithFetchCache(dir, time.Hour)))
+		require.Equal(t, validCatalog, fetch(WithFetchCache(dir, time.Hour)))
+		require.Equal(t, 1, requests)
+	})
+
+	t.Run("revalidates stale entries", func(t *testing.T) {
+		requests, notModified = 0, 0
+		dir := t.TempDir()
+		require.Equal(t, validCatalog, fetch(WithFetchCache(dir, 0)))
+		require.Equal(t, validCatalog, fetch(WithFetchCache(dir, 0)))
+		require.Equal(t, 2, requests)
+		require.Equal(t, 1, notModified)
+	})
+
+	t.Run("refresh forces a fresh fetch", func(t *testing.T) {
+		requests, notModified = 0, 0
+		dir := t.TempDir()
+		require.Equal(t, validCatalog, fetch(WithFetchCache(dir, time.Hour)))
+		require.Equal(t, validCatalog, fetch(WithFetchCache(dir, time.Hour), WithFetchCacheRefresh(true)))
+		require.Equal(t, 2, requests)
+		require.Equal(t, 0, notModified)
+	})
+
+	t.Run("corrupted entries are refetched", func(t *testing.T) {
+		requests, notModified = 0, 0
+		dir := t.TempDir()
+		require.Equal(t, validCatalog, fetch(WithFetchCache(dir, time.Hour)))
+		entries, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.NoError(t, os.WriteFile(entries[0], []byte("{corrupted"), 0o600))
+
+		require.Equal(t, validCatalog, fetch(WithFetchCache(dir, time.Hour)))
+		require.Equal(t, 2, requests)
+		require.Equal(t, 0, notModified)
+	})
+}
+
+func TestFetchConfigStdin(t *testing.T) {
+	rc, err := FetchContributionConfig(context.Background(), StdinPath, &fakeGetter{shouldError: true}, WithStdin(strings.NewReader(validComposite)))
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.Equal(t, validComposite, string(data))
+	require.NoError(t, rc.Close())
+
+	_, err = FetchCatalogConfig(context.Background(), StdinPath, &fakeGetter{}, WithStdin(strings.NewReader(validCatalog)), WithExpectedDigest(digest.FromString("other").String()))
+	require.ErrorContains(t, err, "catalog config file \"-\" does not match the expected digest")
+}
+
+func TestParseContributionPattern(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"b-second.yml":       strings.Replace(secondContributionComposite, "name: first-catalog", "name: third-catalog", 1),
+		"a-first.yaml":       validComposite,
+		".hidden.yaml":       invalidSchemaComposite,
+		"notes.txt":          "not a contribution",
+		"nested/extra.yaml":  invalidSchemaComposite,
+		"broken/broken.yaml": invalidSchemaComposite,
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	t.Run("directory", func(t *testing.T) {
+		composite, err := NewTemplate(WithContributionPattern(dir)).parseContributionSpec()
+		require.NoError(t, err)
+		names := []string{}
+		for _, c := range composite.Components {
+			names = append(names, c.Name)
+		}
+		require.Equal(t, []string{"first-catalog", "second-catalog", "third-catalog"}, names)
+	})
+
+	t.Run("glob", func(t *testing.T) {
+		composite, err := NewTemplate(WithContributionPattern(filepath.Join(dir, "a-*.yaml"))).parseContributionSpec()
+		require.NoError(t, err)
+		require.Equal(t, 1, len(composite.Components))
+	})
+
+	t.Run("duplicates across files", func(t *testing.T) {
+		_, err := NewTemplate(WithContributionPattern(dir), WithContributionPattern(filepath.Join(dir, "a-*.yaml"))).parseContributionSpec()
+		aFirst := filepath.Join(dir, "a-first.yaml")
+		require.ErrorContains(t, err, fmt.Sprintf("duplicate component name \"first-catalog\" at %s components[0], %s components[0]", aFirst, aFirst))
+	})
+
+	t.Run("errors identify the file", func(t *testing.T) {
+		broken := filepath.Join(dir, "broken", "broken.yaml")
+		_, err := NewTemplate(WithContributionPattern(filepath.Join(dir, "broken"))).parseContributionSpec()
+		require.EqualError(t, err, broken+": composite configuration file has unknown schema, should be \"olm.composite\"")
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		pattern := filepath.Join(dir, "*.json")
+		_, err := NewTemplate(WithContributionPattern(pattern)).parseContributionSpec()
+		require.EqualError(t, err, fmt.Sprintf("contribution file pattern %q did not match any YAML or JSON files", pattern))
+	})
+}
+
+func TestCompositeRenderDeterministicOrder(t *testing.T) {
+	manyCatalogs := "schema: olm.composite.catalogs\ncatalogs:\n"
+	manyComponents := "schema: olm.composite\ncomponents:\n"
+	for _, name := range []string{"kiwi", "apple", "mango", "banana", "cherry", "fig"} {
+		manyCatalogs += fmt.Sprintf("  - name: %s\n    destination:\n      workingDir: contributions/%s\n    builders:\n      - olm.builder.test\n", name, name)
+		manyComponents += fmt.Sprintf("  - name: %s\n    destination:\n      path: %s-operator\n    strategy:\n      name: test\n      template:\n        schema: olm.builder.test\n", name, name)
+	}
+
+	render := func(contribution string) ([]string, *RenderReport, error) {
+		builder := &recordingBuilder{}
+		template := NewTemplate(
+			WithAtomicOutput(false),
+			WithCatalogFile(strings.NewReader(manyCatalogs)),
+			WithContributionFile(strings.NewReader(contribution)),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+		}
+		report, err := template.RenderWithReport(context.Background(), true)
+		return builder.built, report, err
+	}
+
+	t.Run("components are rendered in input order", func(t *testing.T) {
+		firstBuilt, firstReport, err := render(manyComponents)
+		require.NoError(t, err)
+		secondBuilt, secondReport, err := render(manyComponents)
+		require.NoError(t, err)
+		require.Equal(t, []string{"kiwi-operator", "apple-operator", "mango-operator", "banana-operator", "cherry-operator", "fig-operator"}, firstBuilt)
+		require.Equal(t, firstBuilt, secondBuilt)
+		require.Equal(t, len(firstReport.Components), len(secondReport.Components))
+		for i := range firstReport.Components {
+			require.Equal(t, firstReport.Components[i].Name, secondReport.Components[i].Name)
+		}
+	})
+
+	t.Run("available components are sorted", func(t *testing.T) {
+		missing := strings.Replace(manyComponents, "name: fig", "name: grape", 1)
+		for i := 0; i < 5; i++ {
+			_, _, err := render(missing)
+			require.EqualError(t, err, "building component \"grape\": component does not exist in the catalog configuration. Available components are: [apple banana cherry fig kiwi mango]")
+		}
+	})
+
+	t.Run("catalog validation errors are in input order", func(t *testing.T) {
+		invalid := strings.ReplaceAll(manyCatalogs, "workingDir: contributions/", "workingDir: ")
+		invalid = strings.Replace(invalid, "workingDir: kiwi", "workingDir: \"\"", 1)
+		invalid = strings.Replace(invalid, "workingDir: banana", "workingDir: \"\"", 1)
+		template := NewTemplate(WithCatalogFile(strings.NewReader(invalid)))
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{} },
+		}
+		catalogs, err := template.parseCatalogsSpec()
+		require.NoError(t, err)
+		for i := 0; i < 5; i++ {
+			_, err = template.newCatalogBuilderMap(catalogs.Catalogs, "yaml")
+			require.EqualError(t, err, "catalog configuration file field validation failed: \nCatalog kiwi:\n  - catalog-config[0]: destination.workingDir must not be an empty string\n\nCatalog banana:\n  - catalog-config[0]: destination.workingDir must not be an empty string\n")
+		}
+	})
+}
+
+// partialBuilder writes its output and then optionally fails, leaving a
+// partially written destination behind.
+type partialBuilder struct {
+	builderCfg          BuilderConfig
+	buildShouldError    bool
+	validateShouldError bool
+}
+
+func (pb *partialBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	destDir := path.Join(pb.builderCfg.WorkingDir, dir)
+	if err := os.MkdirAll(destDir, 0o777); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(destDir, "catalog.yaml"), []byte("new"), 0o666); err != nil {
+		return err
+	}
+	if pb.buildShouldError {
+		return fmt.Errorf("build error!")
+	}
+	return nil
+}
+
+func (pb *partialBuilder) Validate(ctx context.Context, dir string) error {
+	if pb.validateShouldError {
+		return fmt.Errorf("validate error!")
+	}
+	return nil
+}
+
+func (pb *partialBuilder) Schema() string {
+	return TestBuilderSchema
+}
+
+func (pb *partialBuilder) ValidateConfig(td TemplateDefinition) error {
+	return nil
+}
+
+func TestCompositeRenderAtomicOutput(t *testing.T) {
+	type testCase struct {
+		name          string
+		atomic        bool
+		builder       partialBuilder
+		expectedErr   string
+		expectedFiles map[string]string
+	}
+
+	testCases := []testCase{
+		{
+			name:          "successful build replaces the destination",
+			atomic:        true,
+			expectedFiles: map[string]string{"catalog.yaml": "new", "other.yaml": "other"},
+		},
+		{
+			name:          "build failure leaves the destination untouched",
+			atomic:        true,
+			builder:       partialBuilder{buildShouldError: true},
+			expectedErr:   "building component \"first-catalog\": build error!",
+			expectedFiles: map[string]string{"catalog.yaml": "old", "other.yaml": "other"},
+		},
+		{
+			name:          "validation failure leaves the destination untouched",
+			atomic:        true,
+			builder:       partialBuilder{validateShouldError: true},
+			expectedErr:   "validating component \"first-catalog\": validate error!",
+			expectedFiles: map[string]string{"catalog.yaml": "old", "other.yaml": "other"},
+		},
+		{
+			name:          "non-atomic build failure leaves partial output",
+			atomic:        false,
+			builder:       partialBuilder{buildShouldError: true},
+			expectedErr:   "building component \"first-catalog\": build error!",
+			expectedFiles: map[string]string{"catalog.yaml": "new", "other.yaml": "other"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			workingDir := t.TempDir()
+			dest := filepath.Join(workingDir, "my-operator")
+			require.NoError(t, os.MkdirAll(dest, 0o777))
+			require.NoError(t, os.WriteFile(filepath.Join(dest, "catalog.yaml"), []byte("old"), 0o666))
+			require.NoError(t, os.WriteFile(filepath.Join(dest, "other.yaml"), []byte("other"), 0o666))
+
+			catalog := strings.Replace(renderValidCatalog, "workingDir: contributions/first-catalog", "workingDir: "+workingDir, 1)
+			template := NewTemplate(
+				WithCatalogFile(strings.NewReader(catalog)),
+				WithContributionFile(strings.NewReader(renderValidComposite)),
+				WithAtomicOutput(tc.atomic),
+			)
+			template.registeredBuilders = map[string]builderFunc{
+				TestBuilderSchema: func(bc BuilderConfig) Builder {
+					builder := tc.builder
+					builder.builderCfg = bc
+					return &builder
+				},
+			}
+
+			err := template.Render(context.Background(), true)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			entries, err := os.ReadDir(workingDir)
+			require.NoError(t, err)
+			require.Len(t, entries, 1, "staging directories should be removed")
+
+			files := map[string]string{}
+			entries, err = os.ReadDir(dest)
+			require.NoError(t, err)
+			for _, entry := range entries {
+				data, err := os.ReadFile(filepath.Join(dest, entry.Name()))
+				require.NoError(t, err)
+				files[entry.Name()] = string(data)
+			}
+			require.Equal(t, tc.expectedFiles, files)
+		})
+	}
+}
+
+func TestCompositeRenderDestinationValidation(t *testing.T) {
+	sharedCatalogs := strings.Replace(renderMultiCatalog, "workingDir: contributions/second-catalog", "workingDir: contributions/first-catalog/", 1)
+
+	testCases := []struct {
+		name        string
+		catalogs    string
+		composite   string
+		expectedErr string
+	}{
+		{
+			name:        "path traversal",
+			catalogs:    renderMultiCatalog,
+			composite:   strings.Replace(renderMultiComposite, "path: my-operator", "path: ../../etc/something", 1),
+			expectedErr: "invalid component destinations: component \"first-catalog\": destination path \"../../etc/something\" escapes the catalog working directory \"contributions/first-catalog\"",
+		},
+		{
+			name:        "absolute path",
+			catalogs:    renderMultiCatalog,
+			composite:   strings.Replace(renderMultiComposite, "path: my-operator", "path: /etc/something", 1),
+			expectedErr: "invalid component destinations: component \"first-catalog\": destination path \"/etc/something\" must be relative to the catalog working directory",
+		},
+		{
+			name:      "traversal that stays inside the working directory",
+			catalogs:  renderMultiCatalog,
+			composite: strings.Replace(renderMultiComposite, "path: my-operator", "path: nested/../my-operator", 1),
+		},
+		{
+			name:        "collision across catalogs",
+			catalogs:    sharedCatalogs,
+			composite:   renderMultiComposite,
+			expectedErr: "is also the destination of component \"first-catalog\"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			builder := &recordingBuilder{}
+			template := NewTemplate(
+				WithCatalogFile(strings.NewReader(tc.catalogs)),
+				WithContributionFile(strings.NewReader(tc.composite)),
+				WithAtomicOutput(false),
+			)
+			template.registeredBuilders = map[string]builderFunc{
+				TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+			}
+			err := template.Render(context.Background(), false)
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				require.Len(t, builder.built, 2)
+				return
+			}
+			require.ErrorContains(t, err, tc.expectedErr)
+			require.Empty(t, builder.built)
+		})
+	}
+}
+
+// blockingBuilder blocks building the destinations in block until its context
+// is done, and records every other destination it builds.
+type blockingBuilder struct {
+	recordingBuilder
+	block map[string]bool
+}
+
+func (bb *blockingBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	if bb.block[dir] {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return bb.recordingBuilder.Build(ctx, reg, dir, td)
+}
+
+func TestCompositeRenderComponentTimeout(t *testing.T) {
+	multiDestComposite := strings.Replace(renderMultiComposite, "path: my-operator", "path: first-operator", 1)
+
+	newTemplate := func(builder Builder, opts ...TemplateOption) *Template {
+		template := NewTemplate(append([]TemplateOption{
+			WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+			WithContributionFile(strings.NewReader(multiDestComposite)),
+			WithAtomicOutput(false),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+		}
+		return template
+	}
+
+	t.Run("timed out component fails and the rest still build", func(t *testing.T) {
+		builder := &blockingBuilder{block: map[string]bool{"first-operator": true}}
+		report, err := newTemplate(builder, WithComponentTimeout(20*time.Millisecond)).RenderWithReport(context.Background(), false)
+		require.EqualError(t, err, "building component \"first-catalog\": timed out after 20ms: context deadline exceeded")
+		require.ErrorIs(t, report.Components[0].Err, context.DeadlineExceeded)
+		require.NoError(t, report.Components[1].Err)
+		require.Equal(t, []string{"my-operator"}, builder.built)
+	})
+
+	t.Run("timeout covers validation", func(t *testing.T) {
+		builder := &blockingValidator{}
+		err := newTemplate(builder, WithComponentTimeout(20*time.Millisecond), WithComponentFilter("first-catalog")).Render(context.Background(), true)
+		require.EqualError(t, err, "validating component \"first-catalog\": timed out after 20ms: context deadline exceeded")
+	})
+
+	t.Run("zero timeout disables the limit", func(t *testing.T) {
+		builder := &blockingBuilder{}
+		require.NoError(t, newTemplate(builder, WithComponentTimeout(0)).Render(context.Background(), false))
+		require.Len(t, builder.built, 2)
+	})
+}
+
+// blockingValidator builds successfully but blocks validating until its
+// context is done.
+type blockingValidator struct {
+	recordingBuilder
+}
+
+func (bv *blockingValidator) Validate(ctx context.Context, dir string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// flakyBuilder fails the first failures builds of every destination, and
+// records every destination it builds successfully.
+type flakyBuilder struct {
+	recordingBuilder
+	failures int
+	attempts map[string]int
+}
+
+func (fb *flakyBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	fb.mu.Lock()
+	fb.attempts[dir]++
+	failed := fb.attempts[dir] <= fb.failures
+	fb.mu.Unlock()
+	if failed {
+		return fmt.Errorf("transient failure building %q", dir)
+	}
+	return fb.recordingBuilder.Build(ctx, reg, dir, td)
+}
+
+func TestCompositeRenderBuildRetries(t *testing.T) {
+	multiDestComposite := strings.Replace(renderMultiComposite, "path: my-operator", "path: first-operator", 1)
+
+	newTemplate := func(builder Builder, opts ...TemplateOption) *Template {
+		template := NewTemplate(append([]TemplateOption{
+			WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+			WithContributionFile(strings.NewReader(multiDestComposite)),
+			WithAtomicOutput(false),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+		}
+		return template
+	}
+
+	t.Run("transient failures are retried", func(t *testing.T) {
+		builder := &flakyBuilder{failures: 2, attempts: map[string]int{}}
+		report, err := newTemplate(builder, WithBuildRetries(3, time.Millisecond)).RenderWithReport(context.Background(), false)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"first-operator", "my-operator"}, builder.built)
+		for _, component := range report.Components {
+			require.Equal(t, 3, component.Attempts)
+		}
+	})
+
+	t.Run("last error is returned once attempts run out", func(t *testing.T) {
+		builder := &flakyBuilder{failures: 3, attempts: map[string]int{}}
+		report, err := newTemplate(builder, WithBuildRetries(2, time.Millisecond), WithComponentFilter("first-catalog")).RenderWithReport(context.Background(), false)
+		require.EqualError(t, err, "building component \"first-catalog\": transient failure building \"first-operator\"")
+		require.Equal(t, 2, report.Components[0].Attempts)
+		require.Empty(t, builder.built)
+	})
+
+	t.Run("successful builds are not retried", func(t *testing.T) {
+		builder := &flakyBuilder{attempts: map[string]int{}}
+		report, err := newTemplate(builder, WithBuildRetries(3, time.Millisecond)).RenderWithReport(context.Background(), false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]int{"first-operator": 1, "my-operator": 1}, builder.attempts)
+		require.Equal(t, 1, report.Components[0].Attempts)
+	})
+
+	t.Run("retries stop when the context is done", func(t *testing.T) {
+		builder := &flakyBuilder{failures: 3, attempts: map[string]int{}}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		report, err := newTemplate(builder, WithBuildRetries(3, time.Hour), WithComponentFilter("first-catalog")).RenderWithReport(ctx, false)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, 1, report.Components[0].Attempts)
+	})
+
+	t.Run("retries disabled by default", func(t *testing.T) {
+		builder := &flakyBuilder{failures: 1, attempts: map[string]int{}}
+		err := newTemplate(builder, WithComponentFilter("first-catalog")).Render(context.Background(), false)
+		require.Error(t, err)
+		require.Equal(t, 1, builder.attempts["first-operator"])
+	})
+}
+
+// countingBuilder writes a catalog like fileWritingBuilder and counts the
+// number of builds and validations.
+type countingBuilder struct {
+	fileWritingBuilder
+	builds      *int
+	validations *int
+}
+
+func (cb *countingBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	*cb.builds++
+	return cb.fileWritingBuilder.Build(ctx, reg, dir, td)
+}
+
+func (cb *countingBuilder) Validate(ctx context.Context, dir string) error {
+	*cb.validations++
+	return nil
+}
+
+func TestCompositeRenderIncrementalBuild(t *testing.T) {
+	workingDir := t.TempDir()
+	catalog := strings.Replace(renderValidCatalog, "workingDir: contributions/first-catalog", "workingDir: "+workingDir, 1)
+
+	var builds, validations int
+	render := func(t *testing.T, composite string, validate bool, opts ...TemplateOption) *RenderReport {
+		template := NewTemplate(append([]TemplateOption{
+			WithCatalogFile(strings.NewReader(catalog)),
+			WithContributionFile(strings.NewReader(composite)),
+			WithIncrementalBuild(true),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder {
+				return &countingBuilder{fileWritingBuilder: fileWritingBuilder{builderCfg: bc}, builds: &builds, validations: &validations}
+			},
+		}
+		report, err := template.RenderWithReport(context.Background(), validate)
+		require.NoError(t, err)
+		require.Len(t, report.Components, 1)
+		return report
+	}
+
+	t.Run("first render builds the component", func(t *testing.T) {
+		report := render(t, renderValidComposite, false)
+		require.False(t, report.Components[0].UpToDate)
+		require.Equal(t, 1, builds)
+		require.Equal(t, []string{filepath.Join(workingDir, "my-operator", ".indexignore"), filepath.Join(workingDir, "my-operator", "catalog.yaml")}, report.Components[0].Files)
+
+		// the state file must not be loaded as part of the catalog
+		_, err := declcfg.LoadFS(context.Background(), os.DirFS(filepath.Join(workingDir, "my-operator")))
+		require.NoError(t, err)
+	})
+
+	t.Run("unchanged component is skipped but still validated", func(t *testing.T) {
+		report := render(t, renderValidComposite, true)
+		require.True(t, report.Components[0].UpToDate)
+		require.Equal(t, ValidationPassed, report.Components[0].Validation)
+		require.Empty(t, report.Components[0].Files)
+		require.Equal(t, 1, builds)
+		require.Equal(t, 1, validations)
+	})
+
+	t.Run("changed config is rebuilt", func(t *testing.T) {
+		changed := strings.Replace(renderValidComposite, "contribution1.yaml", "contribution2.yaml", 1)
+		report := render(t, changed, false)
+		require.False(t, report.Components[0].UpToDate)
+		require.Equal(t, 2, builds)
+
+		render(t, changed, false)
+		require.Equal(t, 2, builds)
+	})
+
+	t.Run("changed output type is rebuilt", func(t *testing.T) {
+		changed := strings.Replace(renderValidComposite, "contribution1.yaml", "contribution2.yaml", 1)
+		render(t, changed, false, WithOutputType("yaml"))
+		require.Equal(t, 3, builds)
+	})
+
+	t.Run("force rebuilds unchanged components", func(t *testing.T) {
+		changed := strings.Replace(renderValidComposite, "contribution1.yaml", "contribution2.yaml", 1)
+		report := render(t, changed, false, WithOutputType("yaml"), WithForceRebuild(true))
+		require.False(t, report.Components[0].UpToDate)
+		require.Equal(t, 4, builds)
+
+		ignore, err := os.ReadFile(filepath.Join(workingDir, "my-operator", ".indexignore"))
+		require.NoError(t, err)
+		require.Equal(t, ".composite-state.json\n", string(ignore))
+	})
+}
+
+func TestCompositeRenderDiff(t *testing.T) {
+	testCases := []struct {
+		name          string
+		existing      map[string]string
+		expectChanged bool
+		expectedDiff  []string
+	}{
+		{
+			name:          "changed file",
+			existing:      map[string]string{"catalog.yaml": "old\n"},
+			expectChanged: true,
+			expectedDiff:  []string{"--- a%[1]s/catalog.yaml\n+++ b%[1]s/catalog.yaml\n@@ -1 +1,14 @@\n-old\n+---\n"},
+		},
+		{
+			name:          "new destination",
+			expectChanged: true,
+			expectedDiff:  []string{"--- /dev/null\n+++ b%[1]s/catalog.yaml\n@@ -0,0 +1,14 @@\n"},
+		},
+		{
+			name:     "unchanged destination",
+			existing: map[string]string{"catalog.yaml": basicYaml},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			workingDir := t.TempDir()
+			dest := filepath.Join(workingDir, "my-operator")
+			for name, content := range tc.existing {
+				require.NoError(t, os.MkdirAll(dest, 0o777))
+				require.NoError(t, os.WriteFile(filepath.Join(dest, name), []byte(content), 0o666))
+			}
+
+			var out bytes.Buffer
+			catalog := strings.Replace(renderValidCatalog, "workingDir: contributions/first-catalog", "workingDir: "+workingDir, 1)
+			template := NewTemplate(
+				WithCatalogFile(strings.NewReader(catalog)),
+				WithContributionFile(strings.NewReader(renderValidComposite)),
+				WithDiff(true),
+				WithDiffOutput(&out),
+			)
+			template.registeredBuilders = map[string]builderFunc{
+				TestBuilderSchema: func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc} },
+			}
+
+			report, err := template.RenderWithReport(context.Background(), false)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectChanged, report.Changed)
+			require.Equal(t, tc.expectChanged, report.Components[0].Changed)
+			if !tc.expectChanged {
+				require.Empty(t, out.String())
+			}
+			for _, expected := range tc.expectedDiff {
+				require.Contains(t, out.String(), fmt.Sprintf(expected, filepath.ToSlash(dest)))
+			}
+
+			// the destination is never modified
+			files, err := listFiles(dest)
+			require.NoError(t, err)
+			existing := map[string][]byte{}
+			for name, content := range tc.existing {
+				existing[name] = []byte(content)
+			}
+			require.Equal(t, existing, files)
+
+			entries, err := os.ReadDir(workingDir)
+			require.NoError(t, err)
+			for _, entry := range entries {
+				require.False(t, strings.HasPrefix(entry.Name(), stagingPrefix), "staging directory %q was not removed", entry.Name())
+			}
+		})
+	}
+}
+
+func TestCompositeRenderWorkingDirRoot(t *testing.T) {
+	absoluteCatalogs := strings.Replace(renderMultiCatalog, "workingDir: contributions/second-catalog", "workingDir: /contributions/second-catalog", 1)
+	escapingCatalogs := strings.Replace(renderMultiCatalog, "workingDir: contributions/second-catalog", "workingDir: ../second-catalog", 1)
+
+	testCases := []struct {
+		name                string
+		catalogs            string
+		strict              bool
+		expectedWorkingDirs []string
+		expectedErr         string
+	}{
+		{
+			name:                "relative working directories resolve under the root",
+			catalogs:            renderMultiCatalog,
+			expectedWorkingDirs: []string{"contributions/first-catalog", "contributions/second-catalog"},
+		},
+		{
+			name:                "absolute working directories are rebased",
+			catalogs:            absoluteCatalogs,
+			expectedWorkingDirs: []string{"contributions/first-catalog", "contributions/second-catalog"},
+		},
+		{
+			name:        "absolute working directories are rejected when strict",
+			catalogs:    absoluteCatalogs,
+			strict:      true,
+			expectedErr: "catalog \"second-catalog\": working directory \"/contributions/second-catalog\" must be relative to the working directory root",
+		},
+		{
+			name:        "working directories may not escape the root",
+			catalogs:    escapingCatalogs,
+			expectedErr: "catalog \"second-catalog\": working directory \"../second-catalog\" escapes the working directory root",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := filepath.Join(t.TempDir(), "scratch")
+			template := NewTemplate(
+				WithCatalogFile(strings.NewReader(tc.catalogs)),
+				WithContributionFile(strings.NewReader(strings.Replace(renderMultiComposite, "path: my-operator", "path: first-operator", 1))),
+				WithWorkingDirRoot(root, tc.strict),
+			)
+			template.registeredBuilders = map[string]builderFunc{
+				TestBuilderSchema: func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc} },
+			}
+
+			report, err := template.RenderWithReport(context.Background(), false)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				require.NoDirExists(t, root)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, report.Components, len(tc.expectedWorkingDirs))
+			for i, component := range report.Components {
+				workingDir := filepath.Join(root, tc.expectedWorkingDirs[i])
+				require.Equal(t, workingDir, component.WorkingDir)
+				require.FileExists(t, filepath.Join(component.Destination, "catalog.yaml"))
+				require.True(t, strings.HasPrefix(component.Destination, workingDir))
+			}
+		})
+	}
+}
+
+func TestParseCatalogSchemaVersions(t *testing.T) {
+	catalogsDoc := func(schema string) string {
+		return fmt.Sprintf(`
+schema: %s
+catalogs:
+  - name: explicit-builders
+    destination:
+      workingDir: contributions/explicit
+    builders:
+      - olm.builder.semver
+  - name: omitted-builders
+    destination:
+      workingDir: contributions/omitted
+  - name: no-builders
+    destination:
+      workingDir: contributions/none
+    builders: []
+`, schema)
+	}
+
+	testCases := []struct {
+		name             string
+		schema           string
+		expectedBuilders [][]string
+	}{
+		{
+			name:             "v1",
+			schema:           CatalogSchema,
+			expectedBuilders: [][]string{{SemverBuilderSchema}, {}, {}},
+		},
+		{
+			name:             "v2 defaults omitted builders",
+			schema:           CatalogSchemaV2,
+			expectedBuilders: [][]string{{SemverBuilderSchema}, DefaultBuilders, {}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			catalogConfig, err := NewTemplate(WithCatalogFile(strings.NewReader(catalogsDoc(tc.schema)))).parseCatalogsSpec()
+			require.NoError(t, err)
+			require.Equal(t, CatalogSchemaV2, catalogConfig.Schema)
+			builders := [][]string{}
+			for _, catalog := range catalogConfig.Catalogs {
+				builders = append(builders, catalog.Builders)
+			}
+			require.Equal(t, tc.expectedBuilders, builders)
+
+			// the converted configuration parses back to itself as the current version
+			data, err := json.Marshal(catalogConfig)
+			require.NoError(t, err)
+			roundTripped, err := NewTemplate(WithCatalogFile(bytes.NewReader(data))).parseCatalogsSpec()
+			require.NoError(t, err)
+			require.Equal(t, catalogConfig, roundTripped)
+		})
+	}
+
+	t.Run("unknown version", func(t *testing.T) {
+		_, err := NewTemplate(WithCatalogFile(strings.NewReader(catalogsDoc("olm.composite.catalogs/v3")))).parseCatalogsSpec()
+		require.EqualError(t, err, "catalog-config[0]: catalog configuration file has unknown schema \"olm.composite.catalogs/v3\", supported schemas are: [olm.composite.catalogs olm.composite.catalogs/v2]")
+	})
+}
+
+func TestVariableExpansion(t *testing.T) {
+	composite := strings.Replace(renderValidComposite, "input: components/contribution1.yaml", "input: ${REGISTRY}/${CONTRIBUTION}.yaml", 1)
+	catalog := strings.Replace(renderValidCatalog, "workingDir: contributions/first-catalog", "workingDir: ${ROOT}/first-catalog", 1)
+
+	newTemplate := func(opts ...TemplateOption) *Template {
+		template := NewTemplate(append([]TemplateOption{
+			WithCatalogFile(strings.NewReader(catalog)),
+			WithContributionFile(strings.NewReader(composite)),
+			WithDryRun(true),
+			WithDryRunOutput(io.Discard),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &TestBuilder{} },
+		}
+		return template
+	}
+
+	t.Run("variables and environment are expanded in contributions", func(t *testing.T) {
+		t.Setenv("CONTRIBUTION", "contribution2")
+		t.Setenv("REGISTRY", "ignored")
+		template := newTemplate(WithVariableExpansion(map[string]string{"REGISTRY": "staging"}))
+		composite, err := template.parseContributionSpec()
+		require.NoError(t, err)
+		require.JSONEq(t, `{"input": "staging/contribution2.yaml", "output": "catalog.yaml"}`, string(composite.Components[0].Strategy.Template.Config))
+
+		report, err := newTemplate(WithVariableExpansion(map[string]string{"REGISTRY": "staging"})).RenderWithReport(context.Background(), false)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"REGISTRY": "staging", "CONTRIBUTION": "contribution2"}, report.Variables)
+	})
+
+	t.Run("escaped dollar signs are unescaped", func(t *testing.T) {
+		escaped := strings.Replace(renderValidComposite, "output: catalog.yaml", "output: $${NOT_A_VARIABLE}.yaml", 1)
+		template := NewTemplate(WithContributionFile(strings.NewReader(escaped)), WithVariableExpansion(nil))
+		composite, err := template.parseContributionSpec()
+		require.NoError(t, err)
+		require.JSONEq(t, `{"input": "components/contribution1.yaml", "output": "${NOT_A_VARIABLE}.yaml"}`, string(composite.Components[0].Strategy.Template.Config))
+	})
+
+	t.Run("undefined variables are an error", func(t *testing.T) {
+		_, err := newTemplate(WithVariableExpansion(map[string]string{"REGISTRY": "staging"})).parseContributionSpec()
+		require.EqualError(t, err, "contribution-config[0]: expanding variables: undefined variable \"CONTRIBUTION\"")
+	})
+
+	t.Run("undefined variables are kept when lenient", func(t *testing.T) {
+		template := newTemplate(WithVariableExpansion(map[string]string{"REGISTRY": "staging"}), WithLenientParsing(true))
+		composite, err := template.parseContributionSpec()
+		require.NoError(t, err)
+		require.JSONEq(t, `{"input": "staging/${CONTRIBUTION}.yaml", "output": "catalog.yaml"}`, string(composite.Components[0].Strategy.Template.Config))
+	})
+
+	t.Run("catalogs are only expanded when enabled", func(t *testing.T) {
+		vars := map[string]string{"REGISTRY": "staging", "CONTRIBUTION": "contribution1", "ROOT": "scratch"}
+		catalogConfig, err := newTemplate(WithVariableExpansion(vars)).parseCatalogsSpec()
+		require.NoError(t, err)
+		require.Equal(t, "${ROOT}/first-catalog", catalogConfig.Catalogs[0].Destination.WorkingDir)
+
+		catalogConfig, err = newTemplate(WithVariableExpansion(vars), WithCatalogVariableExpansion(true)).parseCatalogsSpec()
+		require.NoError(t, err)
+		require.Equal(t, "scratch/first-catalog", catalogConfig.Catalogs[0].Destination.WorkingDir)
+	})
+}
+
+// outputTypeBuilder records the output type it was configured with for every
+// destination it builds.
+type outputTypeBuilder struct {
+	recordingBuilder
+	outputType OutputType
+	outputs    map[string]OutputType
+}
+
+func (ob *outputTypeBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	ob.mu.Lock()
+	ob.outputs[dir] = ob.outputType
+	ob.mu.Unlock()
+	return nil
+}
+
+func TestCompositeRenderComponentOutputType(t *testing.T) {
+	overridden := strings.Replace(renderMultiComposite, "path: my-operator", "path: first-operator", 1)
+	overridden = strings.Replace(overridden, "  - name: second-catalog\n", "  - name: second-catalog\n    output: yaml\n", 1)
+
+	t.Run("component output type overrides the template output type", func(t *testing.T) {
+		outputs := map[string]OutputType{}
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+			WithContributionFile(strings.NewReader(overridden)),
+			WithOutputType("json"),
+			WithAtomicOutput(false),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder {
+				return &outputTypeBuilder{outputType: bc.OutputType, outputs: outputs}
+			},
+		}
+		require.NoError(t, template.Render(context.Background(), false))
+		require.Equal(t, map[string]OutputType{"first-operator": OutputTypeJSON, "my-operator": OutputTypeYAML}, outputs)
+	})
+
+	t.Run("unsupported output types are rejected when parsing", func(t *testing.T) {
+		invalid := strings.Replace(overridden, "output: yaml", "output: toml", 1)
+		_, err := NewTemplate(WithContributionFile(strings.NewReader(invalid))).parseContributionSpec()
+		require.EqualError(t, err, "composite configuration file is invalid: contribution-config[0]: component \"second-catalog\" has unsupported output type \"toml\", expected one of [json yaml mermaid]")
+
+		var validationErrs ValidationErrors
+		require.ErrorAs(t, err, &validationErrs)
+		require.Equal(t, "components[1].output", validationErrs[0].Path)
+	})
+}
+
+func TestCompositeRenderBuildHooks(t *testing.T) {
+	testDir := t.TempDir()
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %[1]s/first-catalog
+    builders:
+      - olm.builder.test
+  - name: second-catalog
+    destination:
+      workingDir: %[1]s/second-catalog
+    builders:
+      - olm.builder.test
+`, testDir)
+	render := func(t *testing.T, builder *recordingBuilder, opts ...TemplateOption) (*RenderReport, error) {
+		template := NewTemplate(append([]TemplateOption{
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(renderMultiComposite)),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder {
+				return &hookTestBuilder{fileWritingBuilder: fileWritingBuilder{builderCfg: bc}, recorder: builder}
+			},
+		}
+		return template.RenderWithReport(context.Background(), true)
+	}
+
+	t.Run("post-build hooks receive the built components", func(t *testing.T) {
+		var mu sync.Mutex
+		hooked := map[string]ComponentReport{}
+		_, err := render(t, &recordingBuilder{}, WithPostBuildHook(func(ctx context.Context, c ComponentReport) error {
+			mu.Lock()
+			defer mu.Unlock()
+			hooked[c.Name] = c
+			return nil
+		}))
+		require.NoError(t, err)
+		require.Len(t, hooked, 2)
+
+		first := hooked["first-catalog"]
+		require.Equal(t, "first-catalog", first.Catalog)
+		require.Equal(t, path.Join(testDir, "first-catalog", "my-operator"), first.Destination)
+		require.Equal(t, []string{path.Join(testDir, "first-catalog", "my-operator", "catalog.yaml")}, first.Files)
+		require.Equal(t, ValidationPassed, first.Validation)
+	})
+
+	t.Run("pre-build hooks veto components", func(t *testing.T) {
+		builder := &recordingBuilder{}
+		report, err := render(t, builder, WithPreBuildHook(func(ctx context.Context, c ComponentReport) error {
+			if c.Catalog == "first-catalog" {
+				return fmt.Errorf("policy violation")
+			}
+			return nil
+		}))
+		require.EqualError(t, err, "pre-build hook rejected component \"first-catalog\": policy violation")
+		require.Len(t, builder.built, 1)
+		require.Len(t, report.Failed(), 1)
+		require.Equal(t, "first-catalog", report.Failed()[0].Name)
+	})
+
+	t.Run("post-build hook failures are attributed to the component", func(t *testing.T) {
+		report, err := render(t, &recordingBuilder{}, WithPostBuildHook(func(ctx context.Context, c ComponentReport) error {
+			return fmt.Errorf("upload of %s failed", c.Catalog)
+		}))
+		require.EqualError(t, err, "[post-build hook failed for component \"first-catalog\": upload of first-catalog failed, post-build hook failed for component \"second-catalog\": upload of second-catalog failed]")
+		require.Len(t, report.Failed(), 2)
+	})
+
+	t.Run("hooks are not run in dry-run mode", func(t *testing.T) {
+		hook := func(ctx context.Context, c ComponentReport) error {
+			return fmt.Errorf("hook must not be run")
+		}
+		_, err := render(t, &recordingBuilder{}, WithDryRun(true), WithDryRunOutput(io.Discard), WithPreBuildHook(hook), WithPostBuildHook(hook))
+		require.NoError(t, err)
+	})
+}
+
+// hookTestBuilder writes a catalog like fileWritingBuilder and records the
+// directories it built.
+type hookTestBuilder struct {
+	fileWritingBuilder
+	recorder *recordingBuilder
+}
+
+func (hb *hookTestBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	if err := hb.recorder.Build(ctx, reg, dir, td); err != nil {
+		return err
+	}
+	return hb.fileWritingBuilder.Build(ctx, reg, dir, td)
+}
+
+func TestParseOutputType(t *testing.T) {
+	tt := []struct {
+		name      string
+		input     string
+		expected  OutputType
+		assertion require.ErrorAssertionFunc
+	}{
+		{name: "empty defaults to json", input: "", expected: OutputTypeJSON, assertion: require.NoError},
+		{name: "json", input: "json", expected: OutputTypeJSON, assertion: require.NoError},
+		{name: "yaml", input: "yaml", expected: OutputTypeYAML, assertion: require.NoError},
+		{
+			name:  "unsupported",
+			input: "toml",
+			assertion: func(t require.TestingT, err error, _ ...interface{}) {
+				require.EqualError(t, err, "invalid output type \"toml\", expected one of [json yaml mermaid]")
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := ParseOutputType(tc.input)
+			tc.assertion(t, err)
+			require.Equal(t, tc.expected, output)
+		})
+	}
+
+	t.Run("templates reject unsupported output types before rendering", func(t *testing.T) {
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(renderMultiCatalog)),
+			WithContributionFile(strings.NewReader(renderMultiComposite)),
+			WithOutputType("toml"),
+		)
+		_, err := template.RenderWithReport(context.Background(), false)
+		require.EqualError(t, err, "invalid output type \"toml\", expected one of [json yaml mermaid]")
+	})
+
+	t.Run("templates default to json", func(t *testing.T) {
+		require.Equal(t, OutputTypeJSON, NewTemplate().outputType)
+		require.Equal(t, OutputTypeJSON, NewTemplate(WithOutputType("")).outputType)
+	})
+}
+
+func TestCompositeRenderSQLiteOutput(t *testing.T) {
+	testDir := t.TempDir()
+	sqliteDir := filepath.Join(t.TempDir(), "indexes")
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s/first-catalog
+    builders:
+      - olm.builder.test
+`, testDir)
+	render := func(data string, opts ...TemplateOption) (*RenderReport, error) {
+		template := NewTemplate(append([]TemplateOption{
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(renderValidComposite)),
+			WithOutputType(string(OutputTypeYAML)),
+			WithSQLiteOutput(sqliteDir),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc, data: data} },
+		}
+		return template.RenderWithReport(context.Background(), false)
+	}
+
+	const fbc = `---
+schema: olm.package
+name: webhook-operator
+defaultChannel: preview
+---
+schema: olm.channel
+package: webhook-operator
+name: preview
+entries:
+  - name: webhook-operator.v0.0.1
+  - name: webhook-operator.v0.0.2
+    replaces: webhook-operator.v0.0.1
+`
+	bundle := func(version string, props string) string {
+		return fmt.Sprintf(`---
+schema: olm.bundle
+package: webhook-operator
+name: webhook-operator.v%[1]s
+image: quay.io/olmtest/webhook-operator-bundle:%[1]s
+properties:
+  - type: olm.package
+    value:
+      packageName: webhook-operator
+      version: %[1]s
+%[2]s`, version, props)
+	}
+	csv := func(version string) string {
+		return fmt.Sprintf(`  - type: olm.bundle.object
+    value:
+      data: %s
+`, base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`{"apiVersion":"operators.coreos.com/v1alpha1","kind":"ClusterServiceVersion","metadata":{"name":"webhook-operator.v%s"},"spec":{"replaces":"stale"}}`, version))))
+	}
+
+	report, err := render(fbc + bundle("0.0.1", csv("0.0.1")) + bundle("0.0.2", csv("0.0.2")))
+	require.NoError(t, err)
+	dbPath := filepath.Join(sqliteDir, "first-catalog.db")
+	require.Equal(t, []string{dbPath}, report.SQLiteIndexes)
+
+	querier, err := sqlite.NewSQLLiteQuerier(dbPath)
+	require.NoError(t, err)
+	packages, err := querier.ListPackages(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"webhook-operator"}, packages)
+	head, err := querier.GetBundleForChannel(context.Background(), "webhook-operator", "preview")
+	require.NoError(t, err)
+	require.Equal(t, "webhook-operator.v0.0.2", head.CsvName)
+	require.Contains(t, head.CsvJson, `"replaces":"webhook-operator.v0.0.1"`)
+	first, err := querier.GetBundle(context.Background(), "webhook-operator", "preview", "webhook-operator.v0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, "quay.io/olmtest/webhook-operator-bundle:0.0.1", first.BundlePath)
+	require.NotContains(t, first.CsvJson, "replaces")
+
+	// a package without bundle objects can't be written, and the previous
+	// index is left in place
+	_, err = render(fbc + bundle("0.0.1", "  - type: olm.csv.metadata\n    value:\n      displayName: Webhook Operator\n") + bundle("0.0.2", csv("0.0.2")))
+	require.ErrorContains(t, err, `writing sqlite index of catalog "first-catalog": package "webhook-operator" can't be written to sqlite: bundle "webhook-operator.v0.0.1": it only has an olm.csv.metadata property`)
+	require.ErrorContains(t, err, `"none" migration level`)
+	require.FileExists(t, dbPath)
+
+	_, err = render(fbc, WithOutputLayout(string(OutputLayoutPerPackage)))
+	require.EqualError(t, err, "sqlite output can't be combined with the per-package output layout")
+}
+
+// configRecordingBuilder records the configuration of the builder of every
+// component it builds.
+type configRecordingBuilder struct {
+	*fileWritingBuilder
+	built *[]BuilderConfig
+}
+
+func (rb *configRecordingBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	*rb.built = append(*rb.built, rb.builderCfg)
+	return rb.fileWritingBuilder.Build(ctx, reg, dir, td)
+}
+
+func TestCatalogDefaults(t *testing.T) {
+	type spec struct {
+		name         string
+		templateOpts []TemplateOption
+		defaults     string
+		component    string
+		output       OutputType
+		validation   ValidationLevel
+		pinImages    bool
+		destination  string
+		err          string
+	}
+	for _, s := range []spec{
+		{
+			name:        "template options without defaults",
+			output:      OutputTypeJSON,
+			destination: "my-operator",
+		},
+		{
+			name:         "template options",
+			templateOpts: []TemplateOption{WithOutputType(string(OutputTypeYAML)), WithValidationLevel(string(ValidationLevelLoad))},
+			output:       OutputTypeYAML,
+			validation:   ValidationLevelLoad,
+			destination:  "my-operator",
+		},
+		{
+			name:         "catalog defaults override template options",
+			templateOpts: []TemplateOption{WithOutputType(string(OutputTypeYAML)), WithValidationLevel(string(ValidationLevelModel))},
+			defaults: `
+      output: json
+      pinImages: true
+      validationLevel: load
+      destinationPrefix: operators`,
+			output:      OutputTypeJSON,
+			validation:  ValidationLevelLoad,
+			pinImages:   true,
+			destination: "operators/my-operator",
+		},
+		{
+			name:         "component overrides catalog defaults",
+			templateOpts: []TemplateOption{WithOutputType(string(OutputTypeJSON))},
+			defaults: `
+      output: json`,
+			component: `
+    output: yaml`,
+			output:      OutputTypeYAML,
+			destination: "my-operator",
+		},
+		{
+			name: "streamed components are not prefixed",
+			defaults: `
+      destinationPrefix: operators`,
+			component: `
+    destination:
+      path: "-"`,
+			output:      OutputTypeJSON,
+			destination: StdoutPath,
+		},
+		{
+			name: "invalid defaults",
+			defaults: `
+      output: xml
+      validationLevel: none
+      destinationPrefix: /operators`,
+			err: `catalog configuration file field validation failed: 
+Catalog first-catalog:
+  - catalog-config[0]: defaults.output has unsupported output type "xml", expected one of [json yaml mermaid]
+  - catalog-config[0]: defaults.validationLevel has unsupported validation level "none", expected one of [model load]
+  - catalog-config[0]: defaults.destinationPrefix "/operators" must be relative to the catalog working directory
+`,
+		},
+	} {
+		t.Run(s.name, func(t *testing.T) {
+			catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s
+    builders:
+      - olm.builder.test`, t.TempDir())
+			if s.defaults != "" {
+				catalogs += "\n    defaults:" + s.defaults
+			}
+			composite := `
+schema: olm.composite
+components:
+  - name: first-catalog
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+        config: {}`
+			if !strings.Contains(s.component, "destination:") {
+				composite += `
+    destination:
+      path: my-operator`
+			}
+			composite += s.component + "\n"
+
+			var built []BuilderConfig
+			template := NewTemplate(append([]TemplateOption{
+				WithCatalogFile(strings.NewReader(catalogs)),
+				WithContributionFile(strings.NewReader(composite)),
+				WithOutputWriter(io.Discard),
+			}, s.templateOpts...)...)
+			template.registeredBuilders = map[string]builderFunc{
+				TestBuilderSchema: func(bc BuilderConfig) Builder {
+					return &configRecordingBuilder{fileWritingBuilder: &fileWritingBuilder{builderCfg: bc, data: basicBuiltFbcYaml}, built: &built}
+				},
+			}
+			report, err := template.RenderWithReport(context.Background(), false)
+			if s.err != "" {
+				require.EqualError(t, err, s.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, built, 1)
+			require.Equal(t, s.output, built[0].OutputType)
+			require.Equal(t, s.validation, built[0].ValidationLevel)
+			require.Equal(t, s.pinImages, built[0].PinImages)
+			require.Len(t, report.Components, 1)
+			require.Equal(t, path.Join(built[0].WorkingDir, s.destination), report.Components[0].Destination)
+		})
+	}
+
+	// the pinImages setting of a template configuration overrides the
+	// catalog default
+	truth, falsity := true, false
+	require.False(t, BuilderConfig{}.pinImages(nil))
+	require.True(t, BuilderConfig{PinImages: true}.pinImages(nil))
+	require.False(t, BuilderConfig{PinImages: true}.pinImages(&falsity))
+	require.True(t, BuilderConfig{}.pinImages(&truth))
+}
+
+func TestCompositeRenderSchemaNotEnabled(t *testing.T) {
+	for _, s := range []struct {
+		name   string
+		schema string
+		err    string
+	}{
 		{
-			name:      "Valid composite",
-			composite: validComposite,
-			assertions: func(t *testing.T, composite *CompositeConfig, err error) {
-				require.NoError(t, err)
-				require.Equal(t, 1, len(composite.Components))
-			},
+			name:   "registered schema not enabled for the catalog",
+			schema: "olm.builder.other",
+			err:    `building component "first-catalog": schema "olm.builder.other" is not enabled for catalog "first-catalog"; enabled schemas are [olm.builder.test]`,
 		},
 		{
-			name:      "Unmarshal failure",
-			composite: unmarshalFail,
-			assertions: func(t *testing.T, composite *CompositeConfig, err error) {
-				require.Error(t, err)
-				require.Equal(t, "unmarshalling composite config: json: cannot unmarshal string into Go value of type composite.CompositeConfig", err.Error())
-			},
+			name:   "unregistered schema",
+			schema: "olm.builder.tset",
+			err:    `building component "first-catalog": unknown template schema "olm.builder.tset", registered schemas are: [olm.builder.other olm.builder.test]`,
 		},
 		{
-			name:      "Invalid schema",
-			composite: invalidSchemaComposite,
-			assertions: func(t *testing.T, composite *CompositeConfig, err error) {
-				require.Error(t, err)
-				require.Equal(t, fmt.Sprintf("composite configuration file has unknown schema, should be %q", CompositeSchema), err.Error())
-			},
+			name:   "registered schema not permitted",
+			schema: "olm.builder.forbidden",
+			err:    `building component "first-catalog": builder schema "olm.builder.forbidden" is not permitted, permitted schemas are: [olm.builder.other olm.builder.test]`,
 		},
+	} {
+		t.Run(s.name, func(t *testing.T) {
+			template := NewTemplate(
+				WithCatalogFile(strings.NewReader(fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s
+    builders:
+      - olm.builder.test
+`, t.TempDir()))),
+				WithContributionFile(strings.NewReader(strings.Replace(renderValidComposite, "schema: olm.builder.test", "schema: "+s.schema, 1))),
+				WithAllowedBuilders(TestBuilderSchema, "olm.builder.other"),
+			)
+			template.registeredBuilders = map[string]builderFunc{
+				TestBuilderSchema:       func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc} },
+				"olm.builder.other":     func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc} },
+				"olm.builder.forbidden": func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc} },
+			}
+			require.EqualError(t, template.Render(context.Background(), false), s.err)
+		})
+	}
+}
+
+// eventBuilder records when it starts and finishes building each destination,
+// and fails to build the destinations in fail.
+type eventBuilder struct {
+	mu     sync.Mutex
+	events []string
+	fail   map[string]bool
+}
+
+func (eb *eventBuilder) record(event string) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.events = append(eb.events, event)
+}
+
+func (eb *eventBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	eb.record("start " + dir)
+	defer eb.record("end " + dir)
+	time.Sleep(10 * time.Millisecond)
+	if eb.fail[dir] {
+		return fmt.Errorf("build error!")
+	}
+	return nil
+}
+
+func (eb *eventBuilder) Validate(ctx context.Context, dir string) error {
+	return nil
+}
+
+func (eb *eventBuilder) Schema() string {
+	return TestBuilderSchema
+}
+
+func (eb *eventBuilder) ValidateConfig(td TemplateDefinition) error {
+	return nil
+}
+
+func TestCompositeRenderDependencies(t *testing.T) {
+	catalogs := `
+schema: olm.composite.catalogs
+catalogs:
+  - name: shop
+    destination:
+      workingDir: contributions/shop
+    builders:
+      - olm.builder.test
+  - name: other
+    destination:
+      workingDir: contributions/other
+    builders:
+      - olm.builder.test
+`
+	component := func(name string, catalog string, dependsOn ...string) string {
+		c := fmt.Sprintf("  - name: %s\n    catalog: %s\n    destination:\n      path: %s\n    strategy:\n      name: test\n      template:\n        schema: olm.builder.test\n", name, catalog, name)
+		if len(dependsOn) > 0 {
+			c += fmt.Sprintf("    dependsOn: [%s]\n", strings.Join(dependsOn, ", "))
+		}
+		return c
+	}
+	render := func(builder *eventBuilder, components ...string) (*RenderReport, error) {
+		template := NewTemplate(
+			WithAtomicOutput(false),
+			WithMaxConcurrency(4),
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader("schema: olm.composite\ncomponents:\n"+strings.Join(components, ""))),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+		}
+		return template.RenderWithReport(context.Background(), false)
+	}
+	indexOf := func(events []string, event string) int {
+		for i, e := range events {
+			if e == event {
+				return i
+			}
+		}
+		t.Fatalf("no event %q in %v", event, events)
+		return -1
+	}
+
+	t.Run("components are built after their dependencies", func(t *testing.T) {
+		builder := &eventBuilder{}
+		report, err := render(builder,
+			component("a", "shop", "c"),
+			component("b", "shop", "a"),
+			component("c", "shop"),
+			component("d", "shop"),
+		)
+		require.NoError(t, err)
+		require.Less(t, indexOf(builder.events, "end c"), indexOf(builder.events, "start a"))
+		require.Less(t, indexOf(builder.events, "end a"), indexOf(builder.events, "start b"))
+		// independent components are still built in parallel
+		require.Less(t, indexOf(builder.events, "start d"), indexOf(builder.events, "end c"))
+
+		names := []string{}
+		for _, component := range report.Components {
+			names = append(names, component.Name)
+		}
+		require.Equal(t, []string{"a", "b", "c", "d"}, names)
+	})
+
+	t.Run("components of a failed dependency are not built", func(t *testing.T) {
+		builder := &eventBuilder{fail: map[string]bool{"c": true}}
+		report, err := render(builder,
+			component("a", "shop", "c"),
+			component("b", "shop", "a"),
+			component("c", "shop"),
+			component("d", "shop"),
+		)
+		require.Error(t, err)
+		require.EqualError(t, report.Components[0].Err, `building component "a": dependency "c" failed to build`)
+		require.EqualError(t, report.Components[1].Err, `building component "b": dependency "a" failed to build`)
+		require.Error(t, report.Components[2].Err)
+		require.NoError(t, report.Components[3].Err)
+		require.NotContains(t, builder.events, "start a")
+		require.NotContains(t, builder.events, "start b")
+	})
+
+	t.Run("cycles are reported", func(t *testing.T) {
+		_, err := render(&eventBuilder{},
+			component("a", "shop", "c"),
+			component("b", "shop", "a"),
+			component("c", "shop", "b"),
+		)
+		require.EqualError(t, err, `components of catalog "shop" depend on each other in a cycle: a -> c -> b -> a`)
+	})
+
+	t.Run("unknown dependencies are reported", func(t *testing.T) {
+		_, err := render(&eventBuilder{},
+			component("a", "shop", "b", "e"),
+			component("b", "shop", "a", "a"),
+			component("c", "shop", "c"),
+			component("e", "other"),
+		)
+		require.EqualError(t, err, `composite configuration file is invalid: [contribution-config[0]: component "a" depends on unknown component "e", components of catalog "shop" are: [a b c], contribution-config[0]: component "b" depends on "a" more than once, contribution-config[0]: component "c" depends on itself]`)
+	})
+}
+
+func TestCompositeRenderEnabled(t *testing.T) {
+	catalogs := `
+schema: olm.composite.catalogs
+catalogs:
+  - name: shop
+    destination:
+      workingDir: contributions/shop
+    builders:
+      - olm.builder.test
+`
+	component := func(name string, enabled string) string {
+		c := fmt.Sprintf("  - name: %s\n    catalog: shop\n    destination:\n      path: %s\n    strategy:\n      name: test\n      template:\n        schema: olm.builder.test\n", name, name)
+		if enabled != "" {
+			c += fmt.Sprintf("    enabled: %s\n", enabled)
+		}
+		return c
+	}
+	render := func(builder *recordingBuilder, opts []TemplateOption, components ...string) (*RenderReport, error) {
+		template := NewTemplate(append([]TemplateOption{
+			WithAtomicOutput(false),
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader("schema: olm.composite\ncomponents:\n" + strings.Join(components, ""))),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return builder },
+		}
+		return template.RenderWithReport(context.Background(), false)
+	}
+
+	builder := &recordingBuilder{}
+	report, err := render(builder, []TemplateOption{WithRenderValues(map[string]string{"flavor": "community", "legacy": "false"})},
+		component("a", "false"),
+		component("b", `'flavor == "community"'`),
+		component("c", `'legacy || flavor != "community"'`),
+		component("d", `'!legacy && (flavor == "upstream" || true)'`),
+		component("e", ""),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "d", "e"}, builder.built)
+	disabled := []string{}
+	for _, component := range report.Components {
+		if component.Disabled {
+			disabled = append(disabled, component.Name)
+			require.NoError(t, component.Err)
+		}
+	}
+	require.Equal(t, []string{"a", "c"}, disabled)
+
+	_, err = render(&recordingBuilder{}, nil, component("a", `'flavor == "community" && !legacy'`))
+	require.EqualError(t, err, `component "a": evaluating enabled condition "flavor == \"community\" && !legacy": undefined value "flavor"`)
+
+	builder = &recordingBuilder{}
+	_, err = render(builder, []TemplateOption{WithLenientParsing(true)}, component("a", `'flavor == ""'`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, builder.built)
+
+	_, err = render(&recordingBuilder{}, []TemplateOption{WithRenderValues(map[string]string{"flavor": "community"})}, component("a", "flavor"))
+	require.EqualError(t, err, `component "a": evaluating enabled condition "flavor": value "flavor" is "community", which is not a boolean`)
+
+	_, err = render(&recordingBuilder{}, nil, component("a", `'(flavor == "community"'`), component("b", `'flavor =='`))
+	require.EqualError(t, err, `composite configuration file is invalid: [contribution-config[0]: component "a" has an invalid enabled condition "(flavor == \"community\"": missing ), contribution-config[0]: component "b" has an invalid enabled condition "flavor ==": unexpected end of expression]`)
+}
+
+func TestCompositeRenderPreflight(t *testing.T) {
+	catalogs := `
+schema: olm.composite.catalogs
+catalogs:
+  - name: shop
+    destination:
+      workingDir: contributions/shop
+    builders:
+      - olm.builder.test
+      - olm.builder.raw
+      - olm.builder.custom
+`
+	composite := `
+schema: olm.composite
+components:
+  - name: valid
+    catalog: shop
+    destination:
+      path: valid
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+  - name: missing-input
+    catalog: shop
+    destination:
+      path: missing-input
+    strategy:
+      name: raw
+      template:
+        schema: olm.builder.raw
+        config:
+          output: catalog.yaml
+  - name: unknown-field
+    catalog: shop
+    destination:
+      path: unknown-field
+    strategy:
+      name: custom
+      template:
+        schema: olm.builder.custom
+        config:
+          command: ./render.sh
+          comand: ./render.sh
+  - name: wrong-catalog
+    catalog: mall
+    destination:
+      path: wrong-catalog
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+`
+	builder := &recordingBuilder{}
+	template := NewTemplate(
+		WithAtomicOutput(false),
+		WithCatalogFile(strings.NewReader(catalogs)),
+		WithContributionFile(strings.NewReader(composite)),
+		WithRegisteredBuilder(TestBuilderSchema, func(bc BuilderConfig) Builder { return builder }, false),
+	)
+	report, err := template.RenderWithReport(context.Background(), false)
+	require.EqualError(t, err, `[building component "missing-input": raw template configuration is invalid: raw template config must have a non-empty input (templateDefinition.config.input), `+
+		`building component "unknown-field": unmarshalling custom template config: error unmarshaling JSON: while decoding JSON: json: unknown field "comand", `+
+		`building component "wrong-catalog": catalog "mall" does not exist in the catalog configuration. Available catalogs are: [shop]]`)
+	require.Empty(t, builder.built, "no component is built when any fails the checks")
+	names := []string{}
+	for _, component := range report.Failed() {
+		names = append(names, component.Name)
+	}
+	require.Equal(t, []string{"missing-input", "unknown-field", "wrong-catalog"}, names)
+}
+
+func TestCompositeLint(t *testing.T) {
+	workingDir := filepath.Join(t.TempDir(), "shop")
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: shop
+    destination:
+      workingDir: %s
+    builders:
+      - olm.builder.test
+      - olm.builder.basic
+`, workingDir)
+	composite := `
+schema: olm.composite
+components:
+  - name: valid
+    catalog: shop
+    destination:
+      path: valid
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+  - name: no-input
+    catalog: shop
+    destination:
+      path: no-input
+    strategy:
+      name: basic
+      template:
+        schema: olm.builder.basic
+        config:
+          output: catalog.yaml
+`
+	builder := &recordingBuilder{}
+	template := NewTemplate(
+		WithCatalogFile(strings.NewReader(catalogs)),
+		WithContributionFile(strings.NewReader(composite)),
+		WithRegisteredBuilder(TestBuilderSchema, func(bc BuilderConfig) Builder { return builder }, false),
+	)
+	report, err := template.Lint(context.Background())
+	require.EqualError(t, err, `building component "no-input": basic template configuration is invalid: basic template config must have a non-empty input (templateDefinition.config.input)`)
+	require.Len(t, report.Failed(), 1)
+	require.Equal(t, "no-input", report.Failed()[0].Name)
+	require.Empty(t, builder.built)
+	require.NoDirExists(t, workingDir)
+}
+
+// requestBuilder records the build requests it is given, and only reports
+// catalog.yaml of the files it writes.
+type requestBuilder struct {
+	*fileWritingBuilder
+	requests []BuildRequest
+}
+
+func (rb *requestBuilder) BuildComponent(ctx context.Context, reg image.Registry, req BuildRequest) (*BuildResult, error) {
+	rb.requests = append(rb.requests, req)
+	if err := rb.Build(ctx, reg, req.Destination, req.Template); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path.Join(rb.builderCfg.WorkingDir, req.Destination, "unreported.txt"), nil, 0o666); err != nil {
+		return nil, err
+	}
+	return &BuildResult{
+		Files:          []string{"catalog.yaml"},
+		PinnedImages:   map[string]string{"quay.io/foo/bar:v1": "quay.io/foo/bar@sha256:1234"},
+		MigrationLevel: MigrationLevelNone,
+	}, nil
+}
+
+func TestCompositeRenderBuildRequest(t *testing.T) {
+	workingDir := filepath.Join(t.TempDir(), "first-catalog")
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s
+    builders:
+      - olm.builder.test
+`, workingDir)
+	var builder *requestBuilder
+	template := NewTemplate(
+		WithAtomicOutput(false),
+		WithOutputType("yaml"),
+		WithCatalogFile(strings.NewReader(catalogs)),
+		WithContributionFile(strings.NewReader(renderValidComposite)),
+		WithRegisteredBuilder(TestBuilderSchema, func(bc BuilderConfig) Builder {
+			builder = &requestBuilder{fileWritingBuilder: &fileWritingBuilder{builderCfg: bc}}
+			return builder
+		}, false),
+	)
+	report, err := template.RenderWithReport(context.Background(), false)
+	require.NoError(t, err)
+
+	require.Len(t, builder.requests, 1)
+	req := builder.requests[0]
+	require.Equal(t, "first-catalog", req.ComponentName)
+	require.Equal(t, "first-catalog", req.CatalogName)
+	require.Equal(t, "my-operator", req.Destination)
+	require.Equal(t, TestBuilderSchema, req.Template.Schema)
+	require.Equal(t, OutputTypeYAML, req.OutputType)
+	require.NotNil(t, req.Logger)
+
+	// the report has what the builder returned, not what it left behind
+	component := report.Components[0]
+	require.Equal(t, []string{filepath.Join(workingDir, "my-operator", "catalog.yaml")}, component.Files)
+	require.Equal(t, map[string]string{"quay.io/foo/bar:v1": "quay.io/foo/bar@sha256:1234"}, component.PinnedImages)
+	require.Equal(t, MigrationLevelNone, component.MigrationLevel)
+	require.FileExists(t, filepath.Join(workingDir, "my-operator", "unreported.txt"))
+}
+
+func TestAssembleCatalog(t *testing.T) {
+	fbc := func(pkg string, bundle string) string {
+		return fmt.Sprintf(`---
+schema: olm.package
+name: %[1]s
+defaultChannel: stable
+---
+schema: olm.channel
+package: %[1]s
+name: stable
+entries:
+  - name: %[2]s
+---
+schema: olm.bundle
+package: %[1]s
+name: %[2]s
+image: quay.io/example/%[2]s
+properties:
+  - type: olm.package
+    value:
+      packageName: %[1]s
+      version: 0.1.0
+`, pkg, bundle)
+	}
+	workingDir := filepath.Join(t.TempDir(), "shop")
+	for dest, data := range map[string]string{
+		"zebra/catalog.yaml":  fbc("zebra-operator", "zebra-operator.v0.1.0"),
+		"apple/catalog.yaml":  fbc("apple-operator", "apple-operator.v0.1.0"),
+		"broken/catalog.yaml": fbc("broken-operator", "broken-operator.v0.0.1"),
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(workingDir, dest)), 0o777))
+		require.NoError(t, os.WriteFile(filepath.Join(workingDir, dest), []byte(data), 0o666))
+	}
+	report := &RenderReport{Components: []ComponentReport{
+		{Name: "zebra", Catalog: "shop", Destination: filepath.Join(workingDir, "zebra")},
+		{Name: "apple", Catalog: "shop", Destination: filepath.Join(workingDir, "apple")},
+		{Name: "broken", Catalog: "shop", Destination: filepath.Join(workingDir, "broken"), Err: fmt.Errorf("build error!")},
+		{Name: "other", Catalog: "mall", Destination: filepath.Join(workingDir, "other")},
+	}}
+
+	outputDir := filepath.Join(t.TempDir(), "catalog")
+	require.NoError(t, os.MkdirAll(filepath.Join(outputDir, "stale-operator"), 0o777))
+	dcfg, err := AssembleCatalog(context.Background(), "shop", workingDir,
+		WithAssembleReport(report),
+		WithAssembleOutputDir(outputDir),
+		WithAssembleValidation(true),
+	)
+	require.NoError(t, err)
+	names := []string{}
+	for _, pkg := range dcfg.Packages {
+		names = append(names, pkg.Name)
+	}
+	require.Equal(t, []string{"apple-operator", "zebra-operator"}, names)
+	require.FileExists(t, filepath.Join(outputDir, "apple-operator", "catalog.json"))
+	require.FileExists(t, filepath.Join(outputDir, "zebra-operator", "catalog.json"))
+	require.NoDirExists(t, filepath.Join(outputDir, "stale-operator"))
+	written, err := declcfg.LoadFS(context.Background(), os.DirFS(outputDir))
+	require.NoError(t, err)
+	require.Equal(t, dcfg, written)
+
+	// without a report, everything under the working directory is assembled
+	dcfg, err = AssembleCatalog(context.Background(), "shop", workingDir)
+	require.NoError(t, err)
+	require.Len(t, dcfg.Packages, 3)
+
+	_, err = AssembleCatalog(context.Background(), "shop", workingDir, WithAssembleOutputDir(filepath.Join(workingDir, "all")))
+	require.EqualError(t, err, fmt.Sprintf("the output directory %q can't be inside the working directory %q it is assembled from", filepath.Join(workingDir, "all"), workingDir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(workingDir, "apple", "catalog.yaml"), []byte(strings.Replace(fbc("apple-operator", "apple-operator.v0.1.0"), "defaultChannel: stable", "defaultChannel: beta", 1)), 0o666))
+	_, err = AssembleCatalog(context.Background(), "shop", workingDir, WithAssembleReport(report), WithAssembleValidation(true))
+	require.ErrorContains(t, err, `catalog "shop" failed validation: package "apple-operator": `)
+}
+
+func TestCompositeRenderManifest(t *testing.T) {
+	workingDir := filepath.Join(t.TempDir(), "first-catalog")
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s
+    builders:
+      - olm.builder.test
+`, workingDir)
+	template := NewTemplate(
+		WithManifest(true),
+		WithCatalogFile(strings.NewReader(catalogs)),
+		WithContributionFile(strings.NewReader(renderValidComposite)),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc} },
+	}
+	report, err := template.RenderWithReport(context.Background(), false)
+	require.NoError(t, err)
+
+	catalogFile := filepath.Join(workingDir, "my-operator", "catalog.yaml")
+	expectedDigest := digest.FromString(basicYaml).String()
+	require.Equal(t, map[string]string{catalogFile: expectedDigest}, report.Components[0].Digests)
+	manifestPath := filepath.Join(workingDir, manifestFileName)
+	require.Equal(t, []string{manifestPath}, report.Manifests)
+
+	data, err := os.ReadFile(manifestPath)
+	require.NoError(t, err)
+	var manifest Manifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Equal(t, Manifest{
+		Schema:  ManifestSchema,
+		Catalog: "first-catalog",
+		Components: []ManifestComponent{{
+			Name:        "first-catalog",
+			Destination: "my-operator",
+			Files:       map[string]string{"my-operator/catalog.yaml": expectedDigest},
+		}},
+	}, manifest)
+	data, err = os.ReadFile(filepath.Join(workingDir, indexIgnoreFileName))
+	require.NoError(t, err)
+	require.Equal(t, manifestFileName+"\n", string(data))
+
+	drift, err := template.VerifyManifest(manifestPath)
+	require.NoError(t, err)
+	require.Empty(t, drift)
+
+	require.NoError(t, os.WriteFile(catalogFile, []byte(basicYaml+"\n"), 0o666))
+	require.NoError(t, os.WriteFile(filepath.Join(workingDir, "my-operator", "extra.yaml"), nil, 0o666))
+	drift, err = template.VerifyManifest(manifestPath)
+	require.Equal(t, []ManifestDrift{
+		{Component: "first-catalog", Path: "my-operator/catalog.yaml", Expected: expectedDigest, Actual: digest.FromString(basicYaml + "\n").String()},
+		{Component: "first-catalog", Path: "my-operator/extra.yaml", Actual: digest.FromString("").String()},
+	}, drift)
+	require.EqualError(t, err, fmt.Sprintf(`catalog "first-catalog" differs from manifest %q: [component "first-catalog": "my-operator/catalog.yaml" has digest %s, expected %s, component "first-catalog": "my-operator/extra.yaml" is not in the manifest]`,
+		manifestPath, digest.FromString(basicYaml+"\n"), expectedDigest))
+
+	require.NoError(t, os.RemoveAll(filepath.Join(workingDir, "my-operator")))
+	drift, err = template.VerifyManifest(manifestPath)
+	require.Error(t, err)
+	require.Equal(t, []ManifestDrift{{Component: "first-catalog", Path: "my-operator/catalog.yaml", Expected: expectedDigest}}, drift)
+}
+
+type pullingBuilder struct{}
+
+func (pb *pullingBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	return reg.Pull(ctx, image.SimpleReference("quay.io/example/bundle:"+dir))
+}
+
+func (pb *pullingBuilder) Validate(ctx context.Context, dir string) error {
+	if dir == "operator-2" {
+		return fmt.Errorf("invalid")
+	}
+	return nil
+}
+
+func (pb *pullingBuilder) Schema() string {
+	return TestBuilderSchema
+}
+
+func (pb *pullingBuilder) ValidateConfig(td TemplateDefinition) error {
+	return nil
+}
+
+type sizedRegistry struct {
+	*image.MockRegistry
+}
+
+func (r *sizedRegistry) ImageSize(ctx context.Context, ref image.Reference) (int64, error) {
+	return 42, nil
+}
+
+func TestCompositeRenderProgress(t *testing.T) {
+	testDir := t.TempDir()
+	catalogPath := filepath.Join(testDir, "catalogs.yaml")
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s
+    builders:
+      - olm.builder.test
+`, filepath.Join(testDir, "first-catalog"))
+	require.NoError(t, os.WriteFile(catalogPath, []byte(catalogs), 0o666))
+	var components strings.Builder
+	components.WriteString("schema: olm.composite\ncomponents:\n")
+	reg := &image.MockRegistry{RemoteImages: map[image.Reference]*image.MockImage{}}
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&components, "  - name: component-%d\n    catalog: first-catalog\n    destination:\n      path: operator-%d\n    strategy:\n      name: test\n      template:\n        schema: olm.builder.test\n", i, i)
+		reg.RemoteImages[image.SimpleReference(fmt.Sprintf("quay.io/example/bundle:operator-%d", i))] = &image.MockImage{}
+	}
+
+	var events []ProgressEvent
+	progress := func(event ProgressEvent) {
+		events = append(events, event)
+	}
+	catalog, err := FetchCatalogConfig(context.Background(), catalogPath, nil, WithFetchProgress(progress))
+	require.NoError(t, err)
+	defer catalog.Close()
+	template := NewTemplate(
+		WithCatalogFile(catalog),
+		WithContributionFile(strings.NewReader(components.String())),
+		WithAtomicOutput(false),
+		WithRegistry(&sizedRegistry{reg}),
+		WithMaxConcurrency(2),
+		WithProgress(progress),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder { return &pullingBuilder{} },
+	}
+	err = template.Render(context.Background(), true)
+	require.EqualError(t, err, `validating component "component-2": invalid`)
+
+	require.Equal(t, ProgressConfigFetched, events[0].Phase)
+	require.Equal(t, catalogPath, events[0].Config)
+	require.Equal(t, int64(len(catalogs)), events[0].Bytes)
+
+	// events of concurrent components interleave, but each component's are
+	// in order
+	phases := map[string][]ProgressPhase{}
+	for _, event := range events[1:] {
+		require.Equal(t, "first-catalog", event.Catalog)
+		require.Equal(t, TestBuilderSchema, event.Schema)
+		require.False(t, event.Time.IsZero())
+		phases[event.Component] = append(phases[event.Component], event.Phase)
+		switch event.Phase {
+		case ProgressImagePullFinished:
+			require.Equal(t, "quay.io/example/bundle:operator-"+strings.TrimPrefix(event.Component, "component-"), event.Image)
+			require.Equal(t, int64(42), event.Bytes)
+		case ProgressValidationFinished, ProgressComponentFinished:
+			require.Equal(t, event.Component == "component-2", event.Err != nil)
+		}
+	}
+	expected := []ProgressPhase{
+		ProgressComponentQueued,
+		ProgressImagePullStarted,
+		ProgressImagePullFinished,
+		ProgressBuildFinished,
+		ProgressValidationFinished,
+		ProgressComponentFinished,
+	}
+	require.Equal(t, map[string][]ProgressPhase{
+		"component-0": expected,
+		"component-1": expected,
+		"component-2": expected,
+	}, phases)
+}
+
+type recordingInstrumentation struct {
+	NopInstrumentation
+	mu    sync.Mutex
+	calls []string
+}
+
+func (ri *recordingInstrumentation) record(format string, args ...interface{}) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	ri.calls = append(ri.calls, fmt.Sprintf(format, args...))
+}
+
+func (ri *recordingInstrumentation) RenderStarted() {
+	ri.record("render started")
+}
+
+func (ri *recordingInstrumentation) RenderFinished(duration time.Duration, err error) {
+	ri.record("render finished: %v", err)
+}
+
+func (ri *recordingInstrumentation) ComponentBuilt(component string, catalog string, schema string, duration time.Duration, err error) {
+	ri.record("built %s/%s (%s): %v", catalog, component, schema, err)
+}
+
+func (ri *recordingInstrumentation) ComponentValidated(component string, catalog string, schema string, duration time.Duration, err error) {
+	ri.record("validated %s/%s (%s): %v", catalog, component, schema, err)
+}
+
+func (ri *recordingInstrumentation) ImagePulled(catalog string, duration time.Duration, err error) {
+	ri.record("pulled for %s: %v", catalog, err)
+}
+
+func (ri *recordingInstrumentation) ConfigFetched(kind string, source string, duration time.Duration, err error) {
+	ri.record("fetched %s config from %s: %v", kind, source, err)
+}
+
+func TestCompositeRenderInstrumentation(t *testing.T) {
+	testDir := t.TempDir()
+	catalogPath := filepath.Join(testDir, "catalogs.yaml")
+	require.NoError(t, os.WriteFile(catalogPath, []byte(fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s
+    builders:
+      - olm.builder.test
+`, filepath.Join(testDir, "first-catalog"))), 0o666))
+	components := `
+schema: olm.composite
+components:
+  - name: first-catalog
+    destination:
+      path: operator-0
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+`
+	reg := &image.MockRegistry{RemoteImages: map[image.Reference]*image.MockImage{
+		image.SimpleReference("quay.io/example/bundle:operator-0"): {},
+	}}
+
+	instrumentation := &recordingInstrumentation{}
+	catalog, err := FetchCatalogConfig(context.Background(), catalogPath, nil, WithFetchInstrumentation(instrumentation))
+	require.NoError(t, err)
+	defer catalog.Close()
+	_, err = FetchCatalogConfig(context.Background(), filepath.Join(testDir, "missing.yaml"), nil, WithFetchInstrumentation(instrumentation))
+	require.Error(t, err)
+
+	template := NewTemplate(
+		WithCatalogFile(catalog),
+		WithContributionFile(strings.NewReader(components)),
+		WithAtomicOutput(false),
+		WithRegistry(reg),
+		WithInstrumentation(instrumentation),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder { return &pullingBuilder{} },
+	}
+	require.NoError(t, template.Render(context.Background(), true))
+	require.Equal(t, []string{
+		"fetched catalog config from local: <nil>",
+		`fetched catalog config from local: opening catalog config file "` + filepath.Join(testDir, "missing.yaml") + `": open ` + filepath.Join(testDir, "missing.yaml") + `: no such file or directory`,
+		"render started",
+		"pulled for first-catalog: <nil>",
+		"built first-catalog/first-catalog (olm.builder.test): <nil>",
+		"validated first-catalog/first-catalog (olm.builder.test): <nil>",
+		"render finished: <nil>",
+	}, instrumentation.calls)
+}
+
+func TestCompositeRenderExpectedPackages(t *testing.T) {
+	testDir := t.TempDir()
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s/first-catalog
+    builders:
+      - olm.builder.test
+`, testDir)
+	render := func(expectedPackages string) (*RenderReport, error) {
+		composite := strings.Replace(renderValidComposite, "    destination:\n", "    expectedPackages: "+expectedPackages+"\n    destination:\n", 1)
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(composite)),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc, data: basicBuiltFbcYaml} },
+		}
+		return template.RenderWithReport(context.Background(), false)
+	}
+
+	t.Run("passes when the component produces exactly the expected packages", func(t *testing.T) {
+		report, err := render("[webhook-operator]")
+		require.NoError(t, err)
+		require.Equal(t, []string{"webhook-operator"}, report.Components[0].Packages)
+	})
+
+	t.Run("names unexpected and missing packages", func(t *testing.T) {
+		report, err := render("[other-operator, another-operator]")
+		require.EqualError(t, err, `building component "first-catalog": it produced packages not in its expectedPackages: "webhook-operator"; it didn't produce expected packages: "another-operator", "other-operator"`)
+		require.Error(t, report.Components[0].Err)
+	})
+
+	t.Run("checks the output of in memory renders", func(t *testing.T) {
+		input := filepath.Join(testDir, "input.yaml")
+		require.NoError(t, os.WriteFile(input, []byte(basicBuiltFbcYaml), 0o666))
+		_, err := NewTemplate(
+			WithCatalogFile(strings.NewReader(strings.Replace(catalogs, "olm.builder.test", "olm.builder.raw", 1))),
+			WithContributionFile(strings.NewReader(fmt.Sprintf(`
+schema: olm.composite
+components:
+  - name: first-catalog
+    expectedPackages: [other-operator]
+    destination:
+      path: my-operator
+    strategy:
+      name: raw
+      template:
+        schema: olm.builder.raw
+        config:
+          input: %s
+`, input))),
+		).RenderToConfig(context.Background())
+		require.ErrorContains(t, err, `it produced packages not in its expectedPackages: "webhook-operator"`)
+	})
+
+	t.Run("rejects duplicate and empty package names", func(t *testing.T) {
+		_, err := render(`[webhook-operator, "", webhook-operator]`)
+		require.EqualError(t, err, `composite configuration file is invalid: [contribution-config[0]: component "first-catalog" has an empty expected package name, contribution-config[0]: component "first-catalog" expects package "webhook-operator" more than once, it is also expectedPackages[0]]`)
+	})
+}
+
+func TestCompositeRenderAllowedComponents(t *testing.T) {
+	testDir := t.TempDir()
+	render := func(allowedComponents string) (*RenderReport, error) {
+		catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s/first-catalog
+    builders:
+      - olm.builder.test
+    allowedComponents: %s
+`, testDir, allowedComponents)
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(renderValidComposite)),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc, data: basicBuiltFbcYaml} },
+		}
+		return template.RenderWithReport(context.Background(), false)
 	}
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			template := NewTemplate(WithContributionFile(strings.NewReader(tc.composite)))
-			contrib, err := template.parseContributionSpec()
-			tc.assertions(t, contrib, err)
-		})
+	for _, allowed := range []string{"[]", "[first-catalog]", `[other, "first-*"]`} {
+		report, err := render(allowed)
+		require.NoError(t, err, allowed)
+		require.False(t, report.Components[0].Rejected)
 	}
+
+	report, err := render(`[other, "team-*"]`)
+	require.EqualError(t, err, `building component "first-catalog": catalog "first-catalog" only allows components matching its allowedComponents "other", "team-*"`)
+	require.Len(t, report.Components, 1)
+	require.True(t, report.Components[0].Rejected)
+
+	_, err = render(`["team-["]`)
+	require.ErrorContains(t, err, `"team-[" is not a valid component name pattern: syntax error in pattern`)
 }
 
-func TestNewCatalogBuilderMap(t *testing.T) {
-	type testCase struct {
-		name       string
-		catalogs   []Catalog
-		assertions func(t *testing.T, builderMap *CatalogBuilderMap, err error)
+func TestCompositeRenderPackageNamePrefix(t *testing.T) {
+	testDir := t.TempDir()
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s/first-catalog
+    builders:
+      - olm.builder.test
+`, testDir)
+	component := func(name string, prefix string) string {
+		return fmt.Sprintf(`
+  - name: %[1]s
+    catalog: first-catalog
+    packageNamePrefix: %[2]q
+    destination:
+      path: %[1]s
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+`, name, prefix)
+	}
+	render := func(components ...string) (*RenderReport, error) {
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader("schema: olm.composite\ncomponents:"+strings.Join(components, ""))),
+		)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc, data: basicBuiltFbcYaml} },
+		}
+		return template.RenderWithReport(context.Background(), true)
 	}
 
-	testCases := []testCase{
-		{
-			name: "Valid Catalogs",
-			catalogs: []Catalog{
-				{
-					Name: "test-catalog",
-					Destination: CatalogDestination{
-						WorkingDir: "/",
-						// BaseImage:  "base",
-					},
-					Builders: []string{
-						BasicBuilderSchema,
-					},
-				},
-			},
-			assertions: func(t *testing.T, builderMap *CatalogBuilderMap, err error) {
-				require.NoError(t, err)
-				//TODO: More assertions here
-			},
-		},
-		{
-			name: "Invalid Builder",
-			catalogs: []Catalog{
-				{
-					Name: "test-catalog",
-					Destination: CatalogDestination{
-						WorkingDir: "/",
-						// BaseImage:  "base",
-					},
-					Builders: []string{
-						"invalid",
-					},
-				},
+	t.Run("rewrites every package reference", func(t *testing.T) {
+		deprecated := component("tenant-a", "tenant-a-") + `    deprecations:
+      - package: webhook-operator
+        entries:
+          - reference:
+              schema: olm.channel
+              name: preview
+            message: the preview channel is no longer updated
+`
+		report, err := render(deprecated, component("tenant-b", ""))
+		require.NoError(t, err)
+		require.Equal(t, []string{"tenant-a-webhook-operator"}, report.Components[0].Packages)
+		require.Equal(t, []string{"webhook-operator"}, report.Components[1].Packages)
+
+		dcfg, err := declcfg.LoadFS(context.Background(), os.DirFS(filepath.Join(testDir, "first-catalog", "tenant-a")))
+		require.NoError(t, err)
+		require.Equal(t, "tenant-a-webhook-operator", dcfg.Packages[0].Name)
+		require.Equal(t, "tenant-a-webhook-operator", dcfg.Channels[0].Package)
+		require.Equal(t, "tenant-a-webhook-operator", dcfg.Bundles[0].Package)
+		props, err := property.Parse(dcfg.Bundles[0].Properties)
+		require.NoError(t, err)
+		require.Equal(t, "tenant-a-webhook-operator", props.Packages[0].PackageName)
+		require.Equal(t, "tenant-a-webhook-operator", dcfg.Others[0].Package)
+		require.Contains(t, string(dcfg.Others[0].Blob), `"package":"tenant-a-webhook-operator"`)
+		_, err = declcfg.ConvertToModel(*dcfg)
+		require.NoError(t, err)
+	})
+
+	t.Run("package conflicts are checked after prefixing", func(t *testing.T) {
+		_, err := render(component("tenant-a", "tenant-"), component("tenant-b", "tenant-"))
+		require.ErrorContains(t, err, `package "tenant-webhook-operator" of catalog "first-catalog" is written by components "tenant-a" and "tenant-b"`)
+	})
+
+	t.Run("only rewrites dependencies on the component's packages", func(t *testing.T) {
+		dcfg := &declcfg.DeclarativeConfig{Bundles: []declcfg.Bundle{{
+			Name:    "foo.v1.0.0",
+			Package: "foo",
+			Properties: []property.Property{
+				property.MustBuildPackage("foo", "1.0.0"),
+				property.MustBuildPackageRequired("bar", ">=1.0.0"),
+				property.MustBuildPackageRequired("external", ">=2.0.0"),
 			},
-			assertions: func(t *testing.T, builderMap *CatalogBuilderMap, err error) {
-				require.Error(t, err)
-				require.Equal(t, "getting builder \"invalid\" for catalog \"test-catalog\": unknown schema \"invalid\"", err.Error())
-			},
-		},
-		// {
-		// 	name: "BaseImage+WorkingDir invalid",
-		// 	catalogs: []Catalog{
-		// 		{
-		// 			Name:        "test-catalog",
-		// 			Destination: CatalogDestination{},
-		// 			Builders: []string{
-		// 				BasicBuilderSchema,
-		// 			},
-		// 		},
-		// 	},
-		// 	assertions: func(t *testing.T, builderMap *CatalogBuilderMap, err error) {
-		// 		require.Error(t, err)
-		// 		require.Equal(t, "catalog configuration file field validation failed: \nCatalog test-catalog:\n  - destination.baseImage must not be an empty string\n  - destination.workingDir must not be an empty string\n", err.Error())
-		// 	},
-		// },
-	}
+		}}}
+		require.NoError(t, prefixPackages(dcfg, "tenant-", map[string]bool{"foo": true, "bar": true}))
+		require.Equal(t, []property.Property{
+			property.MustBuildPackage("tenant-foo", "1.0.0"),
+			property.MustBuildPackageRequired("tenant-bar", ">=1.0.0"),
+			property.MustBuildPackageRequired("external", ">=2.0.0"),
+		}, dcfg.Bundles[0].Properties)
+	})
+}
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			template := NewTemplate()
-			builderMap, err := template.newCatalogBuilderMap(tc.catalogs, "yaml")
-			tc.assertions(t, builderMap, err)
-		})
+func TestCompositeConfigMapConfig(t *testing.T) {
+	configMap := func(name string, data map[string]string) string {
+		var b strings.Builder
+		fmt.Fprintf(&b, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\ndata:\n", name)
+		for key, value := range data {
+			fmt.Fprintf(&b, "  %s: |\n", key)
+			for _, line := range strings.Split(strings.TrimSpace(value), "\n") {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+		return b.String()
 	}
+
+	t.Run("reads the configuration from the ConfigMap keys", func(t *testing.T) {
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(configMap("catalogs", map[string]string{"catalogs.yaml": renderValidCatalog}))),
+			WithContributionFile(strings.NewReader(configMap("contribution", map[string]string{"composite.yaml": renderValidComposite, "README": "unrelated"}))),
+		)
+		catalogs, err := template.parsedCatalogs()
+		require.NoError(t, err)
+		require.Equal(t, "first-catalog", catalogs.Catalogs[0].Name)
+		contributions, err := template.parsedContributions()
+		require.NoError(t, err)
+		require.Equal(t, "first-catalog", contributions.Components[0].Name)
+	})
+
+	t.Run("reads configured keys", func(t *testing.T) {
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(configMap("catalogs", map[string]string{"prod.yaml": renderValidCatalog}))),
+			WithContributionFile(strings.NewReader(renderValidComposite)),
+			WithConfigMapKeys("prod.yaml", ""),
+		)
+		catalogs, err := template.parsedCatalogs()
+		require.NoError(t, err)
+		require.Equal(t, "first-catalog", catalogs.Catalogs[0].Name)
+		_, err = template.parsedContributions()
+		require.NoError(t, err)
+	})
+
+	t.Run("names the keys found when the key is missing", func(t *testing.T) {
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(configMap("catalogs", map[string]string{"prod.yaml": renderValidCatalog, "staging.yaml": renderValidCatalog}))),
+		)
+		_, err := template.parsedCatalogs()
+		require.EqualError(t, err, `catalog-config[0]: catalog config: ConfigMap "catalogs" has no key "catalogs.yaml", found keys "prod.yaml", "staging.yaml"`)
+
+		template = NewTemplate(WithContributionFile(strings.NewReader("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: empty\n")))
+		_, err = template.parsedContributions()
+		require.EqualError(t, err, `contribution-config[0]: composite config: ConfigMap "empty" has no data, expected key "composite.yaml"`)
+	})
+
+	t.Run("requires the ConfigMap to be the only document", func(t *testing.T) {
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(renderValidCatalog + "---\n" + configMap("catalogs", map[string]string{"catalogs.yaml": renderValidCatalog}))),
+		)
+		_, err := template.parsedCatalogs()
+		require.EqualError(t, err, "catalog-config[0]: catalog config: document[1] is a ConfigMap, which must be the only document of the file")
+	})
 }
 
-type fakeGetter struct {
-	catalog     string
-	shouldError bool
+func TestCompositeEmptyConfig(t *testing.T) {
+	t.Run("names an empty contribution file", func(t *testing.T) {
+		template := NewTemplate(WithNamedContributionFile("contributions/composite.yaml", strings.NewReader("")))
+		_, err := template.parsedContributions()
+		require.EqualError(t, err, `contribution config "contributions/composite.yaml" contained no documents`)
+	})
+
+	t.Run("treats a file of comments as empty", func(t *testing.T) {
+		template := NewTemplate(WithNamedCatalogFile("stdin", strings.NewReader("# generated\n---\n# nothing to see\n")))
+		_, err := template.parsedCatalogs()
+		require.EqualError(t, err, `catalog config "stdin" contained no documents`)
+	})
+
+	t.Run("names unnamed files by index", func(t *testing.T) {
+		template := NewTemplate(WithContributionFiles(strings.NewReader(renderValidComposite), strings.NewReader("\n")))
+		_, err := template.parsedContributions()
+		require.EqualError(t, err, `contribution config "contribution-config[1]" contained no documents`)
+	})
+
+	t.Run("prefixes other errors with the name", func(t *testing.T) {
+		template := NewTemplate(WithNamedCatalogFile("https://example.com/catalogs.yaml", strings.NewReader("schema: olm.composite.catalogs/v3\n")))
+		_, err := template.parsedCatalogs()
+		require.Error(t, err)
+		require.True(t, strings.HasPrefix(err.Error(), "https://example.com/catalogs.yaml: "), err.Error())
+	})
 }
 
-func (fg *fakeGetter) Get(url string) (*http.Response, error) {
-	if fg.shouldError {
-		return nil, fmt.Errorf("error!")
-	}
+func TestNamedConfigFiles(t *testing.T) {
+	t.Run("catalog validation errors name the file", func(t *testing.T) {
+		catalog := renderValidCatalog + "    allowedComponents:\n      - \"[\"\n"
+		template := NewTemplate(WithNamedCatalogFile("catalogs.yaml", strings.NewReader(catalog)))
+		_, err := template.CatalogConfig()
+		require.Error(t, err)
 
-	return &http.Response{
-		Body: io.NopCloser(strings.NewReader(fg.catalog)),
-	}, nil
+		var validationErrs ValidationErrors
+		require.ErrorAs(t, err, &validationErrs)
+		require.Equal(t, "catalogs.yaml", validationErrs[0].Source)
+		require.Contains(t, err.Error(), "  - catalogs.yaml: ")
+	})
+
+	t.Run("component validation errors name the file", func(t *testing.T) {
+		contribution := renderValidComposite + "---\n" + strings.Replace(renderValidComposite, "path: my-operator", "path: other-operator", 1)
+		template := NewTemplate(WithNamedContributionFile("stdin", strings.NewReader(contribution)))
+		_, err := template.ContributionConfig()
+		require.EqualError(t, err, `composite configuration file is invalid: stdin document[1]: duplicate component name "first-catalog" at stdin document[0] components[0], stdin document[1] components[0]`)
+	})
+
+	t.Run("unnamed files are named by index", func(t *testing.T) {
+		template := NewTemplate(
+			WithCatalogFile(strings.NewReader(renderValidCatalog)),
+			WithNamedCatalogFile("https://example.com/catalogs.yaml", strings.NewReader(renderValidCatalog)),
+		)
+		_, err := template.CatalogConfig()
+		require.EqualError(t, err, `catalog configuration is invalid: https://example.com/catalogs.yaml: duplicate catalog name "first-catalog" at catalog-config[0] catalogs[0], https://example.com/catalogs.yaml catalogs[0]`)
+	})
 }
 
-func TestFetchCatalogConfig(t *testing.T) {
-	type testCase struct {
-		name       string
-		fakeGetter *fakeGetter
-		path       string
-		createFile bool
-		assertions func(t *testing.T, rc io.ReadCloser, err error)
+func TestCompositeRenderOutputSink(t *testing.T) {
+	testDir := t.TempDir()
+	input := filepath.Join(testDir, "input.yaml")
+	require.NoError(t, os.WriteFile(input, []byte(basicBuiltFbcYaml), 0o666))
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s/first-catalog
+      baseImage: quay.io/operator-framework/opm:latest
+    builders:
+      - olm.builder.raw
+`, testDir)
+	composite := fmt.Sprintf(`
+schema: olm.composite
+components:
+  - name: first-catalog
+    destination:
+      path: my-operator
+    strategy:
+      name: raw
+      template:
+        schema: olm.builder.raw
+        config:
+          input: %s
+          output: catalog.yaml
+`, input)
+	newTemplate := func(opts ...TemplateOption) *Template {
+		return NewTemplate(append([]TemplateOption{
+			WithCatalogFile(strings.NewReader(catalogs)),
+			WithContributionFile(strings.NewReader(composite)),
+			WithOutputType("yaml"),
+		}, opts...)...)
 	}
 
-	testDir := t.TempDir()
+	t.Run("streams the catalog to a tar archive", func(t *testing.T) {
+		archive := &bytes.Buffer{}
+		report, err := newTemplate(WithOutputSinks(func(Catalog) (OutputSink, error) {
+			return NewTarSink(archive), nil
+		})).RenderWithReport(context.Background(), true)
+		require.NoError(t, err)
+		require.Equal(t, ValidationPassed, report.Components[0].Validation)
+		require.Equal(t, []string{"webhook-operator"}, report.Components[0].Packages)
+		file := filepath.Join(testDir, "first-catalog", "my-operator", "catalog.yaml")
+		require.Equal(t, []string{file}, report.Components[0].Files)
+		require.Equal(t, digest.FromString(basicBuiltFbcYaml).String(), report.Components[0].Digests[file])
+		require.NoDirExists(t, filepath.Join(testDir, "first-catalog"))
 
-	testCases := []testCase{
-		{
-			name: "Successful HTTP fetch",
-			path: "http://some-path.com",
-			fakeGetter: &fakeGetter{
-				catalog: validCatalog,
-			},
-			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
-				require.NoError(t, err)
-				require.NotNil(t, rc)
-			},
-		},
-		{
-			name: "Failed HTTP fetch",
-			path: "http://some-path.com",
-			fakeGetter: &fakeGetter{
-				catalog:     validCatalog,
-				shouldError: true,
-			},
-			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
-				require.Error(t, err)
-				require.Equal(t, "fetching remote catalog config file \"http://some-path.com\": error!", err.Error())
-			},
-		},
-		// TODO: for some reason this is triggering the fakeGetter.Get() function instead of using os.Open()
-		{
-			name: "Successful file fetch",
-			path: "file/test.yaml",
-			fakeGetter: &fakeGetter{
-				catalog:     validCatalog,
-				shouldError: true,
-			},
-			createFile: true,
-			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
-				require.NoError(t, err)
-				require.NotNil(t, rc)
-			},
-		},
-		{
-			name: "Failed file fetch",
-			path: "file/test.yaml",
-			fakeGetter: &fakeGetter{
-				catalog: validCatalog,
-			},
-			createFile: false,
-			assertions: func(t *testing.T, rc io.ReadCloser, err error) {
-				require.Error(t, err)
-				require.Equal(t, "opening catalog config file \"file/test.yaml\": open file/test.yaml: no such file or directory", err.Error())
+		tr := tar.NewReader(archive)
+		names := []string{}
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			names = append(names, hdr.Name)
+		}
+		require.Equal(t, []string{"my-operator/", "my-operator/catalog.yaml"}, names)
+	})
+
+	t.Run("writes an OCI image layout", func(t *testing.T) {
+		layoutDir := filepath.Join(testDir, "layouts")
+		_, err := newTemplate(WithOutputSinks(OCILayoutSinks(layoutDir))).RenderWithReport(context.Background(), true)
+		require.NoError(t, err)
+
+		var index v1.Index
+		data, err := os.ReadFile(filepath.Join(layoutDir, "first-catalog", "index.json"))
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &index))
+		require.Len(t, index.Manifests, 1)
+
+		var manifest v1.Manifest
+		data, err = os.ReadFile(filepath.Join(layoutDir, "first-catalog", "blobs", "sha256", index.Manifests[0].Digest.Encoded()))
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &manifest))
+		require.Equal(t, "quay.io/operator-framework/opm:latest", manifest.Annotations[v1.AnnotationBaseImageName])
+		require.Len(t, manifest.Layers, 1)
+		require.FileExists(t, filepath.Join(layoutDir, "first-catalog", "blobs", "sha256", manifest.Layers[0].Digest.Encoded()))
+	})
+
+	t.Run("validates what was written", func(t *testing.T) {
+		sink := &failingSink{}
+		_, err := newTemplate(WithOutputSinks(func(Catalog) (OutputSink, error) {
+			return sink, nil
+		})).RenderWithReport(context.Background(), true)
+		require.ErrorContains(t, err, `nothing was written to "my-operator" in the output sink`)
+		require.False(t, sink.closed)
+	})
+
+	t.Run("rejects options reading the working directory", func(t *testing.T) {
+		_, err := newTemplate(WithOutputSinks(OCILayoutSinks(testDir)), WithIncrementalBuild(true)).RenderWithReport(context.Background(), true)
+		require.EqualError(t, err, "output sinks can't be combined with incremental builds")
+	})
+}
+
+// failingSink is an OutputSink that drops every file written to it.
+type failingSink struct {
+	fstest.MapFS
+	closed bool
+}
+
+func (s *failingSink) WriteFile(string, []byte) error {
+	return nil
+}
+
+func (s *failingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestCompositeRenderResume(t *testing.T) {
+	workingDir := t.TempDir()
+	catalog := strings.Replace(renderValidCatalog, "workingDir: contributions/first-catalog", "workingDir: "+workingDir, 1) + "    sharedPackages: [webhook-operator]\n"
+	composite := renderValidComposite + `  - name: second
+    catalog: first-catalog
+    destination:
+      path: second-operator
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+`
+
+	var builds, validations int
+	render := func(failing bool, opts ...TemplateOption) (*RenderReport, error) {
+		template := NewTemplate(append([]TemplateOption{
+			WithCatalogFile(strings.NewReader(catalog)),
+			WithContributionFile(strings.NewReader(composite)),
+			WithMaxConcurrency(1),
+			WithAtomicOutput(false),
+			WithResume(true),
+		}, opts...)...)
+		template.registeredBuilders = map[string]builderFunc{
+			TestBuilderSchema: func(bc BuilderConfig) Builder {
+				return &resumeTestBuilder{
+					countingBuilder: countingBuilder{fileWritingBuilder: fileWritingBuilder{builderCfg: bc}, builds: &builds, validations: &validations},
+					failing:         failing,
+				}
 			},
-		},
+		}
+		return template.RenderWithReport(context.Background(), true)
 	}
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			filepath := tc.path
-			if tc.createFile {
-				err := os.MkdirAll(path.Join(testDir, path.Dir(tc.path)), 0o777)
-				require.NoError(t, err)
-				file, err := os.Create(path.Join(testDir, tc.path))
-				require.NoError(t, err)
-				_, err = file.WriteString(tc.fakeGetter.catalog)
-				require.NoError(t, err)
+	t.Run("a failed render records its progress", func(t *testing.T) {
+		_, err := render(true)
+		require.ErrorContains(t, err, "build error!")
+		require.Equal(t, 2, builds)
 
-				filepath = path.Join(testDir, tc.path)
+		data, err := os.ReadFile(filepath.Join(workingDir, resumeFileName))
+		require.NoError(t, err)
+		var state resumeState
+		require.NoError(t, json.Unmarshal(data, &state))
+		require.True(t, state.Components["first-catalog"].Succeeded)
+		require.False(t, state.Components["second"].Succeeded)
+
+		// the state file must not be loaded as part of the catalog
+		ignore, err := os.ReadFile(filepath.Join(workingDir, indexIgnoreFileName))
+		require.NoError(t, err)
+		require.Equal(t, resumeFileName+"\n", string(ignore))
+	})
+
+	t.Run("resuming only builds the failed component", func(t *testing.T) {
+		report, err := render(false)
+		require.NoError(t, err)
+		require.Equal(t, 3, builds)
+		require.True(t, report.Components[0].UpToDate)
+		require.Equal(t, ValidationPassed, report.Components[0].Validation)
+		require.False(t, report.Components[1].UpToDate)
+
+		// a successful render has nothing to resume
+		require.NoFileExists(t, filepath.Join(workingDir, resumeFileName))
+		_, err = render(false)
+		require.NoError(t, err)
+		require.Equal(t, 5, builds)
+	})
+
+	t.Run("changed components are rebuilt", func(t *testing.T) {
+		_, err := render(true)
+		require.Error(t, err)
+		composite = strings.Replace(composite, "contribution1.yaml", "contribution2.yaml", 1)
+		report, err := render(false)
+		require.NoError(t, err)
+		require.False(t, report.Components[0].UpToDate)
+		require.Equal(t, 9, builds)
+	})
+
+	t.Run("force ignores the progress", func(t *testing.T) {
+		_, err := render(true)
+		require.Error(t, err)
+		report, err := render(false, WithForceRebuild(true))
+		require.NoError(t, err)
+		require.False(t, report.Components[0].UpToDate)
+		require.Equal(t, 13, builds)
+	})
+}
+
+// resumeTestBuilder fails to build the second component when failing is set.
+type resumeTestBuilder struct {
+	countingBuilder
+	failing bool
+}
+
+func (b *resumeTestBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	if b.failing && dir == "second-operator" {
+		*b.builds++
+		return fmt.Errorf("build error!")
+	}
+	return b.countingBuilder.Build(ctx, reg, dir, td)
+}
+
+func TestBuildStandaloneComponent(t *testing.T) {
+	registered := WithRegisteredBuilder(TestBuilderSchema, func(bc BuilderConfig) Builder { return &fileWritingBuilder{builderCfg: bc} }, false)
+
+	t.Run("builds the component into its destination", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "my-operator")
+		require.NoError(t, BuildComponent(context.Background(), ComponentBuildRequest{
+			Schema:         TestBuilderSchema,
+			TemplateConfig: []byte(`{"input": "components/contribution1.yaml", "output": "catalog.yaml"}`),
+			Destination:    dest,
+		}, registered))
+		require.FileExists(t, filepath.Join(dest, "catalog.yaml"))
+	})
+
+	t.Run("unknown schemas list the registered schemas", func(t *testing.T) {
+		err := BuildComponent(context.Background(), ComponentBuildRequest{
+			Schema:      "olm.builder.unknown",
+			Destination: t.TempDir(),
+		}, registered)
+		require.EqualError(t, err, `building component: unknown schema "olm.builder.unknown", registered schemas are: [olm.builder.basic olm.builder.custom olm.builder.raw olm.builder.semver olm.builder.test]`)
+	})
+
+	t.Run("build errors are returned", func(t *testing.T) {
+		err := BuildComponent(context.Background(), ComponentBuildRequest{
+			Schema:      TestBuilderSchema,
+			Destination: t.TempDir(),
+		}, WithRegisteredBuilder(TestBuilderSchema, func(bc BuilderConfig) Builder { return &TestBuilder{buildShouldError: true} }, false))
+		require.EqualError(t, err, "building component: build error!")
+	})
+
+	t.Run("validation errors are returned", func(t *testing.T) {
+		err := BuildComponent(context.Background(), ComponentBuildRequest{
+			Schema:      TestBuilderSchema,
+			Destination: t.TempDir(),
+		}, WithRegisteredBuilder(TestBuilderSchema, func(bc BuilderConfig) Builder { return &TestBuilder{validateShouldError: true} }, false))
+		require.EqualError(t, err, "validating component: validate error!")
+	})
+
+	t.Run("an empty destination is rejected", func(t *testing.T) {
+		err := BuildComponent(context.Background(), ComponentBuildRequest{Schema: TestBuilderSchema}, registered)
+		require.EqualError(t, err, "building component: destination must not be empty")
+	})
+}
+
+// nestingBuilder writes the name of the component it builds to out.txt.
+// Builds interleave when they can: the child component waits for the build
+// of the parent component its destination is nested in to start, and the
+// parent then waits for the output of the child to be in place. Both give up
+// waiting after a while.
+type nestingBuilder struct {
+	TestBuilder
+	bc            BuilderConfig
+	parentStarted chan struct{}
+}
+
+func (nb *nestingBuilder) Build(ctx context.Context, reg image.Registry, dir string, td TemplateDefinition) error {
+	info, _ := ComponentInfoFromContext(ctx)
+	switch info.Component {
+	case "parent":
+		close(nb.parentStarted)
+		childOutput := filepath.Join(nb.bc.WorkingDir, "operators", "nested", "out.txt")
+		for deadline := time.Now().Add(300 * time.Millisecond); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if _, err := os.Stat(childOutput); err == nil {
+				break
 			}
+		}
+	case "child":
+		select {
+		case <-nb.parentStarted:
+		case <-time.After(300 * time.Millisecond):
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(nb.bc.WorkingDir, dir), 0o777); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(nb.bc.WorkingDir, dir, "out.txt"), []byte(info.Component), 0o666)
+}
 
-			rc, err := FetchCatalogConfig(filepath, tc.fakeGetter)
-			tc.assertions(t, rc, err)
-		})
+func TestCompositeRenderNestedDestinations(t *testing.T) {
+	workingDir := t.TempDir()
+	catalogs := fmt.Sprintf(`
+schema: olm.composite.catalogs
+catalogs:
+  - name: first-catalog
+    destination:
+      workingDir: %s
+    builders:
+      - olm.builder.test
+`, workingDir)
+	component := func(name string, path string) string {
+		return fmt.Sprintf(`
+  - name: %s
+    catalog: first-catalog
+    destination:
+      path: %s
+    strategy:
+      name: test
+      template:
+        schema: olm.builder.test
+        config: {}
+`, name, path)
+	}
+	contributions := "schema: olm.composite\ncomponents:" + component("parent", "operators") + component("child", "operators/nested")
+
+	builder := &nestingBuilder{parentStarted: make(chan struct{})}
+	template := NewTemplate(
+		WithCatalogFile(strings.NewReader(catalogs)),
+		WithContributionFile(strings.NewReader(contributions)),
+		WithMaxConcurrency(2),
+	)
+	template.registeredBuilders = map[string]builderFunc{
+		TestBuilderSchema: func(bc BuilderConfig) Builder {
+			builder.bc = bc
+			return builder
+		},
+	}
+
+	require.NoError(t, template.Render(context.Background(), false))
+	for path, component := range map[string]string{
+		"operators/out.txt":        "parent",
+		"operators/nested/out.txt": "child",
+	} {
+		data, err := os.ReadFile(filepath.Join(workingDir, filepath.FromSlash(path)))
+		require.NoError(t, err)
+		require.Equal(t, component, string(data))
 	}
+
+	require.Equal(t, map[string]*sync.Mutex{}, nestedDestinationLocks(map[string]Catalog{"first-catalog": {Name: "first-catalog", Destination: CatalogDestination{WorkingDir: workingDir}}}, []Component{
+		{Name: "a", Catalog: "first-catalog", Destination: ComponentDestination{Path: "a"}},
+		{Name: "ab", Catalog: "first-catalog", Destination: ComponentDestination{Path: "ab"}},
+	}))
 }
@@ -0,0 +1,153 @@
+// Package compositemetrics adapts the instrumentation of composite template
+// renders to Prometheus metrics, for services that render composite
+// templates.
+package compositemetrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/operator-framework/operator-registry/alpha/template/composite"
+)
+
+// The values of the result label of the metrics.
+const (
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+)
+
+// Metrics is a composite.Instrumentation that records Prometheus metrics. It
+// is a prometheus.Collector, to be registered with the registry the service
+// exposes:
+//
+//	metrics := compositemetrics.New("my_service")
+//	prometheus.MustRegister(metrics)
+//	template := composite.NewTemplate(composite.WithInstrumentation(metrics), ...)
+//
+// The same Metrics should be used for every render.
+type Metrics struct {
+	composite.NopInstrumentation
+
+	rendersStarted     prometheus.Counter
+	rendersFinished    *prometheus.CounterVec
+	buildDuration      *prometheus.HistogramVec
+	validationDuration *prometheus.HistogramVec
+	pullDuration       *prometheus.HistogramVec
+	fetchDuration      *prometheus.HistogramVec
+}
+
+var (
+	_ composite.Instrumentation = &Metrics{}
+	_ prometheus.Collector      = &Metrics{}
+)
+
+// New returns metrics named <namespace>_composite_<name>, or
+// composite_<name> when namespace is empty:
+//
+//   - renders_started_total counts the renders that started.
+//   - renders_total counts the renders that finished, by result.
+//   - component_build_duration_seconds is a histogram of the duration of
+//     component builds, by catalog, component, schema and result.
+//   - component_validation_duration_seconds is a histogram of the duration of
+//     component validations, by catalog, component, schema and result.
+//   - image_pull_duration_seconds is a histogram of the duration of the image
+//     pulls of builders, by catalog and result.
+//   - config_fetch_duration_seconds is a histogram of the duration of
+//     configuration file fetches, by kind, source and result.
+func New(namespace string) *Metrics {
+	const subsystem = "composite"
+	// builds and validations of large catalogs take minutes
+	stepBuckets := prometheus.ExponentialBuckets(0.1, 2, 12)
+	return &Metrics{
+		rendersStarted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "renders_started_total",
+			Help:      "Number of composite template renders started.",
+		}),
+		rendersFinished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "renders_total",
+			Help:      "Number of composite template renders finished, by result.",
+		}, []string{"result"}),
+		buildDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "component_build_duration_seconds",
+			Help:      "Duration of component builds, including retries.",
+			Buckets:   stepBuckets,
+		}, []string{"catalog", "component", "schema", "result"}),
+		validationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "component_validation_duration_seconds",
+			Help:      "Duration of component validations.",
+			Buckets:   stepBuckets,
+		}, []string{"catalog", "component", "schema", "result"}),
+		pullDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "image_pull_duration_seconds",
+			Help:      "Duration of the image pulls of builders.",
+			Buckets:   stepBuckets,
+		}, []string{"catalog", "result"}),
+		fetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "config_fetch_duration_seconds",
+			Help:      "Duration of configuration file fetches.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"kind", "source", "result"}),
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.rendersStarted, m.rendersFinished, m.buildDuration, m.validationDuration, m.pullDuration, m.fetchDuration}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+func (m *Metrics) RenderStarted() {
+	m.rendersStarted.Inc()
+}
+
+func (m *Metrics) RenderFinished(_ time.Duration, err error) {
+	m.rendersFinished.WithLabelValues(result(err)).Inc()
+}
+
+func (m *Metrics) ComponentBuilt(component string, catalog string, schema string, duration time.Duration, err error) {
+	m.buildDuration.WithLabelValues(catalog, component, schema, result(err)).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ComponentValidated(component string, catalog string, schema string, duration time.Duration, err error) {
+	m.validationDuration.WithLabelValues(catalog, component, schema, result(err)).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ImagePulled(catalog string, duration time.Duration, err error) {
+	m.pullDuration.WithLabelValues(catalog, result(err)).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ConfigFetched(kind string, source string, duration time.Duration, err error) {
+	m.fetchDuration.WithLabelValues(kind, source, result(err)).Observe(duration.Seconds())
+}
+
+func result(err error) string {
+	if err != nil {
+		return ResultFailed
+	}
+	return ResultSucceeded
+}
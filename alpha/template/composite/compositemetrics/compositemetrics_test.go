@@ -0,0 +1,50 @@
+package compositemetrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := New("test")
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(metrics))
+
+	metrics.RenderStarted()
+	metrics.RenderStarted()
+	metrics.RenderFinished(time.Second, nil)
+	metrics.RenderFinished(time.Second, errors.New("failed"))
+	metrics.ComponentBuilt("my-operator", "my-catalog", "olm.builder.basic", 3*time.Second, nil)
+	metrics.ComponentValidated("my-operator", "my-catalog", "olm.builder.basic", time.Second, errors.New("invalid"))
+	metrics.ImagePulled("my-catalog", 2*time.Second, nil)
+	metrics.ConfigFetched("catalog", "remote", 50*time.Millisecond, nil)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP test_composite_renders_started_total Number of composite template renders started.
+# TYPE test_composite_renders_started_total counter
+test_composite_renders_started_total 2
+# HELP test_composite_renders_total Number of composite template renders finished, by result.
+# TYPE test_composite_renders_total counter
+test_composite_renders_total{result="failed"} 1
+test_composite_renders_total{result="succeeded"} 1
+`), "test_composite_renders_started_total", "test_composite_renders_total"))
+
+	count, err := testutil.GatherAndCount(reg,
+		"test_composite_component_build_duration_seconds",
+		"test_composite_component_validation_duration_seconds",
+		"test_composite_image_pull_duration_seconds",
+		"test_composite_config_fetch_duration_seconds",
+	)
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+
+	problems, err := testutil.GatherAndLint(reg)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+}
@@ -0,0 +1,251 @@
+// Package compositetest helps test composite template builders: it runs a
+// Builder against fixture templates in a temporary working directory,
+// compares what it wrote against golden files and validates the result.
+package compositetest
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
+
+	"github.com/operator-framework/operator-registry/alpha/template/composite"
+	"github.com/operator-framework/operator-registry/pkg/image"
+)
+
+// UpdateGoldenEnv is the environment variable that makes AssertGolden
+// replace the golden files with the output of the builder instead of
+// comparing them when it is set to "true".
+const UpdateGoldenEnv = "COMPOSITETEST_UPDATE_GOLDEN"
+
+// Harness runs a builder in a temporary working directory.
+type Harness struct {
+	t testing.TB
+	// WorkingDir is the working directory of the builder's config, which
+	// builds are written under.
+	WorkingDir string
+	// Registry is passed to the builder, an empty image.MockRegistry unless
+	// set.
+	Registry image.Registry
+	// Builder is the builder under test.
+	Builder composite.Builder
+}
+
+// New returns a harness for the builder newBuilder returns for bc, with its
+// working directory replaced by a new temporary directory that is removed
+// when the test ends.
+func New(t testing.TB, newBuilder func(composite.BuilderConfig) composite.Builder, bc composite.BuilderConfig) *Harness {
+	t.Helper()
+	bc.WorkingDir = t.TempDir()
+	return &Harness{
+		t:          t,
+		WorkingDir: bc.WorkingDir,
+		Registry:   &image.MockRegistry{},
+		Builder:    newBuilder(bc),
+	}
+}
+
+// Registry returns a registry serving an image for every reference in
+// images, with the files under the directory it maps to as contents. Like a
+// bundle image, an image is labeled with the annotations of the directory's
+// metadata/annotations.yaml, if it has one.
+func Registry(t testing.TB, images map[string]string) image.Registry {
+	t.Helper()
+	reg := &image.MockRegistry{RemoteImages: map[image.Reference]*image.MockImage{}}
+	for ref, dir := range images {
+		labels, err := bundleLabels(dir)
+		if err != nil {
+			t.Fatalf("reading the labels of image %q: %v", ref, err)
+		}
+		reg.RemoteImages[image.SimpleReference(ref)] = &image.MockImage{Labels: labels, FS: os.DirFS(dir)}
+	}
+	return reg
+}
+
+// bundleLabels returns the annotations in dir/metadata/annotations.yaml, or
+// none when it doesn't exist.
+func bundleLabels(dir string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "metadata", "annotations.yaml"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var annotations struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := yaml.Unmarshal(data, &annotations); err != nil {
+		return nil, err
+	}
+	return annotations.Annotations, nil
+}
+
+// LoadTemplate reads the template definition at path, a YAML or JSON
+// document with the schema and config of the template, such as
+//
+//	schema: olm.builder.raw
+//	config:
+//	  input: testdata/input.yaml
+//	  output: catalog.yaml
+//
+// Relative paths in the config are not rewritten, so they are relative to
+// the directory of the package under test.
+func LoadTemplate(t testing.TB, path string) composite.TemplateDefinition {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading template %q: %v", path, err)
+	}
+	var td composite.TemplateDefinition
+	if err := yaml.Unmarshal(data, &td); err != nil {
+		t.Fatalf("parsing template %q: %v", path, err)
+	}
+	return td
+}
+
+// Build runs the builder against td, writing to dir relative to the working
+// directory, and returns the path of the destination. The test fails if the
+// build does.
+func (h *Harness) Build(dir string, td composite.TemplateDefinition) string {
+	h.t.Helper()
+	if err := h.BuildErr(dir, td); err != nil {
+		h.t.Fatalf("building %q: %v", dir, err)
+	}
+	return filepath.Join(h.WorkingDir, dir)
+}
+
+// BuildErr runs the builder against td, writing to dir relative to the
+// working directory, and returns its error.
+func (h *Harness) BuildErr(dir string, td composite.TemplateDefinition) error {
+	if err := h.Builder.ValidateConfig(td); err != nil {
+		return err
+	}
+	return h.Builder.Build(context.Background(), h.Registry, dir, td)
+}
+
+// Validate runs the validation of the builder on dir, relative to the
+// working directory.
+func (h *Harness) Validate(dir string) error {
+	return h.Builder.Validate(context.Background(), dir)
+}
+
+// AssertGolden fails the test with a unified diff of every file that differs
+// between dir, relative to the working directory, and goldenDir, including
+// files that only exist on one side. When UpdateGoldenEnv is "true",
+// goldenDir is replaced by the contents of dir instead.
+func (h *Harness) AssertGolden(dir string, goldenDir string) {
+	h.t.Helper()
+	AssertGolden(h.t, filepath.Join(h.WorkingDir, dir), goldenDir)
+}
+
+// AssertGolden fails t with a unified diff of every file that differs between
+// dir and goldenDir, like Harness.AssertGolden.
+func AssertGolden(t testing.TB, dir string, goldenDir string) {
+	t.Helper()
+	if os.Getenv(UpdateGoldenEnv) == "true" {
+		if err := updateGolden(dir, goldenDir); err != nil {
+			t.Fatalf("updating golden files %q: %v", goldenDir, err)
+		}
+		return
+	}
+
+	actual, err := readFiles(dir)
+	if err != nil {
+		t.Fatalf("reading %q: %v", dir, err)
+	}
+	expected, err := readFiles(goldenDir)
+	if err != nil {
+		t.Fatalf("reading golden files %q: %v", goldenDir, err)
+	}
+	names := map[string]bool{}
+	for name := range actual {
+		names[name] = true
+	}
+	for name := range expected {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		a, inActual := actual[name]
+		e, inExpected := expected[name]
+		switch {
+		case !inActual:
+			t.Errorf("%s: missing, expected golden file %s", name, filepath.Join(goldenDir, name))
+		case !inExpected:
+			t.Errorf("%s: unexpected file, not in %s (set %s=true to update the golden files)", name, goldenDir, UpdateGoldenEnv)
+		case a != e:
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(e),
+				B:        difflib.SplitLines(a),
+				FromFile: filepath.Join(goldenDir, name),
+				ToFile:   filepath.Join(dir, name),
+				Context:  3,
+			})
+			if err != nil {
+				t.Fatalf("diffing %s: %v", name, err)
+			}
+			t.Errorf("%s differs from its golden file (set %s=true to update the golden files):\n%s", name, UpdateGoldenEnv, diff)
+		}
+	}
+}
+
+// readFiles returns the contents of the regular files under dir, by slash
+// separated path relative to dir. A missing dir has no files.
+func readFiles(dir string) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	return files, err
+}
+
+// updateGolden replaces the files under goldenDir with those under dir.
+func updateGolden(dir string, goldenDir string) error {
+	files, err := readFiles(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(goldenDir); err != nil {
+		return err
+	}
+	for name, data := range files {
+		p := filepath.Join(goldenDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, []byte(data), 0o666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
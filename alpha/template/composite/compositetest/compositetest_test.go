@@ -0,0 +1,206 @@
+package compositetest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/operator-framework/operator-registry/alpha/template/composite"
+)
+
+func TestInTreeBuilders(t *testing.T) {
+	type spec struct {
+		name       string
+		newBuilder func(composite.BuilderConfig) composite.Builder
+		bc         composite.BuilderConfig
+		template   string
+		images     map[string]string
+		golden     string
+		validate   bool
+	}
+	newRaw := func(bc composite.BuilderConfig) composite.Builder { return composite.NewRawBuilder(bc) }
+	newBasic := func(bc composite.BuilderConfig) composite.Builder { return composite.NewBasicBuilder(bc) }
+	newSemver := func(bc composite.BuilderConfig) composite.Builder { return composite.NewSemverBuilder(bc) }
+	bazImages := map[string]string{
+		"test.registry/baz-operator/baz-bundle:v1.0.0": "testdata/bundles/baz-v1.0.0",
+		"test.registry/baz-operator/baz-bundle:v1.0.1": "testdata/bundles/baz-v1.0.1",
+		"test.registry/baz-operator/baz-bundle:v1.1.0": "testdata/bundles/baz-v1.1.0",
+	}
+	for _, s := range []spec{
+		{
+			name:       "raw",
+			newBuilder: newRaw,
+			bc:         composite.BuilderConfig{OutputType: composite.OutputTypeYAML},
+			template:   "testdata/raw/template.yaml",
+			golden:     "testdata/raw/golden",
+			validate:   true,
+		},
+		{
+			name:       "raw json",
+			newBuilder: newRaw,
+			bc:         composite.BuilderConfig{OutputType: composite.OutputTypeJSON},
+			template:   "testdata/raw/template-json.yaml",
+			golden:     "testdata/raw/golden-json",
+			validate:   true,
+		},
+		{
+			name:       "raw directory input",
+			newBuilder: newRaw,
+			bc:         composite.BuilderConfig{OutputType: composite.OutputTypeYAML},
+			template:   "testdata/raw/template-dir.yaml",
+			golden:     "testdata/raw/golden",
+			validate:   true,
+		},
+		{
+			name:       "raw glob input",
+			newBuilder: newRaw,
+			bc:         composite.BuilderConfig{OutputType: composite.OutputTypeJSON},
+			template:   "testdata/raw/template-glob.yaml",
+			golden:     "testdata/raw/golden-json",
+			validate:   true,
+		},
+		{
+			name:       "raw remote input",
+			newBuilder: newRaw,
+			bc: composite.BuilderConfig{
+				OutputType: composite.OutputTypeYAML,
+				HttpGetter: fileGetter{"https://example.com/raw/input.yaml": "testdata/raw/input.yaml"},
+			},
+			template: "testdata/raw/template-remote.yaml",
+			golden:   "testdata/raw/golden",
+			validate: true,
+		},
+		{
+			name:       "raw per-package layout",
+			newBuilder: newRaw,
+			bc:         composite.BuilderConfig{OutputType: composite.OutputTypeJSON, OutputLayout: composite.OutputLayoutPerPackage},
+			template:   "testdata/raw/template.yaml",
+			golden:     "testdata/raw/golden-per-package",
+			validate:   true,
+		},
+		{
+			name:       "basic mermaid",
+			newBuilder: newBasic,
+			bc:         composite.BuilderConfig{OutputType: composite.OutputTypeMermaid},
+			template:   "testdata/basic/template.yaml",
+			golden:     "testdata/basic/golden",
+		},
+		{
+			name:       "basic yaml",
+			newBuilder: newBasic,
+			bc:         composite.BuilderConfig{OutputType: composite.OutputTypeYAML},
+			template:   "testdata/basic/bundles/template-yaml.yaml",
+			images:     bazImages,
+			golden:     "testdata/basic/bundles/golden",
+			validate:   true,
+		},
+		{
+			name:       "basic json",
+			newBuilder: newBasic,
+			bc:         composite.BuilderConfig{OutputType: composite.OutputTypeJSON},
+			template:   "testdata/basic/bundles/template-json.yaml",
+			images:     bazImages,
+			golden:     "testdata/basic/bundles/golden-json",
+			validate:   true,
+		},
+		{
+			name:       "semver yaml",
+			newBuilder: newSemver,
+			bc:         composite.BuilderConfig{OutputType: composite.OutputTypeYAML},
+			template:   "testdata/semver/template-yaml.yaml",
+			images:     bazImages,
+			golden:     "testdata/semver/golden",
+			validate:   true,
+		},
+		{
+			name:       "semver json",
+			newBuilder: newSemver,
+			bc:         composite.BuilderConfig{OutputType: composite.OutputTypeJSON},
+			template:   "testdata/semver/template-json.yaml",
+			images:     bazImages,
+			golden:     "testdata/semver/golden-json",
+			validate:   true,
+		},
+	} {
+		t.Run(s.name, func(t *testing.T) {
+			h := New(t, s.newBuilder, s.bc)
+			if s.images != nil {
+				h.Registry = Registry(t, s.images)
+			}
+			h.Build("my-operator", LoadTemplate(t, s.template))
+			h.AssertGolden("my-operator", s.golden)
+			if s.validate {
+				require.NoError(t, h.Validate("my-operator"))
+			}
+		})
+	}
+}
+
+// fileGetter serves the file each URL maps to.
+type fileGetter map[string]string
+
+func (g fileGetter) Do(req *http.Request) (*http.Response, error) {
+	path, ok := g[req.URL.String()]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(&bytes.Buffer{})}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func TestBuildErr(t *testing.T) {
+	h := New(t, func(bc composite.BuilderConfig) composite.Builder { return composite.NewRawBuilder(bc) }, composite.BuilderConfig{})
+	err := h.BuildErr("my-operator", composite.TemplateDefinition{Schema: composite.RawBuilderSchema, Config: []byte(`{"output": "catalog.yaml"}`)})
+	require.ErrorContains(t, err, "raw template config must have a non-empty input")
+	require.NoDirExists(t, filepath.Join(h.WorkingDir, "my-operator"))
+}
+
+// recordingT records the errors reported by AssertGolden.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertGolden(t *testing.T) {
+	write := func(dir string, files map[string]string) {
+		for name, data := range files {
+			require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o777))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o666))
+		}
+	}
+	dir, goldenDir := t.TempDir(), t.TempDir()
+	write(dir, map[string]string{"same.yaml": "a\n", "changed.yaml": "a\nb\n", "extra.yaml": "x\n"})
+	write(goldenDir, map[string]string{"same.yaml": "a\n", "changed.yaml": "a\nc\n", "pkg/missing.yaml": "y\n"})
+
+	rt := &recordingT{}
+	AssertGolden(rt, dir, goldenDir)
+	require.Len(t, rt.errors, 3)
+	require.True(t, strings.HasPrefix(rt.errors[0], "changed.yaml differs from its golden file"), rt.errors[0])
+	require.Contains(t, rt.errors[0], "-c\n+b\n")
+	require.Equal(t, fmt.Sprintf("extra.yaml: unexpected file, not in %s (set %s=true to update the golden files)", goldenDir, UpdateGoldenEnv), rt.errors[1])
+	require.Equal(t, fmt.Sprintf("pkg/missing.yaml: missing, expected golden file %s", filepath.Join(goldenDir, "pkg/missing.yaml")), rt.errors[2])
+
+	t.Setenv(UpdateGoldenEnv, "true")
+	AssertGolden(t, dir, goldenDir)
+	require.NoError(t, os.Unsetenv(UpdateGoldenEnv))
+	rt = &recordingT{}
+	AssertGolden(rt, dir, goldenDir)
+	require.Empty(t, rt.errors)
+	require.NoFileExists(t, filepath.Join(goldenDir, "pkg", "missing.yaml"))
+}
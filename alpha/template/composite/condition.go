@@ -0,0 +1,297 @@
+package composite
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// Condition decides whether a component is rendered. It is either a boolean
+// or an expression over the values set with WithRenderValues, such as
+// `flavor == "community" && !legacy`. Expressions compare values and quoted
+// strings with == and !=, and combine conditions with &&, || and !, grouped
+// with parentheses. A value used on its own must be "true" or "false". An
+// empty Condition is true.
+type Condition string
+
+// UnmarshalJSON accepts a boolean or a string expression.
+func (c *Condition) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*c = Condition(strconv.FormatBool(b))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("condition must be a boolean or a string expression")
+	}
+	*c = Condition(s)
+	return nil
+}
+
+// WithRenderValues sets the values that the enabled conditions of components
+// are evaluated with. Conditions referencing a value that is not set are an
+// error unless parsing is lenient, in which case the value is empty.
+func WithRenderValues(values map[string]string) TemplateOption {
+	return func(t *Template) {
+		t.renderValues = map[string]string{}
+		for name, value := range values {
+			t.renderValues[name] = value
+		}
+	}
+}
+
+// disabledComponents evaluates the enabled conditions of components and
+// returns the names of those that are disabled.
+func (t *Template) disabledComponents(components []Component) (map[string]bool, error) {
+	disabled := map[string]bool{}
+	var errs []error
+	for _, component := range components {
+		if component.Enabled == "" {
+			continue
+		}
+		expr, err := parseCondition(string(component.Enabled))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("component %q: invalid enabled condition %q: %v", component.Name, component.Enabled, err))
+			continue
+		}
+		enabled, err := expr.evalBool(t.renderValue)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("component %q: evaluating enabled condition %q: %v", component.Name, component.Enabled, err))
+			continue
+		}
+		if !enabled {
+			t.logger().WithField("component", component.Name).Infof("component is disabled by condition %q", component.Enabled)
+			disabled[component.Name] = true
+		}
+	}
+	return disabled, utilerrors.NewAggregate(errs)
+}
+
+// renderValue returns the render value name.
+func (t *Template) renderValue(name string) (string, error) {
+	if value, ok := t.renderValues[name]; ok {
+		return value, nil
+	}
+	if !t.lenientParsing {
+		return "", fmt.Errorf("undefined value %q", name)
+	}
+	t.logger().Warnf("treating undefined value %q as empty", name)
+	return "", nil
+}
+
+// conditionExpr is a node of a parsed Condition.
+type conditionExpr struct {
+	// op is one of "literal", "value", "!", "&&", "||", "==" or "!="
+	op string
+	// text is the string of a literal or the name of a value
+	text string
+	args []*conditionExpr
+}
+
+// evalBool evaluates e as a condition, looking values up with lookup.
+func (e *conditionExpr) evalBool(lookup func(string) (string, error)) (bool, error) {
+	switch e.op {
+	case "!":
+		v, err := e.args[0].evalBool(lookup)
+		return !v, err
+	case "&&", "||":
+		left, err := e.args[0].evalBool(lookup)
+		if err != nil || (e.op == "&&" && !left) || (e.op == "||" && left) {
+			return left, err
+		}
+		return e.args[1].evalBool(lookup)
+	case "==", "!=":
+		left, err := e.args[0].evalString(lookup)
+		if err != nil {
+			return false, err
+		}
+		right, err := e.args[1].evalString(lookup)
+		if err != nil {
+			return false, err
+		}
+		return (left == right) == (e.op == "=="), nil
+	}
+	s, err := e.evalString(lookup)
+	if err != nil {
+		return false, err
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		if e.op == "value" {
+			return false, fmt.Errorf("value %q is %q, which is not a boolean", e.text, s)
+		}
+		return false, fmt.Errorf("%q is not a boolean", s)
+	}
+	return v, nil
+}
+
+// evalString evaluates an operand of a comparison.
+func (e *conditionExpr) evalString(lookup func(string) (string, error)) (string, error) {
+	switch e.op {
+	case "literal":
+		return e.text, nil
+	case "value":
+		return lookup(e.text)
+	}
+	return "", fmt.Errorf("a comparison can't have an %s operand", e.op)
+}
+
+// parseCondition parses a condition expression.
+func parseCondition(expr string) (*conditionExpr, error) {
+	tokens, err := conditionTokens(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &conditionParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+// conditionTokens splits expr into operators, parentheses, quoted strings and
+// names.
+func conditionTokens(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case strings.HasPrefix(expr[i:], "==") || strings.HasPrefix(expr[i:], "!=") || strings.HasPrefix(expr[i:], "&&") || strings.HasPrefix(expr[i:], "||"):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case c == '!':
+			tokens = append(tokens, "!")
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, expr[i:i+end+2])
+			i += end + 2
+		case isConditionNameChar(rune(c)):
+			start := i
+			for i < len(expr) && isConditionNameChar(rune(expr[i])) {
+				i++
+			}
+			tokens = append(tokens, expr[start:i])
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	return tokens, nil
+}
+
+func isConditionNameChar(c rune) bool {
+	return c <= unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '-' || c == '.')
+}
+
+type conditionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *conditionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *conditionParser) parseOr() (*conditionExpr, error) {
+	return p.parseBinary("||", p.parseAnd)
+}
+
+func (p *conditionParser) parseAnd() (*conditionExpr, error) {
+	return p.parseBinary("&&", p.parseUnary)
+}
+
+// parseBinary parses a left-associative sequence of operands joined by op.
+func (p *conditionParser) parseBinary(op string, operand func() (*conditionExpr, error)) (*conditionExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if p.peek() != op {
+			return left, nil
+		}
+		p.pos++
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &conditionExpr{op: op, args: []*conditionExpr{left, right}}
+	}
+}
+
+func (p *conditionParser) parseUnary() (*conditionExpr, error) {
+	if p.peek() == "!" {
+		p.pos++
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &conditionExpr{op: "!", args: []*conditionExpr{e}}, nil
+	}
+	if p.peek() == "(" {
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return e, nil
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peek(); op == "==" || op == "!=" {
+		p.pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &conditionExpr{op: op, args: []*conditionExpr{left, right}}, nil
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseOperand() (*conditionExpr, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case token[0] == '"' || token[0] == '\'':
+		p.pos++
+		return &conditionExpr{op: "literal", text: token[1 : len(token)-1]}, nil
+	case token == "true" || token == "false":
+		p.pos++
+		return &conditionExpr{op: "literal", text: token}, nil
+	case isConditionNameChar(rune(token[0])):
+		p.pos++
+		return &conditionExpr{op: "value", text: token}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", token)
+}
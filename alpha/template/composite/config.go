@@ -3,17 +3,81 @@ package composite
 const (
 	CompositeSchema = "olm.composite"
 	CatalogSchema   = "olm.composite.catalogs"
+	// CatalogSchemaV2 is the current version of the catalog configuration
+	// schema. Catalogs that omit their builders use DefaultBuilders.
+	CatalogSchemaV2 = "olm.composite.catalogs/v2"
 )
 
+// DefaultBuilders are the builders of a catalog that does not list any in a
+// CatalogSchemaV2 configuration. The custom builder runs arbitrary commands
+// and must always be enabled explicitly.
+var DefaultBuilders = []string{BasicBuilderSchema, SemverBuilderSchema, RawBuilderSchema}
+
 type CompositeConfig struct {
 	Schema     string
 	Components []Component
+	// Catalogs optionally defines the catalogs inline, in place of a separate
+	// catalog configuration file. It is ignored when a catalog configuration
+	// file is provided.
+	Catalogs []Catalog `json:",omitempty"`
 }
 
 type Component struct {
-	Name        string
+	Name string
+	// Catalog is the name of the catalog the component is rendered into.
+	// When empty, the component name is used as the catalog name.
+	Catalog     string `json:",omitempty"`
 	Destination ComponentDestination
 	Strategy    BuildStrategy
+	// Output overrides the template's output type (json or yaml) for the
+	// component.
+	Output OutputType `json:",omitempty"`
+	// Deprecations are written as olm.deprecations blobs alongside the
+	// built content of the component.
+	Deprecations []Deprecation `json:",omitempty"`
+	// DependsOn are the names of the components of the same catalog that
+	// must be built before this one, for example because its builder reads
+	// their output.
+	DependsOn []string `json:",omitempty"`
+	// Enabled is the condition under which the component is rendered. The
+	// component is skipped when it is false.
+	Enabled Condition `json:",omitempty"`
+	// ExpectedPackages are the packages the component must produce. When
+	// set, the component fails if its output is missing one of them or has
+	// any other package. Streamed output is not checked.
+	ExpectedPackages []string `json:",omitempty"`
+	// PackageNamePrefix is prepended to the name of every package the
+	// component produces, and to every reference to them in its output,
+	// before it is validated. The expected packages, deprecations written
+	// by the Template and package conflicts are checked against the prefixed
+	// names. It can't be used with streamed output.
+	PackageNamePrefix string `json:",omitempty"`
+}
+
+// Deprecation deprecates a package, or some of its channels and bundles.
+type Deprecation struct {
+	Package string
+	Entries []DeprecationEntry
+}
+
+type DeprecationEntry struct {
+	Reference DeprecationReference
+	Message   string
+}
+
+// DeprecationReference names the deprecated object by schema, one of
+// olm.package, olm.channel or olm.bundle. The name is empty for the package.
+type DeprecationReference struct {
+	Schema string
+	Name   string `json:",omitempty"`
+}
+
+// CatalogName returns the name of the catalog the component is rendered into.
+func (c Component) CatalogName() string {
+	if c.Catalog != "" {
+		return c.Catalog
+	}
+	return c.Name
 }
 
 type ComponentDestination struct {
@@ -23,6 +87,9 @@ type ComponentDestination struct {
 type BuildStrategy struct {
 	Name     string
 	Template TemplateDefinition
+	// SkipPatch overrides the skipPatch setting of the component's semver
+	// template config.
+	SkipPatch *bool `json:",omitempty"`
 }
 
 type CatalogConfig struct {
@@ -34,9 +101,54 @@ type Catalog struct {
 	Name        string
 	Destination CatalogDestination
 	Builders    []string
+	// Registry configures how the builders of the catalog pull images. It
+	// overrides the configuration set with WithRegistryConfig.
+	Registry *CatalogRegistry `json:",omitempty"`
+	// SharedPackages are the packages that more than one component of the
+	// catalog may write.
+	SharedPackages []string `json:",omitempty"`
+	// Defaults apply to every component of the catalog.
+	Defaults *CatalogDefaults `json:",omitempty"`
+	// AllowedComponents are the names of the components that may target the
+	// catalog, or path.Match patterns matching them. Any component may target
+	// the catalog when it is empty.
+	AllowedComponents []string `json:",omitempty"`
+}
+
+// CatalogDefaults are the settings inherited by the components of a catalog.
+// A setting of the component itself takes precedence over the catalog's
+// default, which takes precedence over the option the Template was created
+// with.
+type CatalogDefaults struct {
+	// Output is the output type of the components that don't set one,
+	// instead of the one set with WithOutputType.
+	Output OutputType `json:",omitempty"`
+	// PinImages is whether the basic and semver builders pin bundle images
+	// when their template configuration doesn't set pinImages.
+	PinImages *bool `json:",omitempty"`
+	// ValidationLevel is how thoroughly the components of the catalog are
+	// validated, instead of the level set with WithValidationLevel.
+	ValidationLevel ValidationLevel `json:",omitempty"`
+	// DestinationPrefix is prepended to the destination path of every
+	// component of the catalog, except streamed ones. It is relative to the
+	// catalog's working directory.
+	DestinationPrefix string `json:",omitempty"`
+}
+
+// CatalogRegistry configures how the images of a catalog are pulled.
+type CatalogRegistry struct {
+	// SkipTLSVerifyHosts are the registry hosts, e.g. "registry.internal:5000",
+	// whose TLS certificates are not verified.
+	SkipTLSVerifyHosts []string `json:",omitempty"`
+	// CAFile is a PEM file of the certificate authorities trusted in addition
+	// to the system ones.
+	CAFile string `json:",omitempty"`
+	// AuthFile is a docker config file with the credentials used to pull
+	// images, instead of the default docker or podman one.
+	AuthFile string `json:",omitempty"`
 }
 
 type CatalogDestination struct {
-	// BaseImage  string
+	BaseImage  string `json:",omitempty"`
 	WorkingDir string
 }
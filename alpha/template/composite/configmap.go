@@ -0,0 +1,90 @@
+package composite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultCatalogConfigMapKey is the key of a ConfigMap catalog
+	// configuration file that holds the catalog configuration.
+	DefaultCatalogConfigMapKey = "catalogs.yaml"
+	// DefaultContributionConfigMapKey is the key of a ConfigMap contribution
+	// file that holds the composite configuration.
+	DefaultContributionConfigMapKey = "composite.yaml"
+)
+
+// WithConfigMapKeys sets the keys holding the catalog and composite
+// configurations of configuration files that are v1 ConfigMap manifests,
+// instead of DefaultCatalogConfigMapKey and DefaultContributionConfigMapKey.
+// An empty key keeps the default.
+func WithConfigMapKeys(catalogKey string, contributionKey string) TemplateOption {
+	return func(t *Template) {
+		t.catalogMapKey = catalogKey
+		t.contributionMapKey = contributionKey
+	}
+}
+
+// unwrapConfigMap returns the value of key in the ConfigMap when data is a
+// v1 ConfigMap manifest, and data itself otherwise. The ConfigMap must be the
+// only document of data.
+func unwrapConfigMap(data []byte, kind string, key string) ([]byte, error) {
+	docs, err := decodeDocuments(bytes.NewReader(data))
+	if err != nil {
+		// reported when the configuration is parsed
+		return data, nil
+	}
+	var configMap *corev1.ConfigMap
+	for i, doc := range docs {
+		var typeMeta struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+		}
+		if err := json.Unmarshal(doc.raw, &typeMeta); err != nil || typeMeta.APIVersion != "v1" || typeMeta.Kind != "ConfigMap" {
+			continue
+		}
+		if len(docs) > 1 {
+			return nil, fmt.Errorf("%s config: document[%d] is a ConfigMap, which must be the only document of the file", kind, i)
+		}
+		configMap = &corev1.ConfigMap{}
+		if err := json.Unmarshal(doc.raw, configMap); err != nil {
+			return nil, fmt.Errorf("%s config: unmarshalling ConfigMap: %v", kind, err)
+		}
+	}
+	if configMap == nil {
+		return data, nil
+	}
+
+	value, ok := configMap.Data[key]
+	if !ok {
+		keys := make([]string, 0, len(configMap.Data))
+		for k := range configMap.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("%s config: ConfigMap %q has no data, expected key %q", kind, configMap.Name, key)
+		}
+		return nil, fmt.Errorf("%s config: ConfigMap %q has no key %q, found keys %s", kind, configMap.Name, key, strings.Join(quoteAll(keys), ", "))
+	}
+	return []byte(value), nil
+}
+
+func (t *Template) catalogConfigMapKey() string {
+	if t.catalogMapKey == "" {
+		return DefaultCatalogConfigMapKey
+	}
+	return t.catalogMapKey
+}
+
+func (t *Template) contributionConfigMapKey() string {
+	if t.contributionMapKey == "" {
+		return DefaultContributionConfigMapKey
+	}
+	return t.contributionMapKey
+}
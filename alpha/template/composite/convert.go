@@ -0,0 +1,56 @@
+package composite
+
+import (
+	"fmt"
+	"sort"
+)
+
+// catalogConverters convert each supported version of the catalog
+// configuration to the current internal representation, in which every
+// catalog lists its builders explicitly.
+var catalogConverters = map[string]func(*CatalogConfig) *CatalogConfig{
+	CatalogSchema:   convertCatalogConfigV1,
+	CatalogSchemaV2: convertCatalogConfigV2,
+}
+
+func convertCatalogConfigV1(c *CatalogConfig) *CatalogConfig {
+	c.Schema = CatalogSchemaV2
+	for i := range c.Catalogs {
+		// v1 catalogs without builders have none rather than the defaults
+		if c.Catalogs[i].Builders == nil {
+			c.Catalogs[i].Builders = []string{}
+		}
+	}
+	return c
+}
+
+func convertCatalogConfigV2(c *CatalogConfig) *CatalogConfig {
+	c.Schema = CatalogSchemaV2
+	for i := range c.Catalogs {
+		// an explicitly empty list disables every builder
+		if c.Catalogs[i].Builders == nil {
+			c.Catalogs[i].Builders = append([]string{}, DefaultBuilders...)
+		}
+	}
+	return c
+}
+
+// supportedCatalogSchemas returns the supported versions of the catalog
+// configuration schema, in lexical order.
+func supportedCatalogSchemas() []string {
+	schemas := make([]string, 0, len(catalogConverters))
+	for schema := range catalogConverters {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+	return schemas
+}
+
+// unknownSchemaError reports a configuration file of the given kind with an
+// unsupported schema.
+func unknownSchemaError(kind string, schema string, supported []string) error {
+	if len(supported) == 1 {
+		return fmt.Errorf("%s configuration file has unknown schema, should be %q", kind, supported[0])
+	}
+	return fmt.Errorf("%s configuration file has unknown schema %q, supported schemas are: %s", kind, schema, supported)
+}
@@ -0,0 +1,103 @@
+package composite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// validateDependencies returns the validation errors of the dependencies of
+// the components, which must name other components of the same catalog.
+func validateDependencies(components []Component, refs []configRef) ValidationErrors {
+	catalogs := map[string][]string{}
+	catalogOf := map[string]string{}
+	for _, component := range components {
+		catalogs[component.CatalogName()] = append(catalogs[component.CatalogName()], component.Name)
+		catalogOf[component.Name] = component.CatalogName()
+	}
+	for _, names := range catalogs {
+		sort.Strings(names)
+	}
+
+	var errs ValidationErrors
+	for i, component := range components {
+		seen := map[string]bool{}
+		for j, dependency := range component.DependsOn {
+			field := fmt.Sprintf("dependsOn[%d]", j)
+			switch {
+			case dependency == component.Name:
+				errs = append(errs, refs[i].invalid(field, "component %q depends on itself", component.Name))
+			case seen[dependency]:
+				errs = append(errs, refs[i].invalid(field, "component %q depends on %q more than once", component.Name, dependency))
+			case catalogOf[dependency] != component.CatalogName():
+				errs = append(errs, refs[i].invalid(field, "component %q depends on unknown component %q, components of catalog %q are: %s", component.Name, dependency, component.CatalogName(), catalogs[component.CatalogName()]))
+			}
+			seen[dependency] = true
+		}
+	}
+	return errs
+}
+
+// buildOrder returns the indices of components in the order they are built:
+// each component after the components it depends on, and otherwise in the
+// order they are defined. Dependencies on components that are not rendered,
+// for example because of the component filter, are ignored.
+func buildOrder(components []Component) ([]int, error) {
+	index := map[string]int{}
+	for i, component := range components {
+		index[component.Name] = i
+	}
+	dependencies := make([][]int, len(components))
+	for i, component := range components {
+		for _, dependency := range component.DependsOn {
+			if j, ok := index[dependency]; ok {
+				dependencies[i] = append(dependencies[i], j)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var (
+		order []int
+		state = make([]int, len(components))
+		stack []int
+		visit func(i int) error
+	)
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := []string{}
+			for k := len(stack) - 1; k >= 0; k-- {
+				cycle = append([]string{components[stack[k]].Name}, cycle...)
+				if stack[k] == i {
+					break
+				}
+			}
+			cycle = append(cycle, components[i].Name)
+			return fmt.Errorf("components of catalog %q depend on each other in a cycle: %s", components[i].CatalogName(), strings.Join(cycle, " -> "))
+		}
+		state[i] = visiting
+		stack = append(stack, i)
+		for _, j := range dependencies[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+		order = append(order, i)
+		return nil
+	}
+	for i := range components {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
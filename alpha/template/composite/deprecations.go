@@ -0,0 +1,211 @@
+package composite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+// SchemaDeprecations is the schema of the blobs deprecating the packages,
+// channels and bundles of a package.
+const SchemaDeprecations = "olm.deprecations"
+
+// deprecationsFileName is the name of the file, without extension, that the
+// deprecations of a component are written to in its destination.
+const deprecationsFileName = "deprecations"
+
+// deprecationReferenceSchemas are the schemas of the objects a deprecation
+// entry may reference.
+var deprecationReferenceSchemas = []string{declcfg.SchemaPackage, declcfg.SchemaChannel, declcfg.SchemaBundle}
+
+// WithCrossComponentDeprecations allows the deprecations of a component to
+// reference channels and bundles written by other components of the same
+// catalog. By default they may only reference the component's own output.
+func WithCrossComponentDeprecations(allow bool) TemplateOption {
+	return func(t *Template) {
+		t.crossDeprecations = allow
+	}
+}
+
+// validateDeprecations returns the validation errors of the deprecations of
+// the component at ref.
+func validateDeprecations(component Component, ref configRef) ValidationErrors {
+	var errs ValidationErrors
+	packages := map[string]int{}
+	for i, deprecation := range component.Deprecations {
+		field := fmt.Sprintf("deprecations[%d]", i)
+		if deprecation.Package == "" {
+			errs = append(errs, ref.invalid(field+".package", "component %q has a deprecation without a package", component.Name))
+		} else if j, ok := packages[deprecation.Package]; ok {
+			errs = append(errs, ref.invalid(field+".package", "component %q deprecates package %q more than once, it is also deprecated by deprecations[%d]", component.Name, deprecation.Package, j))
+		} else {
+			packages[deprecation.Package] = i
+		}
+		if len(deprecation.Entries) == 0 {
+			errs = append(errs, ref.invalid(field+".entries", "component %q has a deprecation of package %q without entries", component.Name, deprecation.Package))
+		}
+		for j, entry := range deprecation.Entries {
+			entryField := fmt.Sprintf("%s.entries[%d]", field, j)
+			switch entry.Reference.Schema {
+			case declcfg.SchemaPackage:
+				if entry.Reference.Name != "" {
+					errs = append(errs, ref.invalid(entryField+".reference.name", "component %q has a package deprecation entry with a name, the package is set by the deprecation", component.Name))
+				}
+			case declcfg.SchemaChannel, declcfg.SchemaBundle:
+				if entry.Reference.Name == "" {
+					errs = append(errs, ref.invalid(entryField+".reference.name", "component %q has a %s deprecation entry without a name", component.Name, entry.Reference.Schema))
+				}
+			default:
+				errs = append(errs, ref.invalid(entryField+".reference.schema", "component %q has a deprecation entry with unsupported schema %q, expected one of %s", component.Name, entry.Reference.Schema, deprecationReferenceSchemas))
+			}
+			if entry.Message == "" {
+				errs = append(errs, ref.invalid(entryField+".message", "component %q has a deprecation entry without a message", component.Name))
+			}
+		}
+	}
+	return errs
+}
+
+// deprecationBlobs returns the olm.deprecations blobs of deprecations.
+func deprecationBlobs(deprecations []Deprecation) ([]declcfg.Meta, error) {
+	type reference struct {
+		Schema string `json:"schema"`
+		Name   string `json:"name,omitempty"`
+	}
+	type entry struct {
+		Reference reference `json:"reference"`
+		Message   string    `json:"message"`
+	}
+	metas := make([]declcfg.Meta, 0, len(deprecations))
+	for _, deprecation := range deprecations {
+		blob := struct {
+			Schema  string  `json:"schema"`
+			Package string  `json:"package"`
+			Entries []entry `json:"entries"`
+		}{
+			Schema:  SchemaDeprecations,
+			Package: deprecation.Package,
+		}
+		for _, e := range deprecation.Entries {
+			blob.Entries = append(blob.Entries, entry{Reference: reference(e.Reference), Message: e.Message})
+		}
+		data, err := json.Marshal(blob)
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, declcfg.Meta{Schema: SchemaDeprecations, Package: deprecation.Package, Blob: data})
+	}
+	return metas, nil
+}
+
+// addDeprecations writes the deprecations of component to dir, where it was
+// just built, after checking that they only reference the component's own
+// output, unless they may reference other components of the catalog, which is
+// checked once all of them are rendered.
+func (t *Template) addDeprecations(ctx context.Context, component Component, dir string, report *ComponentReport) error {
+	if !t.crossDeprecations {
+		dcfg, err := declcfg.LoadFS(ctx, os.DirFS(dir))
+		if err != nil {
+			return fmt.Errorf("loading output to resolve deprecations: %v", err)
+		}
+		if err := utilerrors.NewAggregate(unresolvedDeprecations(component.Deprecations, dcfg)); err != nil {
+			return fmt.Errorf("deprecations are not in the component's output: %w", err)
+		}
+	}
+
+	metas, err := deprecationBlobs(component.Deprecations)
+	if err != nil {
+		return fmt.Errorf("writing deprecations: %v", err)
+	}
+	outputType := t.componentOutputType(component).fbcType()
+	name := deprecationsFileName + "." + string(outputType)
+	if err := build(&declcfg.DeclarativeConfig{Others: metas}, filepath.Join(dir, name), outputType); err != nil {
+		return fmt.Errorf("writing deprecations: %v", err)
+	}
+	// builders that don't report the files they write leave pruning the
+	// destination alone
+	if report.outputs != nil {
+		report.outputs = append(report.outputs, name)
+	}
+	return nil
+}
+
+// unresolvedDeprecations returns the errors of the entries of deprecations
+// that reference packages, channels or bundles that dcfg doesn't have.
+func unresolvedDeprecations(deprecations []Deprecation, dcfg *declcfg.DeclarativeConfig) []error {
+	packages := map[string]bool{}
+	channels := map[string]bool{}
+	bundles := map[string]bool{}
+	for _, p := range dcfg.Packages {
+		packages[p.Name] = true
+	}
+	for _, c := range dcfg.Channels {
+		channels[c.Package+"/"+c.Name] = true
+	}
+	for _, b := range dcfg.Bundles {
+		bundles[b.Package+"/"+b.Name] = true
+	}
+
+	var errs []error
+	for _, deprecation := range deprecations {
+		if !packages[deprecation.Package] {
+			errs = append(errs, fmt.Errorf("deprecated package %q is not defined", deprecation.Package))
+			continue
+		}
+		for _, entry := range deprecation.Entries {
+			key := deprecation.Package + "/" + entry.Reference.Name
+			if (entry.Reference.Schema == declcfg.SchemaChannel && !channels[key]) || (entry.Reference.Schema == declcfg.SchemaBundle && !bundles[key]) {
+				errs = append(errs, fmt.Errorf("deprecated %s %q of package %q is not defined", entry.Reference.Schema, entry.Reference.Name, deprecation.Package))
+			}
+		}
+	}
+	return errs
+}
+
+// checkCatalogDeprecations resolves the deprecations of the rendered
+// components against the whole catalog they are rendered into, its working
+// directory or, in memory, the FBC of its components.
+func (t *Template) checkCatalogDeprecations(ctx context.Context, in *renderInput, components []Component, reports []ComponentReport) error {
+	deprecations := map[string][]Deprecation{}
+	for _, component := range components {
+		deprecations[component.Name] = component.Deprecations
+	}
+
+	catalogs := map[string]*declcfg.DeclarativeConfig{}
+	var errs []error
+	for _, report := range reports {
+		if len(deprecations[report.Name]) == 0 || report.Err != nil || report.Disabled || report.Destination == StdoutPath {
+			continue
+		}
+		dcfg, ok := catalogs[report.Catalog]
+		if !ok {
+			dcfg = &declcfg.DeclarativeConfig{}
+			if in.mode == renderModeInMemory {
+				for _, r := range reports {
+					if r.Catalog == report.Catalog && r.config != nil {
+						dcfg.Packages = append(dcfg.Packages, r.config.Packages...)
+						dcfg.Channels = append(dcfg.Channels, r.config.Channels...)
+						dcfg.Bundles = append(dcfg.Bundles, r.config.Bundles...)
+					}
+				}
+			} else {
+				var err error
+				dcfg, err = declcfg.LoadFS(ctx, os.DirFS(report.WorkingDir))
+				if err != nil {
+					return fmt.Errorf("loading catalog %q to resolve deprecations: %v", report.Catalog, err)
+				}
+			}
+			catalogs[report.Catalog] = dcfg
+		}
+		if unresolved := unresolvedDeprecations(deprecations[report.Name], dcfg); len(unresolved) > 0 {
+			errs = append(errs, fmt.Errorf("component %q has deprecations that are not in catalog %q: %v", report.Name, report.Catalog, utilerrors.NewAggregate(unresolved)))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
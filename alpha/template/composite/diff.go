@@ -0,0 +1,109 @@
+package composite
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// diffDirs returns a unified diff of the regular files under oldDir and
+// newDir, labelled with their paths relative to label. Files that only exist
+// on one side are diffed against /dev/null. A missing directory is treated as
+// empty. The build state file is not compared.
+func diffDirs(oldDir string, newDir string, label string) (string, error) {
+	oldFiles, err := listFiles(oldDir)
+	if err != nil {
+		return "", err
+	}
+	newFiles, err := listFiles(newDir)
+	if err != nil {
+		return "", err
+	}
+
+	names := map[string]bool{}
+	for name := range oldFiles {
+		names[name] = true
+	}
+	for name := range newFiles {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var out bytes.Buffer
+	for _, name := range sorted {
+		oldData, inOld := oldFiles[name]
+		newData, inNew := newFiles[name]
+		if inOld && inNew && bytes.Equal(oldData, newData) {
+			continue
+		}
+		fromFile, toFile := "/dev/null", "/dev/null"
+		if inOld {
+			fromFile = path.Join("a", filepath.ToSlash(label), name)
+		}
+		if inNew {
+			toFile = path.Join("b", filepath.ToSlash(label), name)
+		}
+		err := difflib.WriteUnifiedDiff(&out, difflib.UnifiedDiff{
+			A:        splitLines(oldData),
+			B:        splitLines(newData),
+			FromFile: fromFile,
+			ToFile:   toFile,
+			Context:  3,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return out.String(), nil
+}
+
+// splitLines splits data into lines, keeping their line endings.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// listFiles reads the regular files under dir, keyed by their slash separated
+// path relative to dir.
+func listFiles(dir string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || d.Name() == stateFileName || d.Name() == resumeFileName {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
@@ -0,0 +1,73 @@
+package composite
+
+import (
+	"fmt"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ConfigValidationError describes an invalid field in a catalog or composite
+// configuration.
+type ConfigValidationError struct {
+	// Catalog is the name of the catalog whose field is invalid, if the error
+	// applies to a single catalog.
+	Catalog string `json:"catalog,omitempty"`
+	// Source identifies the configuration file and document containing the
+	// field when the configuration spans more than one of them or the file was
+	// given a name. Error prefixes the message with it.
+	Source string `json:"source,omitempty"`
+	// Field is the name of the invalid field, e.g. destination.workingDir.
+	Field string `json:"field"`
+	// Path is the JSON path of the invalid field within its document, e.g.
+	// catalogs[2].destination.workingDir. Catalog indices are positions in
+	// the merged catalog configuration, which only match the document when
+	// the catalogs are defined in a single document.
+	Path string `json:"path"`
+	// Line is the line the invalid field is defined on within its document,
+	// or 0 if unknown.
+	Line int `json:"line,omitempty"`
+	// Message is a human-readable description of the error.
+	Message string `json:"message"`
+}
+
+func (e ConfigValidationError) Error() string {
+	return e.Message
+}
+
+// ValidationErrors aggregates the validation errors found in a configuration.
+// Errors that apply to a single catalog are grouped by catalog.
+type ValidationErrors []ConfigValidationError
+
+func (e ValidationErrors) Error() string {
+	var (
+		ungrouped []error
+		catalogs  []string
+		grouped   = map[string][]string{}
+	)
+	for _, err := range e {
+		if err.Source != "" {
+			err.Message = err.Source + ": " + err.Message
+		}
+		if err.Catalog == "" {
+			ungrouped = append(ungrouped, err)
+			continue
+		}
+		if _, ok := grouped[err.Catalog]; !ok {
+			catalogs = append(catalogs, err.Catalog)
+		}
+		grouped[err.Catalog] = append(grouped[err.Catalog], err.Message)
+	}
+
+	var msg strings.Builder
+	if len(ungrouped) > 0 {
+		msg.WriteString(utilerrors.NewAggregate(ungrouped).Error())
+	}
+	for _, catalog := range catalogs {
+		fmt.Fprintf(&msg, "\nCatalog %v:\n", catalog)
+		for _, m := range grouped[catalog] {
+			fmt.Fprintf(&msg, "  - %v\n", m)
+		}
+	}
+	return msg.String()
+}
@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package composite
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows, which has no process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills cmd. Processes it started are not killed.
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,53 @@
+package composite
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// variablePattern matches ${NAME} references and the $$ escape.
+var variablePattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandVariables replaces every ${NAME} in data with the value of the
+// variable NAME, taken from the configured variables or else from the
+// environment, and every $$ with $. The resolved values are recorded in
+// t.resolvedVariables. Undefined variables are an error unless parsing is
+// lenient, in which case they are left as is.
+func (t *Template) expandVariables(data []byte) ([]byte, error) {
+	if t.resolvedVariables == nil {
+		t.resolvedVariables = map[string]string{}
+	}
+
+	var errs []error
+	undefined := map[string]bool{}
+	expanded := variablePattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		if string(match) == "$$" {
+			return []byte("$")
+		}
+		name := string(match[2 : len(match)-1])
+		value, ok := t.variables[name]
+		if !ok {
+			value, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			if !undefined[name] {
+				undefined[name] = true
+				if t.lenientParsing {
+					t.logger().Warnf("leaving undefined variable %q unexpanded", name)
+				} else {
+					errs = append(errs, fmt.Errorf("undefined variable %q", name))
+				}
+			}
+			return match
+		}
+		t.resolvedVariables[name] = value
+		return []byte(value)
+	})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("expanding variables: %v", utilerrors.NewAggregate(errs))
+	}
+	return expanded, nil
+}
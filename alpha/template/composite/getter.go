@@ -0,0 +1,168 @@
+package composite
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const defaultHttpTimeout = 30 * time.Second
+
+// GetterOption configures the client returned by NewDefaultHttpGetter.
+type GetterOption func(*getterOptions)
+
+type getterOptions struct {
+	timeout            time.Duration
+	caFile             string
+	insecureSkipVerify bool
+	proxy              string
+	header             http.Header
+	tokenEnv           string
+}
+
+// WithHttpTimeout sets the overall timeout of a request, including reading
+// the response body. A value of 0 disables the timeout.
+func WithHttpTimeout(timeout time.Duration) GetterOption {
+	return func(o *getterOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithHttpCAFile adds the PEM encoded certificates in caFile to the system
+// certificate pool used to verify servers.
+func WithHttpCAFile(caFile string) GetterOption {
+	return func(o *getterOptions) {
+		o.caFile = caFile
+	}
+}
+
+// WithHttpInsecureSkipVerify disables verification of server certificates.
+// This should only be used with trusted mirrors, e.g. in air-gapped
+// environments.
+func WithHttpInsecureSkipVerify(skip bool) GetterOption {
+	return func(o *getterOptions) {
+		o.insecureSkipVerify = skip
+	}
+}
+
+// WithHttpProxy sends every request through the proxy at proxyURL. By default
+// the proxy is taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables.
+func WithHttpProxy(proxyURL string) GetterOption {
+	return func(o *getterOptions) {
+		o.proxy = proxyURL
+	}
+}
+
+// WithHttpHeader adds a header, e.g. Authorization, to every request. The
+// Authorization header is not sent when a request is redirected to a
+// different host.
+func WithHttpHeader(key, value string) GetterOption {
+	return func(o *getterOptions) {
+		o.header.Add(key, value)
+	}
+}
+
+// WithHttpBearerTokenFromEnv authenticates every request with the bearer
+// token stored in the environment variable name, which keeps the token off
+// the command line.
+func WithHttpBearerTokenFromEnv(name string) GetterOption {
+	return func(o *getterOptions) {
+		o.tokenEnv = name
+	}
+}
+
+// NewDefaultHttpGetter returns an HttpGetter suitable for fetching remote
+// configuration files. Requests time out after 30s unless configured
+// otherwise.
+func NewDefaultHttpGetter(opts ...GetterOption) (HttpGetter, error) {
+	options := getterOptions{
+		timeout: defaultHttpTimeout,
+		header:  http.Header{},
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if options.proxy != "" {
+		proxyURL, err := url.Parse(options.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parsing proxy URL %q: %v", options.proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: options.insecureSkipVerify,
+	}
+	if options.caFile != "" {
+		pem, err := os.ReadFile(options.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file %q: %v", options.caFile, err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file %q does not contain any PEM encoded certificates", options.caFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if options.tokenEnv != "" {
+		token := os.Getenv(options.tokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("environment variable %q for the bearer token is empty or not set", options.tokenEnv)
+		}
+		options.header.Set("Authorization", "Bearer "+token)
+	}
+
+	return &headerGetter{
+		client: &http.Client{
+			Timeout:       options.timeout,
+			Transport:     transport,
+			CheckRedirect: checkRedirect,
+		},
+		header: options.header,
+	}, nil
+}
+
+// headerGetter adds a fixed set of headers to every request it sends.
+type headerGetter struct {
+	client *http.Client
+	header http.Header
+}
+
+func (g *headerGetter) Do(req *http.Request) (*http.Response, error) {
+	if len(g.header) > 0 {
+		req = req.Clone(req.Context())
+		for key, values := range g.header {
+			if req.Header.Get(key) == "" {
+				req.Header[key] = values
+			}
+		}
+	}
+	return g.client.Do(req)
+}
+
+// checkRedirect follows at most 10 redirects like the default client, and
+// drops the Authorization header when redirected to a different host.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
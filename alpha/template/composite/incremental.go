@@ -0,0 +1,115 @@
+package composite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// stateFileName is the name of the file under a component's destination that
+// records the hash of the inputs it was last built from. It is listed in the
+// destination's .indexignore so that it is not loaded as part of the catalog.
+const stateFileName = ".composite-state.json"
+
+const indexIgnoreFileName = ".indexignore"
+
+type componentState struct {
+	Hash string `json:"hash"`
+}
+
+// componentHash returns a digest of everything that determines the output of
+// building component: its builder schema, its builder config, the output
+// type, the migration level, its skip-patch override, its deprecations, its
+// package name prefix and the defaults of its catalog.
+func componentHash(component Component, outputType OutputType, migrationLevel MigrationLevel, defaults *CatalogDefaults) (string, error) {
+	data, err := json.Marshal(struct {
+		Schema         string
+		Config         json.RawMessage
+		OutputType     OutputType
+		MigrationLevel MigrationLevel   `json:",omitempty"`
+		SkipPatch      *bool            `json:",omitempty"`
+		Deprecations   []Deprecation    `json:",omitempty"`
+		PackagePrefix  string           `json:",omitempty"`
+		Defaults       *CatalogDefaults `json:",omitempty"`
+	}{
+		Schema:         component.Strategy.Template.Schema,
+		Config:         component.Strategy.Template.Config,
+		OutputType:     outputType,
+		MigrationLevel: migrationLevel,
+		SkipPatch:      component.Strategy.SkipPatch,
+		Deprecations:   component.Deprecations,
+		PackagePrefix:  component.PackageNamePrefix,
+		Defaults:       defaults,
+	})
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(data).String(), nil
+}
+
+// readComponentState returns the hash recorded under dest, or an empty string
+// if there is none or it can't be read.
+func readComponentState(dest string) string {
+	data, err := os.ReadFile(filepath.Join(dest, stateFileName))
+	if err != nil {
+		return ""
+	}
+	var state componentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return ""
+	}
+	return state.Hash
+}
+
+// writeComponentState records hash under dir and makes sure the state file is
+// ignored when dir is loaded as a catalog.
+func writeComponentState(dir string, hash string) error {
+	data, err := json.Marshal(componentState{Hash: hash})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return fmt.Errorf("writing build state: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, stateFileName), data, 0o666); err != nil {
+		return fmt.Errorf("writing build state: %v", err)
+	}
+	if err := ensureIndexIgnored(dir, stateFileName); err != nil {
+		return fmt.Errorf("updating %s: %v", indexIgnoreFileName, err)
+	}
+	return nil
+}
+
+// removeComponentState removes the state recorded under dest, if any.
+func removeComponentState(dest string) error {
+	if err := os.Remove(filepath.Join(dest, stateFileName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing build state: %v", err)
+	}
+	return nil
+}
+
+// ensureIndexIgnored appends pattern to the .indexignore file in dir, unless
+// it is already listed.
+func ensureIndexIgnored(dir string, pattern string) error {
+	name := filepath.Join(dir, indexIgnoreFileName)
+	data, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == pattern {
+			return nil
+		}
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	data = append(data, pattern+"\n"...)
+	return os.WriteFile(name, data, 0o666)
+}
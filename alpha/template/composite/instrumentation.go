@@ -0,0 +1,97 @@
+package composite
+
+import (
+	"strings"
+	"time"
+)
+
+// Instrumentation receives the outcome of the steps of renders, for
+// aggregating them into metrics when the composite template is rendered by a
+// long-lived service. It is called for the same steps as the progress
+// callback of WithProgress, but with the labels that are worth aggregating
+// rather than the details of each event. The methods may be called
+// concurrently.
+//
+// Implementations should embed NopInstrumentation, so that they keep
+// compiling when methods are added for new steps.
+type Instrumentation interface {
+	// RenderStarted is called when a render, validation or lint starts.
+	RenderStarted()
+	// RenderFinished is called when a render, validation or lint started
+	// duration ago has finished, failing with err if it is not nil.
+	RenderFinished(duration time.Duration, err error)
+	// ComponentBuilt is called when the builder of a component returns.
+	ComponentBuilt(component string, catalog string, schema string, duration time.Duration, err error)
+	// ComponentValidated is called when a component has been validated.
+	ComponentValidated(component string, catalog string, schema string, duration time.Duration, err error)
+	// ImagePulled is called when a builder has pulled an image.
+	ImagePulled(catalog string, duration time.Duration, err error)
+	// ConfigFetched is called when a configuration file of the given kind has
+	// been fetched from source, which is one of ConfigSourceLocal,
+	// ConfigSourceRemote, ConfigSourceOCI and ConfigSourceStdin.
+	ConfigFetched(kind string, source string, duration time.Duration, err error)
+}
+
+// The sources configuration files are fetched from, as reported to
+// Instrumentation.ConfigFetched.
+const (
+	ConfigSourceLocal  = "local"
+	ConfigSourceRemote = "remote"
+	ConfigSourceOCI    = "oci"
+	ConfigSourceStdin  = "stdin"
+)
+
+// NopInstrumentation is an Instrumentation that ignores every call.
+type NopInstrumentation struct{}
+
+var _ Instrumentation = NopInstrumentation{}
+
+func (NopInstrumentation) RenderStarted() {}
+
+func (NopInstrumentation) RenderFinished(time.Duration, error) {}
+
+func (NopInstrumentation) ComponentBuilt(string, string, string, time.Duration, error) {}
+
+func (NopInstrumentation) ComponentValidated(string, string, string, time.Duration, error) {}
+
+func (NopInstrumentation) ImagePulled(string, time.Duration, error) {}
+
+func (NopInstrumentation) ConfigFetched(string, string, time.Duration, error) {}
+
+// WithInstrumentation reports the steps of renders to instrumentation, which
+// defaults to NopInstrumentation.
+func WithInstrumentation(instrumentation Instrumentation) TemplateOption {
+	return func(t *Template) {
+		t.instrumentation = instrumentation
+	}
+}
+
+// WithFetchInstrumentation reports every configuration file fetch to
+// instrumentation.
+func WithFetchInstrumentation(instrumentation Instrumentation) FetchOption {
+	return func(o *fetchOptions) {
+		o.metrics = instrumentation
+	}
+}
+
+func (t *Template) instrument() Instrumentation {
+	if t.instrumentation == nil {
+		return NopInstrumentation{}
+	}
+	return t.instrumentation
+}
+
+// configSource returns the source a configuration file at path is fetched
+// from.
+func configSource(path string) string {
+	switch {
+	case path == StdinPath:
+		return ConfigSourceStdin
+	case strings.HasPrefix(path, ociScheme):
+		return ConfigSourceOCI
+	}
+	if _, local := localConfigPath(path); local {
+		return ConfigSourceLocal
+	}
+	return ConfigSourceRemote
+}
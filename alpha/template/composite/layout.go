@@ -0,0 +1,124 @@
+package composite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+// OutputLayout is how builders lay out the FBC they write to a component's
+// destination.
+type OutputLayout string
+
+const (
+	// OutputLayoutSingleFile writes the FBC to the file named by the output
+	// of the builder config.
+	OutputLayoutSingleFile OutputLayout = "single-file"
+	// OutputLayoutPerPackage writes the FBC of each package to
+	// <package>/catalog.<json|yaml>, like opm does, and the objects that
+	// don't belong to any package to catalog.<json|yaml>. The output of the
+	// builder config is ignored.
+	OutputLayoutPerPackage OutputLayout = "per-package"
+)
+
+// outputLayouts are the supported output layouts.
+var outputLayouts = []OutputLayout{OutputLayoutSingleFile, OutputLayoutPerPackage}
+
+// ParseOutputLayout returns the OutputLayout named by layout. An empty layout
+// defaults to OutputLayoutSingleFile.
+func ParseOutputLayout(layout string) (OutputLayout, error) {
+	if layout == "" {
+		return OutputLayoutSingleFile, nil
+	}
+	for _, l := range outputLayouts {
+		if OutputLayout(layout) == l {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("invalid output layout %q, expected one of %s", layout, outputLayouts)
+}
+
+// WithOutputLayout sets how the basic, semver and raw builders lay out the
+// FBC they write, one of "single-file" or "per-package". An empty layout
+// selects "single-file"; unsupported values are reported when the Template is
+// rendered.
+func WithOutputLayout(layout string) TemplateOption {
+	return func(t *Template) {
+		outputLayout, err := ParseOutputLayout(layout)
+		if err != nil {
+			t.optionErrs = append(t.optionErrs, err)
+			return
+		}
+		t.outputLayout = outputLayout
+	}
+}
+
+// needsOutput reports whether builders need an output file name, which the
+// per-package layout doesn't use.
+func (bc BuilderConfig) needsOutput() bool {
+	return bc.OutputLayout != OutputLayoutPerPackage
+}
+
+// writeOutput writes dcfg to dir, relative to the working directory, in the
+// configured output layout, recording the written files in the build record
+// carried by ctx, if any.
+func (bc BuilderConfig) writeOutput(ctx context.Context, dcfg *declcfg.DeclarativeConfig, dir string, output string) error {
+	files := map[string]*declcfg.DeclarativeConfig{}
+	if bc.needsOutput() {
+		files[output] = dcfg
+	} else {
+		ext := "." + string(bc.OutputType.fbcType())
+		packages := packagesOf(dcfg)
+		for name, pkg := range packages {
+			if name == "" {
+				return fmt.Errorf("every channel and bundle must have a package to be written in the %s layout", OutputLayoutPerPackage)
+			}
+			if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+				return fmt.Errorf("package name %q can't be used as a directory name", name)
+			}
+			files[path.Join(name, "catalog"+ext)] = pkg
+		}
+		unpackaged := &declcfg.DeclarativeConfig{}
+		for _, o := range dcfg.Others {
+			if o.Package == "" {
+				unpackaged.Others = append(unpackaged.Others, o)
+			}
+		}
+		if len(unpackaged.Others) > 0 {
+			files["catalog"+ext] = unpackaged
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if bc.Sink != nil {
+			buf := &bytes.Buffer{}
+			if err := writeDeclCfg(*files[name], buf, bc.OutputType.fbcType()); err != nil {
+				return fmt.Errorf("writing %q to the output sink: %v", sinkName(dir, name), err)
+			}
+			if err := bc.Sink.WriteFile(sinkName(dir, name), buf.Bytes()); err != nil {
+				return fmt.Errorf("writing %q to the output sink: %v", sinkName(dir, name), err)
+			}
+			continue
+		}
+		destPath := filepath.Join(bc.WorkingDir, dir, name)
+		bc.logger().Debugf("writing %q", destPath)
+		if err := build(files[name], destPath, bc.OutputType.fbcType()); err != nil {
+			return err
+		}
+	}
+	if record, ok := ctx.Value(buildRecordKey{}).(*buildRecord); ok {
+		record.outputs = append(record.outputs, names...)
+	}
+	return nil
+}
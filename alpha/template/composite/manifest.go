@@ -0,0 +1,236 @@
+package composite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ManifestSchema is the schema of the manifest written by WithManifest.
+const ManifestSchema = "olm.composite.manifest"
+
+// manifestFileName is the name of the manifest written at the root of a
+// catalog's working directory. It is listed in the working directory's
+// .indexignore so that it is not loaded as part of the catalog.
+const manifestFileName = ".composite-manifest.json"
+
+// Manifest records the digest of every file in the destinations of the
+// components of a catalog, for attesting what a render produced.
+type Manifest struct {
+	Schema  string `json:"schema"`
+	Catalog string `json:"catalog"`
+	// Components are the components of the catalog, ordered by name.
+	Components []ManifestComponent `json:"components"`
+}
+
+// ManifestComponent records the files in the destination of a component.
+type ManifestComponent struct {
+	Name string `json:"name"`
+	// Destination is the component's destination path, relative to the
+	// catalog working directory.
+	Destination string `json:"destination"`
+	// Files maps the path of every file in the destination, relative to the
+	// catalog working directory, to its digest.
+	Files map[string]string `json:"files"`
+}
+
+// ManifestDrift describes a file that differs from its manifest.
+type ManifestDrift struct {
+	Component string
+	// Path is the path of the file, relative to the catalog working
+	// directory.
+	Path string
+	// Expected is the digest recorded in the manifest, empty when the file
+	// is not in the manifest.
+	Expected string
+	// Actual is the digest of the file, empty when the file is missing.
+	Actual string
+}
+
+func (d ManifestDrift) String() string {
+	switch {
+	case d.Expected == "":
+		return fmt.Sprintf("component %q: %q is not in the manifest", d.Component, d.Path)
+	case d.Actual == "":
+		return fmt.Sprintf("component %q: %q is missing", d.Component, d.Path)
+	}
+	return fmt.Sprintf("component %q: %q has digest %s, expected %s", d.Component, d.Path, d.Actual, d.Expected)
+}
+
+// WithManifest writes a manifest of the files in the destinations of the
+// components of each catalog to .composite-manifest.json at the root of the
+// catalog working directory after a successful render. It can be checked
+// later with Template.VerifyManifest.
+func WithManifest(write bool) TemplateOption {
+	return func(t *Template) {
+		t.writeManifest = write
+	}
+}
+
+// writeManifests writes the manifest of every catalog whose working directory
+// exists, returning their paths in catalog order. Streamed and disabled
+// components are left out.
+func (t *Template) writeManifests(catalogs map[string]Catalog, components []Component, disabled map[string]bool) ([]string, error) {
+	names := make([]string, 0, len(catalogs))
+	for name := range catalogs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		written []string
+		errs    []error
+	)
+	for _, name := range names {
+		workingDir := catalogs[name].Destination.WorkingDir
+		if _, err := os.Stat(workingDir); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		manifest := Manifest{Schema: ManifestSchema, Catalog: name, Components: []ManifestComponent{}}
+		for _, component := range components {
+			if component.CatalogName() != name || component.Destination.Path == StdoutPath || disabled[component.Name] {
+				continue
+			}
+			manifest.Components = append(manifest.Components, ManifestComponent{
+				Name:        component.Name,
+				Destination: filepath.Clean(component.Destination.Path),
+			})
+		}
+		sort.Slice(manifest.Components, func(i, j int) bool {
+			return manifest.Components[i].Name < manifest.Components[j].Name
+		})
+		var err error
+		for i := range manifest.Components {
+			if manifest.Components[i].Files, err = destinationDigests(workingDir, manifest.Components, i); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = writeManifest(workingDir, manifest)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("writing manifest of catalog %q: %v", name, err))
+			continue
+		}
+		manifestPath := filepath.Join(workingDir, manifestFileName)
+		t.logger().WithField("catalog", name).Infof("wrote manifest to %q", manifestPath)
+		written = append(written, manifestPath)
+	}
+	return written, utilerrors.NewAggregate(errs)
+}
+
+func writeManifest(workingDir string, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(workingDir, manifestFileName), append(data, '\n'), 0o666); err != nil {
+		return err
+	}
+	return ensureIndexIgnored(workingDir, manifestFileName)
+}
+
+// destinationDigests returns the digest of every file in the destination of
+// components[i], by path relative to workingDir. The build state file, the
+// manifest itself, hidden directories such as staging directories, and the
+// destinations of other components nested in it are skipped. A missing
+// destination has no files.
+func destinationDigests(workingDir string, components []ManifestComponent, i int) (map[string]string, error) {
+	others := map[string]bool{}
+	for j, component := range components {
+		if j != i {
+			others[filepath.Join(workingDir, component.Destination)] = true
+		}
+	}
+	dest := filepath.Join(workingDir, components[i].Destination)
+	digests := map[string]string{}
+	err := filepath.WalkDir(dest, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dest && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p != dest && (strings.HasPrefix(d.Name(), ".") || others[p]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || d.Name() == stateFileName || d.Name() == resumeFileName || p == filepath.Join(workingDir, manifestFileName) {
+			return nil
+		}
+		rel, err := filepath.Rel(workingDir, p)
+		if err != nil {
+			return err
+		}
+		if digests[filepath.ToSlash(rel)], err = fileDigest(p); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+// VerifyManifest recomputes the digests of the files in the destinations of
+// the components recorded in the manifest at path and returns the files that
+// were modified, removed or added since it was written, ordered by component
+// and path. The error lists the same files when there are any.
+func (t *Template) VerifyManifest(path string) ([]ManifestDrift, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %v", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("reading manifest %q: %v", path, err)
+	}
+	if manifest.Schema != ManifestSchema {
+		return nil, fmt.Errorf("reading manifest %q: expected schema %q, found %q", path, ManifestSchema, manifest.Schema)
+	}
+
+	workingDir := filepath.Dir(path)
+	t.logger().WithField("catalog", manifest.Catalog).Infof("verifying %d component(s) against manifest %q", len(manifest.Components), path)
+	var drift []ManifestDrift
+	for i, component := range manifest.Components {
+		actual, err := destinationDigests(workingDir, manifest.Components, i)
+		if err != nil {
+			return nil, fmt.Errorf("computing digests of component %q: %v", component.Name, err)
+		}
+		paths := map[string]bool{}
+		for p := range component.Files {
+			paths[p] = true
+		}
+		for p := range actual {
+			paths[p] = true
+		}
+		sorted := make([]string, 0, len(paths))
+		for p := range paths {
+			sorted = append(sorted, p)
+		}
+		sort.Strings(sorted)
+		for _, p := range sorted {
+			if component.Files[p] != actual[p] {
+				drift = append(drift, ManifestDrift{Component: component.Name, Path: p, Expected: component.Files[p], Actual: actual[p]})
+			}
+		}
+	}
+	if len(drift) == 0 {
+		return nil, nil
+	}
+	errs := make([]error, 0, len(drift))
+	for _, d := range drift {
+		errs = append(errs, errors.New(d.String()))
+	}
+	return drift, fmt.Errorf("catalog %q differs from manifest %q: %w", manifest.Catalog, path, utilerrors.NewAggregate(errs))
+}
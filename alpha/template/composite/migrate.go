@@ -0,0 +1,153 @@
+package composite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/operator-framework/api/pkg/operators"
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+)
+
+// MigrationLevel is the last FBC migration the catalogs rendered by the basic
+// and semver builders reflect, like the --migrate-level of opm render.
+// Rendering at a level older than MigrationLevelLatest undoes the later
+// migrations, for catalog consumers that don't understand the newer schemas.
+type MigrationLevel string
+
+const (
+	// MigrationLevelNone reflects no migration: the objects of each bundle
+	// are written as olm.bundle.object properties.
+	MigrationLevelNone MigrationLevel = "none"
+	// MigrationLevelBundleObjectToCSVMetadata writes the metadata of the CSV
+	// of each bundle as an olm.csv.metadata property, which is how bundle
+	// images are rendered.
+	MigrationLevelBundleObjectToCSVMetadata MigrationLevel = "bundle-object-to-csv-metadata"
+
+	// MigrationLevelLatest is the level catalogs are rendered at unless
+	// another one is configured.
+	MigrationLevelLatest = MigrationLevelBundleObjectToCSVMetadata
+)
+
+// migrationLevels are the supported migration levels, oldest first.
+var migrationLevels = []MigrationLevel{MigrationLevelNone, MigrationLevelBundleObjectToCSVMetadata}
+
+// ParseMigrationLevel returns the MigrationLevel named by level. An empty
+// level defaults to MigrationLevelLatest.
+func ParseMigrationLevel(level string) (MigrationLevel, error) {
+	if level == "" {
+		return MigrationLevelLatest, nil
+	}
+	for _, l := range migrationLevels {
+		if MigrationLevel(level) == l {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("invalid migration level %q, expected one of %s", level, migrationLevels)
+}
+
+// WithMigrationLevel sets the migration level the basic and semver builders
+// render catalogs at, one of "none" or "bundle-object-to-csv-metadata". An
+// empty level selects the latest; unsupported values are reported when the
+// Template is rendered.
+func WithMigrationLevel(level string) TemplateOption {
+	return func(t *Template) {
+		migrationLevel, err := ParseMigrationLevel(level)
+		if err != nil {
+			t.optionErrs = append(t.optionErrs, err)
+			return
+		}
+		t.migrationLevel = migrationLevel
+	}
+}
+
+// migrationLevel returns the effective migration level of the builder.
+func (bc BuilderConfig) migrationLevel() MigrationLevel {
+	if bc.MigrationLevel == "" {
+		return MigrationLevelLatest
+	}
+	return bc.MigrationLevel
+}
+
+// migrate rewrites dcfg, which is rendered at the latest level, at the
+// migration level of the builder and records the level in the build record
+// carried by ctx, if any.
+func (bc BuilderConfig) migrate(ctx context.Context, dcfg *declcfg.DeclarativeConfig) error {
+	level := bc.migrationLevel()
+	if record, ok := ctx.Value(buildRecordKey{}).(*buildRecord); ok {
+		record.migrationLevel = level
+	}
+	if level != MigrationLevelNone {
+		return nil
+	}
+	for i := range dcfg.Bundles {
+		if err := csvMetadataToBundleObjects(&dcfg.Bundles[i]); err != nil {
+			return fmt.Errorf("migrating bundle %q to level %q: %v", dcfg.Bundles[i].Name, level, err)
+		}
+	}
+	return nil
+}
+
+// csvMetadataToBundleObjects replaces the olm.csv.metadata property of b with
+// an olm.bundle.object property for each of its objects, as they were before
+// the bundle-object-to-csv-metadata migration. Bundles that were not rendered
+// from an image only have the CSV metadata, which a CSV is rebuilt from.
+func csvMetadataToBundleObjects(b *declcfg.Bundle) error {
+	var props []property.Property
+	for _, p := range b.Properties {
+		if p.Type != property.TypeCSVMetadata {
+			props = append(props, p)
+			continue
+		}
+		if len(b.Objects) > 0 {
+			for _, obj := range b.Objects {
+				props = append(props, property.MustBuildBundleObjectData([]byte(obj)))
+			}
+			continue
+		}
+		var metadata property.CSVMetadata
+		if err := json.Unmarshal(p.Value, &metadata); err != nil {
+			return fmt.Errorf("parsing %s property: %v", property.TypeCSVMetadata, err)
+		}
+		data, err := json.Marshal(csvFromMetadata(b.Name, metadata))
+		if err != nil {
+			return err
+		}
+		props = append(props, property.MustBuildBundleObjectData(data))
+	}
+	b.Properties = props
+	return nil
+}
+
+// csvFromMetadata returns a CSV named name with the given metadata.
+func csvFromMetadata(name string, metadata property.CSVMetadata) v1alpha1.ClusterServiceVersion {
+	return v1alpha1.ClusterServiceVersion{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       operators.ClusterServiceVersionKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: metadata.Annotations,
+			Labels:      metadata.Labels,
+		},
+		Spec: v1alpha1.ClusterServiceVersionSpec{
+			APIServiceDefinitions:     metadata.APIServiceDefinitions,
+			CustomResourceDefinitions: metadata.CustomResourceDefinitions,
+			Description:               metadata.Description,
+			DisplayName:               metadata.DisplayName,
+			InstallModes:              metadata.InstallModes,
+			Keywords:                  metadata.Keywords,
+			Links:                     metadata.Links,
+			Maintainers:               metadata.Maintainers,
+			Maturity:                  metadata.Maturity,
+			MinKubeVersion:            metadata.MinKubeVersion,
+			NativeAPIs:                metadata.NativeAPIs,
+			Provider:                  metadata.Provider,
+		},
+	}
+}
@@ -0,0 +1,170 @@
+package composite
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+// PackageConflict describes a package that more than one component of a
+// catalog writes olm.package blobs for.
+type PackageConflict struct {
+	Catalog string `json:"catalog"`
+	Package string `json:"package"`
+	// Components are the components writing the package, in the order they
+	// are defined in the contribution files.
+	Components []string `json:"components"`
+}
+
+func (c PackageConflict) String() string {
+	return fmt.Sprintf("package %q of catalog %q is written by components %s, list it in the catalog's sharedPackages if this is intended", c.Package, c.Catalog, strings.Join(quoteAll(c.Components), " and "))
+}
+
+// WithPackageConflictWarnings only warns about packages written by more than
+// one component of a catalog, and records them in the render report, instead
+// of failing the render. Packages listed in the sharedPackages of their
+// catalog never conflict.
+func WithPackageConflictWarnings(warn bool) TemplateOption {
+	return func(t *Template) {
+		t.warnPackageConflicts = warn
+	}
+}
+
+// writtenPackages returns the names of the packages that the FBC under dir
+// defines an olm.package blob for, in lexical order. A missing dir has no
+// packages.
+func writtenPackages(dir string) ([]string, error) {
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return packagesIn(os.DirFS(dir), dir)
+}
+
+// packagesIn returns the names of the packages that the FBC in root, which
+// name identifies in errors, defines an olm.package blob for, in lexical
+// order.
+func packagesIn(root fs.FS, name string) ([]string, error) {
+	seen := map[string]bool{}
+	err := declcfg.WalkMetasFS(root, func(path string, meta *declcfg.Meta, err error) error {
+		if err != nil {
+			return err
+		}
+		if meta.Schema == declcfg.SchemaPackage {
+			seen[meta.Name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing packages written to %q: %v", name, err)
+	}
+	packages := make([]string, 0, len(seen))
+	for name := range seen {
+		packages = append(packages, name)
+	}
+	sort.Strings(packages)
+	return packages, nil
+}
+
+// checkComponentAllowed returns an error citing the allowedComponents of
+// catalog if they don't allow the component name.
+func checkComponentAllowed(catalog Catalog, name string) error {
+	if len(catalog.AllowedComponents) == 0 {
+		return nil
+	}
+	for _, pattern := range catalog.AllowedComponents {
+		// invalid patterns are rejected when the catalogs are parsed
+		if matched, _ := path.Match(pattern, name); matched {
+			return nil
+		}
+	}
+	return fmt.Errorf("catalog %q only allows components matching its allowedComponents %s", catalog.Name, strings.Join(quoteAll(catalog.AllowedComponents), ", "))
+}
+
+// validateExpectedPackages checks that the expected packages of component are
+// named and listed once.
+func validateExpectedPackages(component Component, ref configRef) ValidationErrors {
+	var errs ValidationErrors
+	seen := map[string]int{}
+	for i, pkg := range component.ExpectedPackages {
+		field := fmt.Sprintf("expectedPackages[%d]", i)
+		if pkg == "" {
+			errs = append(errs, ref.invalid(field, "component %q has an empty expected package name", component.Name))
+		} else if j, ok := seen[pkg]; ok {
+			errs = append(errs, ref.invalid(field, "component %q expects package %q more than once, it is also expectedPackages[%d]", component.Name, pkg, j))
+		} else {
+			seen[pkg] = i
+		}
+	}
+	return errs
+}
+
+// checkExpectedPackages returns an error naming the packages written that are
+// not expected, and the expected packages that were not written, if any.
+func checkExpectedPackages(expected []string, written []string) error {
+	difference := func(a []string, b []string) []string {
+		in := map[string]bool{}
+		for _, v := range b {
+			in[v] = true
+		}
+		var diff []string
+		for _, v := range a {
+			if !in[v] {
+				diff = append(diff, v)
+			}
+		}
+		sort.Strings(diff)
+		return diff
+	}
+	var problems []string
+	if unexpected := difference(written, expected); len(unexpected) > 0 {
+		problems = append(problems, fmt.Sprintf("it produced packages not in its expectedPackages: %s", strings.Join(quoteAll(unexpected), ", ")))
+	}
+	if missing := difference(expected, written); len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("it didn't produce expected packages: %s", strings.Join(quoteAll(missing), ", ")))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// packageConflicts returns the packages written by more than one of the
+// rendered components of the same catalog that the catalog doesn't share,
+// ordered by catalog and package.
+func packageConflicts(catalogs map[string]Catalog, reports []ComponentReport) []PackageConflict {
+	writers := map[string]map[string][]string{}
+	for _, report := range reports {
+		for _, pkg := range report.Packages {
+			if writers[report.Catalog] == nil {
+				writers[report.Catalog] = map[string][]string{}
+			}
+			writers[report.Catalog][pkg] = append(writers[report.Catalog][pkg], report.Name)
+		}
+	}
+
+	var conflicts []PackageConflict
+	for catalog, packages := range writers {
+		shared := map[string]bool{}
+		for _, pkg := range catalogs[catalog].SharedPackages {
+			shared[pkg] = true
+		}
+		for pkg, components := range packages {
+			if len(components) > 1 && !shared[pkg] {
+				conflicts = append(conflicts, PackageConflict{Catalog: catalog, Package: pkg, Components: components})
+			}
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Catalog != conflicts[j].Catalog {
+			return conflicts[i].Catalog < conflicts[j].Catalog
+		}
+		return conflicts[i].Package < conflicts[j].Package
+	})
+	return conflicts
+}
@@ -0,0 +1,682 @@
+package composite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// CatalogConfig returns the merged catalog configuration of the Template,
+// parsed and validated with the same rules as Render. The catalog files are
+// only read once; Render and later calls reuse the result, which must not be
+// modified.
+func (t *Template) CatalogConfig() (*CatalogConfig, error) {
+	catalogConfig, err := t.parsedCatalogs()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.newCatalogBuilderMap(catalogConfig.Catalogs, t.outputType); err != nil {
+		return nil, err
+	}
+	return catalogConfig, nil
+}
+
+// ContributionConfig returns the merged composite configuration of the
+// Template, parsed and validated with the same rules as Render. The
+// contribution files are only read once; Render and later calls reuse the
+// result, which must not be modified.
+func (t *Template) ContributionConfig() (*CompositeConfig, error) {
+	return t.parsedContributions()
+}
+
+// parsedCatalogs memoizes parseCatalogsSpec, as the catalog files can only be
+// read once.
+func (t *Template) parsedCatalogs() (*CatalogConfig, error) {
+	if !t.catalogs.parsed {
+		t.catalogs.config, t.catalogs.err = t.parseCatalogsSpec()
+		t.catalogs.parsed = true
+	}
+	return t.catalogs.config, t.catalogs.err
+}
+
+// parsedContributions memoizes parseContributionSpec, as the contribution
+// files can only be read once.
+func (t *Template) parsedContributions() (*CompositeConfig, error) {
+	if !t.contributions.parsed {
+		t.contributions.config, t.contributions.err = t.parseContributionSpec()
+		t.contributions.parsed = true
+	}
+	return t.contributions.config, t.contributions.err
+}
+
+// parseCatalogsSpec parses every catalog configuration file and merges their
+// catalogs, in order, into a single catalog configuration. Errors are prefixed
+// with the name of the offending file, or its index when it has none.
+func (t *Template) parseCatalogsSpec() (*CatalogConfig, error) {
+	if t.catalogObject != nil {
+		if len(t.catalogFiles) > 0 {
+			return nil, fmt.Errorf("only one of a catalog configuration file and a catalog configuration object can be provided")
+		}
+		return parseCatalogObject(t.catalogObject)
+	}
+	if len(t.catalogFiles) == 0 {
+		return nil, fmt.Errorf("no catalog configuration file provided")
+	}
+
+	merged := &CatalogConfig{Schema: CatalogSchemaV2}
+	refs := map[string][]configRef{}
+	names := []string{}
+	t.catalogSources = map[string]string{}
+	for i, source := range t.catalogFiles {
+		if source.name == "" {
+			source.name = fmt.Sprintf("catalog-config[%d]", i)
+		}
+		catalogConfig, fileRefs, err := t.parseCatalogFile(source.reader)
+		if errors.Is(err, errNoDocuments) {
+			return nil, fmt.Errorf("catalog config %q contained no documents", source.name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source.name, err)
+		}
+		for j, catalog := range catalogConfig.Catalogs {
+			if _, ok := refs[catalog.Name]; !ok {
+				names = append(names, catalog.Name)
+				t.catalogSources[catalog.Name] = fileRefs[j].in(source.name).source
+			}
+			refs[catalog.Name] = append(refs[catalog.Name], fileRefs[j].in(source.name))
+		}
+		merged.Catalogs = append(merged.Catalogs, catalogConfig.Catalogs...)
+	}
+
+	// duplicates within a single file are reported by newCatalogBuilderMap
+	if len(t.catalogFiles) > 1 {
+		var errs ValidationErrors
+		for _, name := range names {
+			if len(refs[name]) > 1 {
+				errs = append(errs, refs[name][1].invalid("name", "duplicate catalog name %q at %s", name, joinRefs(refs[name])))
+			}
+		}
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("catalog configuration is invalid: %w", errs)
+		}
+	}
+
+	return merged, nil
+}
+
+// resolveCatalogs returns the catalog configuration to render with. A
+// catalog configuration parsed from files takes precedence over catalogs
+// defined inline in the contribution files, which are only used when no
+// catalog file is provided.
+func (t *Template) resolveCatalogs(catalogConfig *CatalogConfig, contribution *CompositeConfig) (*CatalogConfig, error) {
+	if catalogConfig != nil {
+		if len(contribution.Catalogs) > 0 {
+			t.logger().Warn("ignoring inline catalogs in the composite configuration, the catalog configuration file takes precedence")
+		}
+		return catalogConfig, nil
+	}
+	if len(contribution.Catalogs) == 0 {
+		return nil, fmt.Errorf("no catalog configuration file provided")
+	}
+	t.logger().Debug("using inline catalog configuration")
+	return &CatalogConfig{Schema: CatalogSchemaV2, Catalogs: contribution.Catalogs}, nil
+}
+
+// parseCatalogFile parses every document in the catalog configuration file
+// and merges their catalogs. The returned refs describe where each catalog
+// was defined within the file.
+func (t *Template) parseCatalogFile(catalogFile io.Reader) (*CatalogConfig, []configRef, error) {
+	data, err := io.ReadAll(catalogFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading catalog config: %v", err)
+	}
+	if data, err = unwrapConfigMap(data, "catalog", t.catalogConfigMapKey()); err != nil {
+		return nil, nil, err
+	}
+	if t.variables != nil && t.expandCatalogs {
+		if data, err = t.expandVariables(data); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	docs, err := decodeDocuments(bytes.NewReader(data))
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errNoDocuments
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding catalog config: %v", err)
+	}
+
+	merged := &CatalogConfig{Schema: CatalogSchemaV2}
+	refs := []configRef{}
+	for i, doc := range docs {
+		catalogConfig, err := t.parseCatalogDoc(doc)
+		if err != nil {
+			if len(docs) > 1 {
+				return nil, nil, fmt.Errorf("document[%d]: %w", i, err)
+			}
+			return nil, nil, err
+		}
+		for j := range catalogConfig.Catalogs {
+			refs = append(refs, documentRef(docs, i, fmt.Sprintf("catalogs[%d]", j)))
+		}
+		merged.Catalogs = append(merged.Catalogs, catalogConfig.Catalogs...)
+	}
+	return merged, refs, nil
+}
+
+func (t *Template) parseCatalogDoc(catalogDoc document) (*CatalogConfig, error) {
+	// get catalog configurations
+	catalogConfig := &CatalogConfig{}
+	err := json.Unmarshal(catalogDoc.raw, catalogConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling catalog config: %v", catalogDoc.positions.positionedError(err))
+	}
+
+	convert, ok := catalogConverters[catalogConfig.Schema]
+	if !ok {
+		return nil, unknownSchemaError("catalog", catalogConfig.Schema, supportedCatalogSchemas())
+	}
+
+	if !t.lenientParsing {
+		var entries struct{ Catalogs []json.RawMessage }
+		if err := json.Unmarshal(catalogDoc.raw, &entries); err != nil {
+			return nil, fmt.Errorf("unmarshalling catalog config: %v", err)
+		}
+		err = unmarshalStrict(catalogDoc, &CatalogConfig{}, catalogEntries(entries.Catalogs, catalogConfig.Catalogs))
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling catalog config: %v", err)
+		}
+	}
+
+	return convert(catalogConfig), nil
+}
+
+// parseContributionSpec parses every contribution file and merges their
+// components into a single composite configuration. Errors are prefixed with
+// the name of the offending file, or its index when it has none.
+func (t *Template) parseContributionSpec() (*CompositeConfig, error) {
+	if t.contributionObject != nil {
+		if len(t.contributionFiles) > 0 || len(t.contributionPatterns) > 0 {
+			return nil, fmt.Errorf("only one of a composite configuration file and a composite configuration object can be provided")
+		}
+		return parseContributionObject(t.contributionObject)
+	}
+	if len(t.contributionFiles) == 0 && len(t.contributionPatterns) == 0 {
+		return nil, fmt.Errorf("no composite configuration file provided")
+	}
+
+	sources := []namedReader{}
+	for i, source := range t.contributionFiles {
+		if source.name == "" {
+			source.name = fmt.Sprintf("contribution-config[%d]", i)
+		}
+		sources = append(sources, source)
+	}
+	for _, pattern := range t.contributionPatterns {
+		files, err := expandContributionPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			f, err := os.Open(file)
+			if err != nil {
+				return nil, fmt.Errorf("opening contribution file %q: %v", file, err)
+			}
+			defer f.Close()
+			sources = append(sources, namedReader{name: file, reader: f})
+		}
+	}
+
+	merged := &CompositeConfig{Schema: CompositeSchema}
+	refs := []configRef{}
+	for _, source := range sources {
+		compositeConfig, fileRefs, err := t.parseContributionFile(source.reader)
+		if errors.Is(err, errNoDocuments) {
+			return nil, fmt.Errorf("contribution config %q contained no documents", source.name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source.name, err)
+		}
+		for _, ref := range fileRefs {
+			refs = append(refs, ref.in(source.name))
+		}
+		merged.Components = append(merged.Components, compositeConfig.Components...)
+		merged.Catalogs = append(merged.Catalogs, compositeConfig.Catalogs...)
+	}
+
+	if err := validateComponents(merged.Components, refs); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// namedReader is a configuration file along with the name used to identify
+// it in errors.
+type namedReader struct {
+	name   string
+	reader io.Reader
+}
+
+// errNoDocuments is returned when a configuration file is empty or only holds
+// comments. It is reported along with the name of the file.
+var errNoDocuments = errors.New("no documents")
+
+// contributionExtensions are the extensions of files loaded from a
+// contribution directory or pattern.
+var contributionExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// parseCatalogObject converts a copy of an already parsed catalog
+// configuration like parseCatalogDoc would.
+func parseCatalogObject(catalogObject *CatalogConfig) (*CatalogConfig, error) {
+	convert, ok := catalogConverters[catalogObject.Schema]
+	if !ok {
+		return nil, unknownSchemaError("catalog", catalogObject.Schema, supportedCatalogSchemas())
+	}
+	catalogConfig := &CatalogConfig{Schema: catalogObject.Schema, Catalogs: make([]Catalog, len(catalogObject.Catalogs))}
+	for i, catalog := range catalogObject.Catalogs {
+		catalogConfig.Catalogs[i] = copyCatalog(catalog)
+	}
+	return convert(catalogConfig), nil
+}
+
+// copyCatalog returns a copy of catalog that shares none of its slices.
+func copyCatalog(catalog Catalog) Catalog {
+	if catalog.Builders != nil {
+		catalog.Builders = append([]string{}, catalog.Builders...)
+	}
+	if catalog.Registry != nil {
+		registry := *catalog.Registry
+		registry.SkipTLSVerifyHosts = append([]string(nil), registry.SkipTLSVerifyHosts...)
+		catalog.Registry = &registry
+	}
+	if catalog.SharedPackages != nil {
+		catalog.SharedPackages = append([]string{}, catalog.SharedPackages...)
+	}
+	if catalog.AllowedComponents != nil {
+		catalog.AllowedComponents = append([]string{}, catalog.AllowedComponents...)
+	}
+	return catalog
+}
+
+// parseContributionObject validates a copy of an already parsed composite
+// configuration like parseContributionSpec would.
+func parseContributionObject(contributionObject *CompositeConfig) (*CompositeConfig, error) {
+	if contributionObject.Schema != CompositeSchema {
+		return nil, unknownSchemaError("composite", contributionObject.Schema, []string{CompositeSchema})
+	}
+	compositeConfig := &CompositeConfig{Schema: contributionObject.Schema, Components: make([]Component, len(contributionObject.Components))}
+	refs := make([]configRef, len(contributionObject.Components))
+	for i, component := range contributionObject.Components {
+		compositeConfig.Components[i] = copyComponent(component)
+		refs[i] = configRef{path: fmt.Sprintf("components[%d]", i)}
+	}
+	if contributionObject.Catalogs != nil {
+		compositeConfig.Catalogs = make([]Catalog, len(contributionObject.Catalogs))
+		for i, catalog := range contributionObject.Catalogs {
+			compositeConfig.Catalogs[i] = copyCatalog(catalog)
+		}
+	}
+	if err := validateComponents(compositeConfig.Components, refs); err != nil {
+		return nil, err
+	}
+	return compositeConfig, nil
+}
+
+// copyComponent returns a copy of component that shares none of its slices.
+func copyComponent(component Component) Component {
+	if component.Strategy.Template.Config != nil {
+		component.Strategy.Template.Config = append(json.RawMessage{}, component.Strategy.Template.Config...)
+	}
+	if component.Strategy.SkipPatch != nil {
+		skipPatch := *component.Strategy.SkipPatch
+		component.Strategy.SkipPatch = &skipPatch
+	}
+	if component.Deprecations != nil {
+		deprecations := make([]Deprecation, len(component.Deprecations))
+		for i, deprecation := range component.Deprecations {
+			if deprecation.Entries != nil {
+				deprecation.Entries = append([]DeprecationEntry{}, deprecation.Entries...)
+			}
+			deprecations[i] = deprecation
+		}
+		component.Deprecations = deprecations
+	}
+	if component.DependsOn != nil {
+		component.DependsOn = append([]string{}, component.DependsOn...)
+	}
+	if component.ExpectedPackages != nil {
+		component.ExpectedPackages = append([]string{}, component.ExpectedPackages...)
+	}
+	return component
+}
+
+// expandContributionPattern returns the contribution files in the directory
+// or matching the glob pattern, in lexical order. Hidden files and files
+// without a YAML or JSON extension are skipped.
+func expandContributionPattern(pattern string) ([]string, error) {
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*")
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid contribution file pattern %q: %v", pattern, err)
+	}
+
+	files := []string{}
+	for _, match := range matches {
+		name := filepath.Base(match)
+		if strings.HasPrefix(name, ".") || !contributionExtensions[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+		if info, err := os.Stat(match); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, match)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("contribution file pattern %q did not match any YAML or JSON files", pattern)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// parseContributionFile parses every document in the contribution file and
+// merges their components. The returned refs describe where each component
+// was defined within the file.
+func (t *Template) parseContributionFile(contributionFile io.Reader) (*CompositeConfig, []configRef, error) {
+	data, err := io.ReadAll(contributionFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading composite config: %v", err)
+	}
+	if data, err = unwrapConfigMap(data, "composite", t.contributionConfigMapKey()); err != nil {
+		return nil, nil, err
+	}
+	if t.variables != nil {
+		if data, err = t.expandVariables(data); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	docs, err := decodeDocuments(bytes.NewReader(data))
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errNoDocuments
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding composite config: %v", err)
+	}
+
+	merged := &CompositeConfig{Schema: CompositeSchema}
+	refs := []configRef{}
+	for i, doc := range docs {
+		compositeConfig, err := t.parseContributionDoc(doc)
+		if err != nil {
+			if len(docs) > 1 {
+				return nil, nil, fmt.Errorf("document[%d]: %w", i, err)
+			}
+			return nil, nil, err
+		}
+		for j := range compositeConfig.Components {
+			refs = append(refs, documentRef(docs, i, fmt.Sprintf("components[%d]", j)))
+		}
+		merged.Components = append(merged.Components, compositeConfig.Components...)
+		merged.Catalogs = append(merged.Catalogs, compositeConfig.Catalogs...)
+	}
+	return merged, refs, nil
+}
+
+func (t *Template) parseContributionDoc(compositeDoc document) (*CompositeConfig, error) {
+	// parse data to composite config
+	compositeConfig := &CompositeConfig{}
+	err := json.Unmarshal(compositeDoc.raw, compositeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling composite config: %v", compositeDoc.positions.positionedError(err))
+	}
+
+	if compositeConfig.Schema != CompositeSchema {
+		return nil, unknownSchemaError("composite", compositeConfig.Schema, []string{CompositeSchema})
+	}
+
+	if !t.lenientParsing {
+		var entries struct{ Components, Catalogs []json.RawMessage }
+		if err := json.Unmarshal(compositeDoc.raw, &entries); err != nil {
+			return nil, fmt.Errorf("unmarshalling composite config: %v", err)
+		}
+		err = unmarshalStrict(compositeDoc, &CompositeConfig{},
+			strictEntries{name: "components", raw: entries.Components, entry: func(i int) (interface{}, string) {
+				return &Component{}, fmt.Sprintf("components[%d] (%q)", i, compositeConfig.Components[i].Name)
+			}},
+			catalogEntries(entries.Catalogs, compositeConfig.Catalogs),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling composite config: %v", err)
+		}
+	}
+
+	return compositeConfig, nil
+}
+
+// document is a YAML or JSON document converted to JSON, along with the
+// positions of its fields in the original document.
+type document struct {
+	raw       json.RawMessage
+	positions docPositions
+}
+
+// decodeDocuments decodes every YAML or JSON document in r. Empty documents
+// are skipped; a stream without any documents results in io.EOF.
+func decodeDocuments(r io.Reader) ([]document, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	positions := decodePositions(data)
+
+	docs := []document{}
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		doc := json.RawMessage{}
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) && len(docs) > 0 {
+				if len(positions) != len(docs) {
+					// the documents could not be matched up with their positions
+					for i := range docs {
+						docs[i].positions = nil
+					}
+				}
+				return docs, nil
+			}
+			if len(docs) > 0 {
+				return nil, fmt.Errorf("document[%d]: %v", len(docs), err)
+			}
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 || string(doc) == "null" {
+			continue
+		}
+		var docPositions docPositions
+		if len(docs) < len(positions) {
+			docPositions = positions[len(docs)]
+		}
+		docs = append(docs, document{raw: doc, positions: docPositions})
+	}
+}
+
+// configRef locates an entry of a configuration file.
+type configRef struct {
+	// source identifies the file and document containing the entry, and is
+	// empty when the configuration consists of a single document
+	source string
+	// path is the JSON path of the entry within its document
+	path string
+	// positions are the positions of the fields in the document
+	positions docPositions
+}
+
+func (r configRef) String() string {
+	if r.source == "" {
+		return r.path
+	}
+	return r.source + " " + r.path
+}
+
+// in returns the ref with its source nested in the named outer source.
+func (r configRef) in(name string) configRef {
+	if r.source == "" {
+		return configRef{source: name, path: r.path, positions: r.positions}
+	}
+	return configRef{source: name + " " + r.source, path: r.path, positions: r.positions}
+}
+
+// invalid returns a validation error for the field of the referenced entry.
+func (r configRef) invalid(field string, format string, args ...interface{}) ConfigValidationError {
+	path := r.path + "." + field
+	line, _ := r.positions.line(path)
+	return ConfigValidationError{
+		Source:  r.source,
+		Field:   field,
+		Path:    path,
+		Line:    line,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// documentRef returns a ref to path in document i, qualified with the
+// document index when a file contains more than one document.
+func documentRef(docs []document, i int, path string) configRef {
+	if len(docs) > 1 {
+		return configRef{source: fmt.Sprintf("document[%d]", i), path: path, positions: docs[i].positions}
+	}
+	return configRef{path: path, positions: docs[i].positions}
+}
+
+func joinRefs(refs []configRef) string {
+	strs := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		strs = append(strs, ref.String())
+	}
+	return strings.Join(strs, ", ")
+}
+
+// strictEntries is a list of raw entries within a document, along with a
+// function returning the value to decode entry i into and its description.
+type strictEntries struct {
+	// name is the JSON path of the list within the document
+	name  string
+	raw   []json.RawMessage
+	entry func(i int) (interface{}, string)
+}
+
+func catalogEntries(raw []json.RawMessage, catalogs []Catalog) strictEntries {
+	return strictEntries{name: "catalogs", raw: raw, entry: func(i int) (interface{}, string) {
+		return &Catalog{}, fmt.Sprintf("catalogs[%d] (%q)", i, catalogs[i].Name)
+	}}
+}
+
+// unmarshalStrict decodes doc into v, rejecting unknown fields. When doc is
+// rejected, each of its list entries is decoded on its own so that the error
+// can point at the offending entry.
+func unmarshalStrict(doc document, v interface{}, lists ...strictEntries) error {
+	err := decodeStrict(doc.raw, v)
+	if err == nil {
+		return nil
+	}
+	for _, list := range lists {
+		for i, raw := range list.raw {
+			ev, desc := list.entry(i)
+			if entryErr := decodeStrict(raw, ev); entryErr != nil {
+				return fmt.Errorf("%s: %v", desc, doc.positions.positionedEntryError(fmt.Sprintf("%s[%d]", list.name, i), entryErr))
+			}
+		}
+	}
+	return doc.positions.positionedEntryError("", err)
+}
+
+func decodeStrict(doc []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// validateComponents ensures that component output types are supported, that
+// component names are unique, that components only depend on components of
+// their own catalog and that no two components in the same catalog share a
+// destination path. refs describes the
+// location of each component for use in error messages. Each duplicate is
+// reported at its second occurrence.
+func validateComponents(components []Component, refs []configRef) error {
+	type destination struct {
+		catalog string
+		path    string
+	}
+	var (
+		names        = map[string][]int{}
+		destinations = map[destination][]int{}
+		nameOrder    = []string{}
+		destOrder    = []destination{}
+	)
+	for i, component := range components {
+		if _, ok := names[component.Name]; !ok {
+			nameOrder = append(nameOrder, component.Name)
+		}
+		names[component.Name] = append(names[component.Name], i)
+
+		if component.Destination.Path == StdoutPath {
+			// any number of components may be streamed
+			continue
+		}
+		dest := destination{catalog: component.CatalogName(), path: filepath.Clean(component.Destination.Path)}
+		if _, ok := destinations[dest]; !ok {
+			destOrder = append(destOrder, dest)
+		}
+		destinations[dest] = append(destinations[dest], i)
+	}
+
+	var errs ValidationErrors
+	for i, component := range components {
+		if component.Output != "" {
+			if _, err := ParseOutputType(string(component.Output)); err != nil {
+				errs = append(errs, refs[i].invalid("output", "component %q has unsupported output type %q, expected one of %s", component.Name, component.Output, outputTypes))
+			}
+		}
+		if component.Enabled != "" {
+			if _, err := parseCondition(string(component.Enabled)); err != nil {
+				errs = append(errs, refs[i].invalid("enabled", "component %q has an invalid enabled condition %q: %v", component.Name, component.Enabled, err))
+			}
+		}
+		errs = append(errs, validateDeprecations(component, refs[i])...)
+		errs = append(errs, validateExpectedPackages(component, refs[i])...)
+	}
+	errs = append(errs, validateDependencies(components, refs)...)
+	for _, name := range nameOrder {
+		if indices := names[name]; len(indices) > 1 {
+			errs = append(errs, refs[indices[1]].invalid("name", "duplicate component name %q at %s", name, componentRefs(refs, indices)))
+		}
+	}
+	for _, dest := range destOrder {
+		if indices := destinations[dest]; len(indices) > 1 {
+			errs = append(errs, refs[indices[1]].invalid("destination.path", "duplicate destination path %q for catalog %q at %s", dest.path, dest.catalog, componentRefs(refs, indices)))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("composite configuration file is invalid: %w", errs)
+	}
+	return nil
+}
+
+func componentRefs(refs []configRef, indices []int) string {
+	selected := make([]configRef, 0, len(indices))
+	for _, i := range indices {
+		selected = append(selected, refs[i])
+	}
+	return joinRefs(selected)
+}
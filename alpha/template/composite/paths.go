@@ -0,0 +1,67 @@
+package composite
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// windowsPath matches Windows drive letter paths, such as C:\dir, C:/dir or
+// C:dir, and UNC paths, such as \\server\share or //server/share.
+var windowsPath = regexp.MustCompile(`^([A-Za-z]:|\\\\|//)`)
+
+// isWindowsPath reports whether p is a Windows drive letter or UNC path,
+// whatever the current platform is. url.ParseRequestURI parses drive letter
+// paths as URLs with a single letter scheme.
+func isWindowsPath(p string) bool {
+	return windowsPath.MatchString(p)
+}
+
+// isAbsPath reports whether p is absolute on the current platform, or is a
+// Windows drive letter, UNC or slash rooted path, which configuration files
+// shared between platforms may not use where relative paths are expected.
+func isAbsPath(p string) bool {
+	return filepath.IsAbs(p) || isWindowsPath(p) || path.IsAbs(filepath.ToSlash(p))
+}
+
+// isWithin reports whether p is dir or is under it, with the path semantics
+// of the current platform.
+func isWithin(dir string, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// localConfigPath returns the local path of the configuration file path
+// refers to, or false if it refers to a remote file. Relative and absolute
+// paths, Windows drive letter and UNC paths, and file URLs are local.
+func localConfigPath(p string) (string, bool) {
+	if isWindowsPath(p) || filepath.IsAbs(p) {
+		return p, true
+	}
+	u, err := url.ParseRequestURI(p)
+	if err != nil {
+		// relative paths are not URLs
+		return p, true
+	}
+	if u.Scheme == "file" {
+		return fileURLPath(u), true
+	}
+	return "", false
+}
+
+var windowsDrivePath = regexp.MustCompile(`^/[A-Za-z]:`)
+
+// fileURLPath returns the local path referenced by a file URL. Windows drive
+// letter paths (file:///C:/dir) and UNC paths (file://host/share) are
+// supported.
+func fileURLPath(u *url.URL) string {
+	p := u.Path
+	if u.Host != "" && u.Host != "localhost" {
+		p = "//" + u.Host + p
+	} else if windowsDrivePath.MatchString(p) {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
@@ -0,0 +1,71 @@
+package composite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/pkg/image"
+)
+
+// DigestResolver is implemented by image registries that can resolve an image
+// reference to the digest of its manifest. The basic and semver builders need
+// one to pin bundle images.
+type DigestResolver interface {
+	ResolveDigest(ctx context.Context, ref image.Reference) (digest.Digest, error)
+}
+
+// pinImages replaces the bundle images of dcfg that are referenced by tag, in
+// both the bundles and their related images, with references to the digests
+// reg resolves them to. It returns the digest-pinned reference of each tag and
+// records them in the build record carried by ctx, if any. References that
+// are already pinned are left unchanged.
+func pinImages(ctx context.Context, reg image.Registry, dcfg *declcfg.DeclarativeConfig) (map[string]string, error) {
+	component := "unknown"
+	if info, ok := ComponentInfoFromContext(ctx); ok {
+		component = info.Component
+	}
+
+	pinned := map[string]string{}
+	for i := range dcfg.Bundles {
+		b := &dcfg.Bundles[i]
+		if b.Image == "" || strings.Contains(b.Image, "@") {
+			continue
+		}
+		ref, ok := pinned[b.Image]
+		if !ok {
+			resolver, ok := reg.(DigestResolver)
+			if !ok {
+				return nil, fmt.Errorf("resolving digest of image %q for component %q: %v", b.Image, component, errNoDigestResolver)
+			}
+			d, err := resolver.ResolveDigest(ctx, image.SimpleReference(b.Image))
+			if err != nil {
+				return nil, fmt.Errorf("resolving digest of image %q for component %q: %v", b.Image, component, err)
+			}
+			ref = repository(b.Image) + "@" + d.String()
+			pinned[b.Image] = ref
+		}
+		for j := range b.RelatedImages {
+			if b.RelatedImages[j].Image == b.Image {
+				b.RelatedImages[j].Image = ref
+			}
+		}
+		b.Image = ref
+	}
+
+	if record, ok := ctx.Value(buildRecordKey{}).(*buildRecord); ok {
+		record.pinnedImages = pinned
+	}
+	return pinned, nil
+}
+
+// repository returns ref without its tag.
+func repository(ref string) string {
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i]
+	}
+	return ref
+}
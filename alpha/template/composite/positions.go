@@ -0,0 +1,124 @@
+package composite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// docPositions maps the JSON paths of the fields in a configuration document,
+// e.g. components[3].strategy.template.config, to the line they are defined
+// on. Field names are matched case-insensitively, like encoding/json does.
+// A nil docPositions knows no positions.
+type docPositions map[string]int
+
+// decodePositions returns the positions of the fields in every non-empty
+// YAML or JSON document in data. Positions are best effort: nil is returned
+// for every document if data can't be parsed as a YAML stream.
+func decodePositions(data []byte) []docPositions {
+	positions := []docPositions{}
+	decoder := yamlv3.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yamlv3.Node
+		if err := decoder.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				return positions
+			}
+			return nil
+		}
+		if len(node.Content) == 0 || node.Content[0].Tag == "!!null" {
+			continue
+		}
+		p := docPositions{}
+		p.add(node.Content[0], "")
+		positions = append(positions, p)
+	}
+}
+
+func (p docPositions) add(node *yamlv3.Node, path string) {
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			child := strings.ToLower(key.Value)
+			if path != "" {
+				child = path + "." + child
+			}
+			p[child] = key.Line
+			p.add(value, child)
+		}
+	case yamlv3.SequenceNode:
+		for i, item := range node.Content {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			p[child] = item.Line
+			p.add(item, child)
+		}
+	}
+}
+
+// line returns the line the field at path is defined on.
+func (p docPositions) line(path string) (int, bool) {
+	line, ok := p[strings.ToLower(path)]
+	return line, ok
+}
+
+// find returns the line of the first field named key under the entry at path,
+// or anywhere in the document if path is empty.
+func (p docPositions) find(path string, key string) (int, bool) {
+	path, key = strings.ToLower(path), strings.ToLower(key)
+	found := 0
+	for candidate, line := range p {
+		if path != "" && !strings.HasPrefix(candidate, path+".") {
+			continue
+		}
+		if candidate != key && !strings.HasSuffix(candidate, "."+key) {
+			continue
+		}
+		if found == 0 || line < found {
+			found = line
+		}
+	}
+	return found, found > 0
+}
+
+var jsonIndexPattern = regexp.MustCompile(`\.(\d+)(\.|$)`)
+
+// positionedError annotates a JSON decoding error of a document with the path
+// and line of the offending field, if known.
+func (p docPositions) positionedError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Field == "" {
+		return err
+	}
+	// encoding/json separates sequence indices with dots
+	path := typeErr.Field
+	for jsonIndexPattern.MatchString(path) {
+		path = jsonIndexPattern.ReplaceAllString(path, "[$1]$2")
+	}
+	if line, ok := p.line(path); ok {
+		return fmt.Errorf("%s: line %d: %w", path, line, err)
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+var unknownFieldPattern = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+// positionedEntryError annotates a strict decoding error of the entry at path,
+// or of the whole document if path is empty, with the line of the unknown
+// field, if known.
+func (p docPositions) positionedEntryError(path string, err error) error {
+	m := unknownFieldPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	if line, ok := p.find(path, m[1]); ok {
+		return fmt.Errorf("line %d: %w", line, err)
+	}
+	return err
+}
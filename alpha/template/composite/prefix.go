@@ -0,0 +1,134 @@
+package composite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+)
+
+// prefixDestinationPackages rewrites every FBC file under dir, as loaded by
+// declcfg, with prefixPackages. Files keep their format, which is YAML for
+// .yaml and .yml files and JSON otherwise.
+func prefixDestinationPackages(dir string, prefix string) error {
+	var (
+		paths   []string
+		configs = map[string]*declcfg.DeclarativeConfig{}
+		own     = map[string]bool{}
+	)
+	err := declcfg.WalkFS(os.DirFS(dir), func(path string, cfg *declcfg.DeclarativeConfig, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		configs[path] = cfg
+		for name := range packageNames(cfg) {
+			own[name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("loading output to prefix package names: %v", err)
+	}
+	for _, path := range paths {
+		if err := prefixPackages(configs[path], prefix, own); err != nil {
+			return fmt.Errorf("prefixing package names in %q: %v", path, err)
+		}
+		outputType := OutputTypeJSON
+		if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+			outputType = OutputTypeYAML
+		}
+		if err := build(configs[path], filepath.Join(dir, filepath.FromSlash(path)), outputType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packageNames returns the names of the packages that dcfg has blobs of.
+func packageNames(dcfg *declcfg.DeclarativeConfig) map[string]bool {
+	names := map[string]bool{}
+	for _, p := range dcfg.Packages {
+		names[p.Name] = true
+	}
+	for _, c := range dcfg.Channels {
+		names[c.Package] = true
+	}
+	for _, b := range dcfg.Bundles {
+		names[b.Package] = true
+	}
+	return names
+}
+
+// prefixPackages prepends prefix to the name of every package of dcfg and to
+// every reference to one: the package of channels, bundles and other blobs
+// such as deprecations, and the olm.package properties of bundles. The
+// olm.package.required properties are only rewritten for packages in own, as
+// other packages are dependencies provided by the rest of the catalog.
+func prefixPackages(dcfg *declcfg.DeclarativeConfig, prefix string, own map[string]bool) error {
+	for i := range dcfg.Packages {
+		dcfg.Packages[i].Name = prefix + dcfg.Packages[i].Name
+	}
+	for i := range dcfg.Channels {
+		dcfg.Channels[i].Package = prefix + dcfg.Channels[i].Package
+	}
+	for i := range dcfg.Bundles {
+		b := &dcfg.Bundles[i]
+		b.Package = prefix + b.Package
+		for j, p := range b.Properties {
+			switch p.Type {
+			case property.TypePackage:
+				var pkg property.Package
+				if err := json.Unmarshal(p.Value, &pkg); err != nil {
+					return fmt.Errorf("bundle %q: parsing %s property: %v", b.Name, p.Type, err)
+				}
+				b.Properties[j] = property.MustBuildPackage(prefix+pkg.PackageName, pkg.Version)
+			case property.TypePackageRequired:
+				var required property.PackageRequired
+				if err := json.Unmarshal(p.Value, &required); err != nil {
+					return fmt.Errorf("bundle %q: parsing %s property: %v", b.Name, p.Type, err)
+				}
+				if own[required.PackageName] {
+					b.Properties[j] = property.MustBuildPackageRequired(prefix+required.PackageName, required.VersionRange)
+				}
+			}
+		}
+	}
+	for i := range dcfg.Others {
+		if dcfg.Others[i].Package == "" {
+			continue
+		}
+		if err := setMetaPackage(&dcfg.Others[i], prefix+dcfg.Others[i].Package); err != nil {
+			return fmt.Errorf("%s blob %q: %v", dcfg.Others[i].Schema, dcfg.Others[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// setMetaPackage sets the package of meta, in its blob as well.
+func setMetaPackage(meta *declcfg.Meta, pkg string) error {
+	blob := map[string]interface{}{}
+	if err := json.Unmarshal(meta.Blob, &blob); err != nil {
+		return err
+	}
+	// declcfg matches the package key case-insensitively
+	for key := range blob {
+		if strings.EqualFold(key, "package") {
+			blob[key] = pkg
+		}
+	}
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(blob); err != nil {
+		return err
+	}
+	meta.Package = pkg
+	meta.Blob = buf.Bytes()
+	return nil
+}
@@ -0,0 +1,140 @@
+package composite
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/operator-framework/operator-registry/pkg/image"
+)
+
+// ProgressPhase is the step of a render a ProgressEvent reports.
+type ProgressPhase string
+
+const (
+	// ProgressConfigFetched is reported when a configuration file has been
+	// opened or fetched.
+	ProgressConfigFetched ProgressPhase = "ConfigFetched"
+	// ProgressComponentQueued is reported when a component is scheduled to
+	// be built, which may be before it starts when builds are concurrent.
+	ProgressComponentQueued ProgressPhase = "ComponentQueued"
+	// ProgressImagePullStarted and ProgressImagePullFinished are reported
+	// around every image pull of a builder.
+	ProgressImagePullStarted  ProgressPhase = "ImagePullStarted"
+	ProgressImagePullFinished ProgressPhase = "ImagePullFinished"
+	// ProgressBuildFinished is reported when the builder of a component
+	// returns, including when it fails.
+	ProgressBuildFinished ProgressPhase = "BuildFinished"
+	// ProgressValidationFinished is reported when a component has been
+	// validated, including when it is invalid.
+	ProgressValidationFinished ProgressPhase = "ValidationFinished"
+	// ProgressComponentFinished is reported once for every queued
+	// component, when nothing more is done for it.
+	ProgressComponentFinished ProgressPhase = "ComponentFinished"
+)
+
+// ProgressEvent reports the progress of a render. Events of different
+// components are interleaved when builds are concurrent, and are correlated
+// by their Component.
+type ProgressEvent struct {
+	Phase ProgressPhase
+	Time  time.Time
+	// Component, Catalog and Schema identify the component the event is
+	// about, and are empty for ProgressConfigFetched.
+	Component string
+	Catalog   string
+	Schema    string
+	// Config is the path of the fetched configuration file.
+	Config string
+	// Image is the reference of the pulled image.
+	Image string
+	// Bytes is the size of the fetched configuration file or pulled image,
+	// or 0 when it is unknown.
+	Bytes int64
+	// Duration is how long the pull, build or validation took.
+	Duration time.Duration
+	// Err is the error the step failed with, if any.
+	Err error
+}
+
+// WithProgress reports the progress of renders to progress. The calls are
+// serialized, so progress doesn't need to be safe for concurrent use, but
+// slow callbacks hold up the builds.
+func WithProgress(progress func(ProgressEvent)) TemplateOption {
+	return func(t *Template) {
+		if progress == nil {
+			t.progress = nil
+			return
+		}
+		var mu sync.Mutex
+		t.progress = func(event ProgressEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			progress(event)
+		}
+	}
+}
+
+// WithFetchProgress reports a ProgressConfigFetched event to progress for
+// every fetched configuration file.
+func WithFetchProgress(progress func(ProgressEvent)) FetchOption {
+	return func(o *fetchOptions) {
+		o.progress = progress
+	}
+}
+
+// ImageSizer is implemented by image registries that know the size of the
+// images they pull, which is reported in ProgressImagePullFinished events.
+type ImageSizer interface {
+	ImageSize(ctx context.Context, ref image.Reference) (int64, error)
+}
+
+// emit reports event, about component if it is not nil, to the progress
+// callback, if any.
+func (t *Template) emit(event ProgressEvent, component *ComponentReport) {
+	if t.progress == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if component != nil {
+		event.Component = component.Name
+		event.Catalog = component.Catalog
+		event.Schema = component.Schema
+	}
+	t.progress(event)
+}
+
+// progressRegistry reports the image pulls of a component to the progress
+// callback and instrumentation.
+type progressRegistry struct {
+	image.Registry
+	t         *Template
+	component *ComponentReport
+}
+
+func (r *progressRegistry) Pull(ctx context.Context, ref image.Reference) error {
+	r.t.emit(ProgressEvent{Phase: ProgressImagePullStarted, Image: ref.String()}, r.component)
+	start := time.Now()
+	err := r.Registry.Pull(ctx, ref)
+	event := ProgressEvent{Phase: ProgressImagePullFinished, Image: ref.String(), Duration: time.Since(start), Err: err}
+	if sizer, ok := r.Registry.(ImageSizer); ok && err == nil {
+		if size, err := sizer.ImageSize(ctx, ref); err == nil {
+			event.Bytes = size
+		}
+	}
+	r.t.emit(event, r.component)
+	r.t.instrument().ImagePulled(r.component.Catalog, event.Duration, err)
+	return err
+}
+
+func (r *progressRegistry) ResolveDigest(ctx context.Context, ref image.Reference) (digest.Digest, error) {
+	resolver, ok := r.Registry.(DigestResolver)
+	if !ok {
+		return "", errNoDigestResolver
+	}
+	return resolver.ResolveDigest(ctx, ref)
+}
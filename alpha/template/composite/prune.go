@@ -0,0 +1,213 @@
+package composite
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/joelanford/ignore"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+// WithPruneStaleOutputs deletes the files under each catalog's working
+// directory that don't belong to the destination of any component in the
+// contribution files after a successful render, e.g. the output of a
+// component that was removed. Files listed in a .indexignore file are kept.
+// Files that don't look like generated FBC are not deleted, and fail the
+// render, unless WithForcePrune is set. In dry-run mode the files that would
+// be deleted are listed instead.
+func WithPruneStaleOutputs(prune bool) TemplateOption {
+	return func(t *Template) {
+		t.pruneStale = prune
+	}
+}
+
+// WithForcePrune makes WithPruneStaleOutputs delete stale files even if they
+// don't look like generated FBC.
+func WithForcePrune(force bool) TemplateOption {
+	return func(t *Template) {
+		t.forcePrune = force
+	}
+}
+
+// pruneStaleOutputs deletes the stale files under the working directories of
+// catalogs, i.e. those outside of the destinations of components, and the
+// FBC files in the destinations of the rendered components whose builder
+// reports the files it writes that it didn't write, e.g. after changing the
+// output layout. Their paths are returned in lexical order. Hidden files and
+// directories, and those matched by the .indexignore files of a working
+// directory, are never pruned. Nothing is deleted if any stale file outside
+// of the destinations doesn't look like generated FBC, unless t.forcePrune is
+// set, or when dryRun is set. Directories left empty are removed as well.
+func (t *Template) pruneStaleOutputs(catalogs map[string]Catalog, components []Component, reports []ComponentReport, dryRun bool) ([]string, error) {
+	claimed := map[string]bool{}
+	for _, component := range components {
+		catalog, ok := catalogs[component.CatalogName()]
+		if !ok || component.Destination.Path == StdoutPath {
+			continue
+		}
+		dest, err := filepath.Abs(filepath.Join(catalog.Destination.WorkingDir, component.Destination.Path))
+		if err != nil {
+			return nil, err
+		}
+		claimed[dest] = true
+	}
+
+	var (
+		stale []string
+		dirs  []string
+		errs  []error
+		seen  = map[string]bool{}
+	)
+	for _, catalog := range catalogs {
+		workingDir := catalog.Destination.WorkingDir
+		matcher, err := ignore.NewMatcher(os.DirFS(workingDir), indexIgnoreFileName)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("reading the %s files of catalog %q: %v", indexIgnoreFileName, catalog.Name, err)
+		}
+		err = filepath.WalkDir(workingDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if p == workingDir && errors.Is(err, fs.ErrNotExist) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return err
+			}
+			if p == workingDir {
+				return nil
+			}
+			rel, err := filepath.Rel(workingDir, p)
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(d.Name(), ".") || claimed[abs] || (matcher != nil && matcher.Match(filepath.ToSlash(rel), d.IsDir())) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if seen[abs] {
+				return nil
+			}
+			seen[abs] = true
+			if d.IsDir() {
+				dirs = append(dirs, p)
+				return nil
+			}
+			if err := looksLikeFBC(p); err != nil && !t.forcePrune {
+				errs = append(errs, fmt.Errorf("refusing to prune %q, which does not look like generated FBC: %v", p, err))
+			}
+			stale = append(stale, p)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("finding stale files of catalog %q: %v", catalog.Name, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("pruning stale outputs: %w", utilerrors.NewAggregate(errs))
+	}
+
+	for _, report := range reports {
+		if report.outputs == nil || report.Err != nil {
+			continue
+		}
+		written := map[string]bool{}
+		for _, output := range report.outputs {
+			written[filepath.Join(report.Destination, output)] = true
+		}
+		err := filepath.WalkDir(report.Destination, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p == report.Destination {
+				return nil
+			}
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return err
+			}
+			// the destinations of other components may be nested
+			if strings.HasPrefix(d.Name(), ".") || claimed[abs] {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				dirs = append(dirs, p)
+				return nil
+			}
+			if !written[p] && looksLikeFBC(p) == nil {
+				stale = append(stale, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("finding stale files of component %q: %v", report.Name, err)
+		}
+	}
+	sort.Strings(stale)
+	if dryRun {
+		return stale, nil
+	}
+
+	for _, p := range stale {
+		t.logger().Infof("pruning stale file %q", p)
+		if err := os.Remove(p); err != nil {
+			return nil, fmt.Errorf("pruning stale file %q: %v", p, err)
+		}
+	}
+	// remove the deepest directories first, so that their parents may be
+	// left empty too
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+			if err := os.Remove(dir); err != nil {
+				return nil, fmt.Errorf("pruning empty directory %q: %v", dir, err)
+			}
+		}
+	}
+	return stale, nil
+}
+
+// fbcOtherSchemas are the schemas of the generated FBC blobs that declcfg
+// doesn't load into packages, channels or bundles.
+var fbcOtherSchemas = map[string]bool{SchemaDeprecations: true}
+
+// looksLikeFBC returns an error unless the file at p is a YAML or JSON file
+// containing FBC: at least one package, channel or bundle, or deprecations
+// for them, and no blobs of any other schema. Template inputs and composite
+// configurations also have a schema, but not one of those.
+func looksLikeFBC(p string) error {
+	if !contributionExtensions[strings.ToLower(filepath.Ext(p))] {
+		return errors.New("it is not a YAML or JSON file")
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cfg, err := declcfg.LoadReader(f)
+	if err != nil {
+		return err
+	}
+	for _, meta := range cfg.Others {
+		if !fbcOtherSchemas[meta.Schema] {
+			return fmt.Errorf("it contains a blob with schema %q", meta.Schema)
+		}
+	}
+	if len(cfg.Packages)+len(cfg.Channels)+len(cfg.Bundles)+len(cfg.Others) == 0 {
+		return errors.New("it contains no FBC blobs")
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package composite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxRawInputSymlinkDepth is the number of symlinked directories that are
+// followed below each other when walking a raw input directory.
+const maxRawInputSymlinkDepth = 1
+
+// expandRawInput returns the files to load for a raw template input. A
+// directory is walked recursively and a glob pattern is expanded, both in
+// lexical order, keeping only files with a YAML or JSON extension. Any other
+// input, including a URL or a single file, is returned as is.
+func expandRawInput(input string, log *logrus.Entry) ([]string, error) {
+	var roots []string
+	info, err := os.Stat(input)
+	switch {
+	case err == nil && info.IsDir():
+		roots = []string{input}
+	case err != nil && !strings.Contains(input, "://") && strings.ContainsAny(input, `*?[`):
+		roots, err = filepath.Glob(input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid raw input pattern %q: %v", input, err)
+		}
+	default:
+		return []string{input}, nil
+	}
+
+	w := rawInputWalker{log: log, active: map[string]string{}}
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			if err := w.walk(root, 0); err != nil {
+				return nil, err
+			}
+		} else if isFBCFile(root, info) {
+			w.files = append(w.files, root)
+		}
+	}
+	if len(w.files) == 0 {
+		return nil, fmt.Errorf("raw input pattern %q did not match any YAML or JSON files", input)
+	}
+	return w.files, nil
+}
+
+type rawInputWalker struct {
+	log   *logrus.Entry
+	files []string
+	// active maps the resolved paths of the directories being walked to the
+	// path they were reached through
+	active map[string]string
+}
+
+// walk appends the FBC files under dir to the walker's files in lexical
+// order. symlinkDepth is the number of symlinked directories that were
+// followed to reach dir.
+func (w *rawInputWalker) walk(dir string, symlinkDepth int) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if previous, ok := w.active[resolved]; ok {
+		return fmt.Errorf("raw input directory %q is a symlink cycle back to %q", dir, previous)
+	}
+	w.active[resolved] = dir
+	defer delete(w.active, resolved)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		p := filepath.Join(dir, entry.Name())
+		depth := symlinkDepth
+		if entry.Type()&os.ModeSymlink != 0 {
+			depth++
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			if isFBCFile(p, info) {
+				w.files = append(w.files, p)
+			}
+			continue
+		}
+		if depth > maxRawInputSymlinkDepth {
+			w.log.Debugf("not following nested symlinked directory %q", p)
+			continue
+		}
+		if err := w.walk(p, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isFBCFile(p string, info os.FileInfo) bool {
+	return info.Mode().IsRegular() && contributionExtensions[strings.ToLower(filepath.Ext(p))]
+}
@@ -0,0 +1,426 @@
+package composite
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/operator-framework/operator-registry/pkg/image"
+	"github.com/operator-framework/operator-registry/pkg/image/containerdregistry"
+)
+
+// errNoDigestResolver is returned when resolving an image digest with a
+// registry that doesn't implement DigestResolver.
+var errNoDigestResolver = errors.New("the registry can't resolve image digests")
+
+// errNoImageSizer is returned when getting the size of an image from a
+// registry that doesn't implement ImageSizer.
+var errNoImageSizer = errors.New("the registry can't report image sizes")
+
+// syncRegistry serializes access to an image.Registry so that a single
+// registry can be shared by builders running concurrently.
+type syncRegistry struct {
+	mu  sync.Mutex
+	reg image.Registry
+}
+
+var _ image.Registry = &syncRegistry{}
+
+func (r *syncRegistry) Pull(ctx context.Context, ref image.Reference) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reg.Pull(ctx, ref)
+}
+
+func (r *syncRegistry) Unpack(ctx context.Context, ref image.Reference, dir string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reg.Unpack(ctx, ref, dir)
+}
+
+func (r *syncRegistry) Labels(ctx context.Context, ref image.Reference) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reg.Labels(ctx, ref)
+}
+
+func (r *syncRegistry) Destroy() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reg.Destroy()
+}
+
+func (r *syncRegistry) ResolveDigest(ctx context.Context, ref image.Reference) (digest.Digest, error) {
+	resolver, ok := r.reg.(DigestResolver)
+	if !ok {
+		return "", errNoDigestResolver
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return resolver.ResolveDigest(ctx, ref)
+}
+
+func (r *syncRegistry) ImageSize(ctx context.Context, ref image.Reference) (int64, error) {
+	sizer, ok := r.reg.(ImageSizer)
+	if !ok {
+		return 0, errNoImageSizer
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return sizer.ImageSize(ctx, ref)
+}
+
+// defaultRegistry is used when no registry is configured with WithRegistry,
+// and for catalogs that configure how their images are pulled. It creates a
+// containerd registry with a temporary cache directory the first time it is
+// used, so that renders whose builders don't need a registry don't create
+// one.
+type defaultRegistry struct {
+	once sync.Once
+	log  *logrus.Entry
+	// config configures the registry, if set
+	config        *CatalogRegistry
+	skipTLSVerify bool
+	// imageCacheDir is the persistent image cache of the registry, which
+	// caches images in its temporary directory when empty
+	imageCacheDir string
+	reg           image.Registry
+	cacheDir      string
+	err           error
+}
+
+var _ image.Registry = &defaultRegistry{}
+
+func (r *defaultRegistry) get() (image.Registry, error) {
+	r.once.Do(func() {
+		r.cacheDir, r.err = os.MkdirTemp("", "composite-registry-")
+		if r.err != nil {
+			return
+		}
+		r.log.Debugf("creating image registry with cache directory %q", r.cacheDir)
+		var opts []containerdregistry.RegistryOption
+		opts, r.err = r.options()
+		if r.err == nil {
+			r.reg, r.err = containerdregistry.NewRegistry(opts...)
+		}
+		if r.err != nil {
+			os.RemoveAll(r.cacheDir)
+		}
+	})
+	if r.err != nil {
+		return nil, fmt.Errorf("creating image registry: %v", r.err)
+	}
+	return r.reg, nil
+}
+
+func (r *defaultRegistry) options() ([]containerdregistry.RegistryOption, error) {
+	imageCacheDir := filepath.Join(r.cacheDir, "cache")
+	if r.imageCacheDir != "" {
+		imageCacheDir = r.imageCacheDir
+		if err := os.MkdirAll(filepath.Dir(imageCacheDir), 0o755); err != nil {
+			return nil, fmt.Errorf("creating image cache directory: %v", err)
+		}
+	}
+	opts := []containerdregistry.RegistryOption{
+		containerdregistry.WithCacheDir(imageCacheDir),
+		containerdregistry.PreserveCache(r.imageCacheDir != ""),
+		containerdregistry.WithLog(r.log),
+		containerdregistry.SkipTLSVerify(r.skipTLSVerify),
+	}
+	if r.config == nil {
+		return opts, nil
+	}
+	if r.config.CAFile != "" {
+		pem, err := os.ReadFile(r.config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file %q contains no PEM certificates", r.config.CAFile)
+		}
+		opts = append(opts, containerdregistry.WithRootCAs(pool))
+	}
+	if r.config.AuthFile != "" {
+		// the resolver reads the docker config file of a directory
+		auth, err := os.ReadFile(r.config.AuthFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading auth file: %v", err)
+		}
+		configDir := filepath.Join(r.cacheDir, "auth")
+		if err := os.Mkdir(configDir, 0o700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(configDir, "config.json"), auth, 0o600); err != nil {
+			return nil, err
+		}
+		opts = append(opts, containerdregistry.WithResolverConfigDir(configDir))
+	}
+	return opts, nil
+}
+
+func (r *defaultRegistry) Pull(ctx context.Context, ref image.Reference) error {
+	reg, err := r.get()
+	if err != nil {
+		return err
+	}
+	return reg.Pull(ctx, ref)
+}
+
+func (r *defaultRegistry) Unpack(ctx context.Context, ref image.Reference, dir string) error {
+	reg, err := r.get()
+	if err != nil {
+		return err
+	}
+	return reg.Unpack(ctx, ref, dir)
+}
+
+func (r *defaultRegistry) Labels(ctx context.Context, ref image.Reference) (map[string]string, error) {
+	reg, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	return reg.Labels(ctx, ref)
+}
+
+func (r *defaultRegistry) ResolveDigest(ctx context.Context, ref image.Reference) (digest.Digest, error) {
+	reg, err := r.get()
+	if err != nil {
+		return "", err
+	}
+	resolver, ok := reg.(DigestResolver)
+	if !ok {
+		return "", errNoDigestResolver
+	}
+	return resolver.ResolveDigest(ctx, ref)
+}
+
+// Destroy destroys the registry, if it was created, and removes its
+// temporary directory. A persistent image cache is kept.
+func (r *defaultRegistry) Destroy() error {
+	if r.reg == nil {
+		return nil
+	}
+	err := r.reg.Destroy()
+	if rmErr := os.RemoveAll(r.cacheDir); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// hostRegistry pulls the images of the hosts in insecureHosts with insecure,
+// and all other images with secure.
+type hostRegistry struct {
+	secure        image.Registry
+	insecure      image.Registry
+	insecureHosts map[string]bool
+}
+
+var _ image.Registry = &hostRegistry{}
+
+func (r *hostRegistry) registryFor(ref image.Reference) image.Registry {
+	if r.insecureHosts[referenceHost(ref.String())] {
+		return r.insecure
+	}
+	return r.secure
+}
+
+func (r *hostRegistry) Pull(ctx context.Context, ref image.Reference) error {
+	return r.registryFor(ref).Pull(ctx, ref)
+}
+
+func (r *hostRegistry) Unpack(ctx context.Context, ref image.Reference, dir string) error {
+	return r.registryFor(ref).Unpack(ctx, ref, dir)
+}
+
+func (r *hostRegistry) Labels(ctx context.Context, ref image.Reference) (map[string]string, error) {
+	return r.registryFor(ref).Labels(ctx, ref)
+}
+
+func (r *hostRegistry) ResolveDigest(ctx context.Context, ref image.Reference) (digest.Digest, error) {
+	resolver, ok := r.registryFor(ref).(DigestResolver)
+	if !ok {
+		return "", errNoDigestResolver
+	}
+	return resolver.ResolveDigest(ctx, ref)
+}
+
+func (r *hostRegistry) ImageSize(ctx context.Context, ref image.Reference) (int64, error) {
+	sizer, ok := r.registryFor(ref).(ImageSizer)
+	if !ok {
+		return 0, errNoImageSizer
+	}
+	return sizer.ImageSize(ctx, ref)
+}
+
+func (r *hostRegistry) Destroy() error {
+	return utilerrors.NewAggregate([]error{r.secure.Destroy(), r.insecure.Destroy()})
+}
+
+// referenceHost returns the registry host of an image reference, which is
+// docker.io for references without one.
+func referenceHost(ref string) string {
+	i := strings.Index(ref, "/")
+	if i < 0 {
+		return "docker.io"
+	}
+	host := ref[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return "docker.io"
+	}
+	return host
+}
+
+// publicRegistryHosts are well known public registries, whose TLS
+// certificates should always be verified.
+var publicRegistryHosts = map[string]bool{
+	"docker.io":            true,
+	"index.docker.io":      true,
+	"registry-1.docker.io": true,
+	"quay.io":              true,
+	"gcr.io":               true,
+	"ghcr.io":              true,
+	"registry.k8s.io":      true,
+	"registry.redhat.io":   true,
+}
+
+// WithImageCacheDir keeps the image cache of the registries the Template
+// creates under dir instead of in a temporary directory, so that images
+// pulled by one render are available to the next, including renders in
+// offline mode. The registry shared by catalogs without a registry
+// configuration caches images in dir itself, and the registries of the other
+// catalogs in catalogs/<catalog> under it, with images of the hosts they
+// skip TLS verification for in catalogs/<catalog>/insecure. A registry set
+// with WithRegistry may cache its images in dir, which the Template then
+// only creates catalog registries under.
+func WithImageCacheDir(dir string) TemplateOption {
+	return func(t *Template) {
+		t.imageCacheDir = dir
+	}
+}
+
+// WithRegistryConfig configures how the builders of catalogs that don't have
+// their own registry configuration pull images. It takes precedence over
+// WithRegistry for those catalogs.
+func WithRegistryConfig(config CatalogRegistry) TemplateOption {
+	return func(t *Template) {
+		t.registryConfig = &config
+	}
+}
+
+// catalogRegistries returns the registry of each catalog and a function
+// destroying the registries the Template created. Catalogs with a registry
+// configuration get a registry of their own; the others share the registry
+// set with WithRegistry, or a default one.
+func (t *Template) catalogRegistries(catalogs map[string]Catalog) (map[string]image.Registry, func()) {
+	var created []image.Registry
+	newRegistry := func(catalog string, config *CatalogRegistry) image.Registry {
+		log := t.logger()
+		if catalog != "" {
+			log = log.WithField("catalog", catalog)
+		}
+		var cacheDir, insecureCacheDir string
+		if t.imageCacheDir != "" {
+			cacheDir = t.imageCacheDir
+			if catalog != "" {
+				cacheDir = filepath.Join(t.imageCacheDir, "catalogs", catalog)
+			}
+			insecureCacheDir = filepath.Join(cacheDir, "insecure")
+		}
+		secure := &defaultRegistry{log: log, config: config, imageCacheDir: cacheDir}
+		created = append(created, secure)
+		if config == nil || len(config.SkipTLSVerifyHosts) == 0 {
+			return secure
+		}
+		insecureHosts := map[string]bool{}
+		for _, host := range config.SkipTLSVerifyHosts {
+			if publicRegistryHosts[host] {
+				log.Warnf("skipping TLS verification for public registry %q", host)
+			}
+			insecureHosts[host] = true
+		}
+		insecure := &defaultRegistry{log: log, config: config, skipTLSVerify: true, imageCacheDir: insecureCacheDir}
+		created = append(created, insecure)
+		return &hostRegistry{secure: secure, insecure: insecure, insecureHosts: insecureHosts}
+	}
+
+	shared := t.registry
+	registries := map[string]image.Registry{}
+	for name, catalog := range catalogs {
+		config := catalog.Registry
+		if config == nil {
+			config = t.registryConfig
+		}
+		if config != nil {
+			registries[name] = newRegistry(name, config)
+			continue
+		}
+		if shared == nil {
+			shared = newRegistry("", nil)
+		}
+		registries[name] = shared
+	}
+	if t.offline {
+		offline := map[image.Registry]image.Registry{}
+		for name, reg := range registries {
+			if _, ok := offline[reg]; !ok {
+				offline[reg] = &offlineRegistry{reg: reg}
+			}
+			registries[name] = offline[reg]
+		}
+	}
+
+	destroy := func() {
+		for _, reg := range created {
+			if err := reg.Destroy(); err != nil {
+				t.logger().WithError(err).Warn("destroying image registry")
+			}
+		}
+	}
+	return registries, destroy
+}
+
+// offlineRegistry serves images from the local cache of an image.Registry,
+// failing to pull those it doesn't have instead of reaching the network.
+type offlineRegistry struct {
+	reg image.Registry
+}
+
+var _ image.Registry = &offlineRegistry{}
+
+// Pull succeeds when ref is already in the cache of the underlying registry,
+// which Labels reads without pulling.
+func (r *offlineRegistry) Pull(ctx context.Context, ref image.Reference) error {
+	if _, err := r.reg.Labels(ctx, ref); err != nil {
+		return fmt.Errorf("offline mode: image %q not in cache", ref.String())
+	}
+	return nil
+}
+
+func (r *offlineRegistry) Unpack(ctx context.Context, ref image.Reference, dir string) error {
+	return r.reg.Unpack(ctx, ref, dir)
+}
+
+func (r *offlineRegistry) Labels(ctx context.Context, ref image.Reference) (map[string]string, error) {
+	return r.reg.Labels(ctx, ref)
+}
+
+func (r *offlineRegistry) Destroy() error {
+	return r.reg.Destroy()
+}
+
+func (r *offlineRegistry) ResolveDigest(_ context.Context, ref image.Reference) (digest.Digest, error) {
+	return "", fmt.Errorf("offline mode: can't resolve the digest of image %q", ref.String())
+}
@@ -0,0 +1,163 @@
+package composite
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+// ValidationStatus describes whether a rendered component was validated and
+// what the outcome was.
+type ValidationStatus string
+
+const (
+	ValidationSkipped ValidationStatus = "Skipped"
+	ValidationPassed  ValidationStatus = "Passed"
+	ValidationFailed  ValidationStatus = "Failed"
+)
+
+// RenderReport describes the outcome of rendering a composite template.
+type RenderReport struct {
+	Components []ComponentReport
+	// Variables are the values that variables in the configuration files
+	// were expanded to, by name.
+	Variables map[string]string
+	// Changed is set in diff mode when any component differs from its
+	// current destination.
+	Changed bool
+	// Warnings are the catalog configuration entries that no component
+	// uses, unless WithStrictUnused turns them into an error.
+	Warnings ValidationErrors
+	// PackageConflicts are the packages written by more than one component
+	// of a catalog.
+	PackageConflicts []PackageConflict
+	// Pruned are the stale files deleted by WithPruneStaleOutputs, or that
+	// would be deleted in dry-run and diff mode.
+	Pruned []string
+	// SQLiteIndexes are the sqlite indexes written by WithSQLiteOutput.
+	SQLiteIndexes []string
+	// Manifests are the manifests written by WithManifest.
+	Manifests []string
+	// Offline is set when the render was run with WithOfflineMode, without
+	// network access.
+	Offline bool
+}
+
+// ComponentReport describes the outcome of rendering a single component.
+type ComponentReport struct {
+	// Name is the name of the component in the contribution file.
+	Name string
+	// Catalog is the name of the catalog the component was rendered into.
+	Catalog string
+	// Schema is the builder schema used to render the component.
+	Schema string
+	// WorkingDir is the effective working directory of the component's
+	// catalog, after applying any working directory root.
+	WorkingDir string
+	// Destination is the component's destination path, relative to the
+	// current directory.
+	Destination string
+	// Files are the files written by the builder, in lexical order.
+	Files []string
+	// Digests maps each of Files to its sha256 digest, e.g.
+	// "sha256:<hex>".
+	Digests map[string]string
+	// Duration is how long the builder took to build the component,
+	// including any retries.
+	Duration time.Duration
+	// Attempts is the number of times the builder was run, which is more
+	// than one when the build was retried.
+	Attempts int
+	// UpToDate is set when the component was not built because its inputs
+	// were unchanged since it was last built, or since the previous render
+	// built it when resuming.
+	UpToDate bool
+	// Disabled is set when the component was not built because its enabled
+	// condition is false.
+	Disabled bool
+	// Rejected is set when the component was not built because the
+	// allowedComponents of its catalog don't allow it.
+	Rejected bool
+	// Changed is set in diff mode when the component differs from its
+	// current destination.
+	Changed bool
+	// Diff is the unified diff of the component against its current
+	// destination in diff mode.
+	Diff string
+	// Channels are the channels generated by the builder, for builders that
+	// report them, such as the semver builder.
+	Channels []ChannelSummary
+	// ChannelGraph is a mermaid graph of the edges of Channels.
+	ChannelGraph string
+	// PinnedImages are the digest-pinned references the builder replaced
+	// tagged bundle images with, by tagged reference.
+	PinnedImages map[string]string
+	// Packages are the packages the component's destination defines an
+	// olm.package blob for.
+	Packages []string
+	// MigrationLevel is the migration level the component was rendered at,
+	// for builders that apply one, such as the basic and semver builders.
+	MigrationLevel MigrationLevel
+	// SkipPatch is whether the component was rendered skipping patch
+	// versions, for builders that support it, such as the semver builder.
+	SkipPatch *bool
+	// Validation is the validation outcome for the component.
+	Validation ValidationStatus
+	// Err is the error encountered while rendering the component, if any.
+	Err error
+
+	// config is the rendered FBC of components built in memory.
+	config *declcfg.DeclarativeConfig
+	// outputs are the files the builder reported writing, relative to
+	// Destination, if it reports them.
+	outputs []string
+}
+
+// Failed returns the reports of every component that failed to render.
+func (r *RenderReport) Failed() []ComponentReport {
+	failed := []ComponentReport{}
+	for _, c := range r.Components {
+		if c.Err != nil {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// filesWrittenSince returns the regular files under dir that were modified at
+// or after the given time. A missing dir yields no files.
+func filesWrittenSince(dir string, since time.Time) ([]string, error) {
+	// file modification times may be truncated by the filesystem
+	since = since.Truncate(time.Second)
+
+	files := []string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || d.Name() == stateFileName || d.Name() == resumeFileName {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Before(since) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,124 @@
+package composite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// resumeFileName is the name of the file under a catalog's working directory
+// that records the progress of a render of its components, for the next
+// render to resume from. It is listed in the working directory's .indexignore
+// so that it is not loaded as part of the catalog.
+const resumeFileName = ".composite-resume.json"
+
+// WithResume resumes a render that failed part way: components whose inputs
+// are unchanged since they were successfully built by the previous render are
+// not built again, like WithIncrementalBuild would consider them up to date.
+// The progress of the render is recorded in a state file under every catalog
+// working directory, which is removed once every component has been rendered
+// successfully. WithForceRebuild ignores the recorded progress.
+func WithResume(resume bool) TemplateOption {
+	return func(t *Template) {
+		t.resume = resume
+	}
+}
+
+type resumeState struct {
+	Components map[string]resumeEntry `json:"components"`
+}
+
+type resumeEntry struct {
+	// Hash is the componentHash of the inputs the component was built from
+	Hash      string `json:"hash"`
+	Succeeded bool   `json:"succeeded"`
+}
+
+// catalogProgress is the progress of the components of a catalog while
+// rendering with WithResume.
+type catalogProgress struct {
+	mu         sync.Mutex
+	workingDir string
+	state      resumeState
+}
+
+// loadProgress returns the progress recorded under workingDir by the previous
+// render. Progress that can't be read is ignored, which only means that the
+// components are built again.
+func loadProgress(workingDir string) *catalogProgress {
+	p := &catalogProgress{workingDir: workingDir, state: resumeState{Components: map[string]resumeEntry{}}}
+	data, err := os.ReadFile(filepath.Join(workingDir, resumeFileName))
+	if err != nil {
+		return p
+	}
+	var state resumeState
+	if err := json.Unmarshal(data, &state); err != nil || state.Components == nil {
+		return p
+	}
+	p.state = state
+	return p
+}
+
+// succeeded reports whether the component was successfully built from inputs
+// with hash by the previous render.
+func (p *catalogProgress) succeeded(component string, hash string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.state.Components[component]
+	return ok && entry.Succeeded && entry.Hash == hash
+}
+
+// record records whether the component was successfully built from inputs
+// with hash.
+func (p *catalogProgress) record(component string, hash string, succeeded bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.Components[component] = resumeEntry{Hash: hash, Succeeded: succeeded}
+	data, err := json.Marshal(p.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p.workingDir, 0o777); err != nil {
+		return fmt.Errorf("writing render progress: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(p.workingDir, resumeFileName), data, 0o666); err != nil {
+		return fmt.Errorf("writing render progress: %v", err)
+	}
+	if err := ensureIndexIgnored(p.workingDir, resumeFileName); err != nil {
+		return fmt.Errorf("updating %s: %v", indexIgnoreFileName, err)
+	}
+	return nil
+}
+
+// loadResumeProgress loads the progress of every catalog.
+func loadResumeProgress(catalogs map[string]Catalog) map[string]*catalogProgress {
+	progress := map[string]*catalogProgress{}
+	for name, catalog := range catalogs {
+		progress[name] = loadProgress(catalog.Destination.WorkingDir)
+	}
+	return progress
+}
+
+// finishResume removes the progress recorded for every catalog, once every
+// component has been rendered successfully.
+func (t *Template) finishResume() error {
+	names := make([]string, 0, len(t.resumeProgress))
+	for name := range t.resumeProgress {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		err := os.Remove(filepath.Join(t.resumeProgress[name].workingDir, resumeFileName))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("removing the render progress of catalog %q: %v", name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,124 @@
+package composite
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryBackoff    = time.Second
+	defaultRetryMaxElapsed = 30 * time.Second
+)
+
+// RetryingHttpGetter wraps an HttpGetter, retrying requests that fail with a
+// network error or a 5xx response. Client errors (4xx) are never retried.
+type RetryingHttpGetter struct {
+	getter     HttpGetter
+	attempts   int
+	backoff    time.Duration
+	maxElapsed time.Duration
+}
+
+var _ HttpGetter = &RetryingHttpGetter{}
+
+// RetryOption configures a RetryingHttpGetter.
+type RetryOption func(*RetryingHttpGetter)
+
+// WithRetryAttempts sets the total number of attempts made for a request.
+// Values less than 1 are treated as 1, which disables retries.
+func WithRetryAttempts(attempts int) RetryOption {
+	return func(g *RetryingHttpGetter) {
+		g.attempts = attempts
+	}
+}
+
+// WithRetryBackoff sets the delay before the first retry. The delay doubles
+// after every subsequent attempt.
+func WithRetryBackoff(backoff time.Duration) RetryOption {
+	return func(g *RetryingHttpGetter) {
+		g.backoff = backoff
+	}
+}
+
+// WithRetryMaxElapsed caps the total time spent on a request, including the
+// delays between attempts. No further attempts are started once the next one
+// would begin after the cap. A value of 0 removes the cap.
+func WithRetryMaxElapsed(maxElapsed time.Duration) RetryOption {
+	return func(g *RetryingHttpGetter) {
+		g.maxElapsed = maxElapsed
+	}
+}
+
+// NewRetryingHttpGetter returns a RetryingHttpGetter that sends requests
+// using getter. By default a request is attempted 3 times, starting with a
+// 1s backoff, for at most 30s.
+func NewRetryingHttpGetter(getter HttpGetter, opts ...RetryOption) *RetryingHttpGetter {
+	g := &RetryingHttpGetter{
+		getter:     getter,
+		attempts:   defaultRetryAttempts,
+		backoff:    defaultRetryBackoff,
+		maxElapsed: defaultRetryMaxElapsed,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Do sends req, retrying it until it succeeds, fails with a non-retryable
+// error, runs out of attempts or time, or its context is done. The response
+// and error of the last attempt are returned. Retries of requests with a body
+// send a copy of req with the body recreated by req.GetBody.
+func (g *RetryingHttpGetter) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	delay := g.backoff
+	attemptReq := req
+	for attempt := 1; ; attempt++ {
+		resp, err := g.getter.Do(attemptReq)
+		if !g.shouldRetry(req, resp, err) || attempt >= g.attempts {
+			return resp, err
+		}
+		if g.maxElapsed > 0 && time.Since(start)+delay > g.maxElapsed {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		delay *= 2
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("recreating the request body to retry: %v", err)
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+	}
+}
+
+func (g *RetryingHttpGetter) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	// requests with a body can only be retried if the body can be recreated
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500
+}
@@ -0,0 +1,158 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/operator-framework/operator-registry/pkg/image"
+)
+
+// RunOptions configures Run.
+type RunOptions struct {
+	// CatalogConfigPath is the catalog configuration file: a local path, an
+	// http(s) URL, an oci:// reference or StdinPath. When empty, the catalogs
+	// must be defined inline in the contribution files.
+	CatalogConfigPath string
+	// CatalogConfigDigest is the expected digest of the catalog configuration
+	// file, e.g. "sha256:<hex>", if any.
+	CatalogConfigDigest string
+	// ContributionPath is the contribution file, resolved like
+	// CatalogConfigPath, or a directory or glob pattern matching several
+	// local contribution files.
+	ContributionPath string
+	// OutputType is the format the catalogs are written in, see
+	// WithOutputType.
+	OutputType string
+	// Registry pulls bundle images and oci:// configuration files.
+	Registry image.Registry
+	// Validate validates every component after it is built.
+	Validate bool
+	// ValidateOnly validates the existing destinations of the components
+	// without building them, like Template.Validate.
+	ValidateOnly bool
+	// Lint only checks the configuration files, like Template.Lint.
+	Lint bool
+	// HttpGetter fetches remote configuration files. It defaults to a
+	// retrying NewDefaultHttpGetter.
+	HttpGetter HttpGetter
+	// Logger reports the progress of the render. Nothing is logged when it
+	// is nil.
+	Logger *logrus.Entry
+	// Progress is sent an event for every configuration file fetched and for
+	// every step of the render, see WithProgress. Nothing is sent when it is
+	// nil.
+	Progress func(ProgressEvent)
+	// Instrumentation receives the outcome of the configuration file fetches
+	// and of the steps of the render, see WithInstrumentation.
+	Instrumentation Instrumentation
+	// FetchOptions configure how the configuration files are fetched.
+	FetchOptions []FetchOption
+	// TemplateOptions configure the Template. They are applied after the
+	// options derived from the other fields, which they may override.
+	TemplateOptions []TemplateOption
+}
+
+// Run fetches the configuration files named by opts, renders the composite
+// template they describe and returns the report of the render, which is
+// returned even when some components fail to render. It is what opm alpha
+// render-template composite runs.
+func Run(ctx context.Context, opts RunOptions) (*RenderReport, error) {
+	if opts.ContributionPath == "" {
+		return nil, errors.New("a contribution path is required")
+	}
+	if opts.ContributionPath == StdinPath && opts.CatalogConfigPath == StdinPath {
+		return nil, fmt.Errorf("only one of the contribution and catalog configuration files can be read from stdin (%q)", StdinPath)
+	}
+
+	getter := opts.HttpGetter
+	if getter == nil {
+		client, err := NewDefaultHttpGetter()
+		if err != nil {
+			return nil, fmt.Errorf("creating http client: %v", err)
+		}
+		getter = NewRetryingHttpGetter(client)
+	}
+	fetchOpts := []FetchOption{WithFetchRegistry(opts.Registry)}
+	if opts.Logger != nil {
+		fetchOpts = append(fetchOpts, WithFetchLogger(opts.Logger))
+	}
+	if opts.Progress != nil {
+		fetchOpts = append(fetchOpts, WithFetchProgress(opts.Progress))
+	}
+	if opts.Instrumentation != nil {
+		fetchOpts = append(fetchOpts, WithFetchInstrumentation(opts.Instrumentation))
+	}
+	fetchOpts = append(fetchOpts, opts.FetchOptions...)
+
+	var templateOpts []TemplateOption
+	if isContributionPattern(opts.ContributionPath) {
+		templateOpts = append(templateOpts, WithContributionPattern(opts.ContributionPath))
+	} else {
+		contribution, err := FetchContributionConfig(ctx, opts.ContributionPath, getter, fetchOpts...)
+		if err != nil {
+			return nil, err
+		}
+		defer contribution.Close()
+		templateOpts = append(templateOpts, WithNamedContributionFile(configName(opts.ContributionPath), contribution))
+	}
+	if opts.CatalogConfigPath != "" {
+		catalogFetchOpts := fetchOpts
+		if opts.CatalogConfigDigest != "" {
+			catalogFetchOpts = append(catalogFetchOpts[:len(catalogFetchOpts):len(catalogFetchOpts)], WithExpectedDigest(opts.CatalogConfigDigest))
+		}
+		catalog, err := FetchCatalogConfig(ctx, opts.CatalogConfigPath, getter, catalogFetchOpts...)
+		if err != nil {
+			return nil, err
+		}
+		defer catalog.Close()
+		templateOpts = append(templateOpts, WithNamedCatalogFile(configName(opts.CatalogConfigPath), catalog))
+	}
+
+	template := NewTemplate(append(append(templateOpts,
+		WithOutputType(opts.OutputType),
+		WithRegistry(opts.Registry),
+		WithValidate(opts.Validate),
+		WithContributionFetcher(getter),
+		WithLogger(opts.Logger),
+		WithProgress(opts.Progress),
+		WithInstrumentation(opts.Instrumentation),
+	), opts.TemplateOptions...)...)
+
+	if opts.Lint {
+		return template.Lint(ctx)
+	}
+	if opts.ValidateOnly {
+		return template.render(ctx, true, renderModeValidate)
+	}
+	return template.RenderWithReport(ctx, opts.Validate)
+}
+
+// isContributionPattern reports whether path names a local directory or glob
+// pattern of contribution files rather than a single file. Stdin and URLs,
+// whose query strings may contain glob characters, are never patterns.
+func isContributionPattern(path string) bool {
+	if path == StdinPath {
+		return false
+	}
+	if local, ok := localConfigPath(path); !ok || local != path {
+		return false
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return true
+	}
+	return strings.ContainsAny(path, "*?[")
+}
+
+// configName returns the name identifying the configuration file at path in
+// errors.
+func configName(path string) string {
+	if path == StdinPath {
+		return "stdin"
+	}
+	return path
+}
@@ -0,0 +1,111 @@
+package composite
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sandboxSnapshot records the regular files under a root directory, except
+// those under the excluded directories and .git, so that files written by a
+// custom command outside the excluded directories can be detected.
+type sandboxSnapshot struct {
+	root    string
+	exclude map[string]bool
+	files   map[string]fileStamp
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// newSandboxSnapshot snapshots the files under root, skipping the exclude
+// directories.
+func newSandboxSnapshot(root string, exclude ...string) (*sandboxSnapshot, error) {
+	s := &sandboxSnapshot{root: root, exclude: map[string]bool{}}
+	for _, dir := range exclude {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		s.exclude[abs] = true
+	}
+	var err error
+	s.files, err = s.walk()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sandboxSnapshot) walk() (map[string]fileStamp, error) {
+	files := map[string]fileStamp{}
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// files may be removed while walking
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if abs, err := filepath.Abs(p); err == nil && s.exclude[abs] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		files[p] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// changes returns the files that were created, modified or removed since the
+// snapshot was taken, in lexical order.
+func (s *sandboxSnapshot) changes() ([]string, error) {
+	current, err := s.walk()
+	if err != nil {
+		return nil, err
+	}
+	changed := []string{}
+	for p, stamp := range current {
+		if previous, ok := s.files[p]; !ok || previous.size != stamp.size || !previous.modTime.Equal(stamp.modTime) {
+			changed = append(changed, p)
+		}
+	}
+	for p := range s.files {
+		if _, ok := current[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// localPath reports whether p is a relative path that does not escape the
+// directory it is relative to.
+func localPath(p string) bool {
+	if filepath.IsAbs(p) {
+		return false
+	}
+	clean := filepath.Clean(p)
+	return clean != ".." && !strings.HasPrefix(clean, ".."+string(filepath.Separator))
+}
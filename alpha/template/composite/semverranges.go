@@ -0,0 +1,148 @@
+package composite
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/blang/semver/v4"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+)
+
+// semverArchetypes are the channel archetypes of the semver template, which
+// name the channels it generates, e.g. "stable-v1" or "stable-v1.2".
+var semverArchetypes = []string{"candidate", "fast", "stable"}
+
+var semverChannelName = regexp.MustCompile(`^(candidate|fast|stable)-v\d+(\.\d+)?$`)
+
+// parseChannelRanges parses the version ranges of the semver builder config by
+// channel archetype, returning the validation errors of the invalid ones.
+func parseChannelRanges(channelRanges map[string]string) (map[string]semver.Range, []string) {
+	ranges := map[string]semver.Range{}
+	validationErrs := []string{}
+	archetypes := make([]string, 0, len(channelRanges))
+	for archetype := range channelRanges {
+		archetypes = append(archetypes, archetype)
+	}
+	sort.Strings(archetypes)
+	for _, archetype := range archetypes {
+		known := false
+		for _, a := range semverArchetypes {
+			known = known || a == archetype
+		}
+		if !known {
+			validationErrs = append(validationErrs, fmt.Sprintf("semver template config has a channel range for unknown channel archetype %q, expected one of %s (templateDefinition.config.channelRanges.%s)", archetype, semverArchetypes, archetype))
+			continue
+		}
+		r, err := semver.ParseRange(channelRanges[archetype])
+		if err != nil {
+			validationErrs = append(validationErrs, fmt.Sprintf("semver template config has an invalid %s channel range %q: %v (templateDefinition.config.channelRanges.%s)", archetype, channelRanges[archetype], err, archetype))
+			continue
+		}
+		ranges[archetype] = r
+	}
+	return ranges, validationErrs
+}
+
+// filterChannelRanges drops the bundles outside the version range of each
+// channel's archetype from the channels of dcfg, linking the remaining
+// entries past the dropped ones. Channels left empty are removed, as are
+// bundles left in no channel, whose images are returned.
+func filterChannelRanges(dcfg *declcfg.DeclarativeConfig, ranges map[string]semver.Range) ([]string, error) {
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+	versions := map[string]semver.Version{}
+	for _, b := range dcfg.Bundles {
+		props, err := property.Parse(b.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("parsing properties of bundle %q: %v", b.Name, err)
+		}
+		if len(props.Packages) != 1 {
+			return nil, fmt.Errorf("bundle %q must have exactly one %q property", b.Name, property.TypePackage)
+		}
+		v, err := semver.Parse(props.Packages[0].Version)
+		if err != nil {
+			return nil, fmt.Errorf("parsing version of bundle %q: %v", b.Name, err)
+		}
+		versions[b.Package+"/"+b.Name] = v
+	}
+
+	channels := dcfg.Channels[:0]
+	for _, channel := range dcfg.Channels {
+		match := semverChannelName.FindStringSubmatch(channel.Name)
+		if match == nil {
+			channels = append(channels, channel)
+			continue
+		}
+		inRange, ok := ranges[match[1]]
+		if !ok {
+			channels = append(channels, channel)
+			continue
+		}
+
+		// dropped entries are replaced by the entry they replace
+		dropped := map[string]string{}
+		for _, entry := range channel.Entries {
+			if !inRange(versions[channel.Package+"/"+entry.Name]) {
+				dropped[entry.Name] = entry.Replaces
+			}
+		}
+		resolve := func(name string) string {
+			for seen := 0; name != "" && seen <= len(dropped); seen++ {
+				replaces, ok := dropped[name]
+				if !ok {
+					return name
+				}
+				name = replaces
+			}
+			return ""
+		}
+		entries := []declcfg.ChannelEntry{}
+		for _, entry := range channel.Entries {
+			if _, ok := dropped[entry.Name]; ok {
+				continue
+			}
+			entry.Replaces = resolve(entry.Replaces)
+			var skips []string
+			for _, skip := range entry.Skips {
+				if _, ok := dropped[skip]; !ok {
+					skips = append(skips, skip)
+				}
+			}
+			entry.Skips = skips
+			entries = append(entries, entry)
+		}
+		if len(entries) == 0 {
+			for _, pkg := range dcfg.Packages {
+				if pkg.Name == channel.Package && pkg.DefaultChannel == channel.Name {
+					return nil, fmt.Errorf("default channel %q of package %q has no bundles in the %s channel range", channel.Name, channel.Package, match[1])
+				}
+			}
+			continue
+		}
+		channel.Entries = entries
+		channels = append(channels, channel)
+	}
+	dcfg.Channels = channels
+
+	inChannel := map[string]bool{}
+	for _, channel := range dcfg.Channels {
+		for _, entry := range channel.Entries {
+			inChannel[channel.Package+"/"+entry.Name] = true
+		}
+	}
+	var excluded []string
+	bundles := dcfg.Bundles[:0]
+	for _, b := range dcfg.Bundles {
+		if !inChannel[b.Package+"/"+b.Name] {
+			excluded = append(excluded, b.Image)
+			continue
+		}
+		bundles = append(bundles, b)
+	}
+	dcfg.Bundles = bundles
+	return excluded, nil
+}
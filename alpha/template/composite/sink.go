@@ -0,0 +1,387 @@
+package composite
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/operator-framework/operator-registry/pkg/containertools"
+)
+
+// OutputSink receives the rendered FBC of the components of a catalog in
+// place of the catalog's working directory, so that it can be packed without
+// writing every file to disk first. Names are slash-separated paths relative
+// to the working directory. Reading a sink through its fs.FS reads back what
+// was written, which is how the components written to it are validated. The
+// methods of a sink may be called concurrently.
+type OutputSink interface {
+	fs.FS
+	// WriteFile writes data to the file name, replacing what was written to
+	// it before.
+	WriteFile(name string, data []byte) error
+	// Close finishes the output once every component of the catalog has
+	// been written. It is only called when the render succeeds.
+	Close() error
+}
+
+// WithOutputSinks writes the rendered FBC of every catalog to the sink
+// returned by open for the catalog, instead of to its working directory.
+// Output sinks can't be combined with incremental builds, resuming, pruning,
+// diffs, SQLite output, manifests, catalog validation or cross-component
+// deprecations, which all read the working directories back, and components
+// written to a sink can't have deprecations or a package name prefix.
+func WithOutputSinks(open func(catalog Catalog) (OutputSink, error)) TemplateOption {
+	return func(t *Template) {
+		t.openSink = open
+	}
+}
+
+// OCILayoutSinks returns a function for WithOutputSinks that writes every
+// catalog to an OCI image layout in the directory named after the catalog
+// under root.
+func OCILayoutSinks(root string) func(catalog Catalog) (OutputSink, error) {
+	return func(catalog Catalog) (OutputSink, error) {
+		return NewOCILayoutSink(filepath.Join(root, catalog.Name), catalog.Destination.BaseImage), nil
+	}
+}
+
+// NewDirectorySink returns an OutputSink that writes files to dir, like
+// rendering without a sink writes them to the catalog working directory.
+func NewDirectorySink(dir string) OutputSink {
+	return &directorySink{FS: os.DirFS(dir), dir: dir}
+}
+
+type directorySink struct {
+	fs.FS
+	dir string
+}
+
+func (s *directorySink) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	filename := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filename), 0o777); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o666)
+}
+
+func (s *directorySink) Close() error {
+	return nil
+}
+
+// NewTarSink returns an OutputSink that writes a tar archive of the files
+// written to it to w when it is closed. The files are kept in memory until
+// then and archived in lexical order, so that the archive doesn't depend on
+// the order components finish in.
+func NewTarSink(w io.Writer) OutputSink {
+	return &tarSink{w: w}
+}
+
+type tarSink struct {
+	memorySink
+	w io.Writer
+}
+
+func (s *tarSink) Close() error {
+	return s.writeTar(s.w, "")
+}
+
+// NewOCILayoutSink returns an OutputSink that writes an OCI image layout to
+// dir when it is closed. The image has a single layer holding the files
+// written to the sink under /configs, is labelled as a catalog image serving
+// them and, unless baseImage is empty, is annotated with baseImage as its
+// base image. Like NewTarSink, the files are kept in memory until then.
+func NewOCILayoutSink(dir string, baseImage string) OutputSink {
+	return &ociLayoutSink{dir: dir, baseImage: baseImage}
+}
+
+// ociConfigsDir is the directory of the image the catalog is served from.
+const ociConfigsDir = "configs"
+
+type ociLayoutSink struct {
+	memorySink
+	dir       string
+	baseImage string
+}
+
+func (s *ociLayoutSink) Close() error {
+	layer := &bytes.Buffer{}
+	if err := s.writeTar(layer, ociConfigsDir); err != nil {
+		return err
+	}
+	layerDesc := v1.Descriptor{MediaType: v1.MediaTypeImageLayer, Digest: digest.FromBytes(layer.Bytes()), Size: int64(layer.Len())}
+
+	// the platform of the image is the one of the base image the layer is
+	// applied to
+	configDesc, err := s.writeJSONBlob(v1.MediaTypeImageConfig, v1.Image{
+		OS: "linux",
+		Config: v1.ImageConfig{
+			Labels: map[string]string{containertools.ConfigsLocationLabel: "/" + ociConfigsDir},
+		},
+		RootFS: v1.RootFS{Type: "layers", DiffIDs: []digest.Digest{layerDesc.Digest}},
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.writeBlob(layerDesc.Digest, layer.Bytes()); err != nil {
+		return err
+	}
+	manifest := v1.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: v1.MediaTypeImageManifest,
+		Config:    configDesc,
+		Layers:    []v1.Descriptor{layerDesc},
+	}
+	if s.baseImage != "" {
+		manifest.Annotations = map[string]string{v1.AnnotationBaseImageName: s.baseImage}
+	}
+	manifestDesc, err := s.writeJSONBlob(v1.MediaTypeImageManifest, manifest)
+	if err != nil {
+		return err
+	}
+
+	index, err := json.Marshal(v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: v1.MediaTypeImageIndex,
+		Manifests: []v1.Descriptor{manifestDesc},
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, "index.json"), index, 0o666); err != nil {
+		return fmt.Errorf("writing OCI image layout index: %v", err)
+	}
+	layout, err := json.Marshal(v1.ImageLayout{Version: v1.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, v1.ImageLayoutFile), layout, 0o666); err != nil {
+		return fmt.Errorf("writing OCI image layout: %v", err)
+	}
+	return nil
+}
+
+func (s *ociLayoutSink) writeJSONBlob(mediaType string, v interface{}) (v1.Descriptor, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	desc := v1.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(data), Size: int64(len(data))}
+	return desc, s.writeBlob(desc.Digest, data)
+}
+
+func (s *ociLayoutSink) writeBlob(dgst digest.Digest, data []byte) error {
+	blobs := filepath.Join(s.dir, "blobs", dgst.Algorithm().String())
+	if err := os.MkdirAll(blobs, 0o777); err != nil {
+		return fmt.Errorf("creating OCI image layout: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(blobs, dgst.Encoded()), data, 0o666); err != nil {
+		return fmt.Errorf("writing OCI image layout blob %s: %v", dgst, err)
+	}
+	return nil
+}
+
+// memorySink keeps the files written to an OutputSink in memory.
+type memorySink struct {
+	mu    sync.Mutex
+	files fstest.MapFS
+}
+
+func (s *memorySink) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = fstest.MapFS{}
+	}
+	s.files[name] = &fstest.MapFile{Data: append([]byte(nil), data...), Mode: 0o644}
+	return nil
+}
+
+func (s *memorySink) Open(name string) (fs.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files.Open(name)
+}
+
+// writeTar writes a tar archive of the files to w, under the root directory
+// if it isn't empty. Entries have fixed modification times and owners, so
+// that the archive of the same files is always the same.
+func (s *memorySink) writeTar(w io.Writer, root string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tar.NewWriter(w)
+	dirs := map[string]bool{}
+	var writeDir func(dir string) error
+	writeDir = func(dir string) error {
+		if dir == "." || dirs[dir] {
+			return nil
+		}
+		if err := writeDir(path.Dir(dir)); err != nil {
+			return err
+		}
+		dirs[dir] = true
+		return tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir + "/", Mode: 0o755, ModTime: time.Unix(0, 0), Format: tar.FormatPAX})
+	}
+	for _, name := range names {
+		if root != "" {
+			name = path.Join(root, name)
+		}
+		if err := writeDir(path.Dir(name)); err != nil {
+			return fmt.Errorf("writing tar archive: %v", err)
+		}
+	}
+	for _, name := range names {
+		file := s.files[name]
+		entry := name
+		if root != "" {
+			entry = path.Join(root, name)
+		}
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: entry, Mode: 0o644, Size: int64(len(file.Data)), ModTime: time.Unix(0, 0), Format: tar.FormatPAX}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("writing tar archive: %v", err)
+		}
+		if _, err := tw.Write(file.Data); err != nil {
+			return fmt.Errorf("writing tar archive: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("writing tar archive: %v", err)
+	}
+	return nil
+}
+
+// sinkName returns the name of the file at name within dir, a destination
+// path relative to the catalog working directory, in an OutputSink.
+func sinkName(dir string, name string) string {
+	return path.Join(filepath.ToSlash(dir), name)
+}
+
+// sinkFiles returns the names of the files written to sink within dir,
+// relative to dir.
+func sinkFiles(sink OutputSink, dir string) ([]string, error) {
+	root := sinkName(dir, ".")
+	files := []string{}
+	err := fs.WalkDir(sink, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			rel := strings.TrimPrefix(p, root+"/")
+			if root == "." {
+				rel = p
+			}
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// sinkPackages returns the names of the packages written to sink within dir
+// like writtenPackages.
+func sinkPackages(sink OutputSink, dir string) ([]string, error) {
+	root, err := fs.Sub(sink, sinkName(dir, "."))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.Stat(root, "."); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return packagesIn(root, sinkName(dir, "."))
+}
+
+// sinkDigest returns the digest of file, a path within workingDir, as written
+// to sink.
+func sinkDigest(sink OutputSink, workingDir string, file string) (string, error) {
+	rel, err := filepath.Rel(workingDir, file)
+	if err != nil {
+		return "", err
+	}
+	data, err := fs.ReadFile(sink, filepath.ToSlash(rel))
+	if err != nil {
+		return "", err
+	}
+	return digest.FromBytes(data).String(), nil
+}
+
+// openSinks opens the output sink of every catalog.
+func (t *Template) openSinks(catalogs []Catalog) (map[string]OutputSink, error) {
+	var conflicts []string
+	for _, option := range []struct {
+		set  bool
+		name string
+	}{
+		{t.incremental, "incremental builds"},
+		{t.resume, "resuming"},
+		{t.pruneStale, "pruning"},
+		{t.diff, "diffs"},
+		{t.sqliteDir != "", "SQLite output"},
+		{t.writeManifest, "manifests"},
+		{t.catalogValidation, "catalog validation"},
+		{t.crossDeprecations, "cross-component deprecations"},
+	} {
+		if option.set {
+			conflicts = append(conflicts, option.name)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("output sinks can't be combined with %s", strings.Join(conflicts, ", "))
+	}
+
+	sinks := map[string]OutputSink{}
+	for _, catalog := range catalogs {
+		sink, err := t.openSink(catalog)
+		if err != nil {
+			return nil, fmt.Errorf("opening the output sink of catalog %q: %v", catalog.Name, err)
+		}
+		sinks[catalog.Name] = sink
+	}
+	return sinks, nil
+}
+
+// closeSinks closes the output sinks of the render that just succeeded.
+func (t *Template) closeSinks() error {
+	names := make([]string, 0, len(t.sinks))
+	for name := range t.sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		if err := t.sinks[name].Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing the output sink of catalog %q: %v", name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
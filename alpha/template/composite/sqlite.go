@@ -0,0 +1,247 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/model"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"github.com/operator-framework/operator-registry/pkg/registry"
+	"github.com/operator-framework/operator-registry/pkg/sqlite"
+)
+
+// WithSQLiteOutput additionally writes every catalog that components were
+// rendered into as a sqlite index at "<dir>/<catalog>.db" once all of its
+// components are built and validated, for consumers that only understand the
+// sqlite-based registry format. An existing index is replaced. It can't be
+// combined with the per-package output layout.
+func WithSQLiteOutput(dir string) TemplateOption {
+	return func(t *Template) {
+		t.sqliteDir = dir
+	}
+}
+
+// writeSQLiteIndexes writes the sqlite index of every catalog whose working
+// directory exists, returning their paths in catalog order. The index of a
+// catalog with packages that can't be represented in sqlite is not written.
+func (t *Template) writeSQLiteIndexes(ctx context.Context, catalogs map[string]Catalog) ([]string, error) {
+	names := make([]string, 0, len(catalogs))
+	for name := range catalogs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := os.MkdirAll(t.sqliteDir, 0o777); err != nil {
+		return nil, fmt.Errorf("creating sqlite output directory: %v", err)
+	}
+	var (
+		written []string
+		errs    []error
+	)
+	for _, name := range names {
+		workingDir := catalogs[name].Destination.WorkingDir
+		if _, err := os.Stat(workingDir); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		dbPath := filepath.Join(t.sqliteDir, name+".db")
+		t.logger().WithField("catalog", name).Infof("writing sqlite index to %q", dbPath)
+		if err := writeSQLiteIndex(ctx, workingDir, dbPath); err != nil {
+			errs = append(errs, fmt.Errorf("writing sqlite index of catalog %q: %w", name, err))
+			continue
+		}
+		written = append(written, dbPath)
+	}
+	return written, utilerrors.NewAggregate(errs)
+}
+
+// writeSQLiteIndex loads the FBC under workingDir into a new sqlite index,
+// which replaces dbPath only if every package could be loaded.
+func writeSQLiteIndex(ctx context.Context, workingDir string, dbPath string) error {
+	dcfg, err := declcfg.LoadFS(ctx, os.DirFS(workingDir))
+	if err != nil {
+		return fmt.Errorf("loading %q: %v", workingDir, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dbPath), "."+filepath.Base(dbPath)+"-")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	db, err := sqlite.Open(tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	loader, err := sqlite.NewSQLLiteLoader(db)
+	if err != nil {
+		return err
+	}
+	if err := loader.Migrate(ctx); err != nil {
+		return fmt.Errorf("creating sqlite schema: %v", err)
+	}
+
+	packages := packagesOf(dcfg)
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		if err := loadSQLitePackage(loader, *packages[name]); err != nil {
+			errs = append(errs, fmt.Errorf("package %q can't be written to sqlite: %v", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dbPath)
+}
+
+// loadSQLitePackage loads the bundles and channels of a single package. The
+// upgrade edges of each bundle are written to its CSV, from which sqlite
+// reads them, so a bundle must have the same edges in every channel.
+func loadSQLitePackage(loader sqlite.MigratableLoader, dcfg declcfg.DeclarativeConfig) error {
+	m, err := declcfg.ConvertToModel(dcfg)
+	if err != nil {
+		return err
+	}
+	if len(m) != 1 {
+		return fmt.Errorf("expected a single package, found %d", len(m))
+	}
+	var pkg *model.Package
+	for _, p := range m {
+		pkg = p
+	}
+
+	channelNames := make([]string, 0, len(pkg.Channels))
+	for name := range pkg.Channels {
+		channelNames = append(channelNames, name)
+	}
+	sort.Strings(channelNames)
+
+	manifest := registry.PackageManifest{PackageName: pkg.Name}
+	if pkg.DefaultChannel != nil {
+		manifest.DefaultChannelName = pkg.DefaultChannel.Name
+	}
+	var (
+		bundleNames []string
+		bundles     = map[string]*model.Bundle{}
+		channels    = map[string][]string{}
+	)
+	for _, channelName := range channelNames {
+		ch := pkg.Channels[channelName]
+		head, err := ch.Head()
+		if err != nil {
+			return fmt.Errorf("channel %q: %v", channelName, err)
+		}
+		manifest.Channels = append(manifest.Channels, registry.PackageChannel{Name: channelName, CurrentCSVName: head.Name})
+
+		for _, b := range ch.Bundles {
+			other, ok := bundles[b.Name]
+			if !ok {
+				bundles[b.Name] = b
+				bundleNames = append(bundleNames, b.Name)
+			} else if other.Replaces != b.Replaces || other.SkipRange != b.SkipRange || strings.Join(other.Skips, ",") != strings.Join(b.Skips, ",") {
+				return fmt.Errorf("bundle %q has different upgrade edges in channels %q and %q, but sqlite stores a single set of edges per bundle", b.Name, other.Channel.Name, channelName)
+			}
+			channels[b.Name] = append(channels[b.Name], channelName)
+		}
+	}
+	sort.Strings(bundleNames)
+
+	for _, name := range bundleNames {
+		bundle, err := sqliteBundle(bundles[name], manifest.DefaultChannelName, channels[name])
+		if err != nil {
+			return fmt.Errorf("bundle %q: %v", name, err)
+		}
+		if err := loader.AddOperatorBundle(bundle); err != nil {
+			return fmt.Errorf("bundle %q: %v", name, err)
+		}
+	}
+	return loader.AddPackageChannels(manifest)
+}
+
+// sqliteBundle returns the registry bundle of b, whose CSV has the upgrade
+// edges of b.
+func sqliteBundle(b *model.Bundle, defaultChannel string, channels []string) (*registry.Bundle, error) {
+	if len(b.Objects) == 0 {
+		if b.PropertiesP != nil && len(b.PropertiesP.CSVMetadatas) > 0 {
+			return nil, fmt.Errorf("it only has an %s property, which sqlite can't represent, render it with the %q migration level to keep its objects as %s properties", property.TypeCSVMetadata, MigrationLevelNone, property.TypeBundleObject)
+		}
+		return nil, fmt.Errorf("it has no %s properties", property.TypeBundleObject)
+	}
+
+	var objs []*unstructured.Unstructured
+	foundCSV := false
+	for _, o := range b.Objects {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.NewYAMLOrJSONDecoder(strings.NewReader(o), 4096).Decode(obj); err != nil {
+			return nil, fmt.Errorf("decoding %s property: %v", property.TypeBundleObject, err)
+		}
+		if obj.GetKind() == "ClusterServiceVersion" {
+			foundCSV = true
+			if err := setCSVEdges(obj, b); err != nil {
+				return nil, err
+			}
+		}
+		objs = append(objs, obj)
+	}
+	if !foundCSV {
+		return nil, fmt.Errorf("none of its %s properties is a ClusterServiceVersion", property.TypeBundleObject)
+	}
+
+	bundle := registry.NewBundle(b.Name, &registry.Annotations{
+		PackageName:        b.Package.Name,
+		Channels:           strings.Join(channels, ","),
+		DefaultChannelName: defaultChannel,
+	}, objs...)
+	bundle.BundleImage = b.Image
+	return bundle, nil
+}
+
+// setCSVEdges replaces the upgrade edges of csv with those of b.
+func setCSVEdges(csv *unstructured.Unstructured, b *model.Bundle) error {
+	if err := unstructured.SetNestedField(csv.Object, b.Name, "metadata", "name"); err != nil {
+		return err
+	}
+	unstructured.RemoveNestedField(csv.Object, "spec", "replaces")
+	if b.Replaces != "" {
+		if err := unstructured.SetNestedField(csv.Object, b.Replaces, "spec", "replaces"); err != nil {
+			return err
+		}
+	}
+	unstructured.RemoveNestedField(csv.Object, "spec", "skips")
+	if len(b.Skips) > 0 {
+		if err := unstructured.SetNestedStringSlice(csv.Object, b.Skips, "spec", "skips"); err != nil {
+			return err
+		}
+	}
+	annotations := csv.GetAnnotations()
+	delete(annotations, "olm.skipRange")
+	if b.SkipRange != "" {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations["olm.skipRange"] = b.SkipRange
+	}
+	csv.SetAnnotations(annotations)
+	return nil
+}
@@ -0,0 +1,163 @@
+package composite
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// stagingPrefix is the prefix of the staging directories created under a
+// catalog's working directory while a component is rendered.
+const stagingPrefix = ".composite-staging-"
+
+// newStagingDir creates a staging directory under workingDir seeded with the
+// current contents of dest, so that builders only need to write the files
+// they produce. The staging directory is returned relative to workingDir.
+func newStagingDir(workingDir string, dest string) (string, error) {
+	if err := os.MkdirAll(workingDir, 0o777); err != nil {
+		return "", fmt.Errorf("creating working directory %q: %v", workingDir, err)
+	}
+	staging, err := os.MkdirTemp(workingDir, stagingPrefix)
+	if err != nil {
+		return "", fmt.Errorf("creating staging directory: %v", err)
+	}
+	if err := copyDir(dest, staging); err != nil {
+		os.RemoveAll(staging)
+		return "", fmt.Errorf("copying %q to staging directory: %v", dest, err)
+	}
+	return filepath.Base(staging), nil
+}
+
+// commitStagingDir replaces dest with staging. The previous contents of dest
+// are only removed once staging has been moved into place, and are restored
+// if that fails.
+func commitStagingDir(staging string, dest string) error {
+	if _, err := os.Stat(dest); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(dest), 0o777); err != nil {
+			return fmt.Errorf("creating destination parent directory: %v", err)
+		}
+		return os.Rename(staging, dest)
+	}
+
+	previous := staging + ".previous"
+	if err := os.Rename(dest, previous); err != nil {
+		return fmt.Errorf("moving aside %q: %v", dest, err)
+	}
+	if err := os.Rename(staging, dest); err != nil {
+		if restoreErr := os.Rename(previous, dest); restoreErr != nil {
+			return fmt.Errorf("moving staging directory to %q: %v (restoring the previous contents failed: %v)", dest, err, restoreErr)
+		}
+		return fmt.Errorf("moving staging directory to %q: %v", dest, err)
+	}
+	return os.RemoveAll(previous)
+}
+
+// nestedDestinationLocks returns a mutex shared by the components whose
+// destinations are nested in one another, by component name. A staged
+// component seeds its staging directory with a copy of its destination and
+// replaces the destination when it is done, so building a component while
+// a component nested in it commits its output would put the stale copy of
+// the nested destination back. Components without nested destinations have
+// no mutex.
+func nestedDestinationLocks(catalogs map[string]Catalog, components []Component) map[string]*sync.Mutex {
+	type destination struct {
+		component string
+		path      string
+	}
+	var dests []destination
+	for _, component := range components {
+		catalog, ok := catalogs[component.CatalogName()]
+		if !ok || component.Destination.Path == StdoutPath {
+			continue
+		}
+		workingDir, err := filepath.Abs(catalog.Destination.WorkingDir)
+		if err != nil {
+			continue
+		}
+		dests = append(dests, destination{component: component.Name, path: filepath.Join(workingDir, component.Destination.Path)})
+	}
+
+	locks := map[string]*sync.Mutex{}
+	for i := range dests {
+		for j := i + 1; j < len(dests); j++ {
+			if !isWithin(dests[i].path, dests[j].path) && !isWithin(dests[j].path, dests[i].path) {
+				continue
+			}
+			first, second := locks[dests[i].component], locks[dests[j].component]
+			switch {
+			case first == nil && second == nil:
+				lock := &sync.Mutex{}
+				locks[dests[i].component], locks[dests[j].component] = lock, lock
+			case first == nil:
+				locks[dests[i].component] = second
+			case second == nil:
+				locks[dests[j].component] = first
+			case first != second:
+				// merge the two nests
+				for name, lock := range locks {
+					if lock == second {
+						locks[name] = first
+					}
+				}
+			}
+		}
+	}
+	return locks
+}
+
+// copyDir copies the regular files and directories under src into dst,
+// preserving their modes and modification times. A missing src is treated as
+// empty.
+func copyDir(src string, dst string) error {
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			if err := os.MkdirAll(target, info.Mode().Perm()); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if err := copyFile(p, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func copyFile(src string, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,75 @@
+package composite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/operator-framework/operator-registry/pkg/image"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ComponentBuildRequest describes a single component built by
+// BuildComponent, outside of any catalog or composite configuration.
+type ComponentBuildRequest struct {
+	// Schema is the template schema of the component, which selects the
+	// registered builder.
+	Schema string
+	// TemplateConfig is the builder configuration, as found in a component's
+	// strategy.template.config.
+	TemplateConfig json.RawMessage
+	// Destination is the directory the component is written to.
+	Destination string
+	// OutputType is the type of the FBC the builder writes. An empty type
+	// defaults to OutputTypeJSON.
+	OutputType OutputType
+	// Registry pulls the images the builder renders. It may be nil for
+	// builders that don't pull any.
+	Registry image.Registry
+}
+
+// BuildComponent builds the component described by req with the builder
+// registered for its schema, then validates what it wrote, without mapping it
+// to a catalog. opts configure the Template the builder is looked up in, such
+// as WithRegisteredBuilder, WithAllowedBuilders or WithLogger; options that
+// only apply to catalogs are ignored.
+func BuildComponent(ctx context.Context, req ComponentBuildRequest, opts ...TemplateOption) error {
+	t := NewTemplate(opts...)
+	if len(t.optionErrs) > 0 {
+		return utilerrors.NewAggregate(t.optionErrs)
+	}
+	if req.Destination == "" {
+		return fmt.Errorf("building component: destination must not be empty")
+	}
+	outputType, err := ParseOutputType(string(req.OutputType))
+	if err != nil {
+		return fmt.Errorf("building component: %v", err)
+	}
+
+	dest := filepath.Clean(req.Destination)
+	builder, err := t.builderForSchema(req.Schema, BuilderConfig{
+		WorkingDir:     filepath.Dir(dest),
+		OutputType:     outputType,
+		Log:            t.logger().WithField("builder", req.Schema),
+		HttpGetter:     t.inputGetter,
+		Offline:        t.offline,
+		MigrationLevel: t.migrationLevel,
+	})
+	if err != nil {
+		return fmt.Errorf("building component: %v", err)
+	}
+
+	td := TemplateDefinition{Schema: req.Schema, Config: req.TemplateConfig}
+	if err := builder.ValidateConfig(td); err != nil {
+		return fmt.Errorf("building component: invalid template config: %w", err)
+	}
+	dir := filepath.Base(dest)
+	if err := builder.Build(ctx, req.Registry, dir, td); err != nil {
+		return fmt.Errorf("building component: %w", err)
+	}
+	if err := builder.Validate(ctx, dir); err != nil {
+		return fmt.Errorf("validating component: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package composite
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// SummarySchema is the schema of the summary file written after a render.
+const SummarySchema = "olm.composite.report"
+
+// RenderSummary is the machine-readable summary of a render written by
+// WithSummaryFile.
+type RenderSummary struct {
+	Schema  string         `json:"schema"`
+	Options SummaryOptions `json:"options"`
+	// Components are the results of the components that were rendered, in
+	// the order they are defined in the contribution files.
+	Components []ComponentSummary `json:"components"`
+	// Warnings are the catalog configuration entries that no component uses.
+	Warnings ValidationErrors `json:"warnings,omitempty"`
+	// PackageConflicts are the packages written by more than one component
+	// of a catalog.
+	PackageConflicts []PackageConflict `json:"packageConflicts,omitempty"`
+	// Pruned are the stale files that were deleted.
+	Pruned []string `json:"pruned,omitempty"`
+	// Error is the error the render failed with, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// SummaryOptions are the template options a render was run with.
+type SummaryOptions struct {
+	Validate         bool     `json:"validate"`
+	OutputType       string   `json:"outputType"`
+	FailFast         bool     `json:"failFast"`
+	MaxConcurrency   int      `json:"maxConcurrency"`
+	DryRun           bool     `json:"dryRun"`
+	Diff             bool     `json:"diff"`
+	AtomicOutput     bool     `json:"atomicOutput"`
+	Incremental      bool     `json:"incremental"`
+	ForceRebuild     bool     `json:"forceRebuild"`
+	StrictUnused     bool     `json:"strictUnused"`
+	ComponentTimeout string   `json:"componentTimeout,omitempty"`
+	BuildAttempts    int      `json:"buildAttempts,omitempty"`
+	WorkingDirRoot   string   `json:"workingDirRoot,omitempty"`
+	ComponentFilter  []string `json:"componentFilter,omitempty"`
+	AllowedBuilders  []string `json:"allowedBuilders,omitempty"`
+	Offline          bool     `json:"offline,omitempty"`
+	PruneStale       bool     `json:"pruneStale,omitempty"`
+	ValidationLevel  string   `json:"validationLevel,omitempty"`
+	ValidateCatalogs bool     `json:"validateCatalogs,omitempty"`
+	OutputLayout     string   `json:"outputLayout,omitempty"`
+	MigrationLevel   string   `json:"migrationLevel,omitempty"`
+}
+
+// ComponentSummary is the result of rendering a single component.
+type ComponentSummary struct {
+	Name        string           `json:"name"`
+	Catalog     string           `json:"catalog"`
+	Schema      string           `json:"schema"`
+	Destination string           `json:"destination"`
+	Files       []FileSummary    `json:"files"`
+	Duration    string           `json:"duration"`
+	Attempts    int              `json:"attempts,omitempty"`
+	UpToDate    bool             `json:"upToDate,omitempty"`
+	Disabled    bool             `json:"disabled,omitempty"`
+	Rejected    bool             `json:"rejected,omitempty"`
+	Channels    []ChannelSummary `json:"channels,omitempty"`
+	// PinnedImages are the digest-pinned references of tagged bundle images.
+	PinnedImages map[string]string `json:"pinnedImages,omitempty"`
+	Packages     []string          `json:"packages,omitempty"`
+	SkipPatch    *bool             `json:"skipPatch,omitempty"`
+	Validation   ValidationStatus  `json:"validation"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// FileSummary identifies a file written by a builder.
+type FileSummary struct {
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+}
+
+// WithSummaryFile writes a JSON summary of every render to path, creating its
+// parent directory if needed. The summary is written even when some or all
+// components fail to render, and lists the error of every failed component.
+func WithSummaryFile(path string) TemplateOption {
+	return func(t *Template) {
+		t.summaryPath = path
+	}
+}
+
+// newSummary returns the summary of a render that produced report and
+// renderErr.
+func (t *Template) newSummary(report *RenderReport, validate bool, renderErr error) (*RenderSummary, error) {
+	summary := &RenderSummary{
+		Schema: SummarySchema,
+		Options: SummaryOptions{
+			Validate:         validate,
+			OutputType:       string(t.outputType),
+			FailFast:         t.failFast,
+			MaxConcurrency:   t.maxConcurrency,
+			DryRun:           t.dryRun,
+			Diff:             t.diff,
+			AtomicOutput:     t.atomicOutput,
+			Incremental:      t.incremental,
+			ForceRebuild:     t.forceRebuild,
+			StrictUnused:     t.strictUnused,
+			BuildAttempts:    t.buildAttempts,
+			WorkingDirRoot:   t.workingDirRoot,
+			ComponentFilter:  t.componentFilter,
+			Offline:          report.Offline,
+			PruneStale:       t.pruneStale,
+			ValidationLevel:  string(t.validationLevel),
+			ValidateCatalogs: t.catalogValidation,
+			OutputLayout:     string(t.outputLayout),
+			MigrationLevel:   string(t.migrationLevel),
+		},
+		Components:       []ComponentSummary{},
+		Warnings:         report.Warnings,
+		Pruned:           report.Pruned,
+		PackageConflicts: report.PackageConflicts,
+	}
+	if t.componentTimeout > 0 {
+		summary.Options.ComponentTimeout = t.componentTimeout.String()
+	}
+	if t.allowedBuilders != nil {
+		summary.Options.AllowedBuilders = []string{}
+		for schema := range t.allowedBuilders {
+			summary.Options.AllowedBuilders = append(summary.Options.AllowedBuilders, schema)
+		}
+		sort.Strings(summary.Options.AllowedBuilders)
+	}
+	if renderErr != nil {
+		summary.Error = renderErr.Error()
+	}
+
+	for _, component := range report.Components {
+		c := ComponentSummary{
+			Name:         component.Name,
+			Catalog:      component.Catalog,
+			Schema:       component.Schema,
+			Destination:  component.Destination,
+			Files:        []FileSummary{},
+			Duration:     component.Duration.String(),
+			Attempts:     component.Attempts,
+			UpToDate:     component.UpToDate,
+			Disabled:     component.Disabled,
+			Rejected:     component.Rejected,
+			Channels:     component.Channels,
+			PinnedImages: component.PinnedImages,
+			Packages:     component.Packages,
+			SkipPatch:    component.SkipPatch,
+			Validation:   component.Validation,
+		}
+		if component.Err != nil {
+			c.Error = component.Err.Error()
+		}
+		for _, file := range component.Files {
+			d, ok := component.Digests[file]
+			if !ok {
+				var err error
+				if d, err = fileDigest(file); err != nil {
+					return nil, fmt.Errorf("computing digest of %q: %v", file, err)
+				}
+			}
+			c.Files = append(c.Files, FileSummary{Path: file, Digest: d})
+		}
+		summary.Components = append(summary.Components, c)
+	}
+	return summary, nil
+}
+
+// writeSummary writes the summary of a render to the configured summary path.
+func (t *Template) writeSummary(report *RenderReport, validate bool, renderErr error) error {
+	summary, err := t.newSummary(report, validate, renderErr)
+	if err != nil {
+		return fmt.Errorf("writing summary: %w", err)
+	}
+	data, err := json.MarshalIndent(summary, "", "    ")
+	if err != nil {
+		return fmt.Errorf("writing summary: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.summaryPath), 0o777); err != nil {
+		return fmt.Errorf("writing summary: %v", err)
+	}
+	if err := os.WriteFile(t.summaryPath, append(data, '\n'), 0o666); err != nil {
+		return fmt.Errorf("writing summary: %v", err)
+	}
+	return nil
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	d, err := digest.FromReader(f)
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
@@ -10,20 +10,85 @@ type TemplateDefinition struct {
 type BasicConfig struct {
 	Input  string
 	Output string
+	// PinImages replaces bundle images referenced by tag with references to
+	// their digests in the generated FBC. When unset, the catalog's default
+	// applies.
+	PinImages *bool
 }
 
 type SemverConfig struct {
 	Input  string
 	Output string
+	// ChannelRanges restricts the bundles of the channels generated for a
+	// channel archetype ("candidate", "fast" or "stable") to a semver range,
+	// e.g. ">=1.0.0". Bundles outside the range are left out of those
+	// channels only.
+	ChannelRanges map[string]string
+	// PinImages replaces bundle images referenced by tag with references to
+	// their digests in the generated FBC. When unset, the catalog's default
+	// applies.
+	PinImages *bool
+	// SkipPatch has the highest patch version of each minor version skip the
+	// lower ones, which it replaces otherwise. It defaults to true, and a
+	// component's strategy can override it.
+	SkipPatch *bool
 }
 
 type RawConfig struct {
-	Input  string
+	// Input is a file, URL, directory or glob pattern. The YAML and JSON
+	// files in a directory, recursively, or matching a pattern are loaded in
+	// lexical order and written to Output together.
+	Input string
+	// Inputs are loaded after Input, in order. Each may also be an http or
+	// https URL or an oci:// image reference.
+	Inputs []RawInput
 	Output string
+	// SkipValidation allows objects with schemas other than olm.package,
+	// olm.channel and olm.bundle in the input, which are passed through
+	// as-is. The input must still be parseable FBC, as it is re-encoded in
+	// the configured output type.
+	SkipValidation bool
+}
+
+// RawInput is an input of the raw template builder.
+type RawInput struct {
+	Input string
+	// Digest pins the contents of a single file or remote input, for example
+	// "sha256:<hex>". The build fails if the input does not match it.
+	Digest string
 }
 
 type CustomConfig struct {
 	Command string
 	Args    []string
 	Output  string
+	// StdinConfig writes this configuration, as raw JSON, to the command's
+	// stdin. Otherwise stdin is empty.
+	StdinConfig bool
+	// Timeout bounds how long the command may run, as a duration such as
+	// "5m". The command and every process it started are killed when it is
+	// exceeded. Empty means no limit.
+	Timeout string
+	// Env controls the environment of the command. When nil, the command
+	// inherits the full environment.
+	Env *CustomEnv
+	// WorkingDir is the directory the command is run in, relative to the
+	// catalog's working directory, and is created if missing. When set, files
+	// the command writes under the current directory but outside the
+	// catalog's working directory are reported as warnings.
+	WorkingDir string
+	// StrictSandbox fails the build when the command writes under the current
+	// directory but outside the catalog's working directory.
+	StrictSandbox bool
+}
+
+// CustomEnv is the environment of a custom builder's command. The variables
+// describing the component being built are always set.
+type CustomEnv struct {
+	// Allow lists the variables of the environment that are passed to the
+	// command. All others are withheld.
+	Allow []string
+	// Set are additional variables set for the command, taking precedence
+	// over allowed ones.
+	Set map[string]string
 }
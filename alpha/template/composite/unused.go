@@ -0,0 +1,53 @@
+package composite
+
+import "fmt"
+
+// WithStrictUnused fails the render when the catalog configuration has
+// entries that no component uses: catalogs that no component targets, and
+// builders of a catalog that no component targeting it uses. Otherwise they
+// are recorded as warnings in the render report. Every component in the
+// contribution files counts, whether or not it is selected by the component
+// filter.
+func WithStrictUnused(strict bool) TemplateOption {
+	return func(t *Template) {
+		t.strictUnused = strict
+	}
+}
+
+// unusedCatalogEntries returns the catalogs and catalog builders that none of
+// components use.
+func unusedCatalogEntries(catalogs []Catalog, components []Component) ValidationErrors {
+	used := map[string]map[string]bool{}
+	for _, component := range components {
+		name := component.CatalogName()
+		if used[name] == nil {
+			used[name] = map[string]bool{}
+		}
+		used[name][component.Strategy.Template.Schema] = true
+	}
+
+	var unused ValidationErrors
+	for i, catalog := range catalogs {
+		schemas, ok := used[catalog.Name]
+		if !ok {
+			unused = append(unused, ConfigValidationError{
+				Catalog: catalog.Name,
+				Field:   "name",
+				Path:    fmt.Sprintf("catalogs[%d].name", i),
+				Message: "catalog is not targeted by any component",
+			})
+			continue
+		}
+		for j, schema := range catalog.Builders {
+			if !schemas[schema] {
+				unused = append(unused, ConfigValidationError{
+					Catalog: catalog.Name,
+					Field:   "builders",
+					Path:    fmt.Sprintf("catalogs[%d].builders[%d]", i, j),
+					Message: fmt.Sprintf("builder %q is not used by any component", schema),
+				})
+			}
+		}
+	}
+	return unused
+}
@@ -54,6 +54,7 @@ func (t Template) Render(ctx context.Context) (*declcfg.DeclarativeConfig, error
 		return nil, fmt.Errorf("render: unable to post-process bundle info: %v", err)
 	}
 
+	sv.avoidSkipPatch = t.AvoidSkipPatch
 	channels := sv.generateChannels(channelBundleVersions)
 	out.Channels = channels
 	out.Packages[0].DefaultChannel = sv.defaultChannel
@@ -299,6 +300,22 @@ func (sv *semverTemplate) linkChannels(unlinkedChannels map[string]*declcfg.Chan
 		return entries[i].version.LT(entries[j].version)
 	})
 
+	if sv.avoidSkipPatch {
+		// every bundle replaces its predecessor of the same major version
+		for index := 1; index < len(entries); index++ {
+			prevTuple := entries[index-1]
+			curTuple := entries[index]
+			if curTuple.arch != prevTuple.arch || curTuple.kind != prevTuple.kind || !getMajorVersion(prevTuple.version).EQ(getMajorVersion(curTuple.version)) {
+				continue
+			}
+			unlinkedChannels[curTuple.parent].Entries[curTuple.index].Replaces = prevTuple.name
+		}
+		for _, ch := range unlinkedChannels {
+			channels = append(channels, *ch)
+		}
+		return channels
+	}
+
 	prevZMax := ""
 	var curSkips sets.String = sets.NewString()
 
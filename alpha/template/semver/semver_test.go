@@ -122,6 +122,60 @@ func TestLinkChannels(t *testing.T) {
 	}
 }
 
+func TestLinkChannelsAvoidSkipPatch(t *testing.T) {
+	entries := []entryTuple{
+		{arch: stableChannelArchetype, kind: majorStreamType, name: "a-v1.1.0", parent: "stable-v1", index: 0, version: semver.MustParse("1.1.0")},
+		{arch: stableChannelArchetype, kind: majorStreamType, name: "a-v1.1.1", parent: "stable-v1", index: 1, version: semver.MustParse("1.1.1")},
+		{arch: stableChannelArchetype, kind: majorStreamType, name: "a-v1.2.0", parent: "stable-v1", index: 2, version: semver.MustParse("1.2.0")},
+		{arch: stableChannelArchetype, kind: majorStreamType, name: "a-v2.0.0", parent: "stable-v2", index: 0, version: semver.MustParse("2.0.0")},
+		{arch: stableChannelArchetype, kind: majorStreamType, name: "a-v2.0.1", parent: "stable-v2", index: 1, version: semver.MustParse("2.0.1")},
+	}
+	unlinkedChannels := map[string]*declcfg.Channel{
+		"stable-v1": {
+			Schema:  "olm.channel",
+			Name:    "stable-v1",
+			Package: "a",
+			Entries: []declcfg.ChannelEntry{
+				{Name: "a-v1.1.0"},
+				{Name: "a-v1.1.1"},
+				{Name: "a-v1.2.0"},
+			},
+		},
+		"stable-v2": {
+			Schema:  "olm.channel",
+			Name:    "stable-v2",
+			Package: "a",
+			Entries: []declcfg.ChannelEntry{
+				{Name: "a-v2.0.0"},
+				{Name: "a-v2.0.1"},
+			},
+		},
+	}
+
+	sv := &semverTemplate{pkg: "a", GenerateMajorChannels: true, avoidSkipPatch: true}
+	require.ElementsMatch(t, []declcfg.Channel{
+		{
+			Schema:  "olm.channel",
+			Name:    "stable-v1",
+			Package: "a",
+			Entries: []declcfg.ChannelEntry{
+				{Name: "a-v1.1.0"},
+				{Name: "a-v1.1.1", Replaces: "a-v1.1.0"},
+				{Name: "a-v1.2.0", Replaces: "a-v1.1.1"},
+			},
+		},
+		{
+			Schema:  "olm.channel",
+			Name:    "stable-v2",
+			Package: "a",
+			Entries: []declcfg.ChannelEntry{
+				{Name: "a-v2.0.0"},
+				{Name: "a-v2.0.1", Replaces: "a-v2.0.0"},
+			},
+		},
+	}, sv.linkChannels(unlinkedChannels, entries))
+}
+
 func TestGenerateChannels(t *testing.T) {
 	// type bundleVersions map[string]map[string]semver.Version // e.g. d["stable"]["example-operator.v1.0.0"] = 1.0.0
 	channelOperatorVersions := bundleVersions{
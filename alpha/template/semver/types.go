@@ -12,6 +12,10 @@ import (
 type Template struct {
 	Data     io.Reader
 	Registry image.Registry
+	// AvoidSkipPatch links every bundle to its predecessor with a replaces
+	// edge, instead of having the highest patch version of each minor
+	// version skip the lower ones.
+	AvoidSkipPatch bool
 }
 
 // IO structs -- BEGIN
@@ -34,6 +38,7 @@ type semverTemplate struct {
 
 	pkg            string `json:"-"` // the derived package name
 	defaultChannel string `json:"-"` // detected "most stable" channel head
+	avoidSkipPatch bool   `json:"-"` // replaces chain instead of skipping patch versions
 }
 
 // IO structs -- END
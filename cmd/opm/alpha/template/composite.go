@@ -2,21 +2,75 @@ package template
 
 import (
 	"log"
-	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/operator-framework/operator-registry/alpha/template/composite"
 	"github.com/operator-framework/operator-registry/cmd/opm/internal/util"
+	"github.com/operator-framework/operator-registry/pkg/image/containerdregistry"
 )
 
 func newCompositeTemplateCmd() *cobra.Command {
 	var (
 		output        string
 		validate      bool
+		failFast      bool
+		concurrency   int
+		dryRun        bool
+		diff          bool
+		components    []string
+		validateOnly  bool
+		lint          bool
+		progress      bool
+		atomicOutput  bool
+		timeout       time.Duration
+		buildRetries  int
+		retryBackoff  time.Duration
+		incremental   bool
+		resume        bool
+		rootDir       string
+		strictRoot    bool
+		requireBase   bool
+		variables     []string
+		expandVars    bool
+		expandCatVars bool
+		force         bool
+		summaryFile   string
+		graphDir      string
+		strictUnused  bool
+		offline       bool
+		prune         bool
+		forcePrune    bool
+		validation    string
+		migrateLevel  string
+		validateCats  bool
+		warnConflicts bool
+		crossDeprecs  bool
+		outputLayout  string
+		sqliteDir     string
+		manifest      bool
+		manifestPath  string
+		renderValues  []string
 		compositeFile string
 		catalogFile   string
+		catalogDigest string
+		catalogCMKey  string
+		contribCMKey  string
+		maxConfigSize int64
+		cacheDir      string
+		imageCacheDir string
+		cacheTTL      time.Duration
+		noCache       bool
+		httpTimeout   time.Duration
+		httpCAFile    string
+		httpSkipTLS   bool
+		httpProxy     string
+		httpHeaders   []string
+		httpTokenEnv  string
 	)
 	cmd := &cobra.Command{
 		Use: "composite",
@@ -27,51 +81,223 @@ and a 'composite template' file`,
 		Args: cobra.MaximumNArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
 
-			switch output {
-			case "yaml":
-				// do nothing
-			case "json":
-				// do nothing
-			default:
-				log.Fatalf("invalid --output value %q, expected (json|yaml)", output)
+			if _, err := composite.ParseOutputType(output); err != nil {
+				log.Fatalf("invalid --output value: %v", err)
+			}
+			if _, err := composite.ParseOutputLayout(outputLayout); err != nil {
+				log.Fatalf("invalid --output-layout value: %v", err)
+			}
+			if _, err := composite.ParseValidationLevel(validation); err != nil {
+				log.Fatalf("invalid --validation-level value: %v", err)
+			}
+			if _, err := composite.ParseMigrationLevel(migrateLevel); err != nil {
+				log.Fatalf("invalid --migrate-level value: %v", err)
 			}
 
-			reg, err := util.CreateCLIRegistry(cmd)
+			logger := logrus.NewEntry(logrus.StandardLogger())
+			if manifestPath != "" {
+				if _, err := composite.NewTemplate(composite.WithLogger(logger)).VerifyManifest(manifestPath); err != nil {
+					log.Fatalf("verifying the manifest: %v", err)
+				}
+				return
+			}
+			getterOpts := []composite.GetterOption{
+				composite.WithHttpTimeout(httpTimeout),
+				composite.WithHttpCAFile(httpCAFile),
+				composite.WithHttpInsecureSkipVerify(httpSkipTLS),
+				composite.WithHttpProxy(httpProxy),
+			}
+			for _, header := range httpHeaders {
+				key, value, ok := strings.Cut(header, ":")
+				if !ok {
+					log.Fatalf("invalid --http-header value %q, expected \"Name: value\"", header)
+				}
+				getterOpts = append(getterOpts, composite.WithHttpHeader(strings.TrimSpace(key), strings.TrimSpace(value)))
+			}
+			if httpTokenEnv != "" {
+				getterOpts = append(getterOpts, composite.WithHttpBearerTokenFromEnv(httpTokenEnv))
+			}
+			client, err := composite.NewDefaultHttpGetter(getterOpts...)
+			if err != nil {
+				log.Fatalf("creating http client: %v", err)
+			}
+
+			var reg *containerdregistry.Registry
+			if imageCacheDir != "" {
+				reg, err = util.CreateCLIRegistryWithCacheDir(cmd, imageCacheDir)
+			} else {
+				if offline {
+					logger.Warn("--offline without --image-cache-dir can only use images that were pulled during this render, set --image-cache-dir to the image cache of an earlier render")
+				}
+				reg, err = util.CreateCLIRegistry(cmd)
+			}
 			if err != nil {
 				log.Fatalf("creating containerd registry: %v", err)
 			}
 			defer reg.Destroy()
 
-			// operator author's 'composite.yaml' file
-			compositeReader, err := os.Open(compositeFile)
-			if err != nil {
-				log.Fatalf("opening composite config file %q: %v", compositeFile, err)
+			fetchOpts := []composite.FetchOption{
+				composite.WithMaxConfigSize(maxConfigSize),
+				composite.WithOfflineFetch(offline),
+			}
+			if cacheDir != "" {
+				fetchOpts = append(fetchOpts, composite.WithFetchCache(cacheDir, cacheTTL), composite.WithFetchCacheRefresh(noCache))
 			}
-			defer compositeReader.Close()
 
-			// catalog maintainer's 'catalogs.yaml' file
-			tempCatalog, err := composite.FetchCatalogConfig(catalogFile, http.DefaultClient)
-			if err != nil {
-				log.Fatalf(err.Error())
+			templateOpts := []composite.TemplateOption{
+				composite.WithFailFast(failFast),
+				composite.WithMaxConcurrency(concurrency),
+				composite.WithDryRun(dryRun),
+				composite.WithDiff(diff),
+				composite.WithComponentFilter(components...),
+				composite.WithAtomicOutput(atomicOutput),
+				composite.WithComponentTimeout(timeout),
+				composite.WithBuildRetries(buildRetries+1, retryBackoff),
+				composite.WithIncrementalBuild(incremental),
+				composite.WithResume(resume),
+				composite.WithForceRebuild(force),
+				composite.WithWorkingDirRoot(rootDir, strictRoot),
+				composite.WithRequireBaseImage(requireBase),
+				composite.WithSummaryFile(summaryFile),
+				composite.WithChannelGraphDir(graphDir),
+				composite.WithStrictUnused(strictUnused),
+				composite.WithOfflineMode(offline),
+				composite.WithImageCacheDir(imageCacheDir),
+				composite.WithPruneStaleOutputs(prune),
+				composite.WithForcePrune(forcePrune),
+				composite.WithValidationLevel(validation),
+				composite.WithMigrationLevel(migrateLevel),
+				composite.WithCatalogValidation(validateCats),
+				composite.WithPackageConflictWarnings(warnConflicts),
+				composite.WithCrossComponentDeprecations(crossDeprecs),
+				composite.WithOutputLayout(outputLayout),
+				composite.WithSQLiteOutput(sqliteDir),
+				composite.WithManifest(manifest),
+				composite.WithConfigMapKeys(catalogCMKey, contribCMKey),
+			}
+			if expandVars || len(variables) > 0 {
+				vars := map[string]string{}
+				for _, variable := range variables {
+					name, value, ok := strings.Cut(variable, "=")
+					if !ok {
+						log.Fatalf("invalid --var value %q, expected NAME=VALUE", variable)
+					}
+					vars[name] = value
+				}
+				templateOpts = append(templateOpts, composite.WithVariableExpansion(vars), composite.WithCatalogVariableExpansion(expandCatVars))
+			}
+			if len(renderValues) > 0 {
+				values := map[string]string{}
+				for _, value := range renderValues {
+					name, v, ok := strings.Cut(value, "=")
+					if !ok {
+						log.Fatalf("invalid --set value %q, expected NAME=VALUE", value)
+					}
+					values[name] = v
+				}
+				templateOpts = append(templateOpts, composite.WithRenderValues(values))
 			}
-			defer tempCatalog.Close()
 
-			template := composite.NewTemplate(
-				composite.WithCatalogFile(tempCatalog),
-				composite.WithContributionFile(compositeReader),
-				composite.WithOutputType(output),
-				composite.WithRegistry(reg),
-			)
+			// the catalog maintainer's 'catalogs.yaml' file may be omitted in
+			// favor of catalogs defined inline in the composite config
+			catalogPath := catalogFile
+			if _, err := os.Stat(catalogFile); !cmd.Flags().Changed("catalog-config") && os.IsNotExist(err) {
+				catalogPath = ""
+			}
 
-			err = template.Render(cmd.Context(), validate)
+			var printer *progressPrinter
+			if progress {
+				printer = newProgressPrinter(os.Stderr, logger)
+			}
+			report, err := composite.Run(cmd.Context(), composite.RunOptions{
+				CatalogConfigPath:   catalogPath,
+				CatalogConfigDigest: catalogDigest,
+				ContributionPath:    compositeFile,
+				OutputType:          output,
+				Registry:            reg,
+				Validate:            validate,
+				ValidateOnly:        validateOnly,
+				Lint:                lint,
+				HttpGetter:          composite.NewRetryingHttpGetter(client),
+				Logger:              logger,
+				Progress:            printer.progressFunc(),
+				FetchOptions:        fetchOpts,
+				TemplateOptions:     templateOpts,
+			})
+			printer.done()
 			if err != nil {
+				if lint {
+					log.Fatalf("linting the composite template: %v", err)
+				}
+				if validateOnly {
+					log.Fatalf("validating the composite template: %v", err)
+				}
 				log.Fatalf("rendering the composite template: %v", err)
 			}
+			if report.Changed {
+				// like diff(1), exit with 1 when differences were found. os.Exit
+				// skips deferred calls, so remove the registry cache first.
+				if err := reg.Destroy(); err != nil {
+					logger.Error(err)
+				}
+				os.Exit(1)
+			}
 		},
 	}
-	cmd.Flags().StringVarP(&output, "output", "o", "json", "Output format (json|yaml)")
+	cmd.Flags().StringVarP(&output, "output", "o", "json", "Output format (json|yaml|mermaid), mermaid writes json along with a channel graph of each package built by the basic and semver builders")
 	cmd.Flags().BoolVar(&validate, "validate", true, "whether or not the created FBC should be validated (i.e 'opm validate')")
-	cmd.Flags().StringVarP(&compositeFile, "composite-config", "c", "composite.yaml", "File to use as the composite configuration file")
-	cmd.Flags().StringVarP(&catalogFile, "catalog-config", "f", "catalogs.yaml", "File to use as the catalog configuration file")
+	cmd.Flags().BoolVar(&failFast, "fail-fast", false, "stop rendering at the first component that fails instead of reporting all failures")
+	cmd.Flags().IntVar(&concurrency, "max-concurrency", 1, "maximum number of components to build concurrently")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the components that would be built without building them")
+	cmd.Flags().BoolVar(&diff, "diff", false, "print a diff of the rendered components against their destinations without modifying them, exiting with 1 if there are differences")
+	cmd.Flags().StringSliceVar(&components, "component", nil, "only render the named components (can be specified multiple times)")
+	cmd.Flags().BoolVar(&validateOnly, "validate-only", false, "validate the existing component destinations without building them")
+	cmd.Flags().BoolVar(&lint, "lint", false, "check the catalog and composite configs, including the template config of every component, without building anything")
+	cmd.Flags().BoolVar(&progress, "progress", false, "report the progress of each component as it is queued, pulls images, builds and validates, on a live status line when stderr is a terminal and as log lines otherwise")
+	cmd.Flags().BoolVar(&atomicOutput, "atomic-output", true, "build each component in a staging directory that replaces its destination only if the build and validation succeed")
+	cmd.Flags().DurationVar(&timeout, "component-timeout", 0, "maximum time spent building and validating each component, 0 for no limit")
+	cmd.Flags().IntVar(&buildRetries, "build-retries", 0, "number of times a component that failed to build is retried")
+	cmd.Flags().DurationVar(&retryBackoff, "build-retry-backoff", 5*time.Second, "delay before the first build retry, doubling for each subsequent retry")
+	cmd.Flags().BoolVar(&incremental, "incremental", false, "skip building components whose builder config is unchanged since they were last built")
+	cmd.Flags().BoolVar(&resume, "resume", false, "skip building components that the previous, failed render built successfully from the same builder config")
+	cmd.Flags().BoolVar(&force, "force", false, "with --incremental or --resume, build every component even if it is up to date")
+	cmd.Flags().StringVar(&rootDir, "working-dir-root", "", "resolve every catalog working directory under this directory")
+	cmd.Flags().BoolVar(&strictRoot, "strict-working-dir-root", false, "with --working-dir-root, reject absolute catalog working directories instead of rebasing them")
+	cmd.Flags().BoolVar(&expandVars, "expand-variables", false, "expand ${NAME} references in the composite config using --var values and the environment")
+	cmd.Flags().StringArrayVar(&renderValues, "set", nil, "set a value for the enabled conditions of components, as NAME=VALUE (can be specified multiple times)")
+	cmd.Flags().StringArrayVar(&variables, "var", nil, "set a variable for --expand-variables, as NAME=VALUE (can be specified multiple times, implies --expand-variables)")
+	cmd.Flags().BoolVar(&expandCatVars, "expand-catalog-variables", false, "with --expand-variables, also expand variables in the catalog config")
+	cmd.Flags().StringVar(&summaryFile, "summary-file", "", "write a JSON summary of the rendered components to this file, even if rendering fails")
+	cmd.Flags().StringVar(&graphDir, "channel-graph-dir", "", "write a mermaid graph of the channels generated for each semver component to <component>.mmd in this directory")
+	cmd.Flags().BoolVar(&strictUnused, "strict-unused", false, "fail if the catalog config has catalogs or builders that no component uses, instead of warning about them")
+	cmd.Flags().StringVar(&outputLayout, "output-layout", "", "how builders lay out the FBC of a component, either \"single-file\" to write the configured output file or \"per-package\" to write <package>/catalog.<json|yaml> files (default \"single-file\")")
+	cmd.Flags().StringVar(&sqliteDir, "sqlite-output-dir", "", "also write each catalog as a sqlite index to <catalog>.db in this directory, for consumers of the sqlite-based registry format")
+	cmd.Flags().BoolVar(&manifest, "manifest", false, "after a successful render, write a manifest of the digests of the files in each catalog working directory to .composite-manifest.json")
+	cmd.Flags().StringVar(&manifestPath, "verify-manifest", "", "instead of rendering, check that the catalog working directory of this manifest still has the files it records")
+	cmd.Flags().StringVar(&validation, "validation-level", "", "how thoroughly rendered catalogs are validated, either \"model\" to validate complete packages or \"load\" to only check that partial catalogs load (default \"model\")")
+	cmd.Flags().StringVar(&migrateLevel, "migrate-level", "", "the migration level the basic and semver builders render catalogs at, either \"none\" to write bundle objects for older catalog consumers or \"bundle-object-to-csv-metadata\" (default \"bundle-object-to-csv-metadata\")")
+	cmd.Flags().BoolVar(&validateCats, "validate-catalogs", false, "after rendering, validate each catalog working directory as a whole to catch conflicts between components")
+	cmd.Flags().BoolVar(&warnConflicts, "warn-package-conflicts", false, "warn about packages written by more than one component of a catalog instead of failing")
+	cmd.Flags().BoolVar(&crossDeprecs, "cross-component-deprecations", false, "allow component deprecations to reference channels and bundles written by other components of the same catalog")
+	cmd.Flags().BoolVar(&prune, "prune", false, "delete files in the catalog working directories that no component in the composite config produces, except those listed in .indexignore files")
+	cmd.Flags().BoolVar(&forcePrune, "force-prune", false, "with --prune, also delete stale files that don't look like generated FBC")
+	cmd.Flags().BoolVar(&offline, "offline", false, "forbid network access, only using config files from the fetch cache and images from the image cache set with --image-cache-dir")
+	cmd.Flags().StringVar(&imageCacheDir, "image-cache-dir", "", "directory used to cache pulled images across renders, so that --offline renders can use them, a temporary cache is used when empty")
+	cmd.Flags().BoolVar(&requireBase, "require-base-image", false, "require every catalog to set destination.baseImage")
+	cmd.Flags().StringVarP(&compositeFile, "composite-config", "c", "composite.yaml", "File, URL, directory or glob pattern to use as the composite configuration file(s), or \"-\" to read it from stdin")
+	cmd.Flags().StringVarP(&catalogFile, "catalog-config", "f", "catalogs.yaml", "File, URL or oci:// reference to use as the catalog configuration file, or \"-\" to read it from stdin, optional when the composite configuration defines its catalogs inline")
+	cmd.Flags().StringVar(&catalogDigest, "catalog-config-digest", "", "expected digest (e.g. sha256:<hex>) of the catalog configuration file")
+	cmd.Flags().StringVar(&catalogCMKey, "catalog-configmap-key", composite.DefaultCatalogConfigMapKey, "key holding the catalog configuration when the catalog configuration file is a ConfigMap manifest")
+	cmd.Flags().StringVar(&contribCMKey, "composite-configmap-key", composite.DefaultContributionConfigMapKey, "key holding the composite configuration when a composite configuration file is a ConfigMap manifest")
+	cmd.Flags().Int64Var(&maxConfigSize, "max-config-size", 4<<20, "maximum size in bytes of a remote configuration file, 0 for no limit")
+	cmd.Flags().StringVar(&cacheDir, "config-cache-dir", "", "directory used to cache remote configuration files, caching is disabled when empty")
+	cmd.Flags().DurationVar(&cacheTTL, "config-cache-ttl", 5*time.Minute, "how long a cached remote configuration file is used before it is revalidated")
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "fetch remote configuration files again, ignoring any cached copy")
+	cmd.Flags().DurationVar(&httpTimeout, "http-timeout", 30*time.Second, "timeout for fetching remote configuration files")
+	cmd.Flags().StringVar(&httpCAFile, "http-ca-file", "", "PEM encoded CA bundle used to verify servers when fetching remote configuration files")
+	cmd.Flags().BoolVar(&httpSkipTLS, "http-skip-tls-verify", false, "skip TLS certificate verification when fetching remote configuration files")
+	cmd.Flags().StringVar(&httpProxy, "http-proxy", "", "proxy URL used when fetching remote configuration files (defaults to the HTTP_PROXY/HTTPS_PROXY environment variables)")
+	cmd.Flags().StringArrayVar(&httpHeaders, "http-header", nil, "header, in the form \"Name: value\", sent when fetching remote configuration files (can be specified multiple times)")
+	cmd.Flags().StringVar(&httpTokenEnv, "http-token-env", "", "environment variable holding a bearer token sent when fetching remote configuration files")
 	return cmd
 }
@@ -0,0 +1,132 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/operator-framework/operator-registry/alpha/template/composite"
+)
+
+// progressPrinter renders the progress events of a composite render as a
+// status line that is rewritten in place when out is a terminal, and as log
+// lines otherwise. Its methods do nothing on a nil printer.
+type progressPrinter struct {
+	out      io.Writer
+	log      *logrus.Entry
+	tty      bool
+	queued   int
+	finished int
+	failed   int
+	written  bool
+}
+
+func newProgressPrinter(out *os.File, log *logrus.Entry) *progressPrinter {
+	info, err := out.Stat()
+	return &progressPrinter{
+		out: out,
+		log: log,
+		tty: err == nil && info.Mode()&os.ModeCharDevice != 0,
+	}
+}
+
+// progressFunc returns the callback to pass to composite.WithProgress, nil
+// for a nil printer.
+func (p *progressPrinter) progressFunc() func(composite.ProgressEvent) {
+	if p == nil {
+		return nil
+	}
+	return p.print
+}
+
+func (p *progressPrinter) print(event composite.ProgressEvent) {
+	switch event.Phase {
+	case composite.ProgressComponentQueued:
+		p.queued++
+	case composite.ProgressComponentFinished:
+		p.finished++
+		if event.Err != nil {
+			p.failed++
+		}
+	}
+	message := progressMessage(event)
+	if !p.tty {
+		log := p.log
+		if event.Component != "" {
+			log = log.WithFields(logrus.Fields{
+				"component": event.Component,
+				"catalog":   event.Catalog,
+				"schema":    event.Schema,
+			})
+		}
+		if event.Err != nil {
+			log = log.WithError(event.Err)
+		}
+		log.Info(message)
+		return
+	}
+	status := fmt.Sprintf("[%d/%d components done", p.finished, p.queued)
+	if p.failed > 0 {
+		status += fmt.Sprintf(", %d failed", p.failed)
+	}
+	status += "]"
+	if event.Component != "" {
+		status += fmt.Sprintf(" %s: %s", event.Component, message)
+	} else {
+		status += " " + message
+	}
+	// return to the start of the line and clear it before rewriting it
+	fmt.Fprintf(p.out, "\r\x1b[K%s", status)
+	p.written = true
+}
+
+// done ends the status line, so that what is printed next starts on a line
+// of its own.
+func (p *progressPrinter) done() {
+	if p == nil || !p.written {
+		return
+	}
+	fmt.Fprintln(p.out)
+	p.written = false
+}
+
+func progressMessage(event composite.ProgressEvent) string {
+	outcome := func(succeeded string, failed string) string {
+		if event.Err != nil {
+			return failed
+		}
+		return fmt.Sprintf("%s in %s", succeeded, event.Duration.Round(time.Millisecond))
+	}
+	switch event.Phase {
+	case composite.ProgressConfigFetched:
+		if event.Bytes > 0 {
+			return fmt.Sprintf("fetched config %q (%d bytes)", event.Config, event.Bytes)
+		}
+		return fmt.Sprintf("fetched config %q", event.Config)
+	case composite.ProgressComponentQueued:
+		return "queued"
+	case composite.ProgressImagePullStarted:
+		return fmt.Sprintf("pulling %s", event.Image)
+	case composite.ProgressImagePullFinished:
+		if event.Err != nil {
+			return fmt.Sprintf("failed to pull %s", event.Image)
+		}
+		if event.Bytes > 0 {
+			return fmt.Sprintf("pulled %s (%d bytes) in %s", event.Image, event.Bytes, event.Duration.Round(time.Millisecond))
+		}
+		return fmt.Sprintf("pulled %s in %s", event.Image, event.Duration.Round(time.Millisecond))
+	case composite.ProgressBuildFinished:
+		return outcome("built", "failed to build")
+	case composite.ProgressValidationFinished:
+		return outcome("validated", "failed validation")
+	case composite.ProgressComponentFinished:
+		if event.Err != nil {
+			return "failed"
+		}
+		return "done"
+	}
+	return string(event.Phase)
+}
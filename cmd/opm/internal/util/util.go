@@ -67,6 +67,32 @@ func CreateCLIRegistry(cmd *cobra.Command) (*containerdregistry.Registry, error)
 	return reg, nil
 }
 
+// CreateCLIRegistryWithCacheDir returns a registry configured like
+// CreateCLIRegistry that caches images in cacheDir, creating it if needed,
+// and keeps them when it is destroyed.
+func CreateCLIRegistryWithCacheDir(cmd *cobra.Command, cacheDir string) (*containerdregistry.Registry, error) {
+	skipTlsVerify, useHTTP, err := GetTLSOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	reg, err := containerdregistry.NewRegistry(
+		containerdregistry.WithCacheDir(cacheDir),
+		containerdregistry.PreserveCache(true),
+		containerdregistry.SkipTLSVerify(skipTlsVerify),
+		containerdregistry.WithPlainHTTP(useHTTP),
+		containerdregistry.WithLog(nullLogger()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
 func nullLogger() *logrus.Entry {
 	logger := logrus.New()
 	logger.SetOutput(ioutil.Discard)
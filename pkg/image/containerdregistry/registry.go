@@ -19,6 +19,7 @@ import (
 	"github.com/containerd/containerd/namespaces"
 	"github.com/containerd/containerd/platforms"
 	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -89,6 +90,19 @@ func (r *Registry) Pull(ctx context.Context, ref image.Reference) error {
 	return err
 }
 
+// ResolveDigest resolves an image reference to the digest of its manifest
+// without pulling the image.
+func (r *Registry) ResolveDigest(ctx context.Context, ref image.Reference) (digest.Digest, error) {
+	// Set the default namespace if unset
+	ctx = ensureNamespace(ctx)
+
+	_, root, err := r.resolver.Resolve(ctx, ref.String())
+	if err != nil {
+		return "", fmt.Errorf("error resolving name for image ref %s: %v", ref.String(), err)
+	}
+	return root.Digest, nil
+}
+
 // Unpack writes the unpackaged content of an image to a directory.
 // If the referenced image does not exist in the registry, an error is returned.
 func (r *Registry) Unpack(ctx context.Context, ref image.Reference, dir string) error {